@@ -38,6 +38,7 @@ installBinaries(){
 # Move the configuration template to /etc/prometheus
 sudo cp ./prometheus.yml /etc/prometheus/prometheus.yml
 sudo cp ./web.yml /etc/prometheus/web.yml
+sudo cp ./pongo.rules.yml /etc/prometheus/pongo.rules.yml
 
 # Copy systemd service file.
 sudo cp ./prometheus.service /etc/systemd/system/prometheus.service
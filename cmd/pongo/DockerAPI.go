@@ -3,10 +3,19 @@ package main
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/erodrigufer/pongo/internal/backend"
+	dockerExec "github.com/erodrigufer/pongo/internal/docker/exec"
+	"github.com/erodrigufer/pongo/internal/pongo"
+	"github.com/erodrigufer/pongo/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type containerModel struct {
@@ -23,10 +32,12 @@ type containerModel struct {
 // newUpstream, method to configure upstream containers, it adds the --rm,
 // --tty and -i flags to any container being initialized. Set the container's
 // internal hostname to be the same as its name.
+// The isolation options of sb (OCI runtime, capabilities, read-only rootfs,
+// security profiles) are applied to the container.
 // Parameters: container's name and image used to create container and the
 // networkID of a network to which the container will be connected since the
-// initialization.
-func newUpstream(name, image, networkID string) (newContainer *containerModel) {
+// initialization. sb, the isolation options of the container.
+func newUpstream(name, image, networkID string, sb sandbox) (newContainer *containerModel) {
 	newContainer = new(containerModel)
 	newContainer.name = name
 	newContainer.containerConfig.Image = image
@@ -39,6 +50,13 @@ func newUpstream(name, image, networkID string) (newContainer *containerModel) {
 	// Set the internal hostname of the container to be the same as the
 	// container's name.
 	newContainer.containerConfig.Hostname = newContainer.name
+	// Isolation of the container from the host.
+	newContainer.hostConfig.Runtime = sb.runtime
+	newContainer.hostConfig.CapDrop = sb.capDrop
+	newContainer.hostConfig.CapAdd = sb.capAdd
+	newContainer.hostConfig.ReadonlyRootfs = sb.readOnlyRootfs
+	newContainer.hostConfig.Tmpfs = sb.tmpfs
+	newContainer.hostConfig.SecurityOpt = sb.securityOpt
 	// Create a struct with the configuration of an endpoint for the new
 	// container.
 	endpointsConfig := new(network.EndpointSettings)
@@ -58,7 +76,7 @@ func newUpstream(name, image, networkID string) (newContainer *containerModel) {
 // containerID, ID of container being connected to network.
 func (app *application) containerConnect(networkID, containerID string) error {
 	ctx := context.Background()
-	err := app.client.NetworkConnect(ctx, networkID, containerID, nil)
+	err := app.runtime.ConnectNetwork(ctx, networkID, containerID)
 	if err != nil {
 		return err
 	}
@@ -70,7 +88,7 @@ func (app *application) containerConnect(networkID, containerID string) error {
 func (app *application) listContainers() error {
 	ctx := context.Background()
 
-	containers, err := app.client.ContainerList(ctx, types.ContainerListOptions{})
+	containers, err := app.runtime.ListContainers(ctx, false)
 	if err != nil {
 		return err
 	}
@@ -82,27 +100,48 @@ func (app *application) listContainers() error {
 	return nil
 }
 
-// runContainer, runs a given container in detached mode (-d flag). If the
-// method succeeds, it returns the ID of the newly created container.
-func (app *application) runContainer(newContainer *containerModel) (string, error) {
-	ctx := context.Background()
-
-	resp, err := app.client.ContainerCreate(ctx, &(newContainer.containerConfig), &(newContainer.hostConfig), &(newContainer.networkConfig), nil, newContainer.name)
+// runContainer, runs a given container in detached mode (-d flag) in the
+// container engine rt. If the method succeeds, it returns the ID of the newly
+// created container. Creating and starting the container are traced as spans
+// of ctx.
+func (app *application) runContainer(ctx context.Context, rt backend.ContainerRuntime, newContainer *containerModel) (string, error) {
+	createCtx, span := app.tracer.Start(ctx, "container create", trace.WithAttributes(attribute.String("container.name", newContainer.name)))
+	containerID, err := rt.CreateContainer(createCtx, newContainer.name, &(newContainer.containerConfig), &(newContainer.hostConfig), &(newContainer.networkConfig))
+	tracing.Error(span, err)
+	span.End()
 	if err != nil {
 		return "", err
 	}
 
-	if err := app.client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+	startCtx, span := app.tracer.Start(ctx, "container start", trace.WithAttributes(attribute.String("container.id", containerID)))
+	err = tracing.Error(span, rt.StartContainer(startCtx, containerID))
+	span.End()
+	if err != nil {
+		// AutoRemove only applies to containers which were started.
+		app.removeContainer(rt, containerID)
 		return "", err
 	}
 
-	return resp.ID, nil
+	return containerID, nil
+}
+
+// removeContainer, removes a container that is not needed anymore, e.g.
+// because the creation of its session failed. A failure is only logged, the
+// caller is already handling another error.
+func (app *application) removeContainer(rt backend.ContainerRuntime, containerID string) {
+	// The context of the caller might already be cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := rt.RemoveContainer(ctx, containerID); err != nil {
+		app.errorLog.Printf("error: unable to remove container (with container ID %s): %v", containerID, err)
+	}
 }
 
-//createNetwork, creates a local Docker network with the name specified in the
-// parameter. It returns the ID of the newly created network (string) and
-// an error type.
-func (app *application) createNetwork(networkName string) (string, error) {
+//createNetwork, creates a Docker network with the name specified in the
+// parameter in the container engine rt. driverOptions are passed to the
+// bridge driver, e.g. to disable the communication between containers. It
+// returns the ID of the newly created network (string) and an error type.
+func (app *application) createNetwork(rt backend.ContainerRuntime, networkName string, driverOptions map[string]string) (string, error) {
 	ctx := context.Background()
 
 	// The network created so that SSH Piper and the other containers can
@@ -115,9 +154,10 @@ func (app *application) createNetwork(networkName string) (string, error) {
 		// to catch any issues if there was already a network previously
 		// established with the same name.
 		CheckDuplicate: true,
+		Options:        driverOptions,
 	}
 
-	resp, err := app.client.NetworkCreate(ctx, networkName, networkOptions)
+	resp, err := rt.CreateNetwork(ctx, networkName, networkOptions)
 	if err != nil {
 		// Check if any warnings were returned, if so, print them out.
 		if resp.Warning != "" {
@@ -137,11 +177,14 @@ func (app *application) createNetwork(networkName string) (string, error) {
 }
 
 // createUpstreamContainer, wrapper to create, run and connect to a network
-// a new upstream container. Parameters: name of new container, image
-// from which to create new upstream container and networkID to which to
-// connect the new container.
+// a new upstream container. Parameters: ctx, context in which the creation is
+// traced. name of new container, image
+// from which to create new upstream container and the container engine (node)
+// in which the container is created. The container is connected to the
+// network of the engine. In remote engines, the SSH port of the container is
+// published in the host, so that the reverse proxy can reach it.
 // Output: containerID of newly created container.
-func (app *application) createUpstreamContainer(name, image, networkID string) (string, error) {
+func (app *application) createUpstreamContainer(ctx context.Context, name, image string, node backend.Node) (string, error) {
 	// Create data model for new upstream container.
 	// The container gets connected at initialization time to the network
 	// defined by 'networkID'. In a previous iteration of this program, this
@@ -150,49 +193,94 @@ func (app *application) createUpstreamContainer(name, image, networkID string) (
 	// This was a massive problem, since it was actually intended that most of
 	// these containers be isolated from one another, not connected to the same
 	// network.
-	upstreamContainer := newUpstream(name, image, networkID)
-	containerID, err := app.runContainer(upstreamContainer)
+	upstreamContainer := newUpstream(name, image, node.NetworkID, app.sandbox)
+	if !node.Local {
+		// Publish the SSH port on a random port of the host.
+		upstreamContainer.containerConfig.ExposedPorts = nat.PortSet{nat.Port("22/tcp"): {}}
+		upstreamContainer.hostConfig.PortBindings = nat.PortMap{
+			nat.Port("22/tcp"): []nat.PortBinding{{HostIP: node.BindIP}},
+		}
+	}
+	containerID, err := app.runContainer(ctx, node.Runtime, upstreamContainer)
 	if err != nil {
 		return "", err
 	}
-	app.debugLog.Printf("Created upstream container with ID: %s\n", containerID[:10])
+	app.debugLog.Printf("Created upstream container with ID: %s in engine %s\n", containerID[:10], node.Name)
 
 	return containerID, nil
 }
 
-// runExec, runs a command inside an already running container.
-// Parameters: ctx, a context. containerID, the container ID of the container
-// in which the command will be executed, cmd ([]string) the command to be
-// executed in the container.
-func (app *application) runExec(ctx context.Context, containerID string, cmd []string) error {
-	// Configuration parameters for the exec process.
-	execConfig := types.ExecConfig{
-		// Attach output streams to be able to read diagnostic messages of
-		// container while executing the command.
-		AttachStderr: true,
-		AttachStdout: true,
-		// AttachStdin: true,
-		Cmd: cmd, // Actual command that will be executed.
-	}
-
-	// Configure an exec process, the response is a struct with the ID of the
-	// exec process.
-	response, err := app.client.ContainerExecCreate(ctx, containerID, execConfig)
+// runExec, runs a command inside an already running container and waits for
+// the command to return. It returns an error if the command exits with a
+// non-zero exit code.
+// Parameters: ctx, a context. rt, the container engine of the container.
+// containerID, the container ID of the container in which the command will be
+// executed, cmd ([]string) the command to be executed in the container.
+func (app *application) runExec(ctx context.Context, rt backend.ContainerRuntime, containerID string, cmd []string) error {
+	result, err := rt.Exec(ctx, containerID, cmd)
 	if err != nil {
 		return err
 	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("error: command '%s' failed with exit code %d: %s", cmd[0], result.ExitCode, result.Stderr)
+	}
+
+	return nil
+}
 
-	// Do not check if it is detached or if there is a TTY, before running
-	// command.
-	execStartConfig := types.ExecStartCheck{
-		Detach: false,
-		Tty:    false,
+// runCommand, runs a command, with its standard input, inside an already
+// running container and waits for the command to return. It returns an error
+// if the command exits with a non-zero exit code.
+// Parameters: ctx, a context. rt, the container engine of the container.
+// containerID, the container ID of the container in which the command will be
+// executed, cmd, the command to be executed in the container.
+func (app *application) runCommand(ctx context.Context, rt backend.ContainerRuntime, containerID string, cmd pongo.Command) error {
+	if cmd.Stdin == "" {
+		return app.runExec(ctx, rt, containerID, cmd.Args)
 	}
+	result, err := rt.ExecWithStdin(ctx, containerID, cmd.Args, strings.NewReader(cmd.Stdin))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("error: command '%s' failed with exit code %d: %s", cmd.Args[0], result.ExitCode, result.Stderr)
+	}
+
+	return nil
+}
 
-	err = app.client.ContainerExecStart(ctx, response.ID, execStartConfig)
+// runExecOutput, runs a command inside an already running container and
+// waits for the command to return, in order to collect its output and exit
+// code. Parameters: ctx, a context. rt, the container engine of the
+// container. containerID, the container ID of the container in which the
+// command will be executed, cmd ([]string) the command to be executed in the
+// container.
+func (app *application) runExecOutput(ctx context.Context, rt backend.ContainerRuntime, containerID string, cmd []string) (dockerExec.Result, error) {
+	return rt.Exec(ctx, containerID, cmd)
+}
+
+// writeToTerminals, writes a message to every terminal (pseudo-terminal
+// allocated for an SSH connection) open inside a container, so that the users
+// connected to the container can read the message in their shells.
+// Parameters: rt, the container engine of the container. containerID of the
+// container, msg the message to write.
+func (app *application) writeToTerminals(ctx context.Context, rt backend.ContainerRuntime, containerID, msg string) error {
+	// The message is passed as a positional parameter to the shell, so that it
+	// does not have to be escaped inside the script.
+	cmd := []string{
+		"sh",
+		"-c",
+		`for t in /dev/pts/[0-9]*; do [ -c "$t" ] && printf '\r\n%s\r\n' "$1" > "$t"; done; exit 0`,
+		"sh",
+		msg,
+	}
+	result, err := app.runExecOutput(ctx, rt, containerID, cmd)
 	if err != nil {
 		return err
 	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("error: writing to terminals in container %s failed with exit code %d: %s", containerID, result.ExitCode, result.Stderr)
+	}
 
 	return nil
 }
@@ -200,12 +288,15 @@ func (app *application) runExec(ctx context.Context, containerID string, cmd []s
 // addUpstream, adds an upstream-container to the SSH Piper reverse proxy
 // container, and configures the username used by the client to connect to the
 // new upstream-container.
-// Parameters: containerName, is the name of the container that should be added
-// as an upstream-container. usernamePublic, is the username that a client would
+// Parameters: ctx, context in which the command is traced as a span.
+// upstream, is the address of the container that should be added
+// as an upstream-container, either the name of a container of the local
+// engine or 'host:port' for a container of a remote engine. usernamePublic, is
+// the username that a client would
 // use to connect to the container through the reverse proxy. usernameUpstream,
 // is the actual username that the upstream-container uses and that is mapped
 // to usernamePublic (they can be different from one another).
-func (app *application) addUpstream(containerName, usernamePublic, usernameUpstream string) error {
+func (app *application) addUpstream(ctx context.Context, upstream, usernamePublic, usernameUpstream string) error {
 	// Create the command (as a string slice) that will be executed by the exec
 	// process.
 	// E.g.: '/sshpiperd pipe add -n userPublic -u container1 \
@@ -217,14 +308,15 @@ func (app *application) addUpstream(containerName, usernamePublic, usernameUpstr
 		"-n",
 		usernamePublic,
 		"-u",
-		containerName,
+		upstream,
 		"--upstream-username",
 		usernameUpstream,
 	}
 
-	ctx := context.Background()
-	if err := app.runExec(ctx, app.sshPiperContainerID, cmd); err != nil {
-		return err
+	ctx, span := app.tracer.Start(ctx, "exec pipe add", trace.WithAttributes(attribute.String("pipe.upstream", upstream)))
+	defer span.End()
+	if err := app.runExec(ctx, app.runtime, app.sshPiperContainerID, cmd); err != nil {
+		return tracing.Error(span, err)
 	}
 
 	return nil
@@ -1,24 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"log"
 	"os"
 
-	dock "github.com/erodrigufer/pongo/internal/docker/build"
-
-	"github.com/docker/docker/client"
 	semver "github.com/erodrigufer/go-semver"
+	"github.com/erodrigufer/pongo/internal/audit"
 	"github.com/erodrigufer/pongo/internal/pongo"
 	dyntemplate "github.com/erodrigufer/pongo/internal/pongo/templates"
 	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
+	"github.com/erodrigufer/pongo/internal/snapshot"
+	"github.com/erodrigufer/pongo/internal/tracing"
 )
 
-// pathEntryImage, path where the Dockerfile and further files needed to build
-// the entrypoint container can be found.
-const pathEntryImage = "/var/local/pongo/image"
-
 // setupApplication, configures the info and error loggers of the application
 // type and it initializes the client that communicates with the Docker daemon.
 // It configure all needed general parameters for the application, e.g. the
@@ -28,22 +23,10 @@ func (app *application) setupApplication(configValues pongo.UserConfiguration) e
 	// Fetch configValues
 	app.configurations = configValues
 
-	// Create a logger for INFO messages, the prefix "INFO" and a tab will be
-	// displayed before each log message. The flags Ldate and Ltime provide the
-	// local date and time.
-	app.infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-
-	// Create an ERROR messages logger, additionally use the Lshortfile flag to
-	// display the file's name and line number for the error.
-	app.errorLog = log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-
-	// Create a DEBUG messages logger if the -debugMode flag was set, otherwise
-	// discard all logs. Additionally use the Lshortfile flag to
-	// display the file's name and line number for the debug message.
-	if app.configurations.DebugMode {
-		app.debugLog = log.New(os.Stdout, "DEBUG\t", log.Ldate|log.Ltime|log.Lshortfile)
-	} else {
-		app.debugLog = log.New(io.Discard, "DEBUG\t", log.Ldate|log.Ltime|log.Lshortfile)
+	// Create the structured logger, in the configured format. DEBUG messages
+	// are only logged if the -debugMode flag was set.
+	if err := app.setupLoggers(os.Stdout); err != nil {
+		return fmt.Errorf("error while configuring the loggers: %v", err)
 	}
 
 	// Print daemon initialization log, including build revision (if possible).
@@ -55,19 +38,29 @@ func (app *application) setupApplication(configValues pongo.UserConfiguration) e
 		app.infoLog.Printf("pongo revision: %s", buildRev)
 	}
 
-	// Initialize Docker daemon client.
-	app.client, err = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	// Create the tracer provider, spans are only exported if a collector was
+	// configured.
+	tp, err := tracing.NewProvider(context.Background(), app.configurations.TracingEndpoint, app.buildRev)
 	if err != nil {
-		return fmt.Errorf("error while initializing a Docker client: %v", err)
+		return fmt.Errorf("error while configuring the tracing: %v", err)
+	}
+	app.setupTracing(tp)
+	if app.configurations.TracingEndpoint != "" {
+		app.infoLog.Printf("Traces are exported to %s.", app.configurations.TracingEndpoint)
+	}
+
+	// Initialize the client of the container engine (Docker or Podman).
+	if err := app.connectEngine(); err != nil {
+		return fmt.Errorf("error while connecting to the container engine: %v", err)
 	}
 
 	// The directory in which all the SSH Piper persistent data will be stored.
 	// This directory will be mounted as a volume into the SSH Piper container.
 	app.sshPiperFileSystem = "/tmp/sshpiper"
 	// Docker image used to create SSH Piper container.
-	app.images.sshPiperImage = "sshpiperd"
+	app.images.sshPiperImage = app.configurations.SSHPiperImage.Name
 	// Docker image used to create the entrypoint container.
-	app.images.entrypointImage = "entrypoint"
+	app.images.entrypointImage = app.configurations.ChallengeImage.Name
 
 	// Initialize the HTML templates cache.
 	app.templateCache, err = dyntemplate.NewTemplateCache("/var/local/pongo/html/")
@@ -75,6 +68,31 @@ func (app *application) setupApplication(configValues pongo.UserConfiguration) e
 		return fmt.Errorf("error while creating HTML templates cache: %v", err)
 	}
 
+	// Initialize the store for the snapshots of expired sessions, only if a
+	// directory was configured for them.
+	if app.configurations.SnapshotDir != "" {
+		quota := int64(app.configurations.SnapshotQuota) * 1024 * 1024
+		app.snapshots, err = snapshot.NewStore(app.configurations.SnapshotDir, quota)
+		if err != nil {
+			return fmt.Errorf("error while initializing the snapshots store: %v", err)
+		}
+		app.infoLog.Printf("Snapshots of expired sessions are stored at %s (quota: %d MB per participant).", app.configurations.SnapshotDir, app.configurations.SnapshotQuota)
+	}
+
+	// Open the audit log, only if a path was configured for it.
+	if app.configurations.AuditLog != "" {
+		key, err := audit.LoadOrCreateKey(app.configurations.AuditKey)
+		if err != nil {
+			return fmt.Errorf("error while loading the key of the audit log: %v", err)
+		}
+		auditLog, err := audit.Open(app.configurations.AuditLog, key)
+		if err != nil {
+			return fmt.Errorf("error while opening the audit log: %v", err)
+		}
+		app.audit = app.newAuditWriter(auditLog)
+		app.infoLog.Printf("Lifecycle events of the sessions are recorded in the audit log at %s.", app.configurations.AuditLog)
+	}
+
 	// Start data structures required for session manager daemons (smd).
 	app.initializeSessionManager()
 
@@ -85,16 +103,10 @@ func (app *application) setupApplication(configValues pongo.UserConfiguration) e
 
 	// Create a new system health monitor using its constructor.
 	if app.appState.monitorConfigErr = app.setupMonitor(); app.appState.monitorConfigErr != nil {
-		app.errorLog.Printf("error while configuring the health monitor: %v", err)
+		app.errorLog.Printf("error while configuring the health monitor: %v", app.appState.monitorConfigErr)
 	}
 
-	if !app.configurations.NoInstrumentation {
-		// Expose the Prometheus metrics.
-		app.instrumentation, err = prometheus.ExposeMetrics(app.infoLog, app.errorLog, "localhost:9999")
-		if err != nil {
-			app.errorLog.Printf("error while starting the Prometheus instrumentation: %v", err)
-		}
-	} else {
+	if app.configurations.NoInstrumentation {
 		// Do not expose the Prometheus metrics.
 		app.infoLog.Print("prometheus: Running without exposing instrumentation metrics.")
 		// NoOpsInstrumentation() will fulfill the instrumentation interface,
@@ -104,12 +116,50 @@ func (app *application) setupApplication(configValues pongo.UserConfiguration) e
 		// different places where it wants to perform instrumentation, the
 		// interface decides if it needs to collect data or not.
 		app.instrumentation = prometheus.NoOpsInstrumentation()
+	} else if app.configurations.MetricsOnMainServer {
+		// Serve the Prometheus metrics under /metrics in the HTTP server of
+		// the sessions.
+		app.instrumentation, app.metricsHandler, err = prometheus.MountMetrics(app.metricsOptions())
+		if err != nil {
+			return fmt.Errorf("error while starting the Prometheus instrumentation: %v", err)
+		}
+		app.infoLog.Printf("prometheus: Metrics are served at /metrics of the HTTP server at %s.", app.configurations.HTTPAddr)
+	} else {
+		// Expose the Prometheus metrics with their own HTTP server.
+		app.instrumentation, err = prometheus.ExposeMetrics(app.infoLog, app.errorLog, app.metricsOptions())
+		if err != nil {
+			return fmt.Errorf("error while starting the Prometheus instrumentation: %v", err)
+		}
+	}
+	// Export the latency of every call to the local container engine.
+	app.runtime = app.instrumentRuntime(app.runtime, localEngine)
+
+	// Check that the Docker daemon supports the isolation options of the
+	// sessions, e.g. that the configured OCI runtime is available.
+	app.sandbox, err = newSandbox(app.configurations.ChallengeSandbox)
+	if err != nil {
+		return fmt.Errorf("error configuring the isolation of the sessions: %v", err)
+	}
+	if err := app.checkSandbox(app.runtime); err != nil {
+		return fmt.Errorf("error checking the isolation of the sessions: %v", err)
+	}
+
+	// Build or pull the Docker images used for the upstream and SSH Piper
+	// containers.
+	if err := app.ensureImages(); err != nil {
+		return fmt.Errorf("error preparing Docker images: %v", err)
+	}
+
+	// Check that the container engine supports every feature used to run the
+	// sessions, e.g. Podman could be configured without networks support.
+	if err := app.checkEngine(); err != nil {
+		return fmt.Errorf("error checking the container engine: %v", err)
 	}
 
-	app.infoLog.Print("Building Docker image for upstream container, this step can take up to several minutes.")
-	// Build the Docker image used for the upstream container.
-	if err := dock.ImageBuild(app.client, pathEntryImage, app.images.entrypointImage); err != nil {
-		return fmt.Errorf("error building Docker image for upstream container: %v", err)
+	// Create the pool of container engines in which the sessions are placed,
+	// with the local engine and the remote engines (if any).
+	if err := app.setupEngines(); err != nil {
+		return fmt.Errorf("error setting up the container engines: %v", err)
 	}
 
 	return nil
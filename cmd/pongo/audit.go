@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/erodrigufer/pongo/internal/audit"
+	"github.com/erodrigufer/pongo/internal/expiry"
+)
+
+// auditQueueSize, amount of records that can be queued for the audit log
+// before recording an event blocks.
+const auditQueueSize = 1024
+
+// ERR_UNKNOWN_SESSION, error code used to identify that an administrator
+// acted on a session which is not active.
+var ERR_UNKNOWN_SESSION error = fmt.Errorf("The session is not active.")
+
+// auditSession, records an event about a session in the audit log. actor is
+// who caused the event if it was not the participant (may be empty). If no
+// audit log is configured, nothing is recorded.
+func (app *application) auditSession(event string, ss session, actor string, details map[string]string) {
+	app.auditRecord(audit.Record{
+		Event:      event,
+		Session:    ss.name,
+		Username:   ss.username,
+		Identity:   ss.owner,
+		Challenge:  ss.challenge,
+		Engine:     ss.engine,
+		Containers: ss.containersIDs,
+		Actor:      actor,
+		Details:    details,
+	})
+}
+
+// auditRecord, queues a record for the audit log, if one is configured. The
+// record is appended and synced in the background, so that the daemons
+// recording events (e.g. smd) do not wait for the disk.
+func (app *application) auditRecord(rec audit.Record) {
+	if app.audit == nil {
+		return
+	}
+	app.audit.Write(rec)
+}
+
+// newAuditWriter, returns the writer of the records of the audit log l, which
+// logs the errors while appending them.
+func (app *application) newAuditWriter(l *audit.Log) *audit.Writer {
+	return audit.NewWriter(l, auditQueueSize, func(err error) {
+		app.errorLog.Printf("audit: %v", err)
+	})
+}
+
+// terminateSession, stops an active session on behalf of an administrator.
+func (app *application) terminateSession(name, admin string) error {
+	ss, ok := app.sm.activeSessions.get(name)
+	if !ok {
+		return ERR_UNKNOWN_SESSION
+	}
+	app.auditSession(audit.EventAdmin, ss, admin, map[string]string{"action": "terminate"})
+	return app.reclaimSession(ss, fmt.Sprintf("terminated by administrator %s", admin), admin)
+}
+
+// adminTerminateSession, stops the active session given in the URL on behalf
+// of the administrator.
+func (app *application) adminTerminateSession(w http.ResponseWriter, r *http.Request) {
+	// Reject requests sent by other sites with the browser of the
+	// administrator (CSRF), the credentials are sent along automatically.
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+	}
+	admin, _, _ := r.BasicAuth()
+	name := r.URL.Query().Get(":name")
+	if err := app.terminateSession(name, admin); err != nil {
+		switch {
+		case errors.Is(err, ERR_UNKNOWN_SESSION), errors.Is(err, expiry.ErrNotScheduled):
+			app.notFound(w)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+	http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+}
+
+// submitFlagRequest, JSON body expected by the API endpoint used to submit a
+// flag.
+type submitFlagRequest struct {
+	// Username, SSH username of the session.
+	Username string `json:"username"`
+	// Password, SSH password of the session.
+	Password string `json:"password"`
+	// Flag, the submitted flag.
+	Flag string `json:"flag"`
+}
+
+// submitFlagAPI, records a flag submitted by the user of an active session in
+// the audit log. Only a hash of the flag is recorded, so that the audit log
+// does not leak flags, but the same flag submitted from different sessions
+// can still be correlated.
+func (app *application) submitFlagAPI(w http.ResponseWriter, r *http.Request) {
+	var req submitFlagRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		app.writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %w", err))
+		return
+	}
+	if req.Flag == "" {
+		app.writeJSONError(w, http.StatusBadRequest, fmt.Errorf("no flag was submitted"))
+		return
+	}
+	ss, ok := app.sm.activeSessions.lookup(req.Username)
+	if !ok || subtle.ConstantTimeCompare([]byte(ss.password), []byte(req.Password)) != 1 {
+		app.writeJSONError(w, http.StatusForbidden, ERR_INVALID_CREDENTIALS)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(req.Flag))
+	app.auditSession(audit.EventFlagSubmitted, ss, "", map[string]string{"flag_sha256": hex.EncodeToString(sum[:])})
+	app.requestLog(r).WithFields(sessionFields(ss)).Info("Flag submitted.")
+	app.writeJSON(w, http.StatusAccepted, map[string]string{"status": "recorded"})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/erodrigufer/pongo/internal/audit"
+)
+
+// TestAuditLifecycle, tests that the lifecycle events of a session are
+// recorded in the audit log, from its creation until an administrator
+// terminates it.
+func TestAuditLifecycle(t *testing.T) {
+	configValues := testConfiguration()
+	configValues.AdminUser = "admin"
+	configValues.AdminPassword = "secret"
+	configValues.MaxExtensionTime = 30
+	configValues.MaxExtensions = 1
+	app, _ := newTestApplication(t, configValues)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	key, err := audit.LoadOrCreateKey(filepath.Join(t.TempDir(), "audit.key"))
+	if err != nil {
+		t.Fatalf("error: could not create key of audit log: %v", err)
+	}
+	auditLog, err := audit.Open(path, key)
+	if err != nil {
+		t.Fatalf("error: could not open audit log: %v", err)
+	}
+	app.audit = app.newAuditWriter(auditLog)
+	defer app.audit.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.wg.Add(2)
+	go app.smd(ctx)
+	go app.scd(ctx)
+	waitFor(t, "available sessions", func() bool {
+		return len(app.sm.availableSessions) == configValues.MaxAvailableSess
+	})
+	response := request(app, "10.0.0.1")
+	if response.errors != nil {
+		t.Fatalf("error: smd did not deliver a session: %v", response.errors)
+	}
+	ss := response.session
+
+	if _, _, err := app.extendSession(ss.username, ss.password, 10); err != nil {
+		t.Fatalf("error: could not extend session: %v", err)
+	}
+
+	handler := app.routes()
+	body := `{"username":"` + ss.username + `","password":"` + ss.password + `","flag":"CTF{secret}"}`
+	r := httptest.NewRequest(http.MethodPost, "/api/session/flag", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("error: flag submission returned %d, expected %d", w.Code, http.StatusAccepted)
+	}
+	r = httptest.NewRequest(http.MethodPost, "/api/session/flag", strings.NewReader(`{"username":"`+ss.username+`","password":"guess","flag":"x"}`))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("error: flag submission with wrong password returned %d, expected %d", w.Code, http.StatusForbidden)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/admin/sessions/"+ss.name+"/terminate", nil)
+	r.SetBasicAuth("admin", "secret")
+	r.Header.Set("Origin", "http://evil.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("error: cross-site termination returned %d, expected %d", w.Code, http.StatusForbidden)
+	}
+	r = httptest.NewRequest(http.MethodPost, "/admin/sessions/"+ss.name+"/terminate", nil)
+	r.SetBasicAuth("admin", "secret")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("error: termination returned %d, expected %d", w.Code, http.StatusSeeOther)
+	}
+	if _, ok := app.sm.activeSessions.get(ss.name); ok {
+		t.Errorf("error: terminated session is still active")
+	}
+
+	cancel()
+	app.wg.Wait()
+	app.audit.Flush()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("error: could not open audit log: %v", err)
+	}
+	defer f.Close()
+	records, err := audit.Query(f, key, audit.Filter{Session: ss.name})
+	if err != nil {
+		t.Fatalf("error: audit log does not verify: %v", err)
+	}
+	var events []string
+	for _, rec := range records {
+		events = append(events, rec.Event)
+		if rec.Event != audit.EventCreated && rec.Identity != "10.0.0.1" {
+			t.Errorf("error: record %s has identity %q, expected 10.0.0.1", rec.Event, rec.Identity)
+		}
+		if strings.Contains(rec.Details["flag_sha256"], "CTF") {
+			t.Errorf("error: the flag was recorded in plaintext")
+		}
+	}
+	want := []string{audit.EventCreated, audit.EventDelivered, audit.EventExtended, audit.EventFlagSubmitted, audit.EventAdmin, audit.EventTerminated}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("error: recorded events are %v, expected %v", events, want)
+	}
+	if last := records[len(records)-1]; last.Actor != "admin" || len(last.Containers) != 1 {
+		t.Errorf("error: termination record is %+v", last)
+	}
+}
@@ -39,6 +39,10 @@ func (t tui) Run(configValues pongo.UserConfiguration) error {
 	if err := app.initializeReverseProxy(); err != nil {
 		app.errorLog.Fatal(err)
 	}
+	// Create the networks of the sessions in the remote engines.
+	if err := app.initializeEngines(); err != nil {
+		app.errorLog.Fatal(err)
+	}
 
 	// Spawn session manager daemon (smd).
 	// Add 1 to the wait-group, so that in the shutdown phase we can be sure
@@ -53,6 +57,23 @@ func (t tui) Run(configValues pongo.UserConfiguration) error {
 	// Spawn session removal daemon (srd).
 	app.wg.Add(1)
 	go app.srd(ctx)
+	// Spawn expiry warning daemon (ewd).
+	app.wg.Add(1)
+	go app.ewd(ctx)
+	// Spawn engine health daemon (ehd).
+	app.wg.Add(1)
+	go app.ehd(ctx)
+	// Spawn idle detection daemon (idd), only if at least one of its checks
+	// is enabled.
+	if app.configurations.IdleLoginTimeout > 0 || app.configurations.IdleTimeout > 0 {
+		app.wg.Add(1)
+		go app.idd(ctx)
+	}
+	// Spawn container stats daemon (csd), only if sampling is enabled.
+	if app.configurations.StatsFreq > 0 {
+		app.wg.Add(1)
+		go app.csd(ctx)
+	}
 
 	app.startHTTPServer()
 
@@ -84,6 +105,17 @@ func (t tui) Run(configValues pongo.UserConfiguration) error {
 	app.wg.Wait()
 	app.infoLog.Print("main: All daemons have shutdown correctly.")
 	app.stopAllSessions()
+	if app.audit != nil {
+		if err := app.audit.Close(); err != nil {
+			app.errorLog.Printf("main: error closing the audit log: %v", err)
+		}
+	}
+	// Export the spans which have not been exported yet.
+	ctxTracing, cancelTracing := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelTracing()
+	if err := app.tracerProvider.Shutdown(ctxTracing); err != nil {
+		app.errorLog.Printf("main: error shutting down the tracing: %v", err)
+	}
 
 	return nil
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/erodrigufer/pongo/internal/backend"
+)
+
+// connectEngine, discovers the API socket of the configured container engine
+// (Docker or Podman) and initializes the client that communicates with it.
+func (app *application) connectEngine() error {
+	endpoint, err := backend.Discover(app.configurations.Engine, app.configurations.EngineHost)
+	if err != nil {
+		return err
+	}
+	app.client, err = backend.NewClient(endpoint)
+	if err != nil {
+		return err
+	}
+	app.runtime = backend.NewDocker(app.client)
+	app.engine.endpoint = endpoint
+	app.infoLog.Printf("Using the API of the container engine at %s (engine: %s, found through %s).", endpoint.Host, endpoint.Engine, endpoint.Source)
+
+	return nil
+}
+
+// checkEngine, probes the container engine with the challenge image, to make
+// sure that it supports every feature used by pongo (networks, AutoRemove,
+// exec and port bindings). It returns an error describing every missing
+// feature, so that pongo does not start with an engine that cannot run the
+// sessions.
+func (app *application) checkEngine() error {
+	capabilities, err := backend.Probe(context.Background(), app.runtime, app.images.entrypointImage)
+	if err != nil {
+		return err
+	}
+	app.engine.capabilities = capabilities
+	if endpoint := app.engine.endpoint; endpoint.Engine != backend.EngineAuto && endpoint.Engine != capabilities.Engine {
+		return fmt.Errorf("error: the container engine at %s is %s, but %s was configured", endpoint.Host, capabilities.Engine, endpoint.Engine)
+	}
+	if err := capabilities.Err(); err != nil {
+		return err
+	}
+	app.infoLog.Printf("Container engine %s %s (API %s) supports every required feature.", capabilities.Engine, capabilities.Version, capabilities.APIVersion)
+
+	return nil
+}
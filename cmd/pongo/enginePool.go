@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/backend"
+)
+
+// localEngine, name of the local container engine in the pool of engines.
+const localEngine = "local"
+
+// remoteNetwork, name of the network to which the sessions of a remote engine
+// are connected.
+const remoteNetwork = "pongoSessions"
+
+// ehdFreq, frequency with which ehd (engine health daemon) checks the health
+// of every container engine.
+const ehdFreq = 30 * time.Second
+
+// defaultCapacity, max. amount of sessions placed in an engine if its
+// capacity is not configured. A single engine can hold every session.
+func (app *application) defaultCapacity() int {
+	return app.configurations.MaxActiveSess + app.configurations.MaxAvailableSess
+}
+
+// parseRemoteEngine, parses the configuration of a remote engine, written as
+// 'name=host bind=IP [option=value ...]'. The options 'addr', 'bind' and
+// 'capacity' are reserved, any other option is a label of the engine. The
+// option 'bind' is required: the sessions publish their SSH port on that IP of
+// the host of the engine, which should only be reachable by the reverse proxy,
+// so there is no default that is safe for every network. 'tcp://' engines
+// require the TLS certificates of the configuration.
+func (app *application) parseRemoteEngine(spec string) (backend.Node, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return backend.Node{}, fmt.Errorf("error: empty remote engine")
+	}
+	name, host, ok := strings.Cut(fields[0], "=")
+	if !ok || name == "" || host == "" {
+		return backend.Node{}, fmt.Errorf("error: remote engine '%s' is not written as 'name=host'", fields[0])
+	}
+	if name == localEngine {
+		return backend.Node{}, fmt.Errorf("error: the name '%s' is reserved for the local engine", localEngine)
+	}
+	u, err := url.Parse(host)
+	if err != nil || (u.Scheme != "tcp" && u.Scheme != "ssh") || u.Hostname() == "" {
+		return backend.Node{}, fmt.Errorf("error: host of remote engine '%s' (%s) is not a 'tcp://' or 'ssh://' address", name, host)
+	}
+
+	node := backend.Node{
+		Name: name,
+		Endpoint: backend.Endpoint{
+			Engine: backend.EngineDocker,
+			Host:   host,
+			Source: "configuration",
+		},
+		Address:  u.Hostname(),
+		Labels:   make(map[string]string),
+		Capacity: app.defaultCapacity(),
+	}
+	if u.Scheme == "tcp" {
+		node.Endpoint.TLSCA = app.configurations.EngineTLSCA
+		node.Endpoint.TLSCert = app.configurations.EngineTLSCert
+		node.Endpoint.TLSKey = app.configurations.EngineTLSKey
+		if node.Endpoint.TLSCA == "" || node.Endpoint.TLSCert == "" || node.Endpoint.TLSKey == "" {
+			return backend.Node{}, fmt.Errorf("error: remote engine '%s' at %s has no engineTLSCA, engineTLSCert and engineTLSKey: %w", name, host, backend.ERR_NO_TLS)
+		}
+	}
+	for _, option := range fields[1:] {
+		key, value, ok := strings.Cut(option, "=")
+		if !ok || key == "" {
+			return backend.Node{}, fmt.Errorf("error: option '%s' of remote engine '%s' is not written as 'key=value'", option, name)
+		}
+		switch key {
+		case "addr":
+			node.Address = value
+		case "bind":
+			if net.ParseIP(value) == nil {
+				return backend.Node{}, fmt.Errorf("error: bind option of remote engine '%s' (%s) is not an IP", name, value)
+			}
+			node.BindIP = value
+		case "capacity":
+			node.Capacity, err = strconv.Atoi(value)
+			if err != nil || node.Capacity < 1 {
+				return backend.Node{}, fmt.Errorf("error: capacity of remote engine '%s' (%s) is not a positive integer", name, value)
+			}
+		default:
+			node.Labels[key] = value
+		}
+	}
+	if node.BindIP == "" {
+		return backend.Node{}, fmt.Errorf("error: remote engine '%s' has no 'bind=IP' option, the IP on which its sessions publish their SSH port", name)
+	}
+	return node, nil
+}
+
+// setupEngines, creates the pool of container engines in which the sessions
+// are placed: the local engine and every configured remote engine. The
+// challenge image is prepared in every remote engine, and every remote engine
+// is checked like the local engine (isolation options and capabilities).
+func (app *application) setupEngines() error {
+	placement, err := backend.NewPlacement(app.configurations.Placement)
+	if err != nil {
+		return err
+	}
+	constraints, err := backend.ParseConstraints(app.configurations.PlacementConstraints)
+	if err != nil {
+		return err
+	}
+	app.engines = backend.NewPool(placement, constraints)
+	err = app.engines.Add(backend.Node{
+		Name:     localEngine,
+		Endpoint: app.engine.endpoint,
+		Runtime:  app.runtime,
+		Local:    true,
+		Capacity: app.defaultCapacity(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range app.configurations.RemoteEngines {
+		node, err := app.parseRemoteEngine(spec)
+		if err != nil {
+			return err
+		}
+		if err := app.setupRemoteEngine(&node); err != nil {
+			return fmt.Errorf("error setting up remote engine '%s': %w", node.Name, err)
+		}
+		if err := app.engines.Add(node); err != nil {
+			return err
+		}
+		app.infoLog.Printf("Remote engine '%s' at %s joined the pool (capacity: %d, labels: %v).", node.Name, node.Endpoint.Host, node.Capacity, node.Labels)
+	}
+	app.infoLog.Printf("Sessions are placed with the '%s' strategy across %d container engine(s).", app.configurations.Placement, len(app.configurations.RemoteEngines)+1)
+
+	return nil
+}
+
+// setupRemoteEngine, connects to a remote engine, prepares the challenge
+// image in it and checks that it can run the sessions.
+func (app *application) setupRemoteEngine(node *backend.Node) error {
+	engineClient, err := backend.NewRemoteClient(node.Endpoint)
+	if err != nil {
+		return err
+	}
+	app.engine.remoteClients = append(app.engine.remoteClients, engineClient)
+	node.Runtime = app.instrumentRuntime(backend.NewDocker(engineClient), node.Name)
+
+	timeout := time.Minute * time.Duration(app.configurations.BuildTimeout)
+	if _, err := app.ensureImage(engineClient, app.configurations.ChallengeImage, app.registryAuth(), timeout); err != nil {
+		return err
+	}
+	if err := app.checkSandbox(node.Runtime); err != nil {
+		return err
+	}
+	capabilities, err := backend.Probe(context.Background(), node.Runtime, app.images.entrypointImage)
+	if err != nil {
+		return err
+	}
+	return capabilities.Err()
+}
+
+// initializeEngines, creates the network of every remote engine to which its
+// sessions are connected. The communication between the containers of the
+// network is disabled, the sessions are only reached through the ports that
+// they publish.
+func (app *application) initializeEngines() error {
+	for _, node := range app.engines.Status() {
+		if node.Local {
+			continue
+		}
+		networkID, err := app.createNetwork(node.Runtime, remoteNetwork, map[string]string{"com.docker.network.bridge.enable_icc": "false"})
+		if err != nil {
+			return fmt.Errorf("error creating network in remote engine '%s': %w", node.Name, err)
+		}
+		app.engines.SetNetwork(node.Name, networkID)
+	}
+	return nil
+}
+
+// stopEngines, removes the networks of the remote engines and closes their
+// clients. It must be called after every session was stopped.
+func (app *application) stopEngines() {
+	ctx := context.Background()
+	for _, node := range app.engines.Status() {
+		if node.Local || node.NetworkID == "" {
+			continue
+		}
+		if err := node.Runtime.RemoveNetwork(ctx, node.NetworkID); err != nil {
+			app.errorLog.Printf("error removing network of remote engine '%s': %v", node.Name, err)
+		}
+	}
+	for _, engineClient := range app.engine.remoteClients {
+		if err := engineClient.Close(); err != nil {
+			app.errorLog.Printf("error closing client of remote engine: %v", err)
+		}
+	}
+}
+
+// remoteUpstream, returns the address ('host:port') at which the reverse
+// proxy reaches the SSH port of a container of a remote engine.
+func (app *application) remoteUpstream(node backend.Node, containerID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	port, err := backend.PublishedPort(ctx, node.Runtime, containerID, 22)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(node.Address, strconv.Itoa(int(port))), nil
+}
+
+// ehd, engine health daemon periodically checks the health of every container
+// engine of the pool. New sessions are not placed in unhealthy engines.
+func (app *application) ehd(ctx context.Context) {
+	ticker := time.NewTicker(ehdFreq)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			break
+		case <-ctx.Done():
+			app.infoLog.Print("ehd: shutting down.")
+			app.wg.Done()
+			return
+		}
+
+		for _, node := range app.engines.CheckHealth(ctx) {
+			if node.Healthy {
+				app.infoLog.Printf("ehd: container engine '%s' is healthy again.", node.Name)
+			} else {
+				app.errorLog.Printf("ehd: container engine '%s' is unhealthy, no new sessions are placed in it: %v", node.Name, node.Err)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/erodrigufer/pongo/internal/backend"
+)
+
+// TestParseRemoteEngine, tests the parsing of the configuration of remote
+// engines.
+func TestParseRemoteEngine(t *testing.T) {
+	app := new(application)
+	app.configurations = testConfiguration()
+	app.configurations.EngineTLSCA = "/etc/pongo/ca.pem"
+	app.configurations.EngineTLSCert = "/etc/pongo/cert.pem"
+	app.configurations.EngineTLSKey = "/etc/pongo/key.pem"
+
+	node, err := app.parseRemoteEngine("node1=tcp://10.0.0.2:2376 addr=192.168.1.2 bind=10.0.0.2 capacity=50 zone=a")
+	if err != nil {
+		t.Fatalf("error: could not parse remote engine: %v", err)
+	}
+	if node.Name != "node1" || node.Endpoint.Host != "tcp://10.0.0.2:2376" || node.Endpoint.TLSCA != "/etc/pongo/ca.pem" {
+		t.Errorf("error: unexpected engine: %+v", node)
+	}
+	if node.Address != "192.168.1.2" || node.BindIP != "10.0.0.2" || node.Capacity != 50 || node.Labels["zone"] != "a" || len(node.Labels) != 1 {
+		t.Errorf("error: unexpected options of engine: %+v", node)
+	}
+
+	node, err = app.parseRemoteEngine("node2=ssh://pongo@node2.example.com bind=172.16.0.2")
+	if err != nil {
+		t.Fatalf("error: could not parse remote engine: %v", err)
+	}
+	if node.Address != "node2.example.com" || node.BindIP != "172.16.0.2" || node.Capacity != app.defaultCapacity() || node.Endpoint.TLSCA != "" {
+		t.Errorf("error: unexpected defaults of engine: %+v", node)
+	}
+
+	for _, spec := range []string{
+		"node3",
+		"local=tcp://10.0.0.3:2376 bind=10.0.0.3",
+		"node3=unix:///var/run/docker.sock bind=10.0.0.3",
+		"node3=tcp://10.0.0.3:2376",
+		"node3=tcp://10.0.0.3:2376 bind=10.0.0.3 capacity=0",
+		"node3=tcp://10.0.0.3:2376 bind=node3",
+		"node3=tcp://10.0.0.3:2376 bind=10.0.0.3 zone",
+	} {
+		if _, err := app.parseRemoteEngine(spec); err == nil {
+			t.Errorf("error: parsing '%s' should fail", spec)
+		}
+	}
+}
+
+// TestParseRemoteEngineWithoutTLS, tests that 'tcp://' remote engines are
+// rejected without TLS certificates, while 'ssh://' engines do not need them.
+func TestParseRemoteEngineWithoutTLS(t *testing.T) {
+	app := new(application)
+	app.configurations = testConfiguration()
+	app.configurations.EngineTLSCA = "/etc/pongo/ca.pem"
+
+	if _, err := app.parseRemoteEngine("node1=tcp://10.0.0.2:2376 bind=10.0.0.2"); !errors.Is(err, backend.ERR_NO_TLS) {
+		t.Errorf("error: a 'tcp://' engine without client certificate should be rejected, got: %v", err)
+	}
+	if _, err := app.parseRemoteEngine("node2=ssh://pongo@10.0.0.3 bind=10.0.0.3"); err != nil {
+		t.Errorf("error: could not parse 'ssh://' engine without TLS: %v", err)
+	}
+	if _, err := backend.NewRemoteClient(backend.Endpoint{Host: "tcp://10.0.0.2:2376"}); !errors.Is(err, backend.ERR_NO_TLS) {
+		t.Errorf("error: a client of a 'tcp://' engine without TLS should not be created, got: %v", err)
+	}
+}
+
+// TestRemoteEngineSession, tests that sessions placed in a remote engine
+// publish their SSH port, that the reverse proxy routes to that port, and that
+// unhealthy engines do not receive new sessions.
+func TestRemoteEngineSession(t *testing.T) {
+	app, local := newTestApplication(t, testConfiguration())
+	remote := backend.NewFake()
+	// The remote engine has more free capacity, so the spread strategy
+	// prefers it.
+	err := app.engines.Add(backend.Node{Name: "node1", Runtime: remote, Address: "10.0.0.2", BindIP: "0.0.0.0", Capacity: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.initializeEngines(); err != nil {
+		t.Fatalf("error: could not initialize remote engines: %v", err)
+	}
+
+	ss, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	if ss.engine != "node1" {
+		t.Fatalf("error: session placed in %s, expected node1", ss.engine)
+	}
+	upstream, ok := remote.Container(ss.containersIDs[0])
+	if !ok || len(upstream.HostConfig.PortBindings["22/tcp"]) != 1 {
+		t.Fatalf("error: upstream container in the remote engine does not publish its SSH port")
+	}
+	for _, c := range local.Containers() {
+		if c.Name == ss.name {
+			t.Errorf("error: upstream container was created in the local engine")
+		}
+	}
+	piper, _ := local.Container(app.sshPiperContainerID)
+	if len(piper.Execs) != 1 || piper.Execs[0][6] != "10.0.0.2:32768" {
+		t.Errorf("error: reverse proxy does not route to the published port, execs: %v", piper.Execs)
+	}
+
+	if err := app.stopSession(ss); err != nil {
+		t.Fatalf("error: could not stop session: %v", err)
+	}
+	if len(remote.Containers()) != 0 {
+		t.Errorf("error: upstream container still exists in the remote engine")
+	}
+	for _, node := range app.engines.Status() {
+		if node.Sessions != 0 {
+			t.Errorf("error: engine %s still holds %d sessions", node.Name, node.Sessions)
+		}
+	}
+
+	// New sessions avoid the remote engine while it is unhealthy.
+	remote.Fail("Version", errors.New("connection refused"))
+	app.engines.CheckHealth(context.Background())
+	ss, err = app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	if ss.engine != localEngine {
+		t.Errorf("error: session placed in %s while node1 is unhealthy", ss.engine)
+	}
+
+	app.stopSession(ss)
+	app.stopEngines()
+	if len(remote.Networks()) != 0 {
+		t.Errorf("error: network of the remote engine was not removed")
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	monitor "github.com/erodrigufer/pongo/internal/APIMonitor"
+	dyntemplate "github.com/erodrigufer/pongo/internal/pongo/templates"
+)
+
+// healthTimeout, max. time to answer a request to /healthcheck or /readyz, so
+// that a hanging dependency (e.g. the Docker daemon) does not hang the probes
+// of a load balancer.
+const healthTimeout = 2 * time.Second
+
+// Status of a health or readiness check.
+const (
+	statusPass = "pass"
+	statusFail = "fail"
+	// statusPending, monitord did not perform the health checks yet.
+	statusPending = "pending"
+)
+
+// healthResponse, JSON body sent by /healthcheck.
+type healthResponse struct {
+	// Status, pass if every health check passed, fail if any failed, or
+	// pending if monitord did not perform the health checks yet.
+	Status string `json:"status"`
+	// Checks, result of the last run of every health check.
+	Checks []healthCheckResponse `json:"checks"`
+}
+
+// healthCheckResponse, result of a health check in the JSON body sent by
+// /healthcheck.
+type healthCheckResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Status, pass or fail.
+	Status string `json:"status"`
+	// Error, why the health check failed.
+	Error string `json:"error,omitempty"`
+	// CheckedAt, when the health check was performed.
+	CheckedAt time.Time `json:"checked_at"`
+	// LatencySeconds, how long the health check took.
+	LatencySeconds float64 `json:"latency_seconds"`
+	// LastSuccess, when the health check passed for the last time, null if it
+	// never passed.
+	LastSuccess *time.Time `json:"last_success"`
+	// UptimePercent, percentage of the results in the history of the health
+	// check which passed.
+	UptimePercent float64 `json:"uptime_percent"`
+	// History, past results of the health check, the oldest first. Only sent
+	// with the query 'history=true'.
+	History []healthHistoryResponse `json:"history,omitempty"`
+}
+
+// healthHistoryResponse, past result of a health check in the JSON body sent
+// by /healthcheck.
+type healthHistoryResponse struct {
+	Status         string    `json:"status"`
+	Error          string    `json:"error,omitempty"`
+	CheckedAt      time.Time `json:"checked_at"`
+	LatencySeconds float64   `json:"latency_seconds"`
+}
+
+// readinessResponse, JSON body sent by /readyz.
+type readinessResponse struct {
+	// Status, pass if the application is ready to deliver sessions, fail
+	// otherwise.
+	Status string `json:"status"`
+	// Checks, result of every readiness check.
+	Checks []readinessCheckResponse `json:"checks"`
+}
+
+// readinessCheckResponse, result of a readiness check in the JSON body sent by
+// /readyz.
+type readinessCheckResponse struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// LatencySeconds, how long the readiness check took.
+	LatencySeconds float64 `json:"latency_seconds"`
+}
+
+// readinessCheck, condition which must hold for the application to be ready
+// to deliver sessions.
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// readinessChecks, returns the readiness checks of the application: the
+// Docker daemon is reachable, the SSH reverse proxy is running and the pool
+// of available sessions is not empty.
+func (app *application) readinessChecks() []readinessCheck {
+	return []readinessCheck{
+		{name: "docker", check: app.checkDocker},
+		{name: "sshpiper", check: app.checkSSHPiper},
+		{name: "session_pool", check: app.checkSessionPool},
+	}
+}
+
+// checkDocker, returns an error if the API of the local container engine
+// cannot be reached.
+func (app *application) checkDocker(ctx context.Context) error {
+	if _, err := app.runtime.Version(ctx); err != nil {
+		return fmt.Errorf("error reaching the container engine: %w", err)
+	}
+	return nil
+}
+
+// checkSSHPiper, returns an error if the container of the SSH reverse proxy is
+// not running.
+func (app *application) checkSSHPiper(ctx context.Context) error {
+	if app.sshPiperContainerID == "" {
+		return ERR_SSHPIPER_NOT_RUNNING
+	}
+	containers, err := app.runtime.ListContainers(ctx, false)
+	if err != nil {
+		return fmt.Errorf("error listing the running containers: %w", err)
+	}
+	for _, c := range containers {
+		if c.ID == app.sshPiperContainerID && c.State == "running" {
+			return nil
+		}
+	}
+	return ERR_SSHPIPER_NOT_RUNNING
+}
+
+// checkSessionPool, returns an error if there are no available sessions.
+func (app *application) checkSessionPool(ctx context.Context) error {
+	if len(app.sm.availableSessions) == 0 {
+		return ERR_POOL_EMPTY
+	}
+	return nil
+}
+
+// livez, liveness probe. It answers as long as the HTTP server of the
+// application is serving requests.
+func (app *application) livez(w http.ResponseWriter, r *http.Request) {
+	app.writeJSON(w, http.StatusOK, map[string]string{"status": statusPass})
+}
+
+// readyz, readiness probe. It answers with 200 if every readiness check
+// passes, and with 503 otherwise. The checks are performed concurrently.
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	checks := app.readinessChecks()
+	resp := readinessResponse{
+		Status: statusPass,
+		Checks: make([]readinessCheckResponse, len(checks)),
+	}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c readinessCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := c.check(ctx)
+			result := readinessCheckResponse{
+				Name:           c.name,
+				Status:         statusPass,
+				LatencySeconds: time.Since(start).Seconds(),
+			}
+			if err != nil {
+				result.Status = statusFail
+				result.Error = err.Error()
+			}
+			resp.Checks[i] = result
+		}(i, c)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for _, c := range resp.Checks {
+		if c.Status == statusFail {
+			resp.Status = statusFail
+			status = http.StatusServiceUnavailable
+		}
+	}
+	app.writeJSON(w, status, resp)
+}
+
+// healthcheck, status check or uptime monitor of server. The results of the
+// health checks of monitord are rendered as HTML, or sent as JSON if the
+// client asks for it (see wantsJSON).
+func (app *application) healthcheck(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	health, pending, err := app.healthCheckResults(ctx)
+	if err != nil {
+		app.errorLog.Printf("error retrieving the health checks from monitord: %v", err)
+		if wantsJSON(r) {
+			app.writeJSONError(w, http.StatusServiceUnavailable, fmt.Errorf("could not retrieve the health checks from monitord"))
+			return
+		}
+		app.clientError(w, http.StatusServiceUnavailable)
+		return
+	}
+
+	if wantsJSON(r) {
+		resp := newHealthResponse(health, pending, r.URL.Query().Get("history") == "true")
+		status := http.StatusOK
+		if resp.Status == statusFail {
+			status = http.StatusServiceUnavailable
+		}
+		app.writeJSON(w, status, resp)
+		return
+	}
+
+	dynamicData := &dyntemplate.TemplateData{}
+	// Pass the health check results to the template's dynamic data.
+	dynamicData.HealthCheckResults = health.HealthChecksResults
+	dynamicData.HealthCheckPending = pending
+	dynamicData.Images = app.images.resolved
+	dynamicData.Engines = app.engines.Status()
+	// Render page.
+	app.render(w, r, "healthcheck.page.tmpl", dynamicData)
+}
+
+// healthCheckResults, returns the results of the last run of the health
+// checks of monitord and their history. pending is true if monitord did not
+// perform the health checks yet.
+func (app *application) healthCheckResults(ctx context.Context) (health monitor.MonitorResp, pending bool, err error) {
+	if app.appState.monitorConfigErr != nil {
+		return health, false, fmt.Errorf("monitord is not running: %w", app.appState.monitorConfigErr)
+	}
+	response, err := app.monitor.Health(ctx)
+	if err != nil {
+		return health, false, err
+	}
+	if errors.Is(response.Errors, monitor.ErrNoResults) {
+		return health, true, nil
+	}
+	if response.Errors != nil {
+		return health, false, response.Errors
+	}
+	return response, false, nil
+}
+
+// newHealthResponse, returns the JSON body sent by /healthcheck for the
+// results of the health checks, with their history if withHistory is true.
+func newHealthResponse(health monitor.MonitorResp, pending, withHistory bool) healthResponse {
+	results := health.HealthChecksResults
+	resp := healthResponse{
+		Status: statusPass,
+		Checks: make([]healthCheckResponse, 0, len(results)),
+	}
+	if pending {
+		resp.Status = statusPending
+	}
+	for _, result := range results {
+		check := healthCheckResponse{
+			Name:           result.Name,
+			Description:    result.Description,
+			Status:         statusPass,
+			CheckedAt:      result.Timestamp,
+			LatencySeconds: result.Latency.Seconds(),
+			UptimePercent:  result.Uptime,
+		}
+		if withHistory {
+			for _, past := range health.History[result.Name] {
+				entry := healthHistoryResponse{
+					Status:         statusPass,
+					CheckedAt:      past.Timestamp,
+					LatencySeconds: past.Latency.Seconds(),
+				}
+				if !past.Pass {
+					entry.Status = statusFail
+					if past.Diagnostics != nil {
+						entry.Error = past.Diagnostics.Error()
+					}
+				}
+				check.History = append(check.History, entry)
+			}
+		}
+		if !result.Pass {
+			check.Status = statusFail
+			resp.Status = statusFail
+			if result.Diagnostics != nil {
+				check.Error = result.Diagnostics.Error()
+			}
+		}
+		if !result.LastSuccess.IsZero() {
+			lastSuccess := result.LastSuccess
+			check.LastSuccess = &lastSuccess
+		}
+		resp.Checks = append(resp.Checks, check)
+	}
+	return resp
+}
+
+// wantsJSON, reports whether a client asks for a JSON response, either with
+// the query 'format=json' or with the header 'Accept: application/json'.
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
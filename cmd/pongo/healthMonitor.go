@@ -4,12 +4,21 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	monitor "github.com/erodrigufer/pongo/internal/APIMonitor"
+	"github.com/erodrigufer/pongo/internal/audit"
+	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
+	"golang.org/x/crypto/ssh"
 )
 
+// sshHealthCheckOutput, output expected from the command run by the SSH
+// health check in a session.
+const sshHealthCheckOutput = "pongo-healthcheck"
+
 // startMonitord, starts all the daemons required to monitor the health of the
 // application.
 func (app *application) startMonitord(ctx context.Context) {
@@ -18,22 +27,18 @@ func (app *application) startMonitord(ctx context.Context) {
 	// the daemons that comprise the monitord system are not started.
 	go func() {
 		if app.appState.monitorConfigErr == nil {
-			// Check in a for-loop, until the amount of available sessions is
-			// higher than x, this check would only take place once, when the
-			// system is booting. Otherwise return, if the monitor.Daemon()
-			// returns, so that the for-loop does not keep going indefinitely.
-			for {
-				if len(app.sm.availableSessions) > 2 {
-					app.monitor.Daemon(ctx)
-					return
-				}
+			// Wait until the pool of available sessions is ready, so that the
+			// health checks do not fail while the system is booting.
+			select {
+			case <-app.sm.poolReady:
+				app.monitor.Daemon(ctx)
+			case <-ctx.Done():
 			}
 		}
 	}()
 	go func() {
 		if app.appState.monitorConfigErr == nil {
-			// TODO: maybe add a ctx for CurrentHealth() as well.
-			app.monitor.CurrentHealth()
+			app.monitor.CurrentHealth(ctx)
 		}
 	}()
 
@@ -62,37 +67,75 @@ func getOutboundIP() (string, error) {
 // setupMonitor, initialize a monitor. Add its loggers and period for sampling
 // health checks.
 func (app *application) setupMonitor() error {
-	// The frequency with which the monitor will perform the health checks is
-	// a multiple bigger than 1 of the minimum time between requests from the
-	// same client, so that the monitor does not get a 429 Too Many Requests
-	// response unnecessarily.
-	app.monitor = monitor.NewMonitor(app.infoLog, app.errorLog, time.Duration(app.configurations.TimeBetweenRequests)*6*time.Minute)
+	// The probes of the monitor authenticate with the monitor token, a random
+	// token is used if none was configured.
+	app.monitorToken = app.configurations.MonitorToken
+	if app.monitorToken == "" {
+		token, err := newMonitorToken()
+		if err != nil {
+			return fmt.Errorf("monitor could not be configured: %w", err)
+		}
+		app.monitorToken = token
+	}
+
+	// By default, the frequency with which the monitor will perform the
+	// health checks is a multiple bigger than 1 of the minimum time between
+	// requests, so that the first rate-limit probe of every run is not
+	// throttled by the probes of the previous run.
+	freq := time.Duration(app.configurations.MonitorFreq) * time.Minute
+	if freq <= 0 {
+		freq = time.Duration(app.configurations.TimeBetweenRequests) * 6 * time.Minute
+	} else if app.configurations.MonitorFreq <= app.configurations.TimeBetweenRequests {
+		app.errorLog.Printf("monitor: the health checks run every %v, which is not more than the min. time between requests. The rate-limit health check will fail.", freq)
+	}
+	app.monitor = monitor.NewMonitor(app.infoLog, app.errorLog, freq)
+	app.monitor.HistorySize = app.configurations.MonitorHistory
+	// Export the result of every run of the health checks.
+	app.monitor.OnResult = app.observeHealthCheck
+	if tz := app.configurations.MonitorTimezone; tz != "" {
+		location, err := time.LoadLocation(tz)
+		if err != nil {
+			return fmt.Errorf("monitor could not be configured due to invalid time zone: %w", err)
+		}
+		app.monitor.Location = location
+	}
 
 	if app.outboundIP == "" {
 		return fmt.Errorf("monitor could not be configured due to invalid outboundIP")
 	}
 	serverSessionURL := fmt.Sprintf("http://%s%s/session", app.outboundIP, app.configurations.HTTPAddr)
 	landingPage := fmt.Sprintf("http://%s%s/", app.outboundIP, app.configurations.HTTPAddr)
+	// probeHeader, authenticates the probes as requests of the monitor, so
+	// that they neither consume sessions nor the throttle of the host.
+	probeHeader := http.Header{}
+	probeHeader.Set(monitorTokenHeader, app.monitorToken)
 
 	// Create the health checks that will be performed.
-	// GET a session successfully.
-	sessionResource := monitor.APIResource{
+	// Probe that a session could be delivered, without taking it.
+	allocationResource := monitor.APIResource{
 		Method: "GET",
-		URL:    serverSessionURL,
+		URL:    fmt.Sprintf("%s?probe=%s", serverSessionURL, probeAllocation),
 		// Empty body.
 		ReqBody:            strings.NewReader(""),
+		Header:             probeHeader,
 		ExpectedStatusCode: 200,
 		ReqTimeout:         60 * time.Second,
 	}
-	// GET session request denied due to 'Too many requests' (429).
-	sessionResourceBlocked := monitor.APIResource{
+	// Probe the throttle with the identity of the monitor, the first probe
+	// passes.
+	rateLimitResource := monitor.APIResource{
 		Method: "GET",
-		URL:    serverSessionURL,
+		URL:    fmt.Sprintf("%s?probe=%s", serverSessionURL, probeRateLimit),
 		// Empty body.
 		ReqBody:            strings.NewReader(""),
-		ExpectedStatusCode: 429, // Too many requests.
+		Header:             probeHeader,
+		ExpectedStatusCode: 200,
 		ReqTimeout:         60 * time.Second,
 	}
+	// A subsequent probe is denied due to 'Too many requests' (429).
+	rateLimitResourceBlocked := rateLimitResource
+	rateLimitResourceBlocked.ReqBody = strings.NewReader("")
+	rateLimitResourceBlocked.ExpectedStatusCode = 429 // Too many requests.
 
 	// GET the landing page successfully.
 	landingPageResource := monitor.APIResource{
@@ -105,38 +148,183 @@ func (app *application) setupMonitor() error {
 	}
 
 	h1 := monitor.HealthCheck{
-		Name:        "GET session",
-		Description: "Check if it is possible to GET a new session. Afterwards, check if a subsequent GET request for a session gets denied with a 429 response.",
-		Check: func() error {
-			if err := app.monitor.PingHTTPService(sessionResource); err != nil {
-				return err
-			}
-			// Sleep and try the same resource. It should deliver a 429
-			// (Too Many Requests) response.
-			time.Sleep(3 * time.Second)
-			if err := app.monitor.PingHTTPService(sessionResourceBlocked); err != nil {
-				return err
-			}
-
-			return nil
+		Name:        "Session allocation",
+		Description: "Check if smd could deliver a session right now (the max. amount of active sessions has not been reached and there are available sessions), without taking a session.",
+		Check: func(ctx context.Context) error {
+			return app.monitor.PingHTTPService(ctx, allocationResource)
 		},
+		Timeout: 60 * time.Second,
+		// The pool may be empty for a moment, e.g. while scd replaces the
+		// session of the SSH health check.
+		Retries:    1,
+		RetryDelay: 5 * time.Second,
 	}
 	// Add health check to slice with all health checks.
 	app.monitor.HealthChecks = append(app.monitor.HealthChecks, h1)
 
 	h2 := monitor.HealthCheck{
+		Name:        "Rate limiting",
+		Description: "Check if a request for a session of the monitor passes the throttle of smd, and if a subsequent request gets denied with a 429 response. The monitor is throttled on its own, not on the IP address of the host.",
+		// Not retried, a retry would be throttled by the probes of the
+		// failed attempt.
+		Check: func(ctx context.Context) error {
+			if err := app.monitor.PingHTTPService(ctx, rateLimitResource); err != nil {
+				return err
+			}
+			return app.monitor.PingHTTPService(ctx, rateLimitResourceBlocked)
+		},
+		Timeout: 60 * time.Second,
+	}
+	// Add health check to slice with all health checks.
+	app.monitor.HealthChecks = append(app.monitor.HealthChecks, h2)
+
+	h3 := monitor.HealthCheck{
 		Name:        "GET landing page '/'",
 		Description: "Check if it is possible to GET the landing page of the server.",
-		Check: func() error {
-			if err := app.monitor.PingHTTPService(landingPageResource); err != nil {
+		Check: func(ctx context.Context) error {
+			if err := app.monitor.PingHTTPService(ctx, landingPageResource); err != nil {
 				return err
 			}
 
 			return nil
 		},
+		Timeout:    60 * time.Second,
+		Retries:    1,
+		RetryDelay: 5 * time.Second,
 	}
 	// Add health check to slice with all health checks.
-	app.monitor.HealthChecks = append(app.monitor.HealthChecks, h2)
+	app.monitor.HealthChecks = append(app.monitor.HealthChecks, h3)
+
+	// Log into a session through the SSH reverse proxy and run a command.
+	hostKeyCallback, hostKeyErr := app.sshHostKeyCallback(sshHostKey + ".pub")
+	if hostKeyErr != nil {
+		app.errorLog.Printf("monitor: the SSH health check fails, since it cannot verify the host key of the SSH reverse proxy: %v", hostKeyErr)
+	}
+	sshResource := monitor.SSHResource{
+		Addr:            net.JoinHostPort(app.outboundIP, app.configurations.SSHPort),
+		Command:         "echo " + sshHealthCheckOutput,
+		ExpectedOutput:  sshHealthCheckOutput,
+		Timeout:         30 * time.Second,
+		HostKeyCallback: hostKeyCallback,
+	}
+	h4 := monitor.HealthCheck{
+		Name:        "SSH login",
+		Description: "Check if it is possible to log into an available session through the SSH reverse proxy and run a command in it. The session is terminated afterwards.",
+		// Not retried, every attempt terminates an available session.
+		Check: func(ctx context.Context) error {
+			// Never log in without verifying the host key, the password of
+			// the session would be sent to whoever answers.
+			if hostKeyErr != nil {
+				return hostKeyErr
+			}
+			return app.monitor.PingSSHService(ctx, sshResource, app.acquireHealthCheckSession)
+		},
+		Timeout: 30 * time.Second,
+	}
+	// Add health check to slice with all health checks.
+	app.monitor.HealthChecks = append(app.monitor.HealthChecks, h4)
+
+	// Add the health checks and notifiers of the configuration file.
+	if app.configurations.MonitorConfig != "" {
+		if err := app.configureMonitor(app.configurations.MonitorConfig); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+// configureMonitor, adds the health checks and notifiers of the configuration
+// file at path to the monitor.
+func (app *application) configureMonitor(path string) error {
+	config, err := monitor.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	for _, def := range config.Checks {
+		for _, hc := range app.monitor.HealthChecks {
+			if hc.Name == def.Name {
+				return fmt.Errorf("health check '%s' of %s has the name of a built-in health check", def.Name, path)
+			}
+		}
+		hc, err := app.monitor.HealthCheck(def, app.containerRunning)
+		if err != nil {
+			return fmt.Errorf("error configuring health check of %s: %w", path, err)
+		}
+		app.monitor.HealthChecks = append(app.monitor.HealthChecks, hc)
+	}
+	for _, def := range config.Notifiers {
+		n, err := def.Notifier()
+		if err != nil {
+			return fmt.Errorf("error configuring notifier of %s: %w", path, err)
+		}
+		app.monitor.Notifiers = append(app.monitor.Notifiers, n)
+	}
+	app.infoLog.Printf("monitor: %d health checks and %d notifiers configured in %s.", len(config.Checks), len(config.Notifiers), path)
 	return nil
 }
+
+// containerRunning, reports whether the container with the given name or ID
+// runs in the local container engine. Used by the Docker health checks.
+func (app *application) containerRunning(ctx context.Context, name string) (bool, error) {
+	containers, err := app.runtime.ListContainers(ctx, true)
+	if err != nil {
+		return false, fmt.Errorf("error listing the containers: %w", err)
+	}
+	for _, c := range containers {
+		match := c.ID == name || (len(name) >= 12 && strings.HasPrefix(c.ID, name))
+		for _, n := range c.Names {
+			match = match || strings.TrimPrefix(n, "/") == name
+		}
+		if match {
+			return c.State == "running", nil
+		}
+	}
+	return false, nil
+}
+
+// sshHostKeyCallback, returns the callback used by the SSH health check to
+// verify the host key of the SSH reverse proxy, which uses the RSA host key of
+// the host, whose public key is at path. If the public key cannot be read, an
+// error is returned, unless the user explicitly opted out of the verification
+// (MonitorInsecureSSH).
+func (app *application) sshHostKeyCallback(path string) (ssh.HostKeyCallback, error) {
+	pub, err := os.ReadFile(path)
+	if err == nil {
+		var key ssh.PublicKey
+		if key, _, _, _, err = ssh.ParseAuthorizedKey(pub); err == nil {
+			return ssh.FixedHostKey(key), nil
+		}
+	}
+	if app.configurations.MonitorInsecureSSH {
+		app.errorLog.Printf("monitor: unable to read the SSH host key, the SSH health check does not verify the host key of the SSH reverse proxy (monitorInsecureSSH): %v", err)
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	return nil, fmt.Errorf("error reading the SSH host key %s: %w", path, err)
+}
+
+// acquireHealthCheckSession, takes a session out of the available sessions
+// for the SSH health check. The session is never delivered to a client, it is
+// terminated once the health check is done with it, so that it does not
+// consume capacity (scd creates a new available session instead).
+func (app *application) acquireHealthCheckSession() (monitor.SSHSession, error) {
+	var ss session
+	select {
+	case ss = <-app.sm.availableSessions:
+		prometheus.DecrementGauge(app.instrumentation, "available_sessions_total")
+	default:
+		return monitor.SSHSession{}, ERR_NO_AVAILABLE
+	}
+	return monitor.SSHSession{
+		Username: ss.username,
+		Password: ss.password,
+		Release: func() error {
+			if err := app.stopSession(ss); err != nil {
+				app.sessionLog(ss).Errorf("monitor: unable to stop session of the SSH health check: %v", err)
+				return err
+			}
+			app.auditSession(audit.EventTerminated, ss, "monitord", map[string]string{"reason": "health check"})
+			return nil
+		},
+	}, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	monitor "github.com/erodrigufer/pongo/internal/APIMonitor"
+	"golang.org/x/crypto/ssh"
+)
+
+// getJSON, sends a GET request to target and decodes the JSON body of the
+// response into v. It returns the status code of the response.
+func getJSON(t *testing.T, app *application, target string, v interface{}) int {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, r)
+	if err := json.NewDecoder(rr.Body).Decode(v); err != nil {
+		t.Fatalf("error: could not decode the response of %s: %v", target, err)
+	}
+	return rr.Code
+}
+
+// checkStatus, returns the status of the check name in checks.
+func checkStatus(checks []readinessCheckResponse, name string) string {
+	for _, c := range checks {
+		if c.Name == name {
+			return c.Status
+		}
+	}
+	return ""
+}
+
+// TestReadyz, tests that the application is only ready if the container
+// engine is reachable, the SSH reverse proxy is running and there are
+// available sessions.
+func TestReadyz(t *testing.T) {
+	app, fake := newTestApplication(t, testConfiguration())
+
+	var resp readinessResponse
+	if code := getJSON(t, app, "/readyz", &resp); code != http.StatusServiceUnavailable || resp.Status != statusFail {
+		t.Errorf("error: ready without available sessions (%d, %s)", code, resp.Status)
+	}
+	if status := checkStatus(resp.Checks, "session_pool"); status != statusFail {
+		t.Errorf("error: session_pool check = %s, want %s", status, statusFail)
+	}
+
+	ss, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	app.sm.availableSessions <- ss
+	resp = readinessResponse{}
+	if code := getJSON(t, app, "/readyz", &resp); code != http.StatusOK || resp.Status != statusPass {
+		t.Errorf("error: not ready (%d): %+v", code, resp.Checks)
+	}
+
+	fake.Fail("Version", errors.New("connection refused"))
+	resp = readinessResponse{}
+	if code := getJSON(t, app, "/readyz", &resp); code != http.StatusServiceUnavailable {
+		t.Errorf("error: ready with an unreachable container engine (%d)", code)
+	}
+	if status := checkStatus(resp.Checks, "docker"); status != statusFail {
+		t.Errorf("error: docker check = %s, want %s", status, statusFail)
+	}
+	fake.Fail("Version", nil)
+
+	timeout := time.Duration(0)
+	if err := fake.StopContainer(context.Background(), app.sshPiperContainerID, &timeout); err != nil {
+		t.Fatalf("error: could not stop the SSH reverse proxy: %v", err)
+	}
+	resp = readinessResponse{}
+	getJSON(t, app, "/readyz", &resp)
+	if status := checkStatus(resp.Checks, "sshpiper"); status != statusFail {
+		t.Errorf("error: sshpiper check = %s, want %s", status, statusFail)
+	}
+
+	var live map[string]string
+	if code := getJSON(t, app, "/livez", &live); code != http.StatusOK || live["status"] != statusPass {
+		t.Errorf("error: not live (%d, %v)", code, live)
+	}
+}
+
+// TestHealthcheckJSON, tests the JSON output of /healthcheck before and after
+// the first run of monitord.
+func TestHealthcheckJSON(t *testing.T) {
+	app, _ := newTestApplication(t, testConfiguration())
+	logger := log.New(io.Discard, "", 0)
+	app.monitor = monitor.NewMonitor(logger, logger, time.Hour)
+	app.monitor.HealthChecks = append(app.monitor.HealthChecks,
+		monitor.HealthCheck{Name: "ok", Check: func(ctx context.Context) error { return nil }},
+		monitor.HealthCheck{Name: "broken", Check: func(ctx context.Context) error { return errors.New("boom") }},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.monitor.CurrentHealth(ctx)
+
+	var resp healthResponse
+	if code := getJSON(t, app, "/healthcheck?format=json", &resp); code != http.StatusOK || resp.Status != statusPending {
+		t.Errorf("error: /healthcheck before the first run of monitord = (%d, %s), want (200, %s)", code, resp.Status, statusPending)
+	}
+
+	go app.monitor.Daemon(ctx)
+	var code int
+	waitFor(t, "the first run of monitord", func() bool {
+		resp = healthResponse{}
+		code = getJSON(t, app, "/healthcheck?format=json", &resp)
+		return resp.Status != statusPending
+	})
+	if code != http.StatusServiceUnavailable || resp.Status != statusFail {
+		t.Errorf("error: /healthcheck with a failing check = (%d, %s)", code, resp.Status)
+	}
+	if len(resp.Checks) != 2 {
+		t.Fatalf("error: %d checks, want 2", len(resp.Checks))
+	}
+	if ok := resp.Checks[0]; ok.Status != statusPass || ok.LastSuccess == nil {
+		t.Errorf("error: passing check = %+v", ok)
+	}
+	if broken := resp.Checks[1]; broken.Status != statusFail || broken.Error != "boom" || broken.LastSuccess != nil {
+		t.Errorf("error: failing check = %+v", broken)
+	}
+	if resp.Checks[0].UptimePercent != 100 || resp.Checks[1].UptimePercent != 0 || resp.Checks[0].History != nil {
+		t.Errorf("error: uptime of the checks = %v and %v, want 100 and 0 (without history)", resp.Checks[0].UptimePercent, resp.Checks[1].UptimePercent)
+	}
+	resp = healthResponse{}
+	getJSON(t, app, "/healthcheck?format=json&history=true", &resp)
+	if len(resp.Checks) != 2 || len(resp.Checks[1].History) == 0 || resp.Checks[1].History[0].Error != "boom" {
+		t.Errorf("error: history of the checks = %+v", resp.Checks)
+	}
+
+	app.appState.monitorConfigErr = errors.New("no outbound IP")
+	var errResp map[string]string
+	if code := getJSON(t, app, "/healthcheck?format=json", &errResp); code != http.StatusServiceUnavailable {
+		t.Errorf("error: /healthcheck without monitord = %d, want 503", code)
+	}
+}
+
+// TestHealthCheckSession, tests that the SSH health check takes an available
+// session and terminates it afterwards, giving its capacity back.
+func TestHealthCheckSession(t *testing.T) {
+	app, fake := newTestApplication(t, testConfiguration())
+
+	if _, err := app.acquireHealthCheckSession(); !errors.Is(err, ERR_NO_AVAILABLE) {
+		t.Errorf("error: acquired a session without available sessions (%v)", err)
+	}
+
+	ss, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	app.sm.availableSessions <- ss
+
+	hc, err := app.acquireHealthCheckSession()
+	if err != nil {
+		t.Fatalf("error: could not acquire session: %v", err)
+	}
+	if hc.Username != ss.username || hc.Password != ss.password {
+		t.Errorf("error: acquired credentials %s, want the credentials of %s", hc.Username, ss.username)
+	}
+	if len(app.sm.availableSessions) != 0 {
+		t.Error("error: the session of the health check is still available")
+	}
+
+	if err := hc.Release(); err != nil {
+		t.Fatalf("error: could not release session: %v", err)
+	}
+	for _, id := range ss.containersIDs {
+		if c, ok := fake.Container(id); ok && c.Running {
+			t.Errorf("error: container %s of the health check session is still running", id)
+		}
+	}
+	for _, status := range app.engines.Status() {
+		if status.Sessions != 0 {
+			t.Errorf("error: engine %s still holds %d sessions", status.Name, status.Sessions)
+		}
+	}
+}
+
+// TestSSHHostKeyCallback, tests that the SSH health check only verifies the
+// host key of the SSH reverse proxy with the public host key of the host, and
+// that it only skips the verification if the user opted out of it.
+func TestSSHHostKeyCallback(t *testing.T) {
+	app, _ := newTestApplication(t, testConfiguration())
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	hostKey, otherKey := newKey(), newKey()
+	path := filepath.Join(t.TempDir(), "ssh_host_key.pub")
+	if err := os.WriteFile(path, ssh.MarshalAuthorizedKey(hostKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 50000}
+
+	callback, err := app.sshHostKeyCallback(path)
+	if err != nil {
+		t.Fatalf("error: could not read the host key: %v", err)
+	}
+	if err := callback("localhost:50000", addr, hostKey); err != nil {
+		t.Errorf("error: the host key was rejected: %v", err)
+	}
+	if err := callback("localhost:50000", addr, otherKey); err == nil {
+		t.Errorf("error: another host key was accepted")
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.pub")
+	if _, err := app.sshHostKeyCallback(missing); err == nil {
+		t.Errorf("error: a missing host key does not fail the SSH health check")
+	}
+	app.configurations.MonitorInsecureSSH = true
+	callback, err = app.sshHostKeyCallback(missing)
+	if err != nil {
+		t.Fatalf("error: a missing host key fails the SSH health check despite the opt-out: %v", err)
+	}
+	if err := callback("localhost:50000", addr, otherKey); err != nil {
+		t.Errorf("error: the host key was verified despite the opt-out: %v", err)
+	}
+}
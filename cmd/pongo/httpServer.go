@@ -3,19 +3,27 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"time"
 
 	"github.com/bmizerany/pat"
 
-	monitor "github.com/erodrigufer/pongo/internal/APIMonitor"
+	"github.com/erodrigufer/pongo/internal/expiry"
 	dyntemplate "github.com/erodrigufer/pongo/internal/pongo/templates"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// retryAfterCapacity, amount of seconds a client is asked to wait (through the
+// Retry-After header) before requesting a session again, when no session could
+// be delivered due to a lack of capacity.
+const retryAfterCapacity = 60
+
 // declareHTTPServer, declares and configures an HTTP server.
 func (app *application) declareHTTPServer() {
 	mux := app.routes()
@@ -64,17 +72,45 @@ func (app *application) startHTTPServer() {
 // before returning a servemux, a mux used by an http.Server (an http.Handler).
 func (app *application) routes() http.Handler {
 
-	// Use the pat.New() function to initialize a new servemux.
-	mux := pat.New()
+	// Use the pat.New() function to initialize a new servemux, which records
+	// the route of every request for the Prometheus metrics.
+	mux := routeMux{pat.New()}
 
 	mux.Get("/", http.HandlerFunc(app.index))
 
 	// Create routing for healthcheck function to check uptime/status of server.
 	mux.Get("/healthcheck", http.HandlerFunc(app.healthcheck))
 
+	// Create routing for the liveness and readiness probes of load balancers
+	// and service managers.
+	mux.Get("/livez", http.HandlerFunc(app.livez))
+	mux.Get("/readyz", http.HandlerFunc(app.readyz))
+
 	// Create routing to request a session.
 	mux.Get("/session", http.HandlerFunc(app.sessionFrontend))
 
+	// Create routing to extend the lifetime of an active session, either from
+	// the session page or through the JSON API.
+	mux.Post("/session/extend", http.HandlerFunc(app.extendSessionFrontend))
+	mux.Post("/api/session/extend", http.HandlerFunc(app.extendSessionAPI))
+
+	// Create routing to submit a flag from an active session, the flag is
+	// recorded in the audit log.
+	mux.Post("/api/session/flag", http.HandlerFunc(app.submitFlagAPI))
+
+	// Create routing for the admin view, only if an admin password is
+	// configured.
+	if app.configurations.AdminPassword != "" {
+		mux.Get("/admin/sessions", app.requireAdmin(http.HandlerFunc(app.adminSessions)))
+		mux.Post("/admin/sessions/:name/terminate", app.requireAdmin(http.HandlerFunc(app.adminTerminateSession)))
+	}
+
+	// Create routing for the Prometheus metrics, only if they are not served
+	// by their own HTTP server.
+	if app.metricsHandler != nil {
+		mux.Get("/metrics", app.metricsHandler)
+	}
+
 	// Create a handler/fileServer for all files in the static directory
 	// Type Dir implements the interface required by FileServer and makes the
 	// code portable by using the native file system (which could be different
@@ -93,10 +129,11 @@ func (app *application) routes() http.Handler {
 
 	// chain of middlewares being executed before the mux, e.g.
 	// a defer function to recover from a panic from within a client's connec.
-	// (the go routine for the client), a logger for all requests and then
+	// (the go routine for the client), a span and a logger for all requests and
+	// then
 	// secureHeaders executes its instructions and then returns the next http
 	// Handler in the chain of events, in this case the mux.
-	return app.recoverPanic(app.logRequest(app.prometheusMiddleware(secureHeaders(mux))))
+	return app.recoverPanic(app.requestID(app.traceRequests(app.logRequest(app.prometheusMiddleware(secureHeaders(mux))))))
 }
 
 // index, handler used to render the main landing page.
@@ -107,28 +144,13 @@ func (app *application) index(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// healthcheck, status check or uptime monitor of server.
-func (app *application) healthcheck(w http.ResponseWriter, r *http.Request) {
-	// Create a response channel through which this function will get a
-	// response from the monitord daemon.
-	respCh := make(chan monitor.MonitorResp)
-	req := monitor.ClientReq{
-		RespCh: respCh,
-	}
-	// Send request for the most current health checks.
-	app.monitor.Requests <- req
-	response := <-respCh
-	if response.Errors != nil {
-		app.serverError(w, fmt.Errorf("Error received from monitord, could not retrieve monitor information."))
-		return
-	}
-
+// adminSessions, shows every active session with its resource usage to the
+// administrator.
+func (app *application) adminSessions(w http.ResponseWriter, r *http.Request) {
 	dynamicData := &dyntemplate.TemplateData{}
-	// Pass the health check results to the template's dynamic data.
-	dynamicData.HealthCheckResults = response.HealthChecksResults
+	dynamicData.AdminSessions = app.usageViews()
 	// Render page.
-	app.render(w, r, "healthcheck.page.tmpl", dynamicData)
-
+	app.render(w, r, "admin.page.tmpl", dynamicData)
 }
 
 // sessionFrontend, requests a new session from the session manager, and sends
@@ -142,9 +164,36 @@ func (app *application) sessionFrontend(w http.ResponseWriter, r *http.Request)
 	// not receive an error and retries to get a session.
 	// TLDR: the timeout here should be smaller than the IdleTimeout and
 	// WriteTimeout of the HTTP server.
-	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	// The span of the request is kept, so that the handoff to smd is part of
+	// the trace of the request.
+	// Synthetic requests of the health monitor (probes) carry the monitor
+	// token, they are answered by smd without delivering a session.
+	p, err := app.requestProbe(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ERR_INVALID_MONITOR_TOKEN) {
+			status = http.StatusForbidden
+		}
+		app.writeJSONError(w, status, err)
+		return
+	}
+	// The snapshots of the participant are stored under its participant
+	// token, probes do not belong to any participant.
+	var participant string
+	if p == probeNone {
+		participant, err = app.participantIdentity(w, r)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(trace.ContextWithSpan(context.Background(), trace.SpanFromContext(r.Context())), 8*time.Second)
 	defer cancel()
-	ss, err := app.requestSession(ctx, r)
+	ss, err := app.requestSession(ctx, r, p, participant)
+	if p != probeNone {
+		app.writeProbeResult(w, p, err)
+		return
+	}
 	if err != nil {
 		// Check if the client tried to get a new session in an amount of time
 		// shorter than the minimum permitted between requests.
@@ -155,20 +204,141 @@ func (app *application) sessionFrontend(w http.ResponseWriter, r *http.Request)
 			app.render(w, r, "timeRequestError.page.tmpl", &dyntemplate.TemplateData{})
 			return
 		}
+		// Check if the session could not be delivered due to a lack of
+		// capacity, either because the max. amount of active sessions has been
+		// reached or because no available sessions are ready yet.
+		if errors.Is(err, ERR_MAX_ACTIVE) || errors.Is(err, ERR_NO_AVAILABLE) {
+			app.infoLog.Print(err)
+			// Send a 503 Service Unavailable HTTP error, and hint the client
+			// when it is worth trying again.
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterCapacity))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			app.render(w, r, "capacityError.page.tmpl", &dyntemplate.TemplateData{})
+			return
+		}
 		app.serverError(w, err)
 		// An error occured, return from the handler to not send more data to
 		// the client.
 		return
 	}
-	app.infoLog.Printf("Session (%s) delivered to %s.", ss.name, r.RemoteAddr)
+	app.requestLog(r).WithFields(sessionFields(ss)).Info("Session delivered.")
 
 	dynamicData := &dyntemplate.TemplateData{
-		Username: ss.username,
-		Password: ss.password,
+		Username:         ss.username,
+		Password:         ss.password,
+		ExpiresAt:        ss.timeActivated.Add(ss.lifetime),
+		ExtensionsLeft:   app.configurations.MaxExtensions - ss.extensions,
+		MaxExtensionTime: app.configurations.MaxExtensionTime,
 	}
 	app.render(w, r, "session.page.tmpl", dynamicData)
 }
 
+// extendSessionFrontend, extends the lifetime of the active session whose
+// credentials are sent in the form of the session page, and renders the
+// session page again with the new expiration time.
+func (app *application) extendSessionFrontend(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	username := r.PostForm.Get("username")
+	password := r.PostForm.Get("password")
+
+	// The submitted password is only shown again once the extension
+	// succeeded, i.e. once it is known to be the password of the session.
+	dynamicData := &dyntemplate.TemplateData{
+		Username:         username,
+		MaxExtensionTime: app.configurations.MaxExtensionTime,
+	}
+
+	minutes, err := parseExtension(r.PostForm.Get("minutes"))
+	if err == nil {
+		var ss session
+		ss, dynamicData.ExpiresAt, err = app.extendSession(username, password, minutes)
+		dynamicData.ExtensionsLeft = app.configurations.MaxExtensions - ss.extensions
+	}
+	if err != nil {
+		status := extensionErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			app.serverError(w, err)
+			return
+		}
+		app.infoLog.Printf("Session extension requested by %s failed: %v", r.RemoteAddr, err)
+		dynamicData.Flash = err.Error()
+		w.WriteHeader(status)
+		app.render(w, r, "session.page.tmpl", dynamicData)
+		return
+	}
+	dynamicData.Password = password
+	dynamicData.Flash = fmt.Sprintf("The session was extended by %d minutes.", minutes)
+	app.render(w, r, "session.page.tmpl", dynamicData)
+}
+
+// extendSessionRequest, JSON body expected by the API endpoint used to extend
+// the lifetime of an active session.
+type extendSessionRequest struct {
+	// Username, SSH username of the session.
+	Username string `json:"username"`
+	// Password, SSH password of the session.
+	Password string `json:"password"`
+	// Minutes, amount of minutes by which the session should be extended.
+	Minutes int `json:"minutes"`
+}
+
+// extendSessionResponse, JSON body sent back by the API endpoint used to
+// extend the lifetime of an active session.
+type extendSessionResponse struct {
+	// ExpiresAt, new expiration time of the session.
+	ExpiresAt time.Time `json:"expires_at"`
+	// ExtensionsLeft, amount of times the session can still be extended.
+	ExtensionsLeft int `json:"extensions_left"`
+}
+
+// extendSessionAPI, extends the lifetime of the active session whose
+// credentials are sent in the JSON body of the request.
+func (app *application) extendSessionAPI(w http.ResponseWriter, r *http.Request) {
+	var req extendSessionRequest
+	// Limit the size of the body, it only contains a couple of short fields.
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		app.writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %w", err))
+		return
+	}
+
+	ss, expiresAt, err := app.extendSession(req.Username, req.Password, req.Minutes)
+	if err != nil {
+		status := extensionErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			app.errorLog.Print(err)
+		}
+		app.writeJSONError(w, status, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, extendSessionResponse{
+		ExpiresAt:      expiresAt,
+		ExtensionsLeft: app.configurations.MaxExtensions - ss.extensions,
+	})
+}
+
+// extensionErrorStatus, maps an error returned while extending a session to
+// the HTTP status code sent back to the client.
+func extensionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ERR_INVALID_EXTENSION):
+		return http.StatusBadRequest
+	case errors.Is(err, ERR_INVALID_CREDENTIALS):
+		return http.StatusForbidden
+	case errors.Is(err, ERR_MAX_EXTENSIONS):
+		return http.StatusConflict
+	case errors.Is(err, expiry.ErrNotScheduled):
+		return http.StatusGone
+	case errors.Is(err, ERR_MAX_ACTIVE):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // serverError, sends an error message and stack trace to the error logger and
 // then sends a generic 500 Internal Server Error response to the client.
 func (app *application) serverError(w http.ResponseWriter, err error) {
@@ -182,6 +352,27 @@ func (app *application) serverError(w http.ResponseWriter, err error) {
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
+// writeJSON, encodes v as JSON and sends it to the client with the given
+// status code.
+func (app *application) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	// Encode into a buffer first, so that no half-written JSON is sent to the
+	// client if the encoding fails.
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		app.serverError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// writeJSONError, sends an error to the client as a JSON object with the
+// given status code.
+func (app *application) writeJSONError(w http.ResponseWriter, status int, err error) {
+	app.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
 // clientError, sends a specific error status to the client.
 func (app *application) clientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/audit"
+	"github.com/erodrigufer/pongo/internal/expiry"
+	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
+)
+
+// iddFreq, frequency with which idd (idle detection daemon) probes the SSH
+// activity of all active sessions.
+const iddFreq = time.Minute
+
+// iddExecTimeout, max. time of every command that idd executes inside the
+// container of a session, so that a single hung exec does not stall the
+// idle detection of all sessions.
+const iddExecTimeout = 10 * time.Second
+
+// idleWarningMargin, time before an idle session is reclaimed, at which a
+// warning banner is written to the terminals of the user.
+const idleWarningMargin = 2 * time.Minute
+
+// sessionActivity, SSH activity observed by idd for a single active session.
+type sessionActivity struct {
+	// loggedIn, true if a user has logged into the session at least once.
+	loggedIn bool
+	// lastActivity, last time a user interacted with a terminal of the
+	// session.
+	lastActivity time.Time
+	// warned, true if the user was already warned that the session is about
+	// to be reclaimed due to inactivity.
+	warned bool
+}
+
+// idd, idle detection daemon periodically probes the SSH activity of every
+// active session, and reclaims the sessions in which no user logged in within
+// IdleLoginTimeout minutes after their activation, or which have been idle for
+// IdleTimeout minutes. A timeout equal to 0 disables that check.
+func (app *application) idd(ctx context.Context) {
+	loginTimeout := time.Minute * time.Duration(app.configurations.IdleLoginTimeout)
+	idleTimeout := time.Minute * time.Duration(app.configurations.IdleTimeout)
+	// activities, SSH activity of every active session, indexed by the name
+	// of the session. Only idd accesses this map.
+	activities := make(map[string]*sessionActivity)
+
+	ticker := time.NewTicker(iddFreq)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			break
+		case <-ctx.Done():
+			app.infoLog.Print("idd: shutting down.")
+			app.wg.Done()
+			return
+		}
+
+		app.detectIdleSessions(ctx, activities, loginTimeout, idleTimeout)
+	}
+}
+
+// detectIdleSessions, probes the SSH activity of every active session once,
+// and reclaims the sessions in which no user logged in within loginTimeout
+// after their activation, or which have been idle for idleTimeout. A timeout
+// equal to 0 disables that check. activities, SSH activity observed so far
+// for every active session, it is updated in place.
+func (app *application) detectIdleSessions(ctx context.Context, activities map[string]*sessionActivity, loginTimeout, idleTimeout time.Duration) {
+	active := make(map[string]bool)
+	for _, ss := range app.sm.activeSessions.list() {
+		active[ss.name] = true
+		act, ok := activities[ss.name]
+		if !ok {
+			act = &sessionActivity{lastActivity: ss.timeActivated}
+			activities[ss.name] = act
+		}
+
+		connected, lastInput, err := app.probeActivity(ctx, ss)
+		if err != nil {
+			app.sessionLog(ss).Errorf("idd: unable to probe activity of session: %v", err)
+			continue
+		}
+		if connected {
+			if !act.loggedIn {
+				app.sessionLog(ss).Info("idd: first SSH login into session detected.")
+				app.auditSession(audit.EventLogin, ss, "", nil)
+			}
+			act.loggedIn = true
+			if lastInput.After(act.lastActivity) {
+				act.lastActivity = lastInput
+			}
+		}
+
+		now := time.Now()
+		// No user ever logged into the session.
+		if !act.loggedIn {
+			if loginTimeout > 0 && now.Sub(ss.timeActivated) >= loginTimeout {
+				app.reclaimSession(ss, fmt.Sprintf("no SSH login within %v", loginTimeout), "")
+			}
+			continue
+		}
+
+		if idleTimeout <= 0 {
+			continue
+		}
+		idle := now.Sub(act.lastActivity)
+		if idle >= idleTimeout {
+			app.reclaimSession(ss, fmt.Sprintf("idle for %v", idle.Round(time.Second)), "")
+			continue
+		}
+		if idle < idleTimeout-idleWarningMargin {
+			// The user is active again, warn again if the session becomes
+			// idle once more.
+			act.warned = false
+			continue
+		}
+		if connected && !act.warned {
+			msg := fmt.Sprintf("[pongo] This session has been idle for %v and will be terminated in %v unless there is some activity.", idle.Round(time.Minute), (idleTimeout - idle).Round(time.Minute))
+			warnCtx, cancel := context.WithTimeout(ctx, iddExecTimeout)
+			err := app.writeToTerminals(warnCtx, app.sessionRuntime(ss), ss.containersIDs[0], msg)
+			cancel()
+			if err != nil {
+				app.sessionLog(ss).Errorf("idd: unable to warn idle session: %v", err)
+				continue
+			}
+			act.warned = true
+		}
+	}
+
+	// Forget the activity of the sessions that are not active anymore.
+	for name := range activities {
+		if !active[name] {
+			delete(activities, name)
+		}
+	}
+}
+
+// probeActivity, probes the SSH activity of a session by listing the
+// pseudo-terminals allocated inside the entrypoint container of the session.
+// sshd allocates a pseudo-terminal for every interactive SSH connection and
+// the access time of a pseudo-terminal is updated every time the user types
+// into it (the same approach used by `w` to compute the idle time of a user).
+// It returns true if at least one SSH connection is open, and the last time a
+// user typed into any of the open connections.
+func (app *application) probeActivity(ctx context.Context, ss session) (bool, time.Time, error) {
+	cmd := []string{
+		"find",
+		"/dev/pts",
+		"-mindepth", "1",
+		"-name", "[0-9]*",
+		"-printf", `%A@\n`,
+	}
+	ctx, cancel := context.WithTimeout(ctx, iddExecTimeout)
+	defer cancel()
+	result, err := app.runExecOutput(ctx, app.sessionRuntime(ss), ss.containersIDs[0], cmd)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	if result.ExitCode != 0 {
+		return false, time.Time{}, fmt.Errorf("error: probing pseudo-terminals failed with exit code %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	var lastInput time.Time
+	connected := false
+	for _, line := range strings.Fields(result.Stdout) {
+		// Access times are printed as seconds since the epoch with a
+		// fractional part.
+		secs, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("error: unable to parse access time of pseudo-terminal (%s): %w", line, err)
+		}
+		connected = true
+		if t := time.Unix(0, int64(secs*float64(time.Second))); t.After(lastInput) {
+			lastInput = t
+		}
+	}
+
+	return connected, lastInput, nil
+}
+
+// reclaimSession, stops an active session before its lifetime is over, e.g.
+// when the session has been abandoned by its user.
+// Parameters: ss, the session to reclaim. reason, why the session is
+// reclaimed (used for logging and auditing). actor, who reclaims the session
+// if it is not pongo itself (may be empty).
+// It returns expiry.ErrNotScheduled if srd is already expiring the session.
+func (app *application) reclaimSession(ss session, reason, actor string) error {
+	// If the session is not scheduled anymore, srd is already expiring it.
+	if !app.sm.expiry.Remove(ss.name) {
+		return expiry.ErrNotScheduled
+	}
+	app.snapshotActiveSession(ss)
+	if err := app.stopSession(ss); err != nil {
+		app.sessionLog(ss).Errorf("unable to reclaim session: %v", err)
+		// Let srd try to stop the session again later.
+		app.sm.expiry.Schedule(ss.name, time.Now().Add(time.Minute*time.Duration(app.configurations.SRDFreq)))
+		return err
+	}
+	app.sm.activeSessions.remove(ss.name)
+	app.unscheduleWarnings(ss.name)
+	prometheus.DecrementGauge(app.instrumentation, "active_sessions_total")
+	// Sessions are only reclaimed because they are idle or by an
+	// administrator.
+	termination := terminationIdle
+	if actor != "" {
+		termination = terminationAdmin
+	}
+	app.observeTermination(ss, termination)
+	app.auditSession(audit.EventTerminated, ss, actor, map[string]string{"reason": reason})
+	app.sessionLog(ss).Infof("Session reclaimed: %s.", reason)
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/backend"
+	dockerExec "github.com/erodrigufer/pongo/internal/docker/exec"
+	"github.com/erodrigufer/pongo/internal/expiry"
+)
+
+// activeSession, creates a session which was activated at activated and
+// tracks it as active, with its expiration scheduled.
+func activeSession(t *testing.T, app *application, activated time.Time) session {
+	t.Helper()
+	ss, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	ss.timeActivated = activated
+	if err := app.sm.activeSessions.add(ss); err != nil {
+		t.Fatalf("error: could not track session as active: %v", err)
+	}
+	app.scheduleExpiry(ss.name, ss.timeActivated.Add(ss.lifetime))
+	return ss
+}
+
+// ptsActivity, exec function of the fake runtime which answers the probes of
+// idd with the access time of a single pseudo-terminal per container (no
+// pseudo-terminal if a container has no entry), and records the warnings
+// written to the terminals.
+type ptsActivity struct {
+	mu sync.Mutex
+	// lastInput, access time of the pseudo-terminal of every container.
+	lastInput map[string]time.Time
+	// warned, containers to whose terminals a warning was written.
+	warned map[string]bool
+}
+
+func newPtsActivity() *ptsActivity {
+	return &ptsActivity{lastInput: make(map[string]time.Time), warned: make(map[string]bool)}
+}
+
+func (p *ptsActivity) exec(containerID string, cmd []string) (dockerExec.Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch cmd[0] {
+	case "find":
+		t, ok := p.lastInput[containerID]
+		if !ok {
+			return dockerExec.Result{}, nil
+		}
+		return dockerExec.Result{Stdout: fmt.Sprintf("%d.5\n", t.Unix())}, nil
+	case "sh":
+		p.warned[containerID] = true
+	}
+	return dockerExec.Result{}, nil
+}
+
+// active, reports whether a session is still active.
+func active(app *application, ss session) bool {
+	_, ok := app.sm.activeSessions.get(ss.name)
+	return ok
+}
+
+// TestIdleLoginTimeout, tests that idd reclaims the sessions into which no
+// user logged in within the login timeout.
+func TestIdleLoginTimeout(t *testing.T) {
+	app, fake := newTestApplication(t, testConfiguration())
+	pts := newPtsActivity()
+	fake.SetExecFunc(pts.exec)
+
+	abandoned := activeSession(t, app, time.Now().Add(-20*time.Minute))
+	fresh := activeSession(t, app, time.Now().Add(-5*time.Minute))
+	loggedIn := activeSession(t, app, time.Now().Add(-20*time.Minute))
+	pts.lastInput[loggedIn.containersIDs[0]] = time.Now()
+
+	activities := make(map[string]*sessionActivity)
+	app.detectIdleSessions(context.Background(), activities, 15*time.Minute, 0)
+
+	if active(app, abandoned) {
+		t.Errorf("error: session without SSH login was not reclaimed")
+	}
+	if _, ok := fake.Container(abandoned.containersIDs[0]); ok {
+		t.Errorf("error: container of reclaimed session still exists")
+	}
+	if _, ok := app.sm.expiry.Deadline(abandoned.name); ok {
+		t.Errorf("error: expiration of reclaimed session is still scheduled")
+	}
+	if !active(app, fresh) || !active(app, loggedIn) {
+		t.Errorf("error: session within the login timeout or with an SSH login was reclaimed")
+	}
+	if !activities[loggedIn.name].loggedIn {
+		t.Errorf("error: SSH login into session was not detected")
+	}
+	// The activity of the reclaimed session is forgotten in the next round.
+	app.detectIdleSessions(context.Background(), activities, 15*time.Minute, 0)
+	if _, ok := activities[abandoned.name]; ok {
+		t.Errorf("error: activity of reclaimed session is still tracked")
+	}
+}
+
+// TestIdleTimeout, tests that idd warns the users of sessions which are about
+// to be reclaimed due to inactivity, and reclaims them once the idle timeout
+// is over.
+func TestIdleTimeout(t *testing.T) {
+	app, fake := newTestApplication(t, testConfiguration())
+	pts := newPtsActivity()
+	fake.SetExecFunc(pts.exec)
+
+	activated := time.Now().Add(-time.Hour)
+	idle := activeSession(t, app, activated)
+	pts.lastInput[idle.containersIDs[0]] = time.Now().Add(-40 * time.Minute)
+	almostIdle := activeSession(t, app, activated)
+	pts.lastInput[almostIdle.containersIDs[0]] = time.Now().Add(-29 * time.Minute)
+	busy := activeSession(t, app, activated)
+	pts.lastInput[busy.containersIDs[0]] = time.Now()
+
+	activities := make(map[string]*sessionActivity)
+	app.detectIdleSessions(context.Background(), activities, 0, 30*time.Minute)
+
+	if active(app, idle) {
+		t.Errorf("error: idle session was not reclaimed")
+	}
+	if !active(app, almostIdle) || !active(app, busy) {
+		t.Fatalf("error: session within the idle timeout was reclaimed")
+	}
+	if !pts.warned[almostIdle.containersIDs[0]] || pts.warned[busy.containersIDs[0]] {
+		t.Errorf("error: warned containers %v, expected only the almost idle session", pts.warned)
+	}
+
+	// The user is warned only once, until it becomes active again.
+	pts.warned = make(map[string]bool)
+	app.detectIdleSessions(context.Background(), activities, 0, 30*time.Minute)
+	if pts.warned[almostIdle.containersIDs[0]] {
+		t.Errorf("error: user of almost idle session was warned twice")
+	}
+}
+
+// hungRuntime, container runtime whose execs never finish on their own. It
+// fails an exec without a deadline right away, so that the test never hangs.
+type hungRuntime struct {
+	*backend.Fake
+	mu sync.Mutex
+	// budgets, time left until the deadline of every exec.
+	budgets []time.Duration
+}
+
+func (rt *hungRuntime) Exec(ctx context.Context, containerID string, cmd []string) (dockerExec.Result, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return dockerExec.Result{}, errors.New("exec without deadline")
+	}
+	rt.mu.Lock()
+	rt.budgets = append(rt.budgets, time.Until(deadline))
+	rt.mu.Unlock()
+	// The exec hangs until its deadline.
+	return dockerExec.Result{}, context.DeadlineExceeded
+}
+
+// TestIdleProbeTimeout, tests that every probe of idd is bounded by a
+// timeout, so that a hung exec in one session does not stall the idle
+// detection of the other sessions.
+func TestIdleProbeTimeout(t *testing.T) {
+	app, fake := newTestApplication(t, testConfiguration())
+	hung := &hungRuntime{Fake: fake}
+	// The engine never receives new sessions, sessions are moved to it.
+	if err := app.engines.Add(backend.Node{Name: "hung", Runtime: hung}); err != nil {
+		t.Fatal(err)
+	}
+
+	stuck := activeSession(t, app, time.Now().Add(-20*time.Minute))
+	app.sm.activeSessions.remove(stuck.name)
+	stuck.engine = "hung"
+	if err := app.sm.activeSessions.add(stuck); err != nil {
+		t.Fatal(err)
+	}
+	abandoned := activeSession(t, app, time.Now().Add(-20*time.Minute))
+
+	app.detectIdleSessions(context.Background(), make(map[string]*sessionActivity), 15*time.Minute, 0)
+
+	if len(hung.budgets) != 1 || hung.budgets[0] <= 0 || hung.budgets[0] > iddExecTimeout {
+		t.Errorf("error: probes of the hung session had deadlines in %v, expected one within %v", hung.budgets, iddExecTimeout)
+	}
+	if !active(app, stuck) {
+		t.Errorf("error: session whose activity could not be probed was reclaimed")
+	}
+	if active(app, abandoned) {
+		t.Errorf("error: session without SSH login was not reclaimed after the probe of another session timed out")
+	}
+}
+
+// TestReclaimSession, tests that a session which srd is already expiring is
+// not reclaimed, and that a session which cannot be stopped is left to srd.
+func TestReclaimSession(t *testing.T) {
+	app, fake := newTestApplication(t, testConfiguration())
+
+	expiring := activeSession(t, app, time.Now())
+	app.sm.expiry.Remove(expiring.name)
+	if err := app.reclaimSession(expiring, "test", ""); !errors.Is(err, expiry.ErrNotScheduled) {
+		t.Errorf("error: reclaiming a session which srd is expiring returned %v, expected ErrNotScheduled", err)
+	}
+	if !active(app, expiring) {
+		t.Errorf("error: session which srd is expiring was reclaimed")
+	}
+
+	failing := activeSession(t, app, time.Now())
+	fake.Fail("StopContainer", errors.New("stop failed"))
+	if err := app.reclaimSession(failing, "test", ""); err == nil {
+		t.Fatalf("error: reclaiming a session which cannot be stopped did not fail")
+	}
+	if !active(app, failing) {
+		t.Errorf("error: session which could not be stopped is not active anymore")
+	}
+	deadline, ok := app.sm.expiry.Deadline(failing.name)
+	if !ok || deadline.After(time.Now().Add(time.Duration(app.configurations.SRDFreq)*time.Minute)) {
+		t.Errorf("error: srd does not retry to stop the session (deadline %v, scheduled %v)", deadline, ok)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	dockerBuild "github.com/erodrigufer/pongo/internal/docker/build"
+	dockerImage "github.com/erodrigufer/pongo/internal/docker/image"
+	"github.com/erodrigufer/pongo/internal/pongo"
+)
+
+// ensureImages, makes sure that all the Docker images used by the application
+// are available in the Docker host, building them from their build context or
+// pulling them from a registry if necessary. The resolved digest of every
+// image is logged and stored, so that it can be shown in /healthcheck.
+func (app *application) ensureImages() error {
+	specs := []pongo.ImageSpec{
+		app.configurations.ChallengeImage,
+		app.configurations.SSHPiperImage,
+	}
+
+	auth := app.registryAuth()
+	timeout := time.Minute * time.Duration(app.configurations.BuildTimeout)
+
+	app.images.resolved = nil
+	for _, spec := range specs {
+		if spec.Context != "" {
+			app.infoLog.Printf("Building Docker image %s from %s, this step can take up to several minutes.", spec.Name, spec.Context)
+		} else if spec.Ref != "" {
+			app.infoLog.Printf("Pulling Docker image %s from %s.", spec.Name, spec.Ref)
+		}
+		resolved, err := app.ensureImage(app.client, spec, auth, timeout)
+		if err != nil {
+			return err
+		}
+		app.infoLog.Printf("Docker image %s (%s) resolved to %s.", resolved.Name, resolved.Source, resolved.Digest)
+		app.images.resolved = append(app.images.resolved, resolved)
+	}
+
+	return nil
+}
+
+// registryAuth, returns the credentials used to pull images from a registry,
+// or nil if no credentials were configured.
+func (app *application) registryAuth() *dockerImage.RegistryAuth {
+	if app.configurations.RegistryUser == "" {
+		return nil
+	}
+	return &dockerImage.RegistryAuth{
+		Username:      app.configurations.RegistryUser,
+		Password:      app.configurations.RegistryPassword,
+		ServerAddress: app.configurations.RegistryServer,
+	}
+}
+
+// ensureImage, makes a single Docker image available in the Docker host of
+// engineClient.
+func (app *application) ensureImage(engineClient *client.Client, spec pongo.ImageSpec, auth *dockerImage.RegistryAuth, timeout time.Duration) (dockerImage.Resolved, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	imageSpec := dockerImage.Spec{
+		Name:         spec.Name,
+		Context:      spec.Context,
+		Ref:          spec.Ref,
+		Digest:       spec.Digest,
+		Auth:         auth,
+		BuildTimeout: timeout,
+		OnEvent: func(event dockerBuild.Event) {
+			app.logBuildEvent(spec.Name, event)
+		},
+	}
+	if app.configurations.BuildLogDir != "" {
+		if err := os.MkdirAll(app.configurations.BuildLogDir, 0750); err != nil {
+			return dockerImage.Resolved{}, fmt.Errorf("error creating directory for build logs: %w", err)
+		}
+		imageSpec.BuildLog = buildLogPath(app.configurations.BuildLogDir, spec.Name)
+	}
+
+	resolved, err := dockerImage.Ensure(ctx, engineClient, imageSpec)
+	if err != nil {
+		var buildErr *dockerBuild.BuildError
+		if errors.As(err, &buildErr) && imageSpec.BuildLog != "" {
+			app.errorLog.Printf("build of Docker image %s failed at '%s', the full build log is available at %s.", spec.Name, buildErr.Step, imageSpec.BuildLog)
+		}
+		return resolved, fmt.Errorf("error preparing Docker image %s: %w", spec.Name, err)
+	}
+	return resolved, nil
+}
+
+// logBuildEvent, logs an event of the build or pull of a Docker image in the
+// debug log. Progress events are not logged, since there can be thousands of
+// them for a single layer.
+func (app *application) logBuildEvent(image string, event dockerBuild.Event) {
+	switch event.Kind {
+	case dockerBuild.EventProgress:
+		return
+	case dockerBuild.EventError:
+		app.errorLog.Printf("build of %s: %s", image, event.Message)
+	case dockerBuild.EventLayer:
+		app.debugLog.Printf("build of %s: [%s] %s %s", image, event.Kind, event.Layer, event.Message)
+	default:
+		app.debugLog.Printf("build of %s: [%s] %s", image, event.Kind, event.Message)
+	}
+}
+
+// buildLogPath, path of the file in which the build log of an image is saved.
+func buildLogPath(dir, image string) string {
+	name := strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(image)
+	return filepath.Join(dir, "build-"+name+".log")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/erodrigufer/pongo/internal/logging"
+	"github.com/erodrigufer/pongo/internal/tracing"
+	"github.com/sirupsen/logrus"
+)
+
+// setupLoggers, creates the structured logger of the application, which
+// writes to out in the configured format, and the info, error and debug
+// loggers that log through it.
+func (app *application) setupLoggers(out io.Writer) error {
+	logger, err := logging.New(out, app.configurations.LogFormat, app.configurations.DebugMode)
+	if err != nil {
+		return err
+	}
+	// Log entries with a context (see logrus.Entry.WithContext) get the IDs
+	// of the span carried by the context.
+	logger.AddHook(tracing.LogHook{})
+	app.logger = logger
+	entry := logrus.NewEntry(logger)
+	app.infoLog = logging.NewStdLogger(entry, logrus.InfoLevel, false)
+	// The error and debug loggers add the file and line number from which a
+	// message was logged.
+	app.errorLog = logging.NewStdLogger(entry, logrus.ErrorLevel, true)
+	app.debugLog = logging.NewStdLogger(entry, logrus.DebugLevel, true)
+	return nil
+}
+
+// sessionFields, fields which identify a session in the logs. The password
+// of the session is never logged.
+func sessionFields(ss session) logrus.Fields {
+	fields := logrus.Fields{"session": ss.name}
+	if ss.challenge != "" {
+		fields["challenge"] = ss.challenge
+	}
+	if ss.engine != "" {
+		fields["engine"] = ss.engine
+	}
+	if ss.owner != "" {
+		fields["owner"] = ss.owner
+	}
+	return fields
+}
+
+// sessionLog, returns a log entry for messages about a session.
+func (app *application) sessionLog(ss session) *logrus.Entry {
+	return app.logger.WithFields(sessionFields(ss))
+}
+
+// requestLog, returns a log entry for messages about an HTTP request, with
+// the ID of the request, the address of the client and the IDs of the span of
+// the request.
+func (app *application) requestLog(r *http.Request) *logrus.Entry {
+	return app.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"request_id":  logging.RequestID(r.Context()),
+		"remote_addr": r.RemoteAddr,
+	})
+}
+
+// validRequestID, request IDs accepted from a reverse proxy in front of
+// pongo. Other values are replaced, so that clients cannot forge log lines.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID, assigns an ID to every request, which is added to every log line
+// about the request and sent back to the client in the X-Request-ID header.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logging.RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, id)
+
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
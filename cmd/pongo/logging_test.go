@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/logging"
+)
+
+// TestSessionLogs, tests that the log lines about a session carry the name of
+// the session and never its password.
+func TestSessionLogs(t *testing.T) {
+	configValues := testConfiguration()
+	configValues.LogFormat = logging.FormatJSON
+	app, _ := newTestApplication(t, configValues)
+	buf := new(bytes.Buffer)
+	app.logger.SetOutput(buf)
+
+	ss, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	if strings.Contains(buf.String(), ss.password) {
+		t.Errorf("error: password of the session was logged: %s", buf.String())
+	}
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("error: log line is not JSON: %s", line)
+		}
+		if entry["msg"] == "New session created." {
+			found = true
+			if entry["session"] != ss.name || entry["level"] != "info" {
+				t.Errorf("error: unexpected log entry: %v", entry)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("error: creation of the session was not logged: %s", buf.String())
+	}
+}
+
+// TestSessionStopFailureLogs, tests that a session which cannot be stopped is
+// logged as an error which carries the name of the session.
+func TestSessionStopFailureLogs(t *testing.T) {
+	configValues := testConfiguration()
+	configValues.LogFormat = logging.FormatJSON
+	app, fake := newTestApplication(t, configValues)
+	ss := activeSession(t, app, time.Now())
+	buf := new(bytes.Buffer)
+	app.logger.SetOutput(buf)
+
+	fake.Fail("StopContainer", errors.New("stop failed"))
+	app.expireSession(ss.name, time.Now())
+	app.stopAllSessions()
+
+	logged := 0
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("error: log line is not JSON: %s", line)
+		}
+		// The reverse proxy cannot be stopped either, it is not a session.
+		if msg, _ := entry["msg"].(string); strings.Contains(msg, "stop failed") && !strings.Contains(msg, "SSH Piper") {
+			logged++
+			if entry["session"] != ss.name || entry["level"] != "error" {
+				t.Errorf("error: unexpected log entry: %v", entry)
+			}
+		}
+	}
+	// Once by srd, once at shutdown.
+	if logged != 2 {
+		t.Errorf("error: the failure to stop the session was logged %d times, expected 2: %s", logged, buf.String())
+	}
+}
+
+// TestRequestIDMiddleware, tests that every request gets an ID which is sent
+// back to the client and added to the log lines about the request.
+func TestRequestIDMiddleware(t *testing.T) {
+	configValues := testConfiguration()
+	configValues.LogFormat = logging.FormatJSON
+	app, _ := newTestApplication(t, configValues)
+	buf := new(bytes.Buffer)
+	app.logger.SetOutput(buf)
+	handler := app.requestID(app.logRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"generated", "", false},
+		{"from reverse proxy", "abc-123", true},
+		{"forged", "x\n{\"level\":\"error\"}", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set(logging.RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			id := w.Header().Get(logging.RequestIDHeader)
+			if id == "" || (tt.keep && id != tt.header) || (!tt.keep && id == tt.header) {
+				t.Errorf("error: request ID is %q (header: %q)", id, tt.header)
+			}
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("error: log line is not JSON: %s", buf.String())
+			}
+			if entry["request_id"] != id {
+				t.Errorf("error: log entry has request ID %v, expected %s", entry["request_id"], id)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	monitor "github.com/erodrigufer/pongo/internal/APIMonitor"
+	"github.com/erodrigufer/pongo/internal/backend"
+	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
+)
+
+// Reasons why an active session is stopped, as counted in
+// session_terminations_total.
+const (
+	// terminationExpired, the lifetime of the session was over.
+	terminationExpired = "expired"
+	// terminationIdle, the session was reclaimed because it was idle.
+	terminationIdle = "idle"
+	// terminationAdmin, the session was terminated by an administrator.
+	terminationAdmin = "admin"
+	// terminationShutdown, the session was stopped at shutdown.
+	terminationShutdown = "shutdown"
+)
+
+// Steps of the creation of a session, as observed in
+// session_creation_step_duration_seconds and counted in
+// session_creation_failures_total when they fail.
+const (
+	stepCredentials    = "credentials"
+	stepPlacement      = "placement"
+	stepContainer      = "container"
+	stepUser           = "user"
+	stepRemoteUpstream = "remote_upstream"
+	stepPipeAdd        = "pipe_add"
+)
+
+// observeCreationStep, observes the duration of a step of the creation of a
+// session which started at start.
+func (app *application) observeCreationStep(step string, start time.Time) {
+	if err := prometheus.ObserveHistogram(app.instrumentation, time.Since(start).Seconds(), "session_creation_step_duration_seconds", step); err != nil {
+		app.errorLog.Printf("prometheus: unable to observe value for histogram session_creation_step_duration_seconds: %v", err)
+	}
+}
+
+// observeCreation, observes the creation of a session which started at start.
+// If err is not nil, the creation failed at step.
+func (app *application) observeCreation(step string, start time.Time, err error) {
+	if err != nil {
+		if err := prometheus.IncrementCounter(app.instrumentation, "session_creation_failures_total", step); err != nil {
+			app.errorLog.Printf("prometheus: unable to increment counter session_creation_failures_total: %v", err)
+		}
+		return
+	}
+	if err := prometheus.ObserveHistogram(app.instrumentation, time.Since(start).Seconds(), "session_creation_duration_seconds"); err != nil {
+		app.errorLog.Printf("prometheus: unable to observe value for histogram session_creation_duration_seconds: %v", err)
+	}
+}
+
+// countRejection, counts a request for a session which smd rejected with err.
+// Errors which are not a rejection of the request are not counted.
+func (app *application) countRejection(err error) {
+	var reason string
+	switch {
+	case errors.Is(err, ERR_LAST_REQ):
+		reason = "rate_limit"
+	case errors.Is(err, ERR_MAX_ACTIVE):
+		reason = "max_active"
+	case errors.Is(err, ERR_NO_AVAILABLE):
+		reason = "no_available"
+	default:
+		return
+	}
+	if err := prometheus.IncrementCounter(app.instrumentation, "session_requests_rejected_total", reason); err != nil {
+		app.errorLog.Printf("prometheus: unable to increment counter session_requests_rejected_total: %v", err)
+	}
+}
+
+// observeTermination, counts an active session which was stopped for reason
+// and observes for how long it was used.
+func (app *application) observeTermination(ss session, reason string) {
+	if err := prometheus.IncrementCounter(app.instrumentation, "session_terminations_total", reason); err != nil {
+		app.errorLog.Printf("prometheus: unable to increment counter session_terminations_total: %v", err)
+	}
+	if err := prometheus.ObserveHistogram(app.instrumentation, time.Since(ss.timeActivated).Seconds(), "session_lifetime_used_seconds", reason); err != nil {
+		app.errorLog.Printf("prometheus: unable to observe value for histogram session_lifetime_used_seconds: %v", err)
+	}
+}
+
+// instrumentRuntime, returns a runtime which exports the latency and errors of
+// every call to rt, the runtime of the container engine named engine.
+func (app *application) instrumentRuntime(rt backend.ContainerRuntime, engine string) backend.ContainerRuntime {
+	return backend.NewInstrumented(rt, func(operation string, duration time.Duration, err error) {
+		if err := prometheus.ObserveHistogram(app.instrumentation, duration.Seconds(), "docker_api_duration_seconds", operation, engine); err != nil {
+			app.errorLog.Printf("prometheus: unable to observe value for histogram docker_api_duration_seconds: %v", err)
+		}
+		if err == nil {
+			return
+		}
+		if err := prometheus.IncrementCounter(app.instrumentation, "docker_api_errors_total", operation, engine); err != nil {
+			app.errorLog.Printf("prometheus: unable to increment counter docker_api_errors_total: %v", err)
+		}
+	})
+}
+
+// observeHealthCheck, exports the result of a run of a health check of
+// monitord as the gauge health_check_status. Failed runs are also counted in
+// health_check_failures_total.
+func (app *application) observeHealthCheck(result monitor.HealthCheckResult) {
+	status := 1.0
+	if !result.Pass {
+		status = 0
+		if err := prometheus.IncrementCounter(app.instrumentation, "health_check_failures_total", result.Name); err != nil {
+			app.errorLog.Printf("prometheus: unable to increment counter health_check_failures_total: %v", err)
+		}
+	}
+	if err := prometheus.SetGauge(app.instrumentation, status, "health_check_status", result.Name); err != nil {
+		app.errorLog.Printf("prometheus: unable to set gauge health_check_status: %v", err)
+	}
+}
+
+// metricsOptions, returns the options of the metrics endpoint from the user
+// configurations.
+func (app *application) metricsOptions() prometheus.Options {
+	return prometheus.Options{
+		Addr:        app.configurations.MetricsAddr,
+		TLSCert:     app.configurations.MetricsTLSCert,
+		TLSKey:      app.configurations.MetricsTLSKey,
+		Username:    app.configurations.MetricsUser,
+		Password:    app.configurations.MetricsPassword,
+		BearerToken: app.configurations.MetricsToken,
+	}
+}
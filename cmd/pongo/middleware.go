@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
+	"github.com/bmizerany/pat"
 	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
 	"github.com/urfave/negroni"
 )
@@ -34,11 +36,17 @@ func secureHeaders(next http.Handler) http.Handler {
 }
 
 // logRequest, logs every client's request.
-// Log IP address of client, protocol used, HTTP method and requested URL.
+// Log IP address of client, ID of the request, protocol used, HTTP method and
+// requested URL.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// r.RemoteAddr is the IP address of the client doing the request.
-		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL)
+		// The probes of load balancers and service managers are frequent,
+		// only log them for debugging.
+		if r.URL.Path == "/livez" || r.URL.Path == "/readyz" {
+			app.requestLog(r).Debugf("%s %s %s", r.Proto, r.Method, r.URL)
+		} else {
+			app.requestLog(r).Infof("%s %s %s", r.Proto, r.Method, r.URL)
+		}
 
 		next.ServeHTTP(w, r)
 	})
@@ -66,11 +74,49 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-// prometheusMiddleware, captures all HTTP responses status codes and resource
-// paths and increments a Prometheus counter.
+// routeUnmatched, route of the requests which do not match any route of the
+// mux, e.g. requests for unknown paths.
+const routeUnmatched = "unmatched"
+
+// routeKey, key of the route of a request in the context of the request.
+type routeKey struct{}
+
+// routeMux, pat mux which records the pattern of the route that handles a
+// request in the context of the request (see prometheusMiddleware).
+type routeMux struct {
+	*pat.PatternServeMux
+}
+
+// Get, registers a handler for GET (and HEAD) requests matching pattern.
+func (m routeMux) Get(pattern string, h http.Handler) {
+	m.PatternServeMux.Get(pattern, withRoute(pattern, h))
+}
+
+// Post, registers a handler for POST requests matching pattern.
+func (m routeMux) Post(pattern string, h http.Handler) {
+	m.PatternServeMux.Post(pattern, withRoute(pattern, h))
+}
+
+// withRoute, records pattern as the route of every request handled by next.
+func withRoute(pattern string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+			*route = pattern
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// prometheusMiddleware, captures all HTTP responses status codes and routes
+// and increments a Prometheus counter. Requests are labeled by the pattern of
+// their route, not by their URL, so that every path or query string does not
+// create a new time series.
 func (app *application) prometheusMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		startDuration := time.Now()
+		// The route is recorded by routeMux, once the request is matched.
+		route := routeUnmatched
+		r = r.WithContext(context.WithValue(r.Context(), routeKey{}, &route))
 		// negroni must we used as a wrapper around the http.ResponseWriter,
 		// because otherwise there is no way of having access to the status code
 		// of a response that has been sent to the client.
@@ -86,9 +132,8 @@ func (app *application) prometheusMiddleware(next http.Handler) http.Handler {
 		// processed by other middlewares or endpoints.
 		// Transform status codes into strings, and use them as labels.
 		statusCodeLabel := strconv.Itoa(extW.Status())
-		// URL of resource being requested. Remove any trailing '?' Otherwise,
-		// some URL have a trailing '?' when the user does a POST request.
-		resourceLabel := strings.Trim(r.URL.String(), "?")
+		// Pattern of the route of the resource being requested.
+		resourceLabel := route
 		if err := prometheus.IncrementCounter(app.instrumentation, "http_requests_total", statusCodeLabel, resourceLabel); err != nil {
 			app.errorLog.Printf("prometheus: unable to increment counter http_requests_total: %v", err)
 		}
@@ -99,3 +144,22 @@ func (app *application) prometheusMiddleware(next http.Handler) http.Handler {
 
 	})
 }
+
+// requireAdmin, only lets the request through if it is authenticated with the
+// credentials of the administrator (HTTP basic authentication).
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		// Compare both values in constant time, so that the credentials
+		// cannot be guessed from the response time.
+		validUser := subtle.ConstantTimeCompare([]byte(user), []byte(app.configurations.AdminUser)) == 1
+		validPassword := subtle.ConstantTimeCompare([]byte(password), []byte(app.configurations.AdminPassword)) == 1
+		if !ok || !validUser || !validPassword || app.configurations.AdminPassword == "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="pongo admin", charset="UTF-8"`)
+			app.clientError(w, http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
+	promclient "github.com/prometheus/client_golang/prometheus"
+)
+
+// TestRouteLabels, tests that the HTTP metrics are labeled by the pattern of
+// the route of every request, not by its URL.
+func TestRouteLabels(t *testing.T) {
+	configValues := testConfiguration()
+	configValues.AdminPassword = "secret"
+	app, _ := newTestApplication(t, configValues)
+	reg := promclient.NewRegistry()
+	var err error
+	app.instrumentation, err = prometheus.NewInstrumentation(reg)
+	if err != nil {
+		t.Fatalf("error: could not start instrumentation: %v", err)
+	}
+
+	handler := app.routes()
+	for _, target := range []string{
+		"/admin/sessions/abcdef/terminate",
+		"/admin/sessions/ghijkl/terminate?x=1",
+		"/static/css/main.css?v=1",
+		"/static/js/main.js",
+		"/unknown/path?q=1",
+		"/another/unknown/path",
+	} {
+		method := http.MethodGet
+		if strings.HasPrefix(target, "/admin") {
+			method = http.MethodPost
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, target, nil))
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("error: could not gather metrics: %v", err)
+	}
+	resources := make(map[string]float64)
+	for _, f := range families {
+		if f.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "resource" {
+					resources[l.GetValue()] += m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	want := map[string]float64{
+		"/admin/sessions/:name/terminate": 2,
+		"/static/":                        2,
+		routeUnmatched:                    2,
+	}
+	if len(resources) != len(want) {
+		t.Errorf("error: requests labeled with resources %v, expected %v", resources, want)
+	}
+	for resource, n := range want {
+		if resources[resource] != n {
+			t.Errorf("error: %v requests labeled with resource '%s', expected %v", resources[resource], resource, n)
+		}
+	}
+}
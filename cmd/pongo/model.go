@@ -10,12 +10,23 @@ import (
 
 	"github.com/docker/docker/client"
 	monitor "github.com/erodrigufer/pongo/internal/APIMonitor"
+	"github.com/erodrigufer/pongo/internal/audit"
+	"github.com/erodrigufer/pongo/internal/backend"
+	dockerImage "github.com/erodrigufer/pongo/internal/docker/image"
+	"github.com/erodrigufer/pongo/internal/expiry"
 	"github.com/erodrigufer/pongo/internal/pongo"
 	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
+	"github.com/erodrigufer/pongo/internal/snapshot"
+	"github.com/sirupsen/logrus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // application, type used for dependency injection and to avoid using globals.
 type application struct {
+	// logger, structured logger of the application. infoLog, errorLog and
+	// debugLog log through it.
+	logger *logrus.Logger
 	// errorLog, error log handler.
 	errorLog *log.Logger
 	// infoLog, info log handler.
@@ -27,8 +38,16 @@ type application struct {
 	buildRev string
 	// srv, is the HTTP server that handles clients' requests for sessions.
 	srv *http.Server
-	// client, is the client that communicates with the Docker daemon.
+	// client, is the client that communicates with the container engine
+	// (Docker or Podman). It is used to build and pull images.
 	client *client.Client
+	// engine, the local container engine, which runs the SSH reverse proxy.
+	engine engine
+	// engines, pool of container engines in which the sessions are placed,
+	// including the local engine.
+	engines *backend.Pool
+	// runtime, manages the containers and networks of the sessions.
+	runtime backend.ContainerRuntime
 	// sm, handles the session management.
 	sm *sessionManager
 	// wg, is a WaitGroup that waits for all daemons to return.
@@ -51,6 +70,9 @@ type application struct {
 	templateCache map[string]*template.Template
 	// monitor, monitors the health of the application with periodic checks.
 	monitor *monitor.Monitord
+	// monitorToken, token with which the probes of the health monitor
+	// authenticate against the HTTP server.
+	monitorToken string
 	// outboundIP, the outbound IP used by the host machine.
 	outboundIP string
 	// appState, defines the states of different subsystems of the app.
@@ -58,6 +80,34 @@ type application struct {
 	// instrumentation, defines the interface used to interact with the
 	// Prometheus instrumentation.
 	instrumentation prometheus.InstrumentationAPI
+	// metricsHandler, serves the Prometheus metrics under /metrics in the
+	// HTTP server of the sessions. If nil, the metrics are served by their
+	// own HTTP server (or not at all).
+	metricsHandler http.Handler
+	// snapshots, stores the snapshots of the home directories of expired
+	// sessions. If nil, no snapshots are taken.
+	snapshots *snapshot.Store
+	// sandbox, isolation options applied to the entrypoint container of every
+	// session.
+	sandbox sandbox
+	// audit, appends the lifecycle events of the sessions to the audit log,
+	// without blocking the daemons while the log is synced. If nil, no events
+	// are recorded.
+	audit *audit.Writer
+	// tracerProvider, creates the tracers of the application and exports
+	// their spans. tracer, creates the spans of the application.
+	tracerProvider *sdktrace.TracerProvider
+	tracer         trace.Tracer
+}
+
+// engine, the container engine in which the sessions run.
+type engine struct {
+	// endpoint, address of the API of the engine.
+	endpoint backend.Endpoint
+	// capabilities, features supported by the engine, probed at startup.
+	capabilities backend.Capabilities
+	// remoteClients, clients of the remote engines of the pool.
+	remoteClients []*client.Client
 }
 
 // appSubsystState, stores the state of different subsystems that make up the
@@ -77,6 +127,9 @@ type images struct {
 	// entrypointImage, the Docker image used as the upstream-container from
 	// SSH Piper in which the user initiates his session.
 	entrypointImage string
+	// resolved, the images available in the Docker host after they were
+	// built or pulled at startup, with their resolved digests.
+	resolved []dockerImage.Resolved
 }
 
 // session, stores all the relevant information for a unique session, its
@@ -96,6 +149,28 @@ type session struct {
 	// timeActivated, time at which session was activated, i.e. the session was
 	// given to a client for use after a client's request.
 	timeActivated time.Time
+	// lifetime, time after its activation at which the session expires. Every
+	// session can have a different lifetime.
+	lifetime time.Duration
+	// extensions, amount of times the lifetime of the session was extended
+	// by its user.
+	extensions int
+	// owner, identity (IP address) of the participant to whom the session was
+	// delivered.
+	owner string
+	// participant, identity of the participant to whom the session was
+	// delivered, derived from its participant token. The snapshots of the
+	// session are stored under it. Empty if the participant is unknown.
+	participant string
+	// challenge, name of the challenge (image of the entrypoint container)
+	// run by the session.
+	challenge string
+	// engine, name of the container engine (in app.engines) that owns the
+	// containers of the session.
+	engine string
+	// snapshotted, true once the snapshot of the session was taken before
+	// stopping it, so that it is not taken again if stopping it is retried.
+	snapshotted bool
 }
 
 // sessionManager, manages the creation and allocation of sessions for the
@@ -105,14 +180,76 @@ type sessionManager struct {
 	// stored, so that the sessionManager can read a unique session out of the
 	// channel for every client requesting a session.
 	availableSessions chan session
+	// poolReady, is closed once the pool of available sessions is ready for
+	// the first time. poolReadyOnce, closes it only once.
+	poolReady     chan struct{}
+	poolReadyOnce sync.Once
 	// requestSession, is the channel to which clients can send a clientReq with
 	// a channel from which they will eventually get a reply with their username
 	// and password for a newly created session.
 	requestSession chan clientReq
-	// activeSessions, is a channel in which all currently active sessions
-	// (sessions sent to a client) are stored, so that the srm (session removal
-	// daemon) can later check its creation time to eventually remove them.
-	activeSessions chan session
+	// activeSessions, keeps track of all currently active sessions (sessions
+	// sent to a client), so that srd (session removal daemon) can later check
+	// their activation time to eventually remove them. It also enforces the
+	// max. amount of sessions that can be simultaneously active.
+	activeSessions *sessionTracker
+	// expiry, schedules the expiration of every active session, so that srd
+	// stops each session exactly when its lifetime is over.
+	expiry *expiry.Scheduler
+	// warnings, schedules the warnings written to the terminals of every
+	// active session shortly before the session expires.
+	warnings *expiry.Scheduler
+	// usage, last sampled resource usage of every active session.
+	usage *usageTracker
+	// snapshotSlots, limits the amount of snapshots of expired sessions taken
+	// simultaneously, outside of srd.
+	snapshotSlots chan struct{}
+	// expiring, tracks the expired sessions being snapshotted and stopped
+	// outside of srd, so that srd waits for them at shutdown.
+	expiring sync.WaitGroup
+}
+
+// usageTracker, concurrent-safe record of the resource usage of the active
+// sessions, sampled by csd (container stats daemon).
+type usageTracker struct {
+	// mu, guards the usages map.
+	mu sync.Mutex
+	// usages, maps the name of an active session to its resource usage.
+	usages map[string]sessionUsage
+}
+
+// sessionUsage, resource usage of the entrypoint container of a session.
+type sessionUsage struct {
+	// session, name of the session.
+	session string
+	// challenge, challenge run by the session.
+	challenge string
+	// stats, last sample of the resource usage.
+	stats backend.Stats
+	// netRxRate and netTxRate, bytes received and transmitted per second
+	// between the last two samples.
+	netRxRate float64
+	netTxRate float64
+	// txPacketRate, packets transmitted per second between the last two
+	// samples.
+	txPacketRate float64
+	// exceeded, amount of consecutive samples in which the threshold of
+	// every alert was exceeded, indexed by the name of the alert.
+	exceeded map[string]int
+	// alerts, alerts currently raised for the session.
+	alerts []string
+}
+
+// sessionTracker, concurrent-safe record of all the sessions that are
+// currently active. Contrary to a FIFO channel, any session can be removed
+// from the tracker at any time, regardless of when it was activated.
+type sessionTracker struct {
+	// mu, guards the sessions map.
+	mu sync.Mutex
+	// sessions, maps the name of an active session to the session itself.
+	sessions map[string]session
+	// capacity, max. amount of sessions that can be simultaneously tracked.
+	capacity int
 }
 
 // clientReq, data structure sent to smd by each client that requests a new
@@ -130,12 +267,47 @@ type clientReq struct {
 type reqInfo struct {
 	// clientAddr, IP address of client sending request.
 	clientAddr string
+	// participant, identity of the participant sending the request, derived
+	// from its participant token.
+	participant string
+	// spanContext, span of the request, so that the spans of smd are part
+	// of the trace of the request.
+	spanContext trace.SpanContext
+	// probe, kind of probe if the request is a synthetic request of the
+	// health monitor, probeNone otherwise.
+	probe probe
 }
 
 // ERR_LAST_REQ, error code used to identify an error received when a user tries
 // to request a new session too soon after receiving a session.
 var ERR_LAST_REQ error = fmt.Errorf("Not enough time has passed since last request.")
 
+// ERR_MAX_ACTIVE, error code used to identify that a session could not be
+// delivered to a client, because the max. amount of simultaneously active
+// sessions has been reached.
+var ERR_MAX_ACTIVE error = fmt.Errorf("The max. amount of active sessions has been reached.")
+
+// ERR_NO_AVAILABLE, error code used to identify that a session could not be
+// delivered to a client, because there are currently no available sessions
+// ready to be delivered.
+var ERR_NO_AVAILABLE error = fmt.Errorf("No more sessions are currently available.")
+
+// ERR_SSHPIPER_NOT_RUNNING, error code used to identify that the application
+// is not ready, because the container of the SSH reverse proxy is not running.
+var ERR_SSHPIPER_NOT_RUNNING error = fmt.Errorf("The SSH reverse proxy container is not running.")
+
+// ERR_POOL_EMPTY, error code used to identify that the application is not
+// ready, because the pool of available sessions is empty.
+var ERR_POOL_EMPTY error = fmt.Errorf("There are no available sessions.")
+
+// ERR_INVALID_MONITOR_TOKEN, error code used to identify a request with a
+// monitor token which is not the token of the health monitor.
+var ERR_INVALID_MONITOR_TOKEN error = fmt.Errorf("Invalid monitor token.")
+
+// ERR_INVALID_PROBE, error code used to identify a request of the health
+// monitor for an unknown kind of probe.
+var ERR_INVALID_PROBE error = fmt.Errorf("Unknown kind of probe.")
+
 // smResponse, is a wrapper for the response that a client receives from the
 // session manager (sm), in order to send both a session and an error back.
 // If err == nil, then the new session was sent in the field session.
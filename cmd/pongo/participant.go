@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// participantCookie, cookie in which the browser of a participant keeps its
+// participant token.
+const participantCookie = "pongo_participant"
+
+// participantTokenLen, length in bytes of a participant token.
+const participantTokenLen = 32
+
+// participantCookieMaxAge, time after which the browser of a participant
+// forgets its participant token.
+const participantCookieMaxAge = 30 * 24 * time.Hour
+
+// newParticipantToken, returns a random participant token.
+func newParticipantToken() (string, error) {
+	b := make([]byte, participantTokenLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating participant token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validParticipantToken, reports whether token has the format of a
+// participant token.
+func validParticipantToken(token string) bool {
+	b, err := hex.DecodeString(token)
+	return err == nil && len(b) == participantTokenLen
+}
+
+// participantIdentity, returns the identity of the participant sending r, under
+// which the snapshots of its sessions are stored. The identity is derived
+// from the participant token kept in a cookie by the browser of the
+// participant, so that participants sharing an IP address (e.g. behind a NAT)
+// never get each other's files. If r carries no valid participant token, a
+// new one is sent to the participant in a cookie.
+// Only the hash of the token is used as identity, so that the tokens cannot
+// be recovered from the snapshots stored on disk.
+func (app *application) participantIdentity(w http.ResponseWriter, r *http.Request) (string, error) {
+	var token string
+	if c, err := r.Cookie(participantCookie); err == nil && validParticipantToken(c.Value) {
+		token = c.Value
+	} else {
+		token, err = newParticipantToken()
+		if err != nil {
+			return "", err
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     participantCookie,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   int(participantCookieMaxAge.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:]), nil
+}
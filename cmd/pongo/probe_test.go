@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// probeRequest, sends a request for a session to the HTTP server with the
+// given monitor token and probe. It returns the status code of the response.
+func probeRequest(app *application, token string, p probe) int {
+	target := "/session"
+	if p != probeNone {
+		target += "?probe=" + string(p)
+	}
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if token != "" {
+		r.Header.Set(monitorTokenHeader, token)
+	}
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, r)
+	return rr.Code
+}
+
+// startSMD, starts smd for the duration of the test.
+func startSMD(t *testing.T, app *application) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	app.wg.Add(1)
+	go app.smd(ctx)
+	t.Cleanup(func() {
+		cancel()
+		app.wg.Wait()
+		app.stopAllSessions()
+	})
+}
+
+// TestAllocationProbe, tests that the allocation probe validates that a
+// session could be delivered, without taking it out of the available
+// sessions.
+func TestAllocationProbe(t *testing.T) {
+	app, _ := newTestApplication(t, testConfiguration())
+	app.monitorToken = "monitor-token"
+	startSMD(t, app)
+
+	if code := probeRequest(app, app.monitorToken, probeAllocation); code != http.StatusServiceUnavailable {
+		t.Errorf("error: allocation probe without available sessions returned %d, expected 503", code)
+	}
+
+	ss, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	app.sm.availableSessions <- ss
+	for i := 0; i < 3; i++ {
+		if code := probeRequest(app, app.monitorToken, probeAllocation); code != http.StatusOK {
+			t.Fatalf("error: allocation probe returned %d, expected 200", code)
+		}
+	}
+	if len(app.sm.availableSessions) != 1 || app.sm.activeSessions.len() != 0 {
+		t.Errorf("error: allocation probes consumed a session (%d available, %d active)", len(app.sm.availableSessions), app.sm.activeSessions.len())
+	}
+	// The probes do not throttle a client with the same IP address.
+	if response := request(app, "192.0.2.1"); response.errors != nil {
+		t.Errorf("error: smd did not deliver a session after the probes: %v", response.errors)
+	}
+}
+
+// TestRateLimitProbe, tests that the rate-limit probe is throttled on the
+// identity of the monitor, and not on the IP address of the host.
+func TestRateLimitProbe(t *testing.T) {
+	app, _ := newTestApplication(t, testConfiguration())
+	app.monitorToken = "monitor-token"
+	startSMD(t, app)
+
+	if response := request(app, "192.0.2.1"); !errors.Is(response.errors, ERR_NO_AVAILABLE) {
+		t.Fatalf("error: request of the client returned %v, expected ERR_NO_AVAILABLE", response.errors)
+	}
+	if code := probeRequest(app, app.monitorToken, probeRateLimit); code != http.StatusOK {
+		t.Errorf("error: first rate-limit probe returned %d, expected 200", code)
+	}
+	if code := probeRequest(app, app.monitorToken, probeRateLimit); code != http.StatusTooManyRequests {
+		t.Errorf("error: second rate-limit probe returned %d, expected 429", code)
+	}
+}
+
+// TestProbeAuthentication, tests that a probe with an invalid monitor token
+// or an unknown kind of probe is rejected.
+func TestProbeAuthentication(t *testing.T) {
+	app, _ := newTestApplication(t, testConfiguration())
+	app.monitorToken = "monitor-token"
+	startSMD(t, app)
+
+	if code := probeRequest(app, "not-the-token", probeAllocation); code != http.StatusForbidden {
+		t.Errorf("error: probe with an invalid monitor token returned %d, expected 403", code)
+	}
+	if code := probeRequest(app, app.monitorToken, probe("unknown")); code != http.StatusBadRequest {
+		t.Errorf("error: unknown probe returned %d, expected 400", code)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// monitorTokenHeader, header in which the synthetic requests of the health
+// monitor (probes) carry the monitor token.
+const monitorTokenHeader = "X-Pongo-Monitor-Token"
+
+// monitorIdentity, identity of the health monitor in the throttle of smd. It
+// is never the IP address of a client, so the rate-limit probe does not share
+// the throttle of the host on which the monitor runs.
+const monitorIdentity = "monitor"
+
+// probe, kind of synthetic request for a session sent by the health monitor.
+// smd answers a probe without delivering a session.
+type probe string
+
+const (
+	// probeNone, the request comes from a client and asks for a session.
+	probeNone probe = ""
+	// probeAllocation, validates that a session could be delivered right
+	// now (the max. amount of active sessions is not reached and there are
+	// available sessions). It is not throttled.
+	probeAllocation probe = "allocation"
+	// probeRateLimit, goes through the throttle of smd with the identity of
+	// the monitor, so that a second probe shortly after the first one is
+	// rejected with ERR_LAST_REQ.
+	probeRateLimit probe = "rate_limit"
+)
+
+// newMonitorToken, returns a random monitor token.
+func newMonitorToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating monitor token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// requestProbe, returns the kind of probe requested by r (from the query
+// 'probe', an allocation probe by default) if r carries the monitor token, or
+// probeNone if r carries no monitor token.
+func (app *application) requestProbe(r *http.Request) (probe, error) {
+	token := r.Header.Get(monitorTokenHeader)
+	if token == "" {
+		return probeNone, nil
+	}
+	if app.monitorToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(app.monitorToken)) != 1 {
+		return probeNone, ERR_INVALID_MONITOR_TOKEN
+	}
+	switch p := probe(r.URL.Query().Get("probe")); p {
+	case probeNone, probeAllocation:
+		return probeAllocation, nil
+	case probeRateLimit:
+		return probeRateLimit, nil
+	default:
+		return probeNone, ERR_INVALID_PROBE
+	}
+}
+
+// tooSoon, reports whether a request comes sooner after the last request of
+// the same identity (at last) than the min. time between requests.
+func (app *application) tooSoon(last time.Time) bool {
+	return time.Since(last) < time.Duration(app.configurations.TimeBetweenRequests)*time.Minute
+}
+
+// answerProbe, answers a probe of the health monitor in smd, without
+// delivering a session. Parameters: timeLastRequest, time of the last request
+// of every identity in the throttle of smd.
+func (app *application) answerProbe(p probe, timeLastRequest map[string]time.Time) smResponse {
+	switch p {
+	case probeRateLimit:
+		if last, ok := timeLastRequest[monitorIdentity]; ok && app.tooSoon(last) {
+			return smResponse{errors: ERR_LAST_REQ}
+		}
+		timeLastRequest[monitorIdentity] = time.Now()
+		return smResponse{}
+	default:
+		if app.sm.activeSessions.full() {
+			return smResponse{errors: ERR_MAX_ACTIVE}
+		}
+		if len(app.sm.availableSessions) == 0 {
+			return smResponse{errors: ERR_NO_AVAILABLE}
+		}
+		return smResponse{}
+	}
+}
+
+// probeResponse, JSON body sent back to the health monitor for a probe that
+// passed.
+type probeResponse struct {
+	Probe  string `json:"probe"`
+	Status string `json:"status"`
+}
+
+// writeProbeResult, sends the result of a probe back to the health monitor:
+// 200 if it passed, otherwise the status code a client would have received
+// (429 if throttled, 503 if no session could be delivered).
+func (app *application) writeProbeResult(w http.ResponseWriter, p probe, err error) {
+	switch {
+	case err == nil:
+		app.writeJSON(w, http.StatusOK, probeResponse{Probe: string(p), Status: statusPass})
+	case errors.Is(err, ERR_LAST_REQ):
+		app.writeJSONError(w, http.StatusTooManyRequests, err)
+	case errors.Is(err, ERR_MAX_ACTIVE) || errors.Is(err, ERR_NO_AVAILABLE):
+		app.writeJSONError(w, http.StatusServiceUnavailable, err)
+	default:
+		app.errorLog.Printf("error answering %s probe: %v", p, err)
+		app.writeJSONError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -49,11 +49,14 @@ func (app *application) initializeReverseProxy() error {
 	// Create the network for the reverse proxy (SSH Piper) and the upstream
 	// containers.
 	reverseProxyName := "reverseProxy" // Name of the network.
-	app.networkIDreverseProxy, err = app.createNetwork(reverseProxyName)
+	app.networkIDreverseProxy, err = app.createNetwork(app.runtime, reverseProxyName, nil)
 	if err != nil {
 		return err
 	}
 	app.debugLog.Printf("Created reverse proxy network with ID: %s\n", app.networkIDreverseProxy[:10])
+	// The sessions of the local engine are connected to the reverse proxy
+	// network.
+	app.engines.SetNetwork(localEngine, app.networkIDreverseProxy)
 
 	// Configure the filesystem required for the SSH Piper container.
 	if err = app.configurePiperFilesystem(); err != nil {
@@ -69,6 +72,9 @@ func (app *application) initializeReverseProxy() error {
 	return nil
 }
 
+// sshHostKey, RSA SSH host key of the host, used by the SSH reverse proxy.
+const sshHostKey = "/etc/ssh/ssh_host_rsa_key"
+
 // createPiperContainer, creates and runs the container that will act as the SSH
 // reverse proxy. It connects the container to the network with which it
 // interacts with all upstream-containers (app.networkIDreverseProxy).
@@ -100,7 +106,7 @@ func (app *application) createPiperContainer(name string) (err error) {
 	// client think that the keys have changed for the same IP, which is pretty
 	// bad because the SSH client blocks the connection attempt, in order to
 	// prevent a man-in-the-middle attack.
-	sshPiperProxy.hostConfig.Binds = []string{"/tmp/sshpiper:/var/sshpiper", "/etc/ssh/ssh_host_rsa_key:/etc/ssh/ssh_host_rsa_key"}
+	sshPiperProxy.hostConfig.Binds = []string{"/tmp/sshpiper:/var/sshpiper", sshHostKey + ":" + sshHostKey}
 
 	// Networking configurations for container, so that the SSH piper container
 	// is automatically connected to the SSH reverse proxy network after
@@ -122,7 +128,7 @@ func (app *application) createPiperContainer(name string) (err error) {
 	// sshPiperProxy.containerConfig.AttachStdin = true
 
 	// Run the previously configured SSH Piper reverse proxy container.
-	app.sshPiperContainerID, err = app.runContainer(sshPiperProxy)
+	app.sshPiperContainerID, err = app.runContainer(context.Background(), app.runtime, sshPiperProxy)
 	if err != nil {
 		return err
 	}
@@ -148,11 +154,11 @@ func (app *application) stopReverseProxy() error {
 	// https://vsupalov.com/docker-compose-stop-slow/
 	timeout := time.Duration(-1)
 
-	if err := app.client.ContainerStop(ctx, app.sshPiperContainerID, &timeout); err != nil {
+	if err := app.runtime.StopContainer(ctx, app.sshPiperContainerID, &timeout); err != nil {
 		return fmt.Errorf("error stopping SSH Piper container: %w", err)
 	}
 
-	if err := app.client.NetworkRemove(ctx, app.networkIDreverseProxy); err != nil {
+	if err := app.runtime.RemoveNetwork(ctx, app.networkIDreverseProxy); err != nil {
 		return fmt.Errorf("error removing the reverse proxy network: %w", err)
 	}
 
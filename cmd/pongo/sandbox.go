@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/backend"
+	"github.com/erodrigufer/pongo/internal/pongo"
+)
+
+// sandbox, isolation options applied to the entrypoint container of every
+// session, already in the form expected by the Docker daemon.
+type sandbox struct {
+	// runtime, OCI runtime used to run the containers. If empty, the default
+	// runtime of the Docker daemon is used.
+	runtime string
+	// capDrop, Linux capabilities dropped from the containers.
+	capDrop []string
+	// capAdd, Linux capabilities added to the containers.
+	capAdd []string
+	// readOnlyRootfs, if true, the root filesystem is mounted as read-only.
+	readOnlyRootfs bool
+	// tmpfs, tmpfs mounts of the containers (path -> mount options).
+	tmpfs map[string]string
+	// securityOpt, security options of the containers, e.g. the seccomp and
+	// AppArmor profiles.
+	securityOpt []string
+}
+
+// newSandbox, translates the sandbox options configured by the user into the
+// options expected by the Docker daemon. The seccomp profile is read from the
+// host, since the Docker daemon expects the content of the profile.
+func newSandbox(spec pongo.SandboxSpec) (sandbox, error) {
+	sb := sandbox{
+		runtime:        spec.Runtime,
+		capDrop:        spec.CapDrop,
+		capAdd:         spec.CapAdd,
+		readOnlyRootfs: spec.ReadOnlyRootfs,
+	}
+
+	if len(spec.Tmpfs) > 0 {
+		sb.tmpfs = make(map[string]string)
+	}
+	for _, mount := range spec.Tmpfs {
+		path, options, _ := strings.Cut(mount, ":")
+		if !strings.HasPrefix(path, "/") {
+			return sandbox{}, fmt.Errorf("error: tmpfs mount point (%s) is not an absolute path", path)
+		}
+		// The mount options are separated by spaces in the configuration,
+		// since commas already separate the mounts.
+		sb.tmpfs[path] = strings.Join(strings.Fields(options), ",")
+	}
+
+	if spec.NoNewPrivileges {
+		sb.securityOpt = append(sb.securityOpt, "no-new-privileges")
+	}
+	switch spec.SeccompProfile {
+	case "":
+	case "unconfined":
+		sb.securityOpt = append(sb.securityOpt, "seccomp=unconfined")
+	default:
+		profile, err := os.ReadFile(spec.SeccompProfile)
+		if err != nil {
+			return sandbox{}, fmt.Errorf("error: unable to read seccomp profile: %w", err)
+		}
+		if !json.Valid(profile) {
+			return sandbox{}, fmt.Errorf("error: seccomp profile %s is not valid JSON", spec.SeccompProfile)
+		}
+		sb.securityOpt = append(sb.securityOpt, "seccomp="+string(profile))
+	}
+	if spec.AppArmorProfile != "" {
+		sb.securityOpt = append(sb.securityOpt, "apparmor="+spec.AppArmorProfile)
+	}
+
+	return sb, nil
+}
+
+// checkSandbox, checks that the Docker daemon rt supports the configured
+// sandbox options, e.g. that the OCI runtime is available. It returns an error
+// otherwise, so that the sessions never run with a weaker isolation than the
+// configured one.
+func (app *application) checkSandbox(rt backend.ContainerRuntime) error {
+	spec := app.configurations.ChallengeSandbox
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	info, err := rt.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("error retrieving information about the container engine: %w", err)
+	}
+
+	if spec.Runtime != "" {
+		if _, ok := info.Runtimes[spec.Runtime]; !ok {
+			available := make([]string, 0, len(info.Runtimes))
+			for name := range info.Runtimes {
+				available = append(available, name)
+			}
+			sort.Strings(available)
+			return fmt.Errorf("error: OCI runtime '%s' is not configured in the Docker daemon (available runtimes: %s)", spec.Runtime, strings.Join(available, ", "))
+		}
+	}
+
+	// The security options are reported as e.g. 'name=seccomp,profile=default'.
+	securityOptions := make(map[string]bool)
+	for _, option := range info.SecurityOptions {
+		for _, field := range strings.Split(option, ",") {
+			if strings.HasPrefix(field, "name=") {
+				securityOptions[strings.TrimPrefix(field, "name=")] = true
+			}
+		}
+	}
+	if spec.RequireUserns && !securityOptions["userns"] {
+		return fmt.Errorf("error: user-namespace remapping is required, but it is not enabled in the Docker daemon")
+	}
+	if spec.AppArmorProfile != "" && !securityOptions["apparmor"] {
+		return fmt.Errorf("error: AppArmor profile '%s' was configured, but AppArmor is not enabled in the Docker daemon", spec.AppArmorProfile)
+	}
+	if spec.SeccompProfile != "" && spec.SeccompProfile != "unconfined" && !securityOptions["seccomp"] {
+		return fmt.Errorf("error: seccomp profile was configured, but seccomp is not enabled in the Docker daemon")
+	}
+
+	runtime := spec.Runtime
+	if runtime == "" {
+		runtime = info.DefaultRuntime
+	}
+	app.infoLog.Printf("Sessions run with the OCI runtime '%s' (user-namespace remapping: %t).", runtime, securityOptions["userns"])
+
+	return nil
+}
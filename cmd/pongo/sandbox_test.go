@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/erodrigufer/pongo/internal/pongo"
+)
+
+// TestNewSandbox, tests that the isolation options configured by the user are
+// applied to the upstream containers.
+func TestNewSandbox(t *testing.T) {
+	profile := filepath.Join(t.TempDir(), "seccomp.json")
+	if err := os.WriteFile(profile, []byte(`{"defaultAction":"SCMP_ACT_ERRNO"}`), 0644); err != nil {
+		t.Fatalf("error: could not write seccomp profile: %v", err)
+	}
+	spec := pongo.SandboxSpec{
+		Runtime:         "runsc",
+		CapDrop:         []string{"ALL"},
+		CapAdd:          []string{"SETUID", "SETGID"},
+		NoNewPrivileges: true,
+		ReadOnlyRootfs:  true,
+		Tmpfs:           []string{"/tmp:rw noexec size=64m", "/run"},
+		SeccompProfile:  profile,
+		AppArmorProfile: "pongo-session",
+	}
+	sb, err := newSandbox(spec)
+	if err != nil {
+		t.Fatalf("error: could not create sandbox: %v", err)
+	}
+
+	upstream := newUpstream("session", "entrypoint", "network", sb)
+	hc := upstream.hostConfig
+	if hc.Runtime != "runsc" {
+		t.Errorf("error: runtime is %q, expected %q", hc.Runtime, "runsc")
+	}
+	if len(hc.CapDrop) != 1 || hc.CapDrop[0] != "ALL" {
+		t.Errorf("error: dropped capabilities are %v, expected [ALL]", hc.CapDrop)
+	}
+	if !hc.ReadonlyRootfs {
+		t.Errorf("error: root filesystem should be read-only")
+	}
+	if hc.Tmpfs["/tmp"] != "rw,noexec,size=64m" {
+		t.Errorf("error: options of tmpfs mount /tmp are %q, expected %q", hc.Tmpfs["/tmp"], "rw,noexec,size=64m")
+	}
+	if _, ok := hc.Tmpfs["/run"]; !ok {
+		t.Errorf("error: tmpfs mount /run is missing")
+	}
+	opts := strings.Join(hc.SecurityOpt, "\n")
+	for _, expected := range []string{"no-new-privileges", `seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`, "apparmor=pongo-session"} {
+		if !strings.Contains(opts, expected) {
+			t.Errorf("error: security options %v do not contain %q", hc.SecurityOpt, expected)
+		}
+	}
+
+	if _, err := newSandbox(pongo.SandboxSpec{Tmpfs: []string{"tmp"}}); err == nil {
+		t.Errorf("error: a relative tmpfs mount point should be rejected")
+	}
+}
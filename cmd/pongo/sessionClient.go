@@ -4,13 +4,26 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+
+	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
+	"github.com/erodrigufer/pongo/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // requestSession, method used by clients to request a session.
 // Parameter: r *http.Request, to log the info from the client requesting a new
-// session.
+// session. p, kind of probe if the request is a probe of the health monitor,
+// in which case no session is delivered. participant, identity of the
+// participant requesting the session, under which its snapshots are stored.
+// The handoff to smd is traced as a span of ctx.
 // Returns: a session and an error.
-func (app *application) requestSession(ctx context.Context, r *http.Request) (session, error) {
+func (app *application) requestSession(ctx context.Context, r *http.Request, p probe, participant string) (ss session, err error) {
+	ctx, span := app.tracer.Start(ctx, "requestSession")
+	defer func() {
+		tracing.Error(span, err)
+		span.End()
+	}()
+
 	// Channel sent to the session manager in which to receive a responseCh with
 	// a new valid session and an error.
 	// The channel is buffered to only one smResponse. The channel is buffered,
@@ -21,6 +34,7 @@ func (app *application) requestSession(ctx context.Context, r *http.Request) (se
 
 	// Parse the IP of the client, to send it to smd.
 	clientIP, err := getIP(r.RemoteAddr)
+	span.SetAttributes(attribute.String("client.address", clientIP))
 	if err != nil {
 		app.errorLog.Print(err)
 		// If parsing fails, set clientIP to "" to not store anything in the
@@ -32,10 +46,17 @@ func (app *application) requestSession(ctx context.Context, r *http.Request) (se
 	sessionReq := clientReq{
 		respCh: responseCh,
 		reqInfo: reqInfo{
-			clientAddr: clientIP,
+			clientAddr:  clientIP,
+			participant: participant,
+			spanContext: span.SpanContext(),
+			probe:       p,
 		},
 	}
 
+	// The client waits in the queue of smd until smd answers its request.
+	prometheus.IncrementGauge(app.instrumentation, "session_request_queue_length")
+	defer prometheus.DecrementGauge(app.instrumentation, "session_request_queue_length")
+
 	// Send clientReq to session manager to request a new session.
 	select {
 	case app.sm.requestSession <- sessionReq:
@@ -47,7 +68,10 @@ func (app *application) requestSession(ctx context.Context, r *http.Request) (se
 		err := fmt.Errorf("error: smd did not receive request for new session in time. Canceled request for new session")
 		return ss, err
 	}
-	app.infoLog.Printf("New session requested by: %s", r.RemoteAddr)
+	span.AddEvent("smd received request")
+	if p == probeNone {
+		app.requestLog(r).WithContext(ctx).Info("New session requested.")
+	}
 
 	var smResponse smResponse
 	select {
@@ -70,6 +94,14 @@ func (app *application) requestSession(ctx context.Context, r *http.Request) (se
 		err := fmt.Errorf("client did not receive a valid session from smd: %w", err)
 		return smResponse.session, err
 	}
+	// A probe does not receive a session.
+	if p != probeNone {
+		return smResponse.session, nil
+	}
+	// Restore the files of a previous session of the same participant before
+	// the credentials are delivered, so that the restore cannot overwrite
+	// files written by the participant after logging in.
+	app.restoreSession(smResponse.session)
 
 	return smResponse.session, nil
 }
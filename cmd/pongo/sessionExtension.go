@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/audit"
+)
+
+// expiryWarnings, how long before the expiration of a session a warning is
+// written to the terminals of the users connected to the session.
+var expiryWarnings = []time.Duration{10 * time.Minute, 2 * time.Minute}
+
+// ERR_INVALID_CREDENTIALS, error code used to identify that the credentials
+// provided by a client do not belong to any active session.
+var ERR_INVALID_CREDENTIALS error = fmt.Errorf("The credentials do not belong to any active session.")
+
+// ERR_MAX_EXTENSIONS, error code used to identify that a session cannot be
+// extended, because it has already been extended the max. amount of times.
+var ERR_MAX_EXTENSIONS error = fmt.Errorf("The session cannot be extended any more times.")
+
+// ERR_INVALID_EXTENSION, error code used to identify that the amount of time
+// by which a client wants to extend a session is not permitted.
+var ERR_INVALID_EXTENSION error = fmt.Errorf("The session cannot be extended by the requested amount of time.")
+
+// warningKey, returns the key used to schedule the warning of a session that
+// is written offset before the session expires.
+func warningKey(name string, offset time.Duration) string {
+	return fmt.Sprintf("%s/%d", name, int(offset.Minutes()))
+}
+
+// scheduleExpiry, schedules the expiration of an active session at deadline,
+// and the warnings written to its terminals before it expires. If the session
+// was already scheduled, its expiration and warnings are rescheduled.
+func (app *application) scheduleExpiry(name string, deadline time.Time) {
+	app.sm.expiry.Schedule(name, deadline)
+	app.scheduleWarnings(name, deadline)
+}
+
+// scheduleWarnings, schedules all the warnings of a session that expires at
+// deadline. Warnings that should have been written in the past are skipped.
+func (app *application) scheduleWarnings(name string, deadline time.Time) {
+	for _, offset := range expiryWarnings {
+		key := warningKey(name, offset)
+		at := deadline.Add(-offset)
+		if at.Before(time.Now()) {
+			app.sm.warnings.Remove(key)
+			continue
+		}
+		app.sm.warnings.Schedule(key, at)
+	}
+}
+
+// unscheduleWarnings, removes all pending warnings of a session.
+func (app *application) unscheduleWarnings(name string) {
+	for _, offset := range expiryWarnings {
+		app.sm.warnings.Remove(warningKey(name, offset))
+	}
+}
+
+// ewd, expiry warning daemon writes a warning to the terminals of the users
+// of every active session shortly before the session expires.
+func (app *application) ewd(ctx context.Context) {
+	app.sm.warnings.Run(ctx, app.warnSession)
+	app.infoLog.Print("ewd: shutting down.")
+	app.wg.Done()
+}
+
+// warnSession, writes a warning about its upcoming expiration to the
+// terminals of an active session. Parameters: key of the warning, as returned
+// by warningKey().
+func (app *application) warnSession(key string, _ time.Time) {
+	name := key[:strings.LastIndex(key, "/")]
+	ss, ok := app.sm.activeSessions.get(name)
+	if !ok {
+		return
+	}
+	deadline, ok := app.sm.expiry.Deadline(name)
+	if !ok {
+		return
+	}
+	left := time.Until(deadline).Round(time.Minute)
+	msg := fmt.Sprintf("[pongo] This session expires in %v (at %s). All files in this session will be lost.", left, deadline.Format("15:04 MST"))
+	if ss.extensions < app.configurations.MaxExtensions {
+		msg = fmt.Sprintf("%s The session can still be extended on the session page.", msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := app.writeToTerminals(ctx, app.sessionRuntime(ss), ss.containersIDs[0], msg); err != nil {
+		app.sessionLog(ss).Errorf("ewd: unable to warn session about its expiration: %v", err)
+		return
+	}
+	app.sessionLog(ss).Debugf("ewd: warned session about its expiration in %v.", left)
+}
+
+// extendSession, extends the lifetime of the active session to which the
+// given credentials belong by the given amount of minutes. A session can only
+// be extended MaxExtensions times, by at most MaxExtensionTime minutes each
+// time, and only if the host is not at its max. capacity of active sessions.
+// It returns the extended session and its new deadline.
+func (app *application) extendSession(username, password string, minutes int) (session, time.Time, error) {
+	if minutes <= 0 || minutes > app.configurations.MaxExtensionTime {
+		return session{}, time.Time{}, fmt.Errorf("%w (requested %d min, max. %d min)", ERR_INVALID_EXTENSION, minutes, app.configurations.MaxExtensionTime)
+	}
+	ss, ok := app.sm.activeSessions.lookup(username)
+	// Compare the passwords in constant time, so that the time of the
+	// comparison does not leak information about the password.
+	if !ok || subtle.ConstantTimeCompare([]byte(ss.password), []byte(password)) != 1 {
+		return session{}, time.Time{}, ERR_INVALID_CREDENTIALS
+	}
+	// Extending a session when the host is at its max. capacity would keep
+	// other clients from getting a session for even longer.
+	if app.sm.activeSessions.full() {
+		return session{}, time.Time{}, ERR_MAX_ACTIVE
+	}
+
+	extension := time.Duration(minutes) * time.Minute
+	var deadline time.Time
+	ss, err := app.sm.activeSessions.update(ss.name, func(ss *session) error {
+		if ss.extensions >= app.configurations.MaxExtensions {
+			return ERR_MAX_EXTENSIONS
+		}
+		// The session might be expiring right now, in that case it cannot
+		// be extended anymore.
+		var err error
+		deadline, err = app.sm.expiry.Extend(ss.name, extension)
+		if err != nil {
+			return fmt.Errorf("session is already expiring: %w", err)
+		}
+		ss.extensions++
+		ss.lifetime += extension
+		return nil
+	})
+	if err != nil {
+		return session{}, time.Time{}, err
+	}
+	app.scheduleWarnings(ss.name, deadline)
+	app.sessionLog(ss).Infof("Session extended by %v, it now expires at %s.", extension, deadline.Format(time.RFC3339))
+	app.auditSession(audit.EventExtended, ss, "", map[string]string{"extension": extension.String(), "expires_at": deadline.UTC().Format(time.RFC3339)})
+
+	return ss, deadline, nil
+}
+
+// parseExtension, parses the amount of minutes by which a client wants to
+// extend a session.
+func parseExtension(minutes string) (int, error) {
+	m, err := strconv.Atoi(minutes)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ERR_INVALID_EXTENSION, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/expiry"
+	"github.com/erodrigufer/pongo/internal/pongo"
+	dyntemplate "github.com/erodrigufer/pongo/internal/pongo/templates"
+)
+
+// extensionConfiguration, returns the test configuration with extensions of
+// at most 30 minutes, at most twice per session.
+func extensionConfiguration() pongo.UserConfiguration {
+	configValues := testConfiguration()
+	configValues.MaxExtensions = 2
+	configValues.MaxExtensionTime = 30
+	return configValues
+}
+
+// TestExtendSession, tests the limits of the extensions of a session, and that
+// its expiration and warnings are rescheduled when it is extended.
+func TestExtendSession(t *testing.T) {
+	app, _ := newTestApplication(t, extensionConfiguration())
+	ss := activeSession(t, app, time.Now())
+	// The session expires in 5 minutes, its first warning is already over.
+	ss.lifetime = 5 * time.Minute
+	app.sm.activeSessions.remove(ss.name)
+	if err := app.sm.activeSessions.add(ss); err != nil {
+		t.Fatal(err)
+	}
+	app.scheduleExpiry(ss.name, ss.timeActivated.Add(ss.lifetime))
+	if _, ok := app.sm.warnings.Deadline(warningKey(ss.name, 10*time.Minute)); ok {
+		t.Fatalf("error: warning in the past was scheduled")
+	}
+
+	for _, minutes := range []int{0, -5, 31} {
+		if _, _, err := app.extendSession(ss.username, ss.password, minutes); !errors.Is(err, ERR_INVALID_EXTENSION) {
+			t.Errorf("error: extension by %d min returned %v, expected ERR_INVALID_EXTENSION", minutes, err)
+		}
+	}
+	if _, _, err := app.extendSession(ss.username, "wrong-password", 10); !errors.Is(err, ERR_INVALID_CREDENTIALS) {
+		t.Errorf("error: extension with a wrong password returned %v, expected ERR_INVALID_CREDENTIALS", err)
+	}
+	if _, _, err := app.extendSession("unknown", ss.password, 10); !errors.Is(err, ERR_INVALID_CREDENTIALS) {
+		t.Errorf("error: extension of an unknown user returned %v, expected ERR_INVALID_CREDENTIALS", err)
+	}
+
+	before, _ := app.sm.expiry.Deadline(ss.name)
+	extended, deadline, err := app.extendSession(ss.username, ss.password, 30)
+	if err != nil {
+		t.Fatalf("error: could not extend session: %v", err)
+	}
+	if !deadline.Equal(before.Add(30*time.Minute)) || extended.lifetime != 35*time.Minute || extended.extensions != 1 {
+		t.Errorf("error: extended session expires at %v with lifetime %v after %d extensions, expected %v, 35m and 1", deadline, extended.lifetime, extended.extensions, before.Add(30*time.Minute))
+	}
+	if scheduled, _ := app.sm.expiry.Deadline(ss.name); !scheduled.Equal(deadline) {
+		t.Errorf("error: expiration is scheduled at %v, expected %v", scheduled, deadline)
+	}
+	for _, offset := range expiryWarnings {
+		at, ok := app.sm.warnings.Deadline(warningKey(ss.name, offset))
+		if !ok || !at.Equal(deadline.Add(-offset)) {
+			t.Errorf("error: warning %v before the expiration is scheduled at %v (%v), expected %v", offset, at, ok, deadline.Add(-offset))
+		}
+	}
+	if tracked, _ := app.sm.activeSessions.get(ss.name); tracked.lifetime != extended.lifetime {
+		t.Errorf("error: tracked session has lifetime %v, expected %v", tracked.lifetime, extended.lifetime)
+	}
+
+	if _, _, err := app.extendSession(ss.username, ss.password, 1); err != nil {
+		t.Fatalf("error: could not extend session a second time: %v", err)
+	}
+	if _, _, err := app.extendSession(ss.username, ss.password, 1); !errors.Is(err, ERR_MAX_EXTENSIONS) {
+		t.Errorf("error: third extension returned %v, expected ERR_MAX_EXTENSIONS", err)
+	}
+
+	// A session which srd is already expiring cannot be extended.
+	expiring := activeSession(t, app, time.Now())
+	app.sm.expiry.Remove(expiring.name)
+	if _, _, err := app.extendSession(expiring.username, expiring.password, 10); !errors.Is(err, expiry.ErrNotScheduled) {
+		t.Errorf("error: extension of an expiring session returned %v, expected ErrNotScheduled", err)
+	}
+}
+
+// TestExtendSessionAtCapacity, tests that no session can be extended while the
+// max. amount of active sessions is reached.
+func TestExtendSessionAtCapacity(t *testing.T) {
+	configValues := extensionConfiguration()
+	configValues.MaxActiveSess = 1
+	app, _ := newTestApplication(t, configValues)
+	ss := activeSession(t, app, time.Now())
+	if _, _, err := app.extendSession(ss.username, ss.password, 10); !errors.Is(err, ERR_MAX_ACTIVE) {
+		t.Errorf("error: extension at max. capacity returned %v, expected ERR_MAX_ACTIVE", err)
+	}
+}
+
+// TestExtendSessionAPI, tests the status codes and the body of the API
+// endpoint used to extend a session.
+func TestExtendSessionAPI(t *testing.T) {
+	app, _ := newTestApplication(t, extensionConfiguration())
+	ss := activeSession(t, app, time.Now())
+
+	extend := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/session/extend", strings.NewReader(body)))
+		return rr
+	}
+	for body, status := range map[string]int{
+		`not json`: http.StatusBadRequest,
+		`{"username": "` + ss.username + `", "password": "wrong", "minutes": 10}`:               http.StatusForbidden,
+		`{"username": "` + ss.username + `", "password": "` + ss.password + `", "minutes": 60}`: http.StatusBadRequest,
+	} {
+		if rr := extend(body); rr.Code != status {
+			t.Errorf("error: extension with body %s returned %d, expected %d", body, rr.Code, status)
+		}
+	}
+
+	rr := extend(`{"username": "` + ss.username + `", "password": "` + ss.password + `", "minutes": 10}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("error: extension returned %d, expected 200: %s", rr.Code, rr.Body)
+	}
+	var res extendSessionResponse
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("error: invalid JSON response: %v", err)
+	}
+	if deadline, _ := app.sm.expiry.Deadline(ss.name); !res.ExpiresAt.Equal(deadline) || res.ExtensionsLeft != 1 {
+		t.Errorf("error: response is %+v, expected expiration at %v with 1 extension left", res, deadline)
+	}
+}
+
+// TestExtendSessionFrontend, tests that the session page does not show a
+// submitted password again, unless it is the password of the session.
+func TestExtendSessionFrontend(t *testing.T) {
+	app, _ := newTestApplication(t, extensionConfiguration())
+	var err error
+	app.templateCache, err = dyntemplate.NewTemplateCache("../../ui/html/")
+	if err != nil {
+		t.Fatalf("error: could not load templates: %v", err)
+	}
+	ss := activeSession(t, app, time.Now())
+
+	extend := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {ss.username}, "password": {password}, "minutes": {"10"}}
+		r := httptest.NewRequest(http.MethodPost, "/session/extend", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		app.routes().ServeHTTP(rr, r)
+		return rr
+	}
+
+	const guess = "guessed-password"
+	rr := extend(guess)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("error: extension with a wrong password returned %d, expected 403", rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), guess) {
+		t.Errorf("error: the session page shows the submitted password after a failed extension")
+	}
+	if !strings.Contains(rr.Body.String(), "type='password'") {
+		t.Errorf("error: the session page does not ask for the password after a failed extension")
+	}
+
+	rr = extend(ss.password)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("error: extension returned %d, expected 200", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), ss.password) {
+		t.Errorf("error: the session page does not show the credentials after the extension")
+	}
+}
@@ -2,12 +2,32 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/erodrigufer/pongo/internal/audit"
+	"github.com/erodrigufer/pongo/internal/backend"
+	"github.com/erodrigufer/pongo/internal/expiry"
 	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
+	"github.com/erodrigufer/pongo/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// scdRetryDelay, time that scd waits before trying to create a new session,
+// if no container engine could receive it.
+const scdRetryDelay = 5 * time.Second
+
+// poolReadySessions, amount of available sessions from which the pool is
+// ready (at most the max. amount of available sessions), e.g. to start the
+// health checks.
+const poolReadySessions = 3
+
+// maxConcurrentSnapshots, max. amount of snapshots of expired sessions taken
+// simultaneously.
+const maxConcurrentSnapshots = 4
+
 // initializeSessionManager, this method creates and populates all the channels
 // and data structures required for the sm daemons.
 func (app *application) initializeSessionManager() {
@@ -17,6 +37,9 @@ func (app *application) initializeSessionManager() {
 	// sessions that are then immediately sent to the channel. An unbuffered
 	// channel blocks a sender until a receiver is ready.
 	sm.availableSessions = make(chan session, app.configurations.MaxAvailableSess)
+	// sm.poolReady is closed by scd once the pool of available sessions is
+	// ready for the first time.
+	sm.poolReady = make(chan struct{})
 	// Create a channel to receive requests for a session from clients.
 	// The clients will send a clientReq to this channel, so that the
 	// session manager can use the received channel as a channel to respond to
@@ -24,10 +47,24 @@ func (app *application) initializeSessionManager() {
 	// block until the server reads their request, and the number of concurrent
 	// requests is unlimited.
 	sm.requestSession = make(chan clientReq)
-	// Channel sm.activeSessions stores the sessions that have been delivered
-	// to clients, so that srd can check periodically if the sessions have
+	// sm.activeSessions tracks the sessions that have been delivered to
+	// clients, so that srd can check periodically if the sessions have
 	// exceeded their maximum lifetime, and if so, it terminates the sessions.
-	sm.activeSessions = make(chan session, app.configurations.MaxActiveSess)
+	// The tracker never holds more than MaxActiveSess sessions, smd checks its
+	// capacity before delivering a new session to a client.
+	sm.activeSessions = newSessionTracker(app.configurations.MaxActiveSess)
+	// sm.expiry schedules the expiration of every active session, srd is
+	// notified as soon as the lifetime of a session is over.
+	sm.expiry = expiry.NewScheduler()
+	// sm.warnings schedules the warnings about the upcoming expiration of
+	// every active session.
+	sm.warnings = expiry.NewScheduler()
+	// sm.usage stores the last sample of the resource usage of every active
+	// session, taken by csd.
+	sm.usage = newUsageTracker()
+	// sm.snapshotSlots is buffered, a slot is taken while the snapshot of an
+	// expired session is exported.
+	sm.snapshotSlots = make(chan struct{}, maxConcurrentSnapshots)
 	app.sm = sm
 
 }
@@ -55,25 +92,54 @@ func (app *application) smd(ctx context.Context) {
 			return
 		}
 
+		// Trace the handling of the request as part of the trace of the
+		// client's request.
+		_, span := app.tracer.Start(trace.ContextWithSpanContext(ctx, req.reqInfo.spanContext), "smd deliverSession")
+		// respond, sends a response back to the client and ends the span.
+		respond := func(response smResponse) {
+			if response.errors == nil {
+				span.SetAttributes(tracing.Session(response.session.name, response.session.challenge, response.session.engine)...)
+			}
+			tracing.Error(span, response.errors)
+			span.End()
+			// The rejections of probes are expected by the health monitor,
+			// they are not rejections of participants.
+			if req.reqInfo.probe == probeNone {
+				app.countRejection(response.errors)
+			}
+			req.respCh <- response
+		}
+
+		// Answer the probes of the health monitor before the throttle of the
+		// clients, without delivering a session.
+		if req.reqInfo.probe != probeNone {
+			span.SetAttributes(attribute.String("pongo.probe", string(req.reqInfo.probe)))
+			respond(app.answerProbe(req.reqInfo.probe, timeLastRequest))
+			continue // Loop back to the beginning, wait for next request.
+		}
+
 		tlr, ok := timeLastRequest[req.reqInfo.clientAddr]
 		if !ok {
 			app.infoLog.Printf("smd: client (%s) is establishing a connection for the first time.", req.reqInfo.clientAddr)
 		}
 		// Check when was the last request from this client.
 		if ok {
-			if timeDiff := time.Since(tlr); timeDiff < time.Duration(app.configurations.TimeBetweenRequests)*time.Minute {
+			if app.tooSoon(tlr) {
 				app.infoLog.Printf("smd: Not enough time has passed since last request by client %s", req.reqInfo.clientAddr)
 				response := smResponse{}
 				// Send ERR_LAST_REQ = not enough time has passed since last
 				// request, so that the client can identify the exact error
 				// that took place.
 				response.errors = ERR_LAST_REQ
-				req.respCh <- response
+				respond(response)
 				continue // Loop back to the beginning, wait for next request.
 			}
 		}
-		// The last request was before the minimum time between request, update
-		// time of last request.
+		// The last request was before the minimum time between requests,
+		// update the time of the last request. Every request that passes the
+		// throttle counts, also if it is rejected below because no session
+		// can be delivered, so that clients cannot poll smd while the pool is
+		// full or empty.
 		timeLastRequest[req.reqInfo.clientAddr] = time.Now()
 		app.infoLog.Printf("smd: Req from %s at time: %v.", req.reqInfo.clientAddr, timeLastRequest[req.reqInfo.clientAddr])
 
@@ -81,30 +147,73 @@ func (app *application) smd(ctx context.Context) {
 		// send a response back to the client.
 		response := smResponse{}
 
-		// Check if there are no more available sessions.
-		if len(app.sm.availableSessions) == 0 {
-			// Send error to client.
-			response.errors = fmt.Errorf("no more sessions are currently available.")
-			req.respCh <- response
+		// Check if the max. amount of active sessions has been reached, before
+		// taking a session out of the available sessions. smd is the only
+		// daemon adding sessions to the tracker, so the tracker cannot become
+		// full between this check and the moment the session is added.
+		if app.sm.activeSessions.full() {
+			app.infoLog.Printf("smd: max. amount of active sessions (%d) reached, rejecting request by client %s.", app.configurations.MaxActiveSess, req.reqInfo.clientAddr)
+			response.errors = ERR_MAX_ACTIVE
+			respond(response)
 			continue // Loop back to the beginning, wait for next request.
 		}
 
-		// Get a session to deliver to client requesting session.
-		response.session = <-app.sm.availableSessions
+		// Get a session to deliver to client requesting session, without
+		// blocking if there are no more available sessions (the SSH health
+		// check of monitord also takes available sessions).
+		select {
+		case response.session = <-app.sm.availableSessions:
+		default:
+			// Send error to client.
+			response.errors = ERR_NO_AVAILABLE
+			respond(response)
+			continue // Loop back to the beginning, wait for next request.
+		}
 		prometheus.DecrementGauge(app.instrumentation, "available_sessions_total")
 		response.errors = nil
 		// Add activation time for new session. Required to kill session after
 		// lifetime expires.
 		response.session.timeActivated = time.Now()
+		// The session belongs to the client requesting it from now on.
+		response.session.owner = req.reqInfo.clientAddr
+		response.session.participant = req.reqInfo.participant
+
+		// Track the new client's session as active, before sending it to the
+		// client, so that srd is always able to find and remove it.
+		if err := app.sm.activeSessions.add(response.session); err != nil {
+			app.sessionLog(response.session).Errorf("smd: unable to track session as active: %v", err)
+			// The session was never delivered, stop it so that it does not
+			// keep running outside of any data structure.
+			if err := app.stopSession(response.session); err != nil {
+				app.sessionLog(response.session).Errorf("smd: unable to stop untracked session: %v", err)
+			}
+			response = smResponse{errors: err}
+			respond(response)
+			continue // Loop back to the beginning, wait for next request.
+		}
+		prometheus.IncrementGauge(app.instrumentation, "active_sessions_total")
+		// Schedule the expiration of the session, srd will stop the session
+		// when its lifetime is over.
+		app.scheduleExpiry(response.session.name, response.session.timeActivated.Add(response.session.lifetime))
+		app.auditSession(audit.EventDelivered, response.session, "", nil)
 
 		// Send requested session back to client wrapped in a smResponse struct.
-		req.respCh <- response
+		respond(response)
+	}
+}
 
-		// Send new client's session to the activeSessions channel. If the
-		// buffered channel is completely full, then this call will block, since
-		// the maximum number of active sessions has been achieved.
-		app.sm.activeSessions <- response.session
-		prometheus.IncrementGauge(app.instrumentation, "active_sessions_total")
+// signalPoolReady, closes poolReady once the pool of available sessions holds
+// poolReadySessions sessions (or all the sessions it can hold) for the first
+// time.
+func (app *application) signalPoolReady() {
+	threshold := poolReadySessions
+	if app.configurations.MaxAvailableSess < threshold {
+		threshold = app.configurations.MaxAvailableSess
+	}
+	if len(app.sm.availableSessions) >= threshold {
+		app.sm.poolReadyOnce.Do(func() {
+			close(app.sm.poolReady)
+		})
 	}
 }
 
@@ -114,10 +223,23 @@ func (app *application) smd(ctx context.Context) {
 func (app *application) scd(ctx context.Context) {
 	for {
 		// ss is the next session that will be added to availableSessions chan.
-		ss, err := app.createSession()
+		// The creation is not cancelled at shutdown, so that no session is
+		// left half-created.
+		ss, err := app.createSession(context.Background())
 		if err != nil {
 			err = fmt.Errorf("scd: unable to create session: %w", err)
 			app.errorLog.Print(err)
+			// If no engine can receive new sessions, wait until capacity is
+			// given back or an engine becomes healthy again.
+			if errors.Is(err, backend.ERR_NO_CAPACITY) {
+				select {
+				case <-time.After(scdRetryDelay):
+				case <-ctx.Done():
+					app.infoLog.Print("scd: shutting down.")
+					app.wg.Done()
+					return
+				}
+			}
 			continue
 		}
 		// scd blocks in the next call if the max. capacity of the channel is
@@ -126,117 +248,94 @@ func (app *application) scd(ctx context.Context) {
 		select {
 		case app.sm.availableSessions <- ss:
 			prometheus.IncrementGauge(app.instrumentation, "available_sessions_total")
+			app.signalPoolReady()
 			break
 		case <-ctx.Done():
 			// Stop the session waiting to be sent to the availableSession chan.
 			// Otherwise, this session will not be cleaned up when the channels
 			// are emptied out.
 			if err := app.stopSession(ss); err != nil {
-				err = fmt.Errorf("scd: unable to stop session dangling outside of any channel: %w", err)
-				app.errorLog.Print(err)
+				app.sessionLog(ss).Errorf("scd: unable to stop session dangling outside of any channel: %v", err)
 			}
 			app.infoLog.Print("scd: shutting down.")
 			app.wg.Done()
 			return
 		}
 
-		app.infoLog.Printf("scd: sent new session %s to availableSessions ch.", ss.name)
+		app.sessionLog(ss).Info("scd: sent new session to availableSessions ch.")
 		app.infoLog.Printf("scd: current number of sessions in availableSessions ch: %d", len(app.sm.availableSessions))
 
 	}
 
 }
 
-// srd, session removal daemon is in charge of periodically checking the
-// activeSessions chan and stopping the sessions that are older than a given
-// time scale. It guarantees that all session will not live more than a given
-// time (after their activation).
+// srd, session removal daemon is in charge of stopping every active session
+// exactly when its lifetime is over. It guarantees that all session will not
+// live more than their lifetime (after their activation).
 func (app *application) srd(ctx context.Context) {
-	// freq, the frequency with which srd will be called to clean the
-	// activeSessions chan, convert the frequency parsed from flags to a
-	// time.Duration value.
-	freq := time.Minute * time.Duration(app.configurations.SRDFreq)
-	// maxLifetime, is the maxLifetime of a session, convert lifetime parsed
-	// from flags to time.Duration value.
-	maxLifetime := time.Minute * time.Duration(app.configurations.LifetimeSess)
+	app.infoLog.Print("srd: waiting for active sessions to expire.")
+	// Run blocks until ctx is cancelled, expireSession is called every time
+	// the deadline of an active session is reached.
+	app.sm.expiry.Run(ctx, app.expireSession)
+	// Wait for the expired sessions still being snapshotted, so that they are
+	// not stopped twice at shutdown.
+	app.sm.expiring.Wait()
+	app.infoLog.Print("srd: shutting down.")
+	app.wg.Done()
+}
 
-	oldestSession := session{}
-	getNewSession := true
-	// for-loop for the timer.
-	for {
-		// Start a timer which will return after freq.
-		timer := time.NewTimer(freq)
-		app.infoLog.Printf("srd: next check in %v.", freq)
-		// After the time of the timer expires, the current time will be sent
-		// through its channel, discard the value. The read from the chan will
-		// block until the timer expires.
-		select {
-		case <-timer.C:
-			break
-		case <-ctx.Done():
-			app.infoLog.Print("srd: shutting down.")
-			app.wg.Done()
-			return
-		}
-		app.infoLog.Print("srd: checking max. lifetime of active sessions.")
-		// for-loop to check multiple sessions, until the oldest session has not
-		// expired.
-		keepCheckingSessions := true
-		for keepCheckingSessions {
-			// This first check is necessary in case that in the last iteration
-			// the oldestSession did not expire. So that in the next iteration,
-			// no newer sessions would be read first from the channel. And the
-			// program checks first if the last oldestSession expired yet.
-			if getNewSession {
-				select {
-				// activeSessions is a FIFO, read the oldest session.
-				case oldestSession = <-app.sm.activeSessions:
-				// If there are no activeSessions, re-start the loop and start
-				// a new timer (default). The read-call on activeSessions never
-				// blocks. Break out of the inner-loop.
-				default:
-					// It breaks out of inner-loop in the next if-statement.
-					keepCheckingSessions = false
-				}
-			}
-			// If no oldestSession was read from the channel break out of inner
-			// loop. Re-start timer in outer-loop. This statement is required,
-			// because writing the break inside the 'default' case, would only
-			// break out of the 'select'.
-			if !keepCheckingSessions {
-				break
-			}
-			// Calculate the time elapsed since the activation of the oldest
-			// session.
-			timeElapsed := time.Since(oldestSession.timeActivated)
-			// Check if oldest session expired.
-			if timeElapsed > maxLifetime {
-				if err := app.stopSession(oldestSession); err != nil {
-					err = fmt.Errorf("srd: unable to stop expired session (%s): %w", oldestSession.name, err)
-					app.errorLog.Print(err)
-					// error stopping oldest expired session, break out of
-					// the inner-loop and re-start the timer, try again
-					// later.
-					keepCheckingSessions = false
-				}
-				app.infoLog.Printf("srd: expired session (%s) successfully stopped.", oldestSession.name)
-				prometheus.DecrementGauge(app.instrumentation, "active_sessions_total")
-				// Check the next oldest session. 'continue', restarts the inner
-				// loop. Guarantee that the value to get next activateSessions
-				// is true.
-				getNewSession = true
-				continue
-			} else {
-				// If the oldestSession has not expired yet, continue to the
-				// next outer for-loop iteration and restart the timer. Break
-				// out of the inner for-loop.
-				keepCheckingSessions = false
-				// Do not get new sessions values from the activeSessions
-				// channel, since the current oldestSession has not expired yet.
-				getNewSession = false
-			}
-		}
+// expireSession, stops an active session whose lifetime is over. If the
+// session cannot be stopped, its expiration is scheduled again after the
+// retry interval defined by the user configurations (SRDFreq).
+// Parameters: name of the expired session.
+func (app *application) expireSession(name string, _ time.Time) {
+	ss, ok := app.sm.activeSessions.get(name)
+	if !ok {
+		// The session was already removed, e.g. at shutdown.
+		return
 	}
+	if app.wantsSnapshot(ss) && !ss.snapshotted {
+		// Keep the files of the participant before they are gone. Exporting
+		// them can take up to snapshotTimeout, so the snapshot is taken
+		// outside of srd, otherwise it would delay the expiration of every
+		// other session.
+		app.sm.expiring.Add(1)
+		go func() {
+			defer app.sm.expiring.Done()
+			app.sm.snapshotSlots <- struct{}{}
+			app.snapshotActiveSession(ss)
+			<-app.sm.snapshotSlots
+			app.stopExpiredSession(ss)
+		}()
+		return
+	}
+	app.stopExpiredSession(ss)
+}
+
+// stopExpiredSession, stops an expired session (see expireSession).
+func (app *application) stopExpiredSession(ss session) {
+	if err := app.stopSession(ss); err != nil {
+		retry := time.Minute * time.Duration(app.configurations.SRDFreq)
+		app.sessionLog(ss).Errorf("srd: unable to stop expired session, retrying in %v: %v", retry, err)
+		app.sm.expiry.Schedule(ss.name, time.Now().Add(retry))
+		return
+	}
+	app.sm.activeSessions.remove(ss.name)
+	app.unscheduleWarnings(ss.name)
+	prometheus.DecrementGauge(app.instrumentation, "active_sessions_total")
+
+	// Compare the actual lifetime of the session with its intended lifetime
+	// (which includes any extensions of the session). The deadline of the
+	// expiration is not used, since it includes the retry delay if the
+	// session could not be stopped at its first deadline.
+	actual := time.Since(ss.timeActivated)
+	intended := ss.lifetime
+	if err := prometheus.ObserveHistogram(app.instrumentation, (actual - intended).Seconds(), "session_lifetime_deviation_seconds"); err != nil {
+		app.errorLog.Printf("prometheus: unable to observe value for histogram session_lifetime_deviation_seconds: %v", err)
+	}
+	app.observeTermination(ss, terminationExpired)
+	app.auditSession(audit.EventExpired, ss, "", map[string]string{"lifetime": actual.Round(time.Second).String()})
+	app.sessionLog(ss).Infof("srd: expired session successfully stopped after %v.", actual.Round(time.Second))
 }
 
 // stopAllSessions, stops all active and available sessions.
@@ -248,8 +347,7 @@ func (app *application) stopAllSessions() {
 		case ss := <-app.sm.availableSessions:
 			// Close session
 			if err := app.stopSession(ss); err != nil {
-				err = fmt.Errorf("error stopping session at shutdown: %w", err)
-				app.errorLog.Print(err)
+				app.sessionLog(ss).Errorf("error stopping session at shutdown: %v", err)
 				continue // Try next session in the channel.
 			}
 		default:
@@ -260,27 +358,25 @@ func (app *application) stopAllSessions() {
 	}
 	app.infoLog.Print("Finish stopping sessions from channel 'availableSessions'.")
 
-	activeSessions := true
-	for activeSessions {
-		select {
-		case ss := <-app.sm.activeSessions:
-			// Close session
-			if err := app.stopSession(ss); err != nil {
-				err = fmt.Errorf("error stopping session at shutdown: %w", err)
-				app.errorLog.Print(err)
-				continue // Try next session in the channel.
-			}
-		default:
-			// No more sessions in channel, break out of for-loop.
-			activeSessions = false
-			break
+	for _, ss := range app.sm.activeSessions.list() {
+		app.sm.activeSessions.remove(ss.name)
+		app.sm.expiry.Remove(ss.name)
+		app.unscheduleWarnings(ss.name)
+		// Close session
+		if err := app.stopSession(ss); err != nil {
+			app.sessionLog(ss).Errorf("error stopping session at shutdown: %v", err)
+			continue // Try next active session.
 		}
+		app.observeTermination(ss, terminationShutdown)
+		app.auditSession(audit.EventTerminated, ss, "", map[string]string{"reason": "shutdown"})
 	}
-	app.infoLog.Print("Finish stopping sessions from channel 'activeSessions'.")
+	app.infoLog.Print("Finish stopping active sessions.")
 
 	// Stop SSH Piper container and remove its network.
 	if err := app.stopReverseProxy(); err != nil {
 		app.errorLog.Print(err)
 	}
+	// Remove the networks of the remote engines.
+	app.stopEngines()
 
 }
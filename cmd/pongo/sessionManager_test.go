@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/backend"
+	"github.com/erodrigufer/pongo/internal/logging"
+	"github.com/erodrigufer/pongo/internal/pongo"
+	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// newTestApplication, returns an application that manages its sessions in an
+// in-memory container runtime, with the reverse proxy already initialized.
+func newTestApplication(t *testing.T, configValues pongo.UserConfiguration) (*application, *backend.Fake) {
+	t.Helper()
+	fake := backend.NewFake()
+	app := new(application)
+	app.configurations = configValues
+	if err := app.setupLoggers(io.Discard); err != nil {
+		t.Fatalf("error: could not set up loggers: %v", err)
+	}
+	app.instrumentation = prometheus.NoOpsInstrumentation()
+	// Spans are not exported, tests of the spans set their own provider.
+	app.setupTracing(sdktrace.NewTracerProvider())
+	app.runtime = fake
+	app.images.entrypointImage = "entrypoint"
+	app.images.sshPiperImage = "sshpiperd"
+	app.sshPiperFileSystem = t.TempDir()
+	app.engine.endpoint = backend.Endpoint{Engine: backend.EngineDocker, Host: "unix:///var/run/docker.sock"}
+	app.initializeSessionManager()
+	if err := app.setupEngines(); err != nil {
+		t.Fatalf("error: could not set up engines: %v", err)
+	}
+	if err := app.initializeReverseProxy(); err != nil {
+		t.Fatalf("error: could not initialize reverse proxy: %v", err)
+	}
+	return app, fake
+}
+
+// testConfiguration, returns the configuration used by most tests.
+func testConfiguration() pongo.UserConfiguration {
+	return pongo.UserConfiguration{
+		SSHPort:             "50000",
+		LogFormat:           logging.FormatText,
+		MaxAvailableSess:    2,
+		MaxActiveSess:       5,
+		LifetimeSess:        60,
+		SRDFreq:             1,
+		TimeBetweenRequests: 5,
+		Placement:           backend.PlacementSpread,
+	}
+}
+
+// waitFor, waits until cond returns true, or fails the test after a timeout.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("error: timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// request, sends a request for a session to smd on behalf of a client.
+func request(app *application, clientAddr string) smResponse {
+	respCh := make(chan smResponse, 1)
+	app.sm.requestSession <- clientReq{respCh: respCh, reqInfo: reqInfo{clientAddr: clientAddr}}
+	return <-respCh
+}
+
+// TestCreateAndStopSession, tests that a session runs in its own upstream
+// container, in which its user is created and which is registered in the
+// reverse proxy, and that stopping the session removes the container.
+func TestCreateAndStopSession(t *testing.T) {
+	app, fake := newTestApplication(t, testConfiguration())
+
+	ss, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	if len(ss.containersIDs) != 1 {
+		t.Fatalf("error: session has %d containers, expected 1", len(ss.containersIDs))
+	}
+	upstream, ok := fake.Container(ss.containersIDs[0])
+	if !ok || !upstream.Running {
+		t.Fatalf("error: upstream container of session is not running")
+	}
+	if upstream.Name != ss.name || upstream.Config.Image != "entrypoint" {
+		t.Errorf("error: upstream container is %s (%s), expected %s (entrypoint)", upstream.Name, upstream.Config.Image, ss.name)
+	}
+	if len(upstream.Networks) != 1 || upstream.Networks[0] != app.networkIDreverseProxy {
+		t.Errorf("error: upstream container is connected to %v, expected only the reverse proxy network", upstream.Networks)
+	}
+	if len(upstream.Execs) == 0 || upstream.Execs[0][0] != "useradd" || upstream.Execs[0][len(upstream.Execs[0])-1] != ss.username {
+		t.Errorf("error: user of the session was not created, execs: %v", upstream.Execs)
+	}
+	for i, cmd := range upstream.Execs {
+		if strings.Contains(strings.Join(cmd, " "), ss.password) {
+			t.Errorf("error: password of the session is in the arguments of the command %v", cmd)
+		}
+		if cmd[0] == "chpasswd" && upstream.Stdins[i] != ss.username+":"+ss.password+"\n" {
+			t.Errorf("error: chpasswd received %q on its standard input", upstream.Stdins[i])
+		}
+	}
+	piper, _ := fake.Container(app.sshPiperContainerID)
+	if len(piper.Execs) != 1 || piper.Execs[0][0] != "/sshpiperd" {
+		t.Errorf("error: session was not added as an upstream to the reverse proxy, execs: %v", piper.Execs)
+	}
+
+	if err := app.stopSession(ss); err != nil {
+		t.Fatalf("error: could not stop session: %v", err)
+	}
+	if _, ok := fake.Container(ss.containersIDs[0]); ok {
+		t.Errorf("error: upstream container still exists after the session was stopped")
+	}
+
+	// A failing exec must make the creation of the session fail.
+	fake.Fail("Exec", errors.New("exec failed"))
+	if _, err := app.createSession(context.Background()); err == nil {
+		t.Errorf("error: createSession should fail if the user cannot be created")
+	}
+}
+
+// TestCreateSessionCleanup, tests that the containers of a session whose
+// creation failed are removed, and that its capacity is given back to its
+// engine.
+func TestCreateSessionCleanup(t *testing.T) {
+	for _, op := range []string{"StartContainer", "Exec"} {
+		t.Run(op, func(t *testing.T) {
+			app, fake := newTestApplication(t, testConfiguration())
+			before := len(fake.Containers())
+			fake.Fail(op, errors.New(op+" failed"))
+			if _, err := app.createSession(context.Background()); err == nil {
+				t.Fatalf("error: createSession should fail if %s fails", op)
+			}
+			if containers := fake.Containers(); len(containers) != before {
+				t.Errorf("error: %d containers exist after the failed creation, expected %d", len(containers), before)
+			}
+			for _, status := range app.engines.Status() {
+				if status.Sessions != 0 {
+					t.Errorf("error: engine %s holds %d sessions after the failed creation, expected 0", status.Name, status.Sessions)
+				}
+			}
+		})
+	}
+}
+
+// TestSessionDaemons, tests that scd keeps sessions available, that smd
+// delivers them to clients, and that srd stops them once they expire.
+func TestSessionDaemons(t *testing.T) {
+	configValues := testConfiguration()
+	// Sessions expire as soon as they are delivered.
+	configValues.LifetimeSess = 0
+	app, fake := newTestApplication(t, configValues)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.wg.Add(3)
+	go app.smd(ctx)
+	go app.scd(ctx)
+	go app.srd(ctx)
+
+	waitFor(t, "available sessions", func() bool {
+		return len(app.sm.availableSessions) == configValues.MaxAvailableSess
+	})
+
+	response := request(app, "10.0.0.1")
+	if response.errors != nil {
+		t.Fatalf("error: smd did not deliver a session: %v", response.errors)
+	}
+	if response.session.owner != "10.0.0.1" {
+		t.Errorf("error: session is owned by %q, expected %q", response.session.owner, "10.0.0.1")
+	}
+	waitFor(t, "expired session to be stopped", func() bool {
+		_, exists := fake.Container(response.session.containersIDs[0])
+		return app.sm.activeSessions.len() == 0 && !exists
+	})
+
+	// The same client cannot request a new session right away.
+	if response := request(app, "10.0.0.1"); !errors.Is(response.errors, ERR_LAST_REQ) {
+		t.Errorf("error: second request of the same client returned %v, expected ERR_LAST_REQ", response.errors)
+	}
+
+	cancel()
+	app.wg.Wait()
+	app.stopAllSessions()
+	if containers := fake.Containers(); len(containers) != 0 {
+		t.Errorf("error: %d containers still exist after stopping all sessions", len(containers))
+	}
+	if networks := fake.Networks(); len(networks) != 0 {
+		t.Errorf("error: networks %v still exist after stopping all sessions", networks)
+	}
+}
+
+// TestSMDRejectionThrottled, tests that a request rejected because no session
+// is available still counts as the last request of the client, so that
+// clients cannot poll smd while the pool is empty.
+func TestSMDRejectionThrottled(t *testing.T) {
+	app, _ := newTestApplication(t, testConfiguration())
+	startSMD(t, app)
+
+	if response := request(app, "10.0.0.1"); !errors.Is(response.errors, ERR_NO_AVAILABLE) {
+		t.Fatalf("error: request without available sessions returned %v, expected ERR_NO_AVAILABLE", response.errors)
+	}
+	ss, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	app.sm.availableSessions <- ss
+	if response := request(app, "10.0.0.1"); !errors.Is(response.errors, ERR_LAST_REQ) {
+		t.Errorf("error: retry right after a rejection returned %v, expected ERR_LAST_REQ", response.errors)
+	}
+	// Other clients are not throttled by the rejection.
+	if response := request(app, "10.0.0.2"); response.errors != nil {
+		t.Errorf("error: request of another client returned %v, expected a session", response.errors)
+	}
+}
+
+// TestSMDMaxActive, tests that smd rejects requests once the max. amount of
+// active sessions is reached.
+func TestSMDMaxActive(t *testing.T) {
+	configValues := testConfiguration()
+	configValues.MaxActiveSess = 1
+	app, _ := newTestApplication(t, configValues)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.wg.Add(2)
+	go app.smd(ctx)
+	go app.scd(ctx)
+	defer func() {
+		cancel()
+		app.wg.Wait()
+		app.stopAllSessions()
+	}()
+
+	waitFor(t, "available sessions", func() bool {
+		return len(app.sm.availableSessions) == configValues.MaxAvailableSess
+	})
+	if response := request(app, "10.0.0.1"); response.errors != nil {
+		t.Fatalf("error: smd did not deliver a session: %v", response.errors)
+	}
+	if response := request(app, "10.0.0.2"); !errors.Is(response.errors, ERR_MAX_ACTIVE) {
+		t.Errorf("error: request above the max. amount of active sessions returned %v, expected ERR_MAX_ACTIVE", response.errors)
+	}
+	if _, ok := app.sm.expiry.Deadline(app.sm.activeSessions.list()[0].name); !ok {
+		t.Errorf("error: expiration of the active session was not scheduled")
+	}
+}
+
+// TestPoolReady, tests that scd signals that the pool of available sessions is
+// ready once it holds all the sessions it can hold (fewer than
+// poolReadySessions in the test configuration).
+func TestPoolReady(t *testing.T) {
+	app, _ := newTestApplication(t, testConfiguration())
+	select {
+	case <-app.sm.poolReady:
+		t.Fatal("error: the pool is ready without available sessions")
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.wg.Add(1)
+	go app.scd(ctx)
+	defer func() {
+		cancel()
+		app.wg.Wait()
+		app.stopAllSessions()
+	}()
+
+	select {
+	case <-app.sm.poolReady:
+	case <-time.After(5 * time.Second):
+		t.Fatal("error: timed out waiting for the pool to be ready")
+	}
+	if n := len(app.sm.availableSessions); n != app.configurations.MaxAvailableSess {
+		t.Errorf("error: the pool is ready with %d available sessions, want %d", n, app.configurations.MaxAvailableSess)
+	}
+}
+
+// TestLifetimeDeviation, tests that the deviation of the lifetime of a session
+// which could only be stopped after a retry is measured against its intended
+// lifetime, and not against the deadline of the retry.
+func TestLifetimeDeviation(t *testing.T) {
+	app, fake := newTestApplication(t, testConfiguration())
+	reg := promclient.NewRegistry()
+	var err error
+	app.instrumentation, err = prometheus.NewInstrumentation(reg)
+	if err != nil {
+		t.Fatalf("error: could not start instrumentation: %v", err)
+	}
+
+	ss, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	// The session should have expired two minutes ago.
+	ss.lifetime = time.Minute
+	ss.timeActivated = time.Now().Add(-3 * time.Minute)
+	if err := app.sm.activeSessions.add(ss); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Fail("StopContainer", errors.New("stop failed"))
+	app.expireSession(ss.name, ss.timeActivated.Add(ss.lifetime))
+	retry, ok := app.sm.expiry.Deadline(ss.name)
+	if !ok {
+		t.Fatalf("error: expiration of session which could not be stopped was not scheduled again")
+	}
+	fake.Fail("StopContainer", nil)
+	app.expireSession(ss.name, retry)
+	if app.sm.activeSessions.len() != 0 {
+		t.Fatalf("error: session was not stopped after the retry")
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("error: could not gather metrics: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() != "session_lifetime_deviation_seconds" {
+			continue
+		}
+		h := f.GetMetric()[0].GetHistogram()
+		if h.GetSampleCount() != 1 || h.GetSampleSum() < 119 {
+			t.Errorf("error: observed a deviation of %vs in %d samples, expected about 120s in 1 sample", h.GetSampleSum(), h.GetSampleCount())
+		}
+		return
+	}
+	t.Errorf("error: no deviation of the lifetime was observed")
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/backend"
+	dyntemplate "github.com/erodrigufer/pongo/internal/pongo/templates"
+	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
+)
+
+const (
+	// alertMining, raised when a session uses more CPU than AlertCPU, e.g.
+	// when it runs a crypto miner.
+	alertMining = "mining"
+	// alertScanning, raised when a session transmits more packets per second
+	// than AlertNetPackets, e.g. when it scans other hosts.
+	alertScanning = "scanning"
+)
+
+// alertSamples, amount of consecutive samples in which a threshold has to be
+// exceeded before its alert is raised, so that short bursts (e.g. compiling
+// a program) do not raise alerts.
+const alertSamples = 3
+
+// statsTimeout, max. time that sampling the resource usage of a single
+// session can take.
+const statsTimeout = 10 * time.Second
+
+// sessionGauges, gauges with the resource usage of every active session.
+var sessionGauges = []string{
+	"session_cpu_percent",
+	"session_memory_bytes",
+	"session_network_receive_bytes_per_second",
+	"session_network_transmit_bytes_per_second",
+	"session_pids",
+}
+
+// newUsageTracker, constructor for an empty usageTracker.
+func newUsageTracker() *usageTracker {
+	ut := new(usageTracker)
+	ut.usages = make(map[string]sessionUsage)
+	return ut
+}
+
+// get, returns the resource usage of the session with the given name.
+func (ut *usageTracker) get(name string) (sessionUsage, bool) {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+
+	u, ok := ut.usages[name]
+	return u, ok
+}
+
+// set, stores the resource usage of a session.
+func (ut *usageTracker) set(u sessionUsage) {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+
+	ut.usages[u.session] = u
+}
+
+// prune, forgets the resource usage of every session which is not active
+// anymore. It returns the forgotten usages.
+func (ut *usageTracker) prune(active map[string]bool) []sessionUsage {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+
+	var pruned []sessionUsage
+	for name, u := range ut.usages {
+		if !active[name] {
+			pruned = append(pruned, u)
+			delete(ut.usages, name)
+		}
+	}
+	return pruned
+}
+
+// nextUsage, computes the resource usage of a session from a new sample and
+// the previous usage of the session (if any), and updates its alerts.
+// Parameters: cpuThreshold, CPU usage (in %) above which alertMining is
+// raised. packetThreshold, transmitted packets per second above which
+// alertScanning is raised.
+func nextUsage(prev sessionUsage, ok bool, ss session, stats backend.Stats, cpuThreshold, packetThreshold float64) sessionUsage {
+	u := sessionUsage{
+		session:   ss.name,
+		challenge: ss.challenge,
+		stats:     stats,
+		exceeded:  make(map[string]int),
+	}
+	if ok {
+		if elapsed := stats.Read.Sub(prev.stats.Read).Seconds(); elapsed > 0 {
+			u.netRxRate = rate(prev.stats.NetRxBytes, stats.NetRxBytes, elapsed)
+			u.netTxRate = rate(prev.stats.NetTxBytes, stats.NetTxBytes, elapsed)
+			u.txPacketRate = rate(prev.stats.NetTxPackets, stats.NetTxPackets, elapsed)
+		}
+		for alert, n := range prev.exceeded {
+			u.exceeded[alert] = n
+		}
+	}
+
+	thresholds := []struct {
+		alert    string
+		exceeded bool
+	}{
+		{alertMining, u.stats.CPUPercent >= cpuThreshold},
+		{alertScanning, u.txPacketRate >= packetThreshold},
+	}
+	for _, t := range thresholds {
+		if !t.exceeded {
+			u.exceeded[t.alert] = 0
+			continue
+		}
+		u.exceeded[t.alert]++
+		if u.exceeded[t.alert] >= alertSamples {
+			u.alerts = append(u.alerts, t.alert)
+		}
+	}
+	return u
+}
+
+// rate, returns the rate per second of a counter that went from prev to cur
+// in elapsed seconds. The counter restarts from 0 if the container restarts.
+func rate(prev, cur uint64, elapsed float64) float64 {
+	if cur < prev {
+		return 0
+	}
+	return float64(cur-prev) / elapsed
+}
+
+// hasAlert, reports whether alert is raised in u.
+func (u sessionUsage) hasAlert(alert string) bool {
+	for _, a := range u.alerts {
+		if a == alert {
+			return true
+		}
+	}
+	return false
+}
+
+// csd, container stats daemon periodically samples the resource usage of
+// every active session, exports it as Prometheus metrics and raises alerts
+// for the sessions which are likely being abused (mining or scanning).
+func (app *application) csd(ctx context.Context) {
+	ticker := time.NewTicker(time.Second * time.Duration(app.configurations.StatsFreq))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			break
+		case <-ctx.Done():
+			app.infoLog.Print("csd: shutting down.")
+			app.wg.Done()
+			return
+		}
+
+		app.sampleUsage(ctx)
+	}
+}
+
+// sampleUsage, samples the resource usage of every active session once. The
+// sessions are sampled concurrently, since the engine takes about a second
+// to sample the CPU usage of every container.
+func (app *application) sampleUsage(ctx context.Context) {
+	sessions := app.sm.activeSessions.list()
+	samples := make([]backend.Stats, len(sessions))
+	errs := make([]error, len(sessions))
+	var wg sync.WaitGroup
+	for i, ss := range sessions {
+		wg.Add(1)
+		go func(i int, ss session) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, statsTimeout)
+			defer cancel()
+			samples[i], errs[i] = app.sessionRuntime(ss).Stats(ctx, ss.containersIDs[0])
+		}(i, ss)
+	}
+	wg.Wait()
+
+	active := make(map[string]bool)
+	for i, ss := range sessions {
+		active[ss.name] = true
+		if errs[i] != nil {
+			// The session could have been stopped while it was sampled.
+			if _, ok := app.sm.activeSessions.get(ss.name); ok {
+				app.sessionLog(ss).Errorf("csd: unable to sample resource usage of session: %v", errs[i])
+			}
+			continue
+		}
+		prev, ok := app.sm.usage.get(ss.name)
+		u := nextUsage(prev, ok, ss, samples[i], float64(app.configurations.AlertCPU), float64(app.configurations.AlertNetPackets))
+		for _, alert := range u.alerts {
+			if !prev.hasAlert(alert) {
+				app.sessionLog(ss).WithField("alert", alert).Warnf("csd: ALERT %s: session uses %.0f%% CPU and transmits %.0f packets/s.", alert, u.stats.CPUPercent, u.txPacketRate)
+			}
+		}
+		app.sm.usage.set(u)
+		app.exportUsage(u)
+	}
+
+	for _, u := range app.sm.usage.prune(active) {
+		app.unexportUsage(u)
+	}
+}
+
+// exportUsage, exports the resource usage of a session as Prometheus gauges.
+// The network I/O is exported as the rates between the last two samples, the
+// counters of the container restart with the container and belong to a single
+// session, so they would not be usable with rate().
+func (app *application) exportUsage(u sessionUsage) {
+	values := []float64{
+		u.stats.CPUPercent,
+		float64(u.stats.MemoryBytes),
+		u.netRxRate,
+		u.netTxRate,
+		float64(u.stats.PIDs),
+	}
+	for i, name := range sessionGauges {
+		if err := prometheus.SetGauge(app.instrumentation, values[i], name, u.session, u.challenge); err != nil {
+			app.errorLog.Printf("prometheus: unable to set gauge %s: %v", name, err)
+		}
+	}
+	for _, alert := range []string{alertMining, alertScanning} {
+		value := 0.0
+		if u.hasAlert(alert) {
+			value = 1
+		}
+		if err := prometheus.SetGauge(app.instrumentation, value, "session_alert", u.session, u.challenge, alert); err != nil {
+			app.errorLog.Printf("prometheus: unable to set gauge session_alert: %v", err)
+		}
+	}
+}
+
+// unexportUsage, stops exporting the resource usage of a session which is not
+// active anymore.
+func (app *application) unexportUsage(u sessionUsage) {
+	for _, name := range sessionGauges {
+		if err := prometheus.DeleteGauge(app.instrumentation, name, u.session, u.challenge); err != nil {
+			app.errorLog.Printf("prometheus: unable to delete gauge %s: %v", name, err)
+		}
+	}
+	for _, alert := range []string{alertMining, alertScanning} {
+		if err := prometheus.DeleteGauge(app.instrumentation, "session_alert", u.session, u.challenge, alert); err != nil {
+			app.errorLog.Printf("prometheus: unable to delete gauge session_alert: %v", err)
+		}
+	}
+}
+
+// usageViews, returns every active session with its last sampled resource
+// usage, as shown in the admin view. Sessions with alerts come first.
+func (app *application) usageViews() []dyntemplate.SessionUsage {
+	var views []dyntemplate.SessionUsage
+	for _, ss := range app.sm.activeSessions.list() {
+		v := dyntemplate.SessionUsage{
+			Name:        ss.name,
+			Username:    ss.username,
+			Owner:       ss.owner,
+			Challenge:   ss.challenge,
+			Engine:      ss.engine,
+			ActivatedAt: ss.timeActivated,
+			ExpiresAt:   ss.timeActivated.Add(ss.lifetime),
+		}
+		if u, ok := app.sm.usage.get(ss.name); ok {
+			v.Sampled = true
+			v.SampledAt = u.stats.Read
+			v.CPUPercent = u.stats.CPUPercent
+			v.MemoryMiB = float64(u.stats.MemoryBytes) / (1 << 20)
+			v.NetRxKiBs = u.netRxRate / (1 << 10)
+			v.NetTxKiBs = u.netTxRate / (1 << 10)
+			v.TxPackets = u.txPacketRate
+			v.PIDs = u.stats.PIDs
+			v.Alerts = u.alerts
+		}
+		views = append(views, v)
+	}
+	sort.Slice(views, func(i, j int) bool {
+		if (len(views[i].Alerts) > 0) != (len(views[j].Alerts) > 0) {
+			return len(views[i].Alerts) > 0
+		}
+		return views[i].Name < views[j].Name
+	})
+	return views
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/backend"
+	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
+	promclient "github.com/prometheus/client_golang/prometheus"
+)
+
+// TestNextUsage, tests that the network rates of a session are computed from
+// consecutive samples, and that an alert is only raised after its threshold
+// was exceeded in alertSamples consecutive samples.
+func TestNextUsage(t *testing.T) {
+	ss := session{name: "s1", challenge: "entrypoint"}
+	start := time.Now()
+	sample := func(i int, cpu float64, txPackets uint64) backend.Stats {
+		return backend.Stats{
+			Read:         start.Add(time.Duration(i) * 10 * time.Second),
+			CPUPercent:   cpu,
+			NetTxBytes:   uint64(i) * 10240,
+			NetTxPackets: txPackets,
+		}
+	}
+
+	u := nextUsage(sessionUsage{}, false, ss, sample(0, 95, 0), 90, 1000)
+	if u.netTxRate != 0 || len(u.alerts) != 0 {
+		t.Fatalf("error: first sample has rates or alerts: %+v", u)
+	}
+	u = nextUsage(u, true, ss, sample(1, 95, 20000), 90, 1000)
+	if u.netTxRate != 1024 || u.txPacketRate != 2000 {
+		t.Errorf("error: rates are %.0f B/s and %.0f packets/s, expected 1024 B/s and 2000 packets/s", u.netTxRate, u.txPacketRate)
+	}
+	if len(u.alerts) != 0 {
+		t.Errorf("error: alerts %v raised before %d samples exceeded the thresholds", u.alerts, alertSamples)
+	}
+	u = nextUsage(u, true, ss, sample(2, 95, 40000), 90, 1000)
+	if !u.hasAlert(alertMining) || u.hasAlert(alertScanning) {
+		t.Errorf("error: alerts are %v, expected only %s", u.alerts, alertMining)
+	}
+	u = nextUsage(u, true, ss, sample(3, 95, 60000), 90, 1000)
+	if !u.hasAlert(alertMining) || !u.hasAlert(alertScanning) {
+		t.Errorf("error: alerts are %v, expected %s and %s", u.alerts, alertMining, alertScanning)
+	}
+
+	// The alerts are cleared as soon as the usage drops below the thresholds,
+	// and the counter of a restarted container does not produce a rate.
+	u = nextUsage(u, true, ss, sample(4, 5, 0), 90, 1000)
+	if len(u.alerts) != 0 || u.txPacketRate != 0 {
+		t.Errorf("error: alerts %v (%.0f packets/s) are still raised after the usage dropped", u.alerts, u.txPacketRate)
+	}
+}
+
+// TestSampleUsage, tests that csd samples the resource usage of the active
+// sessions and forgets the usage of the sessions that are stopped.
+func TestSampleUsage(t *testing.T) {
+	configValues := testConfiguration()
+	configValues.AlertCPU = 90
+	configValues.AlertNetPackets = 1000
+	app, fake := newTestApplication(t, configValues)
+
+	ss, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	ss.timeActivated = time.Now()
+	if err := app.sm.activeSessions.add(ss); err != nil {
+		t.Fatalf("error: could not activate session: %v", err)
+	}
+	fake.SetStats(ss.containersIDs[0], backend.Stats{CPUPercent: 99, MemoryBytes: 64 << 20, PIDs: 3})
+
+	for i := 0; i < alertSamples; i++ {
+		app.sampleUsage(context.Background())
+	}
+	u, ok := app.sm.usage.get(ss.name)
+	if !ok {
+		t.Fatalf("error: resource usage of the active session was not sampled")
+	}
+	if u.stats.MemoryBytes != 64<<20 || u.stats.PIDs != 3 || !u.hasAlert(alertMining) {
+		t.Errorf("error: unexpected usage of session: %+v", u)
+	}
+	views := app.usageViews()
+	if len(views) != 1 || !views[0].Sampled || views[0].MemoryMiB != 64 || len(views[0].Alerts) != 1 {
+		t.Errorf("error: unexpected admin view of sessions: %+v", views)
+	}
+
+	app.sm.activeSessions.remove(ss.name)
+	if err := app.stopSession(ss); err != nil {
+		t.Fatalf("error: could not stop session: %v", err)
+	}
+	app.sampleUsage(context.Background())
+	if _, ok := app.sm.usage.get(ss.name); ok {
+		t.Errorf("error: resource usage of a stopped session is still tracked")
+	}
+}
+
+// TestExportUsage, tests that the network I/O of a session is exported as
+// the rates between its last two samples, not as the counters of its
+// container.
+func TestExportUsage(t *testing.T) {
+	app, _ := newTestApplication(t, testConfiguration())
+	reg := promclient.NewRegistry()
+	var err error
+	app.instrumentation, err = prometheus.NewInstrumentation(reg)
+	if err != nil {
+		t.Fatalf("error: could not start instrumentation: %v", err)
+	}
+
+	ss := session{name: "s1", challenge: "entrypoint"}
+	start := time.Now()
+	u := nextUsage(sessionUsage{}, false, ss, backend.Stats{Read: start, NetRxBytes: 1 << 20, NetTxBytes: 1 << 20}, 90, 1000)
+	u = nextUsage(u, true, ss, backend.Stats{Read: start.Add(10 * time.Second), NetRxBytes: 1<<20 + 20480, NetTxBytes: 1<<20 + 10240}, 90, 1000)
+	app.exportUsage(u)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("error: could not gather metrics: %v", err)
+	}
+	expected := map[string]float64{
+		"session_network_receive_bytes_per_second":  2048,
+		"session_network_transmit_bytes_per_second": 1024,
+	}
+	for _, f := range families {
+		want, ok := expected[f.GetName()]
+		if !ok {
+			continue
+		}
+		delete(expected, f.GetName())
+		if got := f.GetMetric()[0].GetGauge().GetValue(); got != want {
+			t.Errorf("error: %s is %v, expected %v", f.GetName(), got, want)
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("error: metrics %v were not exported", expected)
+	}
+}
+
+// TestRequireAdmin, tests that the admin view is only reachable with the
+// credentials of the administrator.
+func TestRequireAdmin(t *testing.T) {
+	configValues := testConfiguration()
+	configValues.AdminUser = "admin"
+	configValues.AdminPassword = "secret"
+	app, _ := newTestApplication(t, configValues)
+	handler := app.requireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		auth     bool
+		want     int
+	}{
+		{"no credentials", "", "", false, http.StatusUnauthorized},
+		{"wrong password", "admin", "guess", true, http.StatusUnauthorized},
+		{"wrong user", "root", "secret", true, http.StatusUnauthorized},
+		{"valid credentials", "admin", "secret", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/sessions", nil)
+			if tt.auth {
+				r.SetBasicAuth(tt.user, tt.password)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("error: status is %d, expected %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("error: unauthorized response does not ask for credentials")
+			}
+		})
+	}
+}
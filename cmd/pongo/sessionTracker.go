@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// newSessionTracker, constructor for a sessionTracker that can hold at most
+// capacity sessions simultaneously.
+func newSessionTracker(capacity int) *sessionTracker {
+	st := new(sessionTracker)
+	st.sessions = make(map[string]session)
+	st.capacity = capacity
+	return st
+}
+
+// add, starts tracking a session. If the tracker already holds the max.
+// amount of sessions, the session is not added and ERR_MAX_ACTIVE is returned.
+func (st *sessionTracker) add(ss session) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(st.sessions) >= st.capacity {
+		return ERR_MAX_ACTIVE
+	}
+	st.sessions[ss.name] = ss
+
+	return nil
+}
+
+// remove, stops tracking the session with the given name. It returns the
+// removed session and false, if no session with that name was being tracked.
+func (st *sessionTracker) remove(name string) (session, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	ss, ok := st.sessions[name]
+	if ok {
+		delete(st.sessions, name)
+	}
+
+	return ss, ok
+}
+
+// get, returns a copy of the tracked session with the given name.
+func (st *sessionTracker) get(name string) (session, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	ss, ok := st.sessions[name]
+	return ss, ok
+}
+
+// len, returns the amount of sessions currently being tracked.
+func (st *sessionTracker) len() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return len(st.sessions)
+}
+
+// full, returns true if no more sessions can be added to the tracker.
+func (st *sessionTracker) full() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return len(st.sessions) >= st.capacity
+}
+
+// list, returns a copy of all the tracked sessions sorted by their activation
+// time (oldest session first).
+func (st *sessionTracker) list() []session {
+	st.mu.Lock()
+	sessions := make([]session, 0, len(st.sessions))
+	for _, ss := range st.sessions {
+		sessions = append(sessions, ss)
+	}
+	st.mu.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].timeActivated.Before(sessions[j].timeActivated)
+	})
+
+	return sessions
+}
+
+// lookup, returns a copy of the tracked session with the given SSH username.
+func (st *sessionTracker) lookup(username string) (session, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, ss := range st.sessions {
+		if ss.username == username {
+			return ss, true
+		}
+	}
+	return session{}, false
+}
+
+// update, atomically modifies the tracked session with the given name through
+// fn. If fn returns an error, the session is left unmodified. It returns a
+// copy of the updated session.
+func (st *sessionTracker) update(name string, fn func(*session) error) (session, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	ss, ok := st.sessions[name]
+	if !ok {
+		return session{}, fmt.Errorf("session (%s) is not active", name)
+	}
+	if err := fn(&ss); err != nil {
+		return session{}, err
+	}
+	st.sessions[name] = ss
+
+	return ss, nil
+}
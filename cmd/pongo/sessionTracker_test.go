@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSessionTracker, tests that the sessionTracker enforces its capacity and
+// that any session can be removed from it, not only the oldest one.
+func TestSessionTracker(t *testing.T) {
+	st := newSessionTracker(2)
+	now := time.Now()
+	oldest := session{name: "oldest", timeActivated: now.Add(-time.Hour)}
+	newest := session{name: "newest", timeActivated: now}
+
+	if err := st.add(newest); err != nil {
+		t.Fatalf("error: could not add session to tracker: %v", err)
+	}
+	if err := st.add(oldest); err != nil {
+		t.Fatalf("error: could not add session to tracker: %v", err)
+	}
+	if !st.full() {
+		t.Errorf("error: tracker with %d sessions should be full", st.len())
+	}
+	if err := st.add(session{name: "extra"}); !errors.Is(err, ERR_MAX_ACTIVE) {
+		t.Errorf("error: adding a session to a full tracker returned %v, expected ERR_MAX_ACTIVE", err)
+	}
+
+	list := st.list()
+	if len(list) != 2 || list[0].name != "oldest" || list[1].name != "newest" {
+		t.Errorf("error: list() is not sorted by activation time: %v", list)
+	}
+
+	// Remove the newest session, which would have been impossible with a
+	// FIFO.
+	if _, ok := st.remove("newest"); !ok {
+		t.Errorf("error: session 'newest' could not be removed from tracker")
+	}
+	if _, ok := st.remove("newest"); ok {
+		t.Errorf("error: session 'newest' was removed twice from tracker")
+	}
+	if st.full() {
+		t.Errorf("error: tracker should not be full after removing a session")
+	}
+	if _, ok := st.get("oldest"); !ok {
+		t.Errorf("error: session 'oldest' should still be tracked")
+	}
+}
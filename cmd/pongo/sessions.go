@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/erodrigufer/pongo/internal/audit"
+	"github.com/erodrigufer/pongo/internal/backend"
+	"github.com/erodrigufer/pongo/internal/pongo"
 	"github.com/erodrigufer/pongo/internal/sysutils"
+	"github.com/erodrigufer/pongo/internal/tracing"
 )
 
 // charsetUsername, valid character-set for generating random usernames.
@@ -37,26 +41,49 @@ func (app *application) stopSession(ss session) error {
 	// Remove all the session-specific containers, which are stored in a slice
 	// of strings with the containers' IDs.
 	for _, containerID := range ss.containersIDs {
-		if err := app.client.ContainerStop(ctx, containerID, &timeout); err != nil {
+		if err := app.sessionRuntime(ss).StopContainer(ctx, containerID, &timeout); err != nil {
 			return fmt.Errorf("error: unable to stop container (with container ID %s): %w", containerID, err)
 		}
 
 	}
+	// Give back the capacity of the session to its engine.
+	app.engines.Release(ss.engine)
 
 	return nil
 }
 
+// sessionRuntime, returns the container engine that owns the containers of a
+// session.
+func (app *application) sessionRuntime(ss session) backend.ContainerRuntime {
+	node, ok := app.engines.Node(ss.engine)
+	if !ok {
+		return app.runtime
+	}
+	return node.Runtime
+}
+
 // createSession, creates a new session, therefore initializing all required
 // containers, and connecting them to the required networks.
 // If no error is returned, the session was correctly created and a struct of
-// type session is returned.
-func (app *application) createSession() (session, error) {
+// type session is returned. Every step of the creation is traced as a span
+// of ctx, and its duration is exported as a Prometheus metric.
+func (app *application) createSession(ctx context.Context) (newSession session, err error) {
+	ctx, span := app.tracer.Start(ctx, "createSession")
+	// step, current step of the creation, if the creation fails it is
+	// counted as the reason of the failure.
+	step, start := stepCredentials, time.Now()
+	stepStart := start
+	defer func() {
+		span.SetAttributes(tracing.Session(newSession.name, newSession.challenge, newSession.engine)...)
+		tracing.Error(span, err)
+		span.End()
+		app.observeCreation(step, start, err)
+	}()
+
 	// Create a session and populate its fields.
 	usernameLength := 15
 	passwordLength := 15
-	var newSession session
 	// Create random username and password.
-	var err error
 	newSession.username, err = sysutils.NewRandomUsername(usernameLength, charsetUsername)
 	if err != nil {
 		return newSession, fmt.Errorf("error: could not create a new session: %w", err)
@@ -67,35 +94,77 @@ func (app *application) createSession() (session, error) {
 	}
 	// Time of creation might be used to delete very old sessions in the future.
 	newSession.timeCreated = time.Now()
+	// Every session starts with the lifetime defined by the user
+	// configurations, the lifetime starts counting after the activation.
+	newSession.lifetime = time.Duration(app.configurations.LifetimeSess) * time.Minute
 
 	// Give the session a name, in this case the first 6 characters of the
 	// randomly generated username.
 	newSession.name = newSession.username[:6]
+	newSession.challenge = app.images.entrypointImage
+
+	// Choose the container engine of the session, capacity is reserved for
+	// the session in the engine until the session is stopped.
+	step, stepStart = stepPlacement, time.Now()
+	node, err := app.engines.Place()
+	if err != nil {
+		return newSession, fmt.Errorf("error: could not place a new session: %w", err)
+	}
+	app.observeCreationStep(step, stepStart)
+	newSession.engine = node.Name
+	defer func() {
+		if err != nil {
+			app.engines.Release(node.Name)
+		}
+	}()
 
 	// Create an upstream container for the entrypoint and connect it to the
-	// reverse proxy network.
-	entrypointID, err := app.createUpstreamContainer(newSession.name, app.images.entrypointImage, app.networkIDreverseProxy)
+	// network of the engine.
+	step, stepStart = stepContainer, time.Now()
+	entrypointID, err := app.createUpstreamContainer(ctx, newSession.name, app.images.entrypointImage, node)
 	if err != nil {
 		return newSession, err
 	}
+	app.observeCreationStep(step, stepStart)
+	defer func() {
+		if err != nil {
+			app.removeContainer(node.Runtime, entrypointID)
+		}
+	}()
 	// Append the container ID of the entrypoint container to the slice with
 	// all the container IDs for this session.
 	newSession.containersIDs = append(newSession.containersIDs, entrypointID)
 
 	// Create a new user account with the randomly generated username and
 	// password in the new upstream-container.
-	if err := app.createUser(entrypointID, newSession.username, newSession.password); err != nil {
+	step, stepStart = stepUser, time.Now()
+	if err = app.createUser(ctx, node.Runtime, entrypointID, newSession.username, newSession.password); err != nil {
 		return newSession, err
 	}
-	app.debugLog.Printf("Created new user (%s) in container (%s).\n", newSession.username, newSession.name)
-
-	// Add a container as an upstream-container to the reverse proxy.
-	if err := app.addUpstream(newSession.name, newSession.username, newSession.username); err != nil {
+	app.observeCreationStep(step, stepStart)
+	app.sessionLog(newSession).WithContext(ctx).Debugf("Created new user (%s) in the session.", newSession.username)
+
+	// Add a container as an upstream-container to the reverse proxy. The
+	// containers of remote engines are reached through the port that they
+	// publish in their host.
+	upstream := newSession.name
+	if !node.Local {
+		step, stepStart = stepRemoteUpstream, time.Now()
+		upstream, err = app.remoteUpstream(node, entrypointID)
+		if err != nil {
+			return newSession, err
+		}
+		app.observeCreationStep(step, stepStart)
+	}
+	step, stepStart = stepPipeAdd, time.Now()
+	if err = app.addUpstream(ctx, upstream, newSession.username, newSession.username); err != nil {
 		return newSession, err
 	}
-	app.debugLog.Printf("Added container %s as an upstream-container.\n", newSession.name)
+	app.observeCreationStep(step, stepStart)
+	app.sessionLog(newSession).WithContext(ctx).Debugf("Added container (%s) as an upstream-container.", upstream)
 
-	app.infoLog.Printf("New session created with username: %s. Password: %s. ID: %s.", newSession.username, newSession.password, newSession.name)
+	app.sessionLog(newSession).WithContext(ctx).WithField("username", newSession.username).Info("New session created.")
+	app.auditSession(audit.EventCreated, newSession, "", nil)
 
 	return newSession, nil
 
@@ -119,42 +188,24 @@ func (app *application) createSession() (session, error) {
 
 // createUser, creates a new user with a given password in an upstream
 // container by running a command inside the upstream container which creates a
-// new user (docker exec) . Parameters: containerID of container being
-// configured, username to create with a given password.
-func (app *application) createUser(containerID, username, password string) error {
-	// Command to create user.
-	cmdCreateUser := []string{
-		"useradd",
-		"--create-home", // Create a home directory for the new user.
-		"--user-group",  // Add user to group with its own name.
-		"--shell",       // Use bash as the default user shell.
-		"/bin/bash",
-		username, // Specify the new user's username.
-	}
-
-	ctx := context.Background()
-	if err := app.runExec(ctx, containerID, cmdCreateUser); err != nil {
-		return err
-	}
-
-	// Format input that will be piped into chpasswd command.
-	accountDetails := fmt.Sprintf("%s:%s", username, password)
-	wholeCmd := fmt.Sprintf("echo %s | chpasswd", accountDetails)
-
-	// Command to change password from a given user.
-	// 'echo $user:$password | chpasswd'.
-	// Without the 'bash -c' it was not working, probably because of the
-	// piping.
-	cmdChangePwd := []string{
-		"bash",
-		"-c",
-		wholeCmd,
-	}
-
-	ctx = context.Background()
-	if err := app.runExec(ctx, containerID, cmdChangePwd); err != nil {
-		return err
+// new user (docker exec) . Parameters: ctx, context in which every command is
+// traced as a span. containerID of container being configured and rt, its
+// container engine, username to create with a given password.
+func (app *application) createUser(ctx context.Context, rt backend.ContainerRuntime, containerID, username, password string) error {
+	// The same commands are used by 'pongo image test' to validate images.
+	for i, cmd := range pongo.CreateUserCmds(username, password) {
+		// The spans are named after the steps, the input of the commands
+		// contains the password of the user.
+		ctx, span := app.tracer.Start(ctx, "exec "+createUserSteps[i])
+		err := tracing.Error(span, app.runCommand(ctx, rt, containerID, cmd))
+		span.End()
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// createUserSteps, names of the commands returned by pongo.CreateUserCmds.
+var createUserSteps = []string{"useradd", "chpasswd"}
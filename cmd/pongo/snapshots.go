@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/snapshot"
+)
+
+// snapshotTimeout, max. time to export the snapshot of a session.
+const snapshotTimeout = 2 * time.Minute
+
+// restoreTimeout, max. time to restore the snapshot of a session. The
+// snapshot is restored while the participant waits for its session, so the
+// restore must finish well within the WriteTimeout of the HTTP server.
+const restoreTimeout = 5 * time.Second
+
+// homeDir, home directory of a user inside an upstream container.
+func homeDir(username string) string {
+	return path.Join("/home", username)
+}
+
+// snapshotSession, exports the home directory of the user of a session as a
+// tar archive, and stores it under the identity of the participant that owns
+// the session (derived from its participant token, never from its IP
+// address). It does nothing if snapshots are disabled.
+func (app *application) snapshotSession(ss session) {
+	if !app.wantsSnapshot(ss) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+
+	archive, err := app.sessionRuntime(ss).CopyFromContainer(ctx, ss.containersIDs[0], homeDir(ss.username))
+	if err != nil {
+		app.sessionLog(ss).Errorf("snapshot: unable to export home directory of session: %v", err)
+		return
+	}
+	defer archive.Close()
+
+	size, err := app.snapshots.Save(ss.participant, ss.challenge, archive)
+	if err != nil {
+		app.sessionLog(ss).Errorf("snapshot: unable to store snapshot of session: %v", err)
+		return
+	}
+	app.sessionLog(ss).Infof("snapshot: stored snapshot of session (%d bytes).", size)
+}
+
+// wantsSnapshot, returns true if the home directory of a session must be
+// kept when the session is stopped, i.e. if snapshots are enabled and the
+// participant that owns the session is known.
+func (app *application) wantsSnapshot(ss session) bool {
+	return app.snapshots != nil && ss.participant != ""
+}
+
+// snapshotActiveSession, takes the snapshot of an active session that is about
+// to be stopped, unless a previous attempt to stop the session already took
+// it. The snapshot is only taken once, so that the retries to stop a session
+// are not delayed by it.
+func (app *application) snapshotActiveSession(ss session) {
+	if ss.snapshotted {
+		return
+	}
+	app.snapshotSession(ss)
+	app.sm.activeSessions.update(ss.name, func(ss *session) error {
+		ss.snapshotted = true
+		return nil
+	})
+}
+
+// restoreSession, restores the last snapshot stored for the participant that
+// owns a session into the home directory of the user of the session. It must
+// be called before the credentials of the session are delivered, otherwise
+// the restore could overwrite files written by the participant. It does
+// nothing if snapshots are disabled or no snapshot exists.
+func (app *application) restoreSession(ss session) {
+	if !app.wantsSnapshot(ss) {
+		return
+	}
+	archive, err := app.snapshots.Open(ss.participant, ss.challenge)
+	if errors.Is(err, snapshot.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		app.sessionLog(ss).Errorf("snapshot: unable to open snapshot for session: %v", err)
+		return
+	}
+	defer archive.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+	defer cancel()
+
+	// The snapshot contains the home directory of the user of a previous
+	// session, rename it to the home directory of the new user while
+	// streaming it into the container.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(snapshot.RenameRoot(pw, archive, ss.username))
+	}()
+	err = app.sessionRuntime(ss).CopyToContainer(ctx, ss.containersIDs[0], "/home", pr)
+	// Unblock the goroutine writing into the pipe, if the copy failed.
+	pr.CloseWithError(err)
+	if err != nil {
+		app.sessionLog(ss).Errorf("snapshot: unable to restore snapshot into session: %v", err)
+		return
+	}
+
+	// The restored files belong to the user of the previous session.
+	owner := fmt.Sprintf("%s:%s", ss.username, ss.username)
+	result, err := app.runExecOutput(ctx, app.sessionRuntime(ss), ss.containersIDs[0], []string{"chown", "-R", owner, homeDir(ss.username)})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("chown failed with exit code %d: %s", result.ExitCode, result.Stderr)
+	}
+	if err != nil {
+		app.sessionLog(ss).Errorf("snapshot: unable to change owner of restored files in session: %v", err)
+		return
+	}
+	app.sessionLog(ss).Info("snapshot: restored snapshot into session.")
+}
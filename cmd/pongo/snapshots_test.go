@@ -0,0 +1,228 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/snapshot"
+)
+
+// homeArchive, returns a tar archive with the home directory of username,
+// holding a single file.
+func homeArchive(t *testing.T, username string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	content := []byte("notes of the participant")
+	if err := tw.WriteHeader(&tar.Header{Name: username + "/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: username + "/notes.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// archiveNames, returns the names of the entries of a tar archive.
+func archiveNames(t *testing.T, archive []byte) []string {
+	t.Helper()
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("error: invalid archive: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+// TestParticipantIdentity, tests that a participant without a valid
+// participant token receives one in a cookie, and that the same token always
+// yields the same identity.
+func TestParticipantIdentity(t *testing.T) {
+	app, _ := newTestApplication(t, testConfiguration())
+
+	rr := httptest.NewRecorder()
+	identity, err := app.participantIdentity(rr, httptest.NewRequest(http.MethodGet, "/session", nil))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != participantCookie || !cookies[0].HttpOnly {
+		t.Fatalf("error: expected an HttpOnly %s cookie, got %v", participantCookie, cookies)
+	}
+	if identity == cookies[0].Value {
+		t.Errorf("error: the identity is the participant token itself")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/session", nil)
+	r.AddCookie(cookies[0])
+	rr = httptest.NewRecorder()
+	again, err := app.participantIdentity(rr, r)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if again != identity {
+		t.Errorf("error: the same participant token yields identities %s and %s", identity, again)
+	}
+	if len(rr.Result().Cookies()) != 0 {
+		t.Errorf("error: a new cookie was sent to a participant with a valid token")
+	}
+
+	// An invalid token is replaced.
+	r = httptest.NewRequest(http.MethodGet, "/session", nil)
+	r.AddCookie(&http.Cookie{Name: participantCookie, Value: "guessed"})
+	rr = httptest.NewRecorder()
+	if other, err := app.participantIdentity(rr, r); err != nil || other == identity {
+		t.Errorf("error: an invalid token yields identity %s (%v)", other, err)
+	}
+	if len(rr.Result().Cookies()) != 1 {
+		t.Errorf("error: no new cookie was sent to a participant with an invalid token")
+	}
+}
+
+// TestSnapshotRestore, tests that the snapshot of a session is restored, before
+// the session is delivered, only into a new session of the same participant,
+// even if another participant shares its IP address.
+func TestSnapshotRestore(t *testing.T) {
+	configValues := testConfiguration()
+	configValues.TimeBetweenRequests = 0
+	app, fake := newTestApplication(t, configValues)
+	store, err := snapshot.NewStore(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.snapshots = store
+	startSMD(t, app)
+
+	const alice, bob = "alice-identity", "bob-identity"
+	expired, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	expired.participant = alice
+	if err := fake.CopyToContainer(context.Background(), expired.containersIDs[0], homeDir(expired.username), bytes.NewReader(homeArchive(t, expired.username))); err != nil {
+		t.Fatal(err)
+	}
+	app.snapshotSession(expired)
+	if err := app.stopSession(expired); err != nil {
+		t.Fatal(err)
+	}
+
+	// deliver, requests a session for a participant from the same IP
+	// address, and returns the archive restored into it (if any).
+	deliver := func(participant string) (session, []byte, bool) {
+		ss, err := app.createSession(context.Background())
+		if err != nil {
+			t.Fatalf("error: could not create session: %v", err)
+		}
+		app.sm.availableSessions <- ss
+		r := httptest.NewRequest(http.MethodGet, "/session", nil)
+		ss, err = app.requestSession(context.Background(), r, probeNone, participant)
+		if err != nil {
+			t.Fatalf("error: no session delivered to %s: %v", participant, err)
+		}
+		restored, err := fake.CopyFromContainer(context.Background(), ss.containersIDs[0], "/home")
+		if err != nil {
+			return ss, nil, false
+		}
+		defer restored.Close()
+		archive, err := io.ReadAll(restored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ss, archive, true
+	}
+
+	if _, _, ok := deliver(bob); ok {
+		t.Errorf("error: the snapshot of a participant was restored into the session of another participant with the same IP address")
+	}
+	ss, archive, ok := deliver(alice)
+	if !ok {
+		t.Fatalf("error: the snapshot was not restored before the session was delivered")
+	}
+	names := archiveNames(t, archive)
+	if len(names) != 2 || names[1] != ss.username+"/notes.txt" {
+		t.Errorf("error: restored archive contains %v, expected the home directory of %s", names, ss.username)
+	}
+}
+
+// TestSlowSnapshotExpiration, tests that a slow snapshot of an expired
+// session does not delay the expiration of other sessions, and that the
+// snapshot is not taken again when stopping the session is retried.
+func TestSlowSnapshotExpiration(t *testing.T) {
+	app, fake := newTestApplication(t, testConfiguration())
+	store, err := snapshot.NewStore(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.snapshots = store
+
+	slow, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	slow.participant = "alice-identity"
+	fast, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+	for _, ss := range []session{slow, fast} {
+		if err := app.sm.activeSessions.add(ss); err != nil {
+			t.Fatal(err)
+		}
+	}
+	release := make(chan struct{})
+	fake.Block("CopyFromContainer", release)
+	fake.Fail("StopContainer", errors.New("stop failed"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.wg.Add(1)
+	go app.srd(ctx)
+	app.sm.expiry.Schedule(slow.name, time.Now())
+	app.sm.expiry.Schedule(fast.name, time.Now().Add(50*time.Millisecond))
+
+	// retried, returns true if stopping the session failed and its
+	// expiration was scheduled again.
+	retried := func(ss session) bool {
+		deadline, ok := app.sm.expiry.Deadline(ss.name)
+		return ok && time.Until(deadline) > 30*time.Second
+	}
+	// The fast session cannot be stopped either, it is scheduled again.
+	waitFor(t, "retry of the expiration of the fast session", func() bool {
+		return retried(fast)
+	})
+	if retried(slow) {
+		t.Fatalf("error: the session was stopped before its snapshot was taken")
+	}
+
+	close(release)
+	waitFor(t, "retry of the expiration of the slow session", func() bool {
+		return retried(slow)
+	})
+	ss, _ := app.sm.activeSessions.get(slow.name)
+	if !ss.snapshotted {
+		t.Errorf("error: the snapshot of the session is taken again when stopping it is retried")
+	}
+
+	cancel()
+	app.wg.Wait()
+}
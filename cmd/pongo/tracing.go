@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/erodrigufer/pongo/internal/logging"
+	"github.com/erodrigufer/pongo/internal/tracing"
+	"github.com/urfave/negroni"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setupTracing, sets the tracer provider which creates and exports the spans
+// of the application.
+func (app *application) setupTracing(tp *sdktrace.TracerProvider) {
+	app.tracerProvider = tp
+	app.tracer = tp.Tracer(tracing.TracerName)
+}
+
+// traceRequests, creates a span for every request, which is continued from
+// the trace context of the request if a reverse proxy in front of pongo
+// propagates one. The trace and span IDs are added to the logs of the request.
+func (app *application) traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := app.tracer.Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.target", r.URL.Path),
+				attribute.String("http.request_id", logging.RequestID(r.Context())),
+			))
+		defer span.End()
+
+		// Wrap the http.ResponseWriter to have access to the status code of
+		// the response (see prometheusMiddleware).
+		lrw := negroni.NewResponseWriter(w)
+		next.ServeHTTP(lrw, r.WithContext(ctx))
+
+		status := lrw.Status()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, strconv.Itoa(status))
+		}
+	})
+}
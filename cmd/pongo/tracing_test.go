@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/erodrigufer/pongo/internal/logging"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans, makes app record its spans in an in-memory exporter.
+func recordSpans(app *application) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	app.setupTracing(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	return exporter
+}
+
+// spanNamed, returns the first recorded span with the given name.
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, s := range spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("error: no span named '%s' was recorded", name)
+	return tracetest.SpanStub{}
+}
+
+// TestCreateSessionSpans, tests that every step of the creation of a session
+// is traced as a child span of the creation, and that the password of the
+// session is not part of any span.
+func TestCreateSessionSpans(t *testing.T) {
+	configValues := testConfiguration()
+	configValues.LogFormat = logging.FormatJSON
+	app, _ := newTestApplication(t, configValues)
+	exporter := recordSpans(app)
+	buf := new(bytes.Buffer)
+	app.logger.SetOutput(buf)
+
+	ss, err := app.createSession(context.Background())
+	if err != nil {
+		t.Fatalf("error: could not create session: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	root := spanNamed(t, spans, "createSession")
+	for _, name := range []string{"container create", "container start", "exec useradd", "exec chpasswd", "exec pipe add"} {
+		s := spanNamed(t, spans, name)
+		if s.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("error: span '%s' is not a child of createSession", name)
+		}
+	}
+	for _, s := range spans {
+		for _, attr := range s.Attributes {
+			if strings.Contains(attr.Value.Emit(), ss.password) {
+				t.Errorf("error: span '%s' contains the password of the session", s.Name)
+			}
+		}
+	}
+
+	traceID := root.SpanContext.TraceID().String()
+	if !strings.Contains(buf.String(), `"trace_id":"`+traceID+`"`) {
+		t.Errorf("error: log lines do not carry the trace ID %s: %s", traceID, buf.String())
+	}
+}
+
+// TestRequestSessionTrace, tests that the handoff of a request for a session
+// to smd is part of the trace of the HTTP request, which continues the trace
+// propagated by the client.
+func TestRequestSessionTrace(t *testing.T) {
+	app, _ := newTestApplication(t, testConfiguration())
+	exporter := recordSpans(app)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.wg.Add(2)
+	go app.smd(ctx)
+	go app.scd(ctx)
+	waitFor(t, "available sessions", func() bool {
+		return len(app.sm.availableSessions) == testConfiguration().MaxAvailableSess
+	})
+
+	handler := app.traceRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := app.requestSession(r.Context(), r, probeNone, ""); err != nil {
+			app.serverError(w, err)
+		}
+	}))
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	r := httptest.NewRequest(http.MethodGet, "/session", nil)
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("error: request returned %d, expected %d", w.Code, http.StatusOK)
+	}
+	cancel()
+	app.wg.Wait()
+
+	spans := exporter.GetSpans()
+	server := spanNamed(t, spans, "HTTP GET")
+	request := spanNamed(t, spans, "requestSession")
+	deliver := spanNamed(t, spans, "smd deliverSession")
+	if server.SpanContext.TraceID().String() != traceID {
+		t.Errorf("error: request span did not continue the propagated trace")
+	}
+	if request.Parent.SpanID() != server.SpanContext.SpanID() || deliver.Parent.SpanID() != request.SpanContext.SpanID() {
+		t.Errorf("error: spans of the handoff to smd are not nested in the request span")
+	}
+}
@@ -0,0 +1,347 @@
+package APIMonitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// Types of the health checks which can be defined in a Config.
+const (
+	// CheckHTTP, sends an HTTP request and expects a status code.
+	CheckHTTP = "http"
+	// CheckSSH, logs into an SSH server with a password, runs a command and
+	// expects its output.
+	CheckSSH = "ssh"
+	// CheckTCP, connects to a TCP service.
+	CheckTCP = "tcp"
+	// CheckDocker, expects a container to be running.
+	CheckDocker = "docker"
+)
+
+// Types of the notifiers which can be defined in a Config.
+const (
+	NotifierWebhook = "webhook"
+	NotifierSMTP    = "smtp"
+	NotifierCommand = "command"
+)
+
+// ErrNoContainerEngine, returned when building a Docker health check without
+// access to the container engine.
+var ErrNoContainerEngine = errors.New("No container engine to check the state of containers.")
+
+// Config, health checks and notifiers of the monitor, loaded from a YAML
+// file.
+type Config struct {
+	// Checks, health checks performed besides the built-in health checks.
+	Checks []CheckDefinition `yaml:"checks"`
+	// Notifiers, notified when a health check changes between pass and fail.
+	Notifiers []NotifierDefinition `yaml:"notifiers"`
+}
+
+// CheckDefinition, definition of a health check in a Config. Only the fields
+// of its type are used.
+type CheckDefinition struct {
+	// Name, unique name of the health check.
+	Name string `yaml:"name"`
+	// Description, human-readable description of the health check. If
+	// empty, a description is derived from the definition.
+	Description string `yaml:"description"`
+	// Type, http, ssh, tcp or docker.
+	Type string `yaml:"type"`
+	// Timeout, of every attempt of the health check, e.g. '10s'.
+	// DefaultCheckTimeout if not set.
+	Timeout time.Duration `yaml:"timeout"`
+	// Interval, time between two runs of the health check, e.g. '1m'. The
+	// frequency of the monitor if not set.
+	Interval time.Duration `yaml:"interval"`
+	// Retries, amount of times a failed health check is attempted again,
+	// after RetryDelay (e.g. '5s'), before its run is considered failed.
+	Retries    int           `yaml:"retries"`
+	RetryDelay time.Duration `yaml:"retryDelay"`
+
+	// Method (GET by default), URL, Headers and ExpectedStatus (200 by
+	// default) of an HTTP health check.
+	Method         string            `yaml:"method"`
+	URL            string            `yaml:"url"`
+	Headers        map[string]string `yaml:"headers"`
+	ExpectedStatus int               `yaml:"expectedStatus"`
+
+	// Addr, address (host:port) of the server of an SSH or TCP health check.
+	Addr string `yaml:"addr"`
+
+	// Username, Password, Command and ExpectedOutput of an SSH health check.
+	// HostKey, path to the public host key (authorized_keys format) of the
+	// SSH server. The host key is only not verified if
+	// InsecureIgnoreHostKey is set.
+	Username              string `yaml:"username"`
+	Password              string `yaml:"password"`
+	Command               string `yaml:"command"`
+	ExpectedOutput        string `yaml:"expectedOutput"`
+	HostKey               string `yaml:"hostKey"`
+	InsecureIgnoreHostKey bool   `yaml:"insecureIgnoreHostKey"`
+
+	// Container, name or ID of the container of a Docker health check.
+	Container string `yaml:"container"`
+}
+
+// NotifierDefinition, definition of a notifier in a Config. Only the fields
+// of its type are used.
+type NotifierDefinition struct {
+	// Type, webhook, smtp or command.
+	Type string `yaml:"type"`
+
+	// URL and Headers of a webhook.
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+
+	// Addr (host:port) of the SMTP server, From, To, Username and Password
+	// of an SMTP notifier.
+	Addr     string   `yaml:"addr"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+
+	// Command, shell command of a command notifier.
+	Command string `yaml:"command"`
+}
+
+// LoadConfig, reads and validates the Config in the YAML file at path.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("error reading monitor configuration: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return config, fmt.Errorf("error parsing monitor configuration %s: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid monitor configuration %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate, returns an error if a health check or notifier of the Config is
+// invalid, or if two health checks have the same name.
+func (c Config) Validate() error {
+	names := make(map[string]bool, len(c.Checks))
+	for i, def := range c.Checks {
+		if err := def.validate(); err != nil {
+			return fmt.Errorf("check %d: %w", i+1, err)
+		}
+		if names[def.Name] {
+			return fmt.Errorf("check %d: duplicated name '%s'", i+1, def.Name)
+		}
+		names[def.Name] = true
+	}
+	for i, def := range c.Notifiers {
+		if err := def.validate(); err != nil {
+			return fmt.Errorf("notifier %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// validate, returns an error if a field required by the type of the health
+// check is missing.
+func (def CheckDefinition) validate() error {
+	if def.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if def.Timeout < 0 || def.Interval < 0 || def.Retries < 0 || def.RetryDelay < 0 {
+		return fmt.Errorf("%s: negative timeout, interval, retries or retry delay", def.Name)
+	}
+	var missing []string
+	switch def.Type {
+	case CheckHTTP:
+		if def.URL == "" {
+			missing = append(missing, "url")
+		}
+	case CheckSSH:
+		if def.Addr == "" {
+			missing = append(missing, "addr")
+		}
+		if def.Username == "" {
+			missing = append(missing, "username")
+		}
+		if def.Command == "" {
+			missing = append(missing, "command")
+		}
+		if def.HostKey == "" && !def.InsecureIgnoreHostKey {
+			missing = append(missing, "hostKey")
+		}
+	case CheckTCP:
+		if def.Addr == "" {
+			missing = append(missing, "addr")
+		}
+	case CheckDocker:
+		if def.Container == "" {
+			missing = append(missing, "container")
+		}
+	default:
+		return fmt.Errorf("%s: unknown type '%s' (expected %s, %s, %s or %s)", def.Name, def.Type, CheckHTTP, CheckSSH, CheckTCP, CheckDocker)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s: missing %s", def.Name, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// validate, returns an error if a field required by the type of the notifier
+// is missing.
+func (def NotifierDefinition) validate() error {
+	switch def.Type {
+	case NotifierWebhook:
+		if def.URL == "" {
+			return fmt.Errorf("%s: missing url", def.Type)
+		}
+	case NotifierSMTP:
+		if def.Addr == "" || def.From == "" || len(def.To) == 0 {
+			return fmt.Errorf("%s: addr, from and to are required", def.Type)
+		}
+	case NotifierCommand:
+		if def.Command == "" {
+			return fmt.Errorf("%s: missing command", def.Type)
+		}
+	default:
+		return fmt.Errorf("unknown type '%s' (expected %s, %s or %s)", def.Type, NotifierWebhook, NotifierSMTP, NotifierCommand)
+	}
+	return nil
+}
+
+// HealthCheck, returns the health check of a definition. running is used by
+// Docker health checks to ask the container engine about the container.
+func (mon *Monitord) HealthCheck(def CheckDefinition, running ContainerRunning) (HealthCheck, error) {
+	if err := def.validate(); err != nil {
+		return HealthCheck{}, err
+	}
+	timeout := def.Timeout
+	if timeout == 0 {
+		timeout = DefaultCheckTimeout
+	}
+	hc := HealthCheck{
+		Name:        def.Name,
+		Description: def.Description,
+		Interval:    def.Interval,
+		Timeout:     timeout,
+		Retries:     def.Retries,
+		RetryDelay:  def.RetryDelay,
+	}
+	switch def.Type {
+	case CheckHTTP:
+		resource := APIResource{
+			Method:             def.Method,
+			URL:                def.URL,
+			Header:             http.Header{},
+			ExpectedStatusCode: def.ExpectedStatus,
+			ReqTimeout:         timeout,
+		}
+		if resource.Method == "" {
+			resource.Method = http.MethodGet
+		}
+		if resource.ExpectedStatusCode == 0 {
+			resource.ExpectedStatusCode = http.StatusOK
+		}
+		for key, value := range def.Headers {
+			resource.Header.Set(key, value)
+		}
+		if hc.Description == "" {
+			hc.Description = fmt.Sprintf("Check if an HTTP %s request to %s is answered with status code %d.", resource.Method, resource.URL, resource.ExpectedStatusCode)
+		}
+		hc.Check = func(ctx context.Context) error {
+			return mon.PingHTTPService(ctx, resource)
+		}
+	case CheckSSH:
+		hostKeyCallback := ssh.InsecureIgnoreHostKey()
+		if def.HostKey != "" {
+			pub, err := os.ReadFile(def.HostKey)
+			if err != nil {
+				return HealthCheck{}, fmt.Errorf("%s: error reading host key: %w", def.Name, err)
+			}
+			key, _, _, _, err := ssh.ParseAuthorizedKey(pub)
+			if err != nil {
+				return HealthCheck{}, fmt.Errorf("%s: error parsing host key %s: %w", def.Name, def.HostKey, err)
+			}
+			hostKeyCallback = ssh.FixedHostKey(key)
+		}
+		resource := SSHResource{
+			Addr:            def.Addr,
+			Command:         def.Command,
+			ExpectedOutput:  def.ExpectedOutput,
+			Timeout:         timeout,
+			HostKeyCallback: hostKeyCallback,
+		}
+		// The credentials are static, there is nothing to release.
+		acquire := func() (SSHSession, error) {
+			return SSHSession{
+				Username: def.Username,
+				Password: def.Password,
+				Release:  func() error { return nil },
+			}, nil
+		}
+		if hc.Description == "" {
+			hc.Description = fmt.Sprintf("Check if it is possible to log into %s as %s and run '%s'.", def.Addr, def.Username, def.Command)
+		}
+		hc.Check = func(ctx context.Context) error {
+			return mon.PingSSHService(ctx, resource, acquire)
+		}
+	case CheckTCP:
+		resource := TCPResource{Addr: def.Addr, Timeout: timeout}
+		if hc.Description == "" {
+			hc.Description = fmt.Sprintf("Check if it is possible to connect to %s over TCP.", def.Addr)
+		}
+		hc.Check = func(ctx context.Context) error {
+			return mon.PingTCPService(ctx, resource)
+		}
+	case CheckDocker:
+		if running == nil {
+			return HealthCheck{}, fmt.Errorf("%s: %w", def.Name, ErrNoContainerEngine)
+		}
+		resource := ContainerResource{Name: def.Container, Timeout: timeout}
+		if hc.Description == "" {
+			hc.Description = fmt.Sprintf("Check if the container %s is running.", def.Container)
+		}
+		hc.Check = func(ctx context.Context) error {
+			return mon.PingContainer(ctx, resource, running)
+		}
+	}
+	return hc, nil
+}
+
+// Notifier, returns the notifier of a definition.
+func (def NotifierDefinition) Notifier() (Notifier, error) {
+	if err := def.validate(); err != nil {
+		return nil, err
+	}
+	switch def.Type {
+	case NotifierWebhook:
+		n := WebhookNotifier{URL: def.URL, Header: http.Header{}}
+		for key, value := range def.Headers {
+			n.Header.Set(key, value)
+		}
+		return n, nil
+	case NotifierSMTP:
+		return SMTPNotifier{
+			Addr:     def.Addr,
+			From:     def.From,
+			To:       def.To,
+			Username: def.Username,
+			Password: def.Password,
+		}, nil
+	default:
+		return CommandNotifier{Command: def.Command}, nil
+	}
+}
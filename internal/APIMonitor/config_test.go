@@ -0,0 +1,129 @@
+package APIMonitor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig, writes a monitor configuration to a temporary file and returns
+// its path.
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "monitor.yml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("error: could not write configuration: %v", err)
+	}
+	return path
+}
+
+// TestLoadConfig, tests that the health checks and notifiers of every type are
+// loaded, and that invalid configurations are rejected.
+func TestLoadConfig(t *testing.T) {
+	config, err := LoadConfig(writeConfig(t, `
+checks:
+  - name: api
+    type: http
+    url: http://localhost:8080/health
+    timeout: 5s
+  - name: ssh
+    type: ssh
+    addr: localhost:22
+    username: probe
+    command: "true"
+    insecureIgnoreHostKey: true
+  - name: db
+    type: tcp
+    addr: localhost:5432
+  - name: registry
+    type: docker
+    container: registry
+notifiers:
+  - type: webhook
+    url: http://localhost:9000/hook
+  - type: smtp
+    addr: localhost:1025
+    from: pongo@localhost
+    to: [ops@localhost]
+  - type: command
+    command: logger pongo
+`))
+	if err != nil {
+		t.Fatalf("error: LoadConfig() = %v", err)
+	}
+	if len(config.Checks) != 4 || len(config.Notifiers) != 3 {
+		t.Fatalf("error: loaded %d checks and %d notifiers, want 4 and 3", len(config.Checks), len(config.Notifiers))
+	}
+	if config.Checks[0].Timeout.Seconds() != 5 {
+		t.Errorf("error: timeout = %v, want 5s", config.Checks[0].Timeout)
+	}
+
+	invalid := map[string]string{
+		"unknown type":     "checks: [{name: a, type: icmp}]",
+		"missing field":    "checks: [{name: a, type: tcp}]",
+		"unverified ssh":   "checks: [{name: a, type: ssh, addr: 'localhost:22', username: u, command: 'true'}]",
+		"duplicated name":  "checks: [{name: a, type: tcp, addr: 'localhost:1'}, {name: a, type: tcp, addr: 'localhost:2'}]",
+		"unknown field":    "checks: [{name: a, type: tcp, address: 'localhost:1'}]",
+		"unknown notifier": "notifiers: [{type: pager}]",
+		"smtp without to":  "notifiers: [{type: smtp, addr: 'localhost:25', from: a@localhost}]",
+	}
+	for name, config := range invalid {
+		if _, err := LoadConfig(writeConfig(t, config)); err == nil {
+			t.Errorf("error: %s: invalid configuration was loaded", name)
+		}
+	}
+}
+
+// TestConfiguredHealthChecks, tests the HTTP, TCP and Docker health checks
+// built from their definitions.
+func TestConfiguredHealthChecks(t *testing.T) {
+	mon := newTestMonitor(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Probe") != "pongo" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error: could not listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	running := func(ctx context.Context, name string) (bool, error) {
+		return name == "registry", nil
+	}
+
+	tests := []struct {
+		def  CheckDefinition
+		pass bool
+	}{
+		{CheckDefinition{Name: "http", Type: CheckHTTP, URL: srv.URL, Headers: map[string]string{"X-Probe": "pongo"}}, true},
+		{CheckDefinition{Name: "http forbidden", Type: CheckHTTP, URL: srv.URL}, false},
+		{CheckDefinition{Name: "tcp", Type: CheckTCP, Addr: strings.TrimPrefix(srv.URL, "http://")}, true},
+		{CheckDefinition{Name: "tcp closed", Type: CheckTCP, Addr: addr}, false},
+		{CheckDefinition{Name: "docker", Type: CheckDocker, Container: "registry"}, true},
+		{CheckDefinition{Name: "docker stopped", Type: CheckDocker, Container: "cache"}, false},
+	}
+	for _, tt := range tests {
+		hc, err := mon.HealthCheck(tt.def, running)
+		if err != nil {
+			t.Fatalf("error: %s: HealthCheck() = %v", tt.def.Name, err)
+		}
+		if hc.Description == "" {
+			t.Errorf("error: %s: no description", tt.def.Name)
+		}
+		if err := hc.Check(context.Background()); (err == nil) != tt.pass {
+			t.Errorf("error: %s: Check() = %v, want pass = %v", tt.def.Name, err, tt.pass)
+		}
+	}
+
+	if _, err := mon.HealthCheck(CheckDefinition{Name: "docker", Type: CheckDocker, Container: "registry"}, nil); err == nil {
+		t.Error("error: Docker health check without container engine was built")
+	}
+}
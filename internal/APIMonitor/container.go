@@ -0,0 +1,37 @@
+package APIMonitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ContainerResource, describes a container which must be running, e.g. a
+// service the sessions depend on.
+type ContainerResource struct {
+	// Name, name or ID of the container.
+	Name string
+	// Timeout, time after which the request to the container engine is
+	// cancelled.
+	Timeout time.Duration
+}
+
+// ContainerRunning, reports whether the container with the given name or ID
+// is running, by asking the container engine.
+type ContainerRunning func(ctx context.Context, name string) (bool, error)
+
+// PingContainer, returns an error if the container of resource is not
+// running, or if the container engine cannot be asked about it before the
+// timeout of resource or before ctx is done.
+func (mon *Monitord) PingContainer(ctx context.Context, resource ContainerResource, running ContainerRunning) error {
+	ctx, cancel := context.WithTimeout(ctx, resource.Timeout)
+	defer cancel()
+	ok, err := running(ctx, resource.Name)
+	if err != nil {
+		return fmt.Errorf("unable to get the state of container %s: %w", resource.Name, err)
+	}
+	if !ok {
+		return fmt.Errorf("container %s is not running", resource.Name)
+	}
+	return nil
+}
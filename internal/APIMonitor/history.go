@@ -0,0 +1,62 @@
+package APIMonitor
+
+// DefaultHistorySize, amount of past results kept for every health check if
+// Monitord.HistorySize is not set.
+const DefaultHistorySize = 100
+
+// history, ring buffer with the last results of a health check. Once full,
+// every new result overwrites the oldest one.
+type history struct {
+	// results, ring buffer. next, index in results of the next result.
+	results []HealthCheckResult
+	next    int
+	// full, the ring buffer wrapped around at least once.
+	full bool
+}
+
+// newHistory, constructor of a history which keeps the last size results.
+func newHistory(size int) *history {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &history{results: make([]HealthCheckResult, size)}
+}
+
+// add, adds result to the history, overwriting the oldest result if the
+// history is full.
+func (h *history) add(result HealthCheckResult) {
+	h.results[h.next] = result
+	h.next = (h.next + 1) % len(h.results)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list, returns a copy of the results in the history, the oldest first.
+func (h *history) list() []HealthCheckResult {
+	if !h.full {
+		return append([]HealthCheckResult(nil), h.results[:h.next]...)
+	}
+	list := make([]HealthCheckResult, 0, len(h.results))
+	list = append(list, h.results[h.next:]...)
+	return append(list, h.results[:h.next]...)
+}
+
+// uptime, returns the percentage of the results in the history which passed,
+// or 0 if the history is empty.
+func (h *history) uptime() float64 {
+	n := h.next
+	if h.full {
+		n = len(h.results)
+	}
+	if n == 0 {
+		return 0
+	}
+	passed := 0
+	for _, result := range h.results[:n] {
+		if result.Pass {
+			passed++
+		}
+	}
+	return 100 * float64(passed) / float64(n)
+}
@@ -0,0 +1,27 @@
+package APIMonitor
+
+import "testing"
+
+// TestHistory, tests that the history keeps only the last results, the oldest
+// first, and computes the uptime over them.
+func TestHistory(t *testing.T) {
+	h := newHistory(3)
+	if uptime := h.uptime(); uptime != 0 {
+		t.Errorf("error: uptime of an empty history = %v, want 0", uptime)
+	}
+	for i, pass := range []bool{false, true, true, false} {
+		h.add(HealthCheckResult{Name: string(rune('a' + i)), Pass: pass})
+	}
+	list := h.list()
+	if len(list) != 3 {
+		t.Fatalf("error: history has %d results, want 3", len(list))
+	}
+	for i, name := range []string{"b", "c", "d"} {
+		if list[i].Name != name {
+			t.Errorf("error: result %d of the history = %s, want %s", i, list[i].Name, name)
+		}
+	}
+	if uptime := h.uptime(); uptime < 66.6 || uptime > 66.7 {
+		t.Errorf("error: uptime = %v, want 66.7", uptime)
+	}
+}
@@ -1,6 +1,7 @@
 package APIMonitor
 
 import (
+	"context"
 	"io"
 	"log"
 	"net/http"
@@ -12,13 +13,29 @@ type Monitord struct {
 	// client, HTTP client to perform HTTP requests to monitor.
 	client *http.Client
 	// healthChecks, this slice contains all the health checks that the daemon
-	// should periodically perform.
+	// should periodically perform, each in its own goroutine.
 	// healthchecks is NOT concurrent-safe, only populate the slice when
 	// invoking the constructor for Monitord.
 	HealthChecks []HealthCheck
-	// freq, frequency with which the monitor daemon will monitor the API
-	// resources.
+	// freq, frequency with which the monitor daemon will perform the health
+	// checks without an interval of their own.
 	freq time.Duration
+	// Location, time zone of the timestamps of the health checks. If nil, the
+	// local time zone is used.
+	Location *time.Location
+	// HistorySize, amount of past results kept for every health check, from
+	// which its uptime is computed. If not positive, DefaultHistorySize is
+	// used.
+	HistorySize int
+	// Notifiers, are notified when a health check changes between pass and
+	// fail. Only populate the slice before starting the daemon.
+	Notifiers []Notifier
+	// NotifyTimeout, time after which a notification is cancelled. If not
+	// positive, DefaultNotifyTimeout is used.
+	NotifyTimeout time.Duration
+	// OnResult, if not nil, is called with the result of every run of a
+	// health check, e.g. to export it as a metric.
+	OnResult func(HealthCheckResult)
 	// infoLog, a logger to print info messages.
 	infoLog *log.Logger
 	// errorLog, a logger to print error messages.
@@ -27,8 +44,9 @@ type Monitord struct {
 	// from the clients.
 	Requests chan ClientReq
 
-	// hcResults, is a channel for a slice with all performed health checks
-	hcResults chan []HealthCheckResult
+	// hcResults, is a channel for the results of all performed health checks
+	// and their history.
+	hcResults chan MonitorResp
 }
 
 // HealthCheck, single health check performed by Monitord.
@@ -38,8 +56,18 @@ type HealthCheck struct {
 	// Description, human-readable description of a health check.
 	Description string
 	// Check, is the function executed by Monitord when performing a specific
-	// health check.
-	Check func() error
+	// health check. It must return once ctx is done.
+	Check func(ctx context.Context) error
+	// Interval, time between two runs of the health check. If not positive,
+	// the frequency of the monitor is used.
+	Interval time.Duration
+	// Timeout, max. time of every attempt of the health check. If not
+	// positive, DefaultCheckTimeout is used.
+	Timeout time.Duration
+	// Retries, amount of times a failed health check is attempted again
+	// (after RetryDelay) before its run is considered failed.
+	Retries    int
+	RetryDelay time.Duration
 }
 
 // HealthCheckResult, struct defines all the information necessarry to
@@ -56,6 +84,16 @@ type HealthCheckResult struct {
 	Diagnostics error
 	// Timestamp, when was the health check performed?
 	Timestamp time.Time
+	// Latency, how long did the last attempt of the health check take?
+	Latency time.Duration
+	// Attempts, how many times was the health check attempted in this run?
+	Attempts int
+	// LastSuccess, when did the health check pass for the last time? It is
+	// the zero time if the health check never passed.
+	LastSuccess time.Time
+	// Uptime, percentage of the results in the history of the health check
+	// (including this one) which passed.
+	Uptime float64
 }
 
 // APIResource, describes a single resource in an HTTP API.
@@ -66,6 +104,9 @@ type APIResource struct {
 	URL string
 	// ReqBody, request body to send to resource.
 	ReqBody io.Reader
+	// Header, headers of the request sent to resource, e.g. to authenticate
+	// the request.
+	Header http.Header
 	// ExpectedStatusCode, HTTP status code expected as response from resource.
 	ExpectedStatusCode int
 	// ReqTimeout, time after which an HTTP requests is cancelled due to a
@@ -77,7 +118,9 @@ type APIResource struct {
 // health status.
 type ClientReq struct {
 	// RespCh, a channel provided by the client to Monitord to receive a
-	// response back from Monitord with all the health checks.
+	// response back from Monitord with all the health checks. It should be
+	// buffered, so that Monitord does not wait for a client which stopped
+	// waiting for the response.
 	RespCh chan MonitorResp
 }
 
@@ -87,6 +130,9 @@ type MonitorResp struct {
 	// HealthChecksResults, slice with all the HealthCheckResults for a particular
 	// timestamp.
 	HealthChecksResults []HealthCheckResult
+	// History, past results of every health check (by name), the oldest
+	// first.
+	History map[string][]HealthCheckResult
 	// Errors, if any Errors happened while getting the health checks, then
 	// Errors != nil, the client should consider the data received as erroneous.
 	Errors error
@@ -4,12 +4,22 @@ package APIMonitor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
+// DefaultCheckTimeout, timeout of every attempt of a health check without
+// timeout.
+const DefaultCheckTimeout = 30 * time.Second
+
+// ErrNoResults, returned (in MonitorResp.Errors) until the monitor daemon
+// performed the health checks for the first time.
+var ErrNoResults = errors.New("No health checks have been received yet.")
+
 // NewMonitor, constructor for a Monitord daemon.
 func NewMonitor(infoLog, errorLog *log.Logger, freq time.Duration) *Monitord {
 	mon := new(Monitord)
@@ -21,17 +31,17 @@ func NewMonitor(infoLog, errorLog *log.Logger, freq time.Duration) *Monitord {
 	// Unbuffered channel to receive unlimited client requests.
 	mon.Requests = make(chan ClientReq)
 	// Unbuffered channel to receive unlimited health check results.
-	mon.hcResults = make(chan []HealthCheckResult)
+	mon.hcResults = make(chan MonitorResp)
 	mon.HealthChecks = make([]HealthCheck, 0, 10)
 	return mon
 }
 
 // PingHTTPService, returns an error if an API resource does not respond with
 // with the expected response status code.
-func (mon *Monitord) PingHTTPService(resource APIResource) error {
+func (mon *Monitord) PingHTTPService(ctx context.Context, resource APIResource) error {
 	// Configure a timeout for the client's HTTP request. If the request takes
 	// more than this time duration, then it should be cancelled.
-	ctx, cancel := context.WithTimeout(context.Background(), resource.ReqTimeout)
+	ctx, cancel := context.WithTimeout(ctx, resource.ReqTimeout)
 	// Canceling a context releases resources associated with it, so code should
 	// call cancel as soon as the operations running in a context complete.
 	defer cancel()
@@ -39,6 +49,9 @@ func (mon *Monitord) PingHTTPService(resource APIResource) error {
 	if err != nil {
 		return fmt.Errorf("unable to create a new %s HTTP request to %s with timeout context: %w", resource.Method, resource.URL, err)
 	}
+	if resource.Header != nil {
+		req.Header = resource.Header.Clone()
+	}
 
 	res, err := mon.client.Do(req)
 	if err != nil {
@@ -55,94 +68,246 @@ func (mon *Monitord) PingHTTPService(resource APIResource) error {
 
 }
 
-// Daemon, runs the Monitord daemon which will periodically perform all the
-// health checks defined in its healthChecks[] slice and send the results from
-// the health checks through a channel.
+// Daemon, runs the Monitord daemon which periodically performs all the health
+// checks defined in its healthChecks[] slice, each in its own goroutine and
+// with its own interval, and sends the results from the health checks through
+// a channel. The results are sent once every health check was performed for
+// the first time, and afterwards every time a health check is performed. The
+// notifiers are notified (in their own goroutine) whenever a health check
+// changes between pass and fail (a health check is considered to pass before
+// it is performed for the first time).
 func (mon *Monitord) Daemon(ctx context.Context) {
 	mon.infoLog.Printf("monitord: health monitor daemon started.")
-	tz, tzErr := time.LoadLocation("Europe/Berlin")
-	if tzErr != nil {
-		mon.infoLog.Printf("monitord: error parsing time location: %v", tzErr)
+	location := mon.Location
+	if location == nil {
+		location = time.Local
+	}
+	// performed, receives the result of every run of every health check.
+	performed := make(chan checkRun)
+	var wg sync.WaitGroup
+	for i, hc := range mon.HealthChecks {
+		wg.Add(1)
+		go func(i int, hc HealthCheck) {
+			defer wg.Done()
+			mon.schedule(ctx, i, hc, location, performed)
+		}(i, hc)
 	}
+	// transitions, queue of the transitions waiting to be notified.
+	transitions := make(chan Transition, notifyQueueSize)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		mon.notifyd(ctx, transitions)
+	}()
+	defer func() {
+		wg.Wait()
+		// Close all possible idle connections of the HTTP client.
+		mon.client.CloseIdleConnections()
+		mon.infoLog.Printf("monitord: context cancelled. Shutting down.")
+	}()
+
+	// results, last result of every health check, in the order of
+	// mon.HealthChecks. pending, amount of health checks not performed yet.
+	results := make([]HealthCheckResult, len(mon.HealthChecks))
+	seen := make([]bool, len(mon.HealthChecks))
+	pending := len(mon.HealthChecks)
+	// lastSuccess, last time each health check passed.
+	lastSuccess := make(map[string]time.Time)
+	// histories, past results of each health check.
+	histories := make(map[string]*history)
+	// failing, health checks which failed the last time they were performed.
+	failing := make(map[string]bool)
 	for {
-		results := make([]HealthCheckResult, 0, 10)
-		var result HealthCheckResult
-
-		for _, hc := range mon.HealthChecks {
-			var timestamp time.Time
-			// No errors while parsing time zone.
-			if tzErr == nil {
-				timestamp = time.Now().In(tz)
-			}
-			if tzErr != nil {
-				timestamp = time.Now()
-			}
-			if err := hc.Check(); err != nil {
-				mon.infoLog.Printf("monitord: [FAIL] %s health check failed: %v", hc.Name, err)
-				// Failed health check!
-				result = HealthCheckResult{
-					Name:        hc.Name,
-					Description: hc.Description,
-					Pass:        false,
-					Diagnostics: err,
-					Timestamp:   timestamp,
-				}
-			} else {
-				mon.infoLog.Printf("monitord: [OK] %s health check passed.", hc.Name)
-				// Successful health check.
-				result = HealthCheckResult{
-					Name:        hc.Name,
-					Description: hc.Description,
-					Pass:        true,
-					Diagnostics: nil,
-					Timestamp:   timestamp,
-				}
-			}
-			results = append(results, result)
+		var run checkRun
+		select {
+		case <-ctx.Done():
+			return
+		case run = <-performed:
+		}
+		result := run.result
+		if result.Pass {
+			lastSuccess[result.Name] = result.Timestamp
+		}
+		result.LastSuccess = lastSuccess[result.Name]
+		h, ok := histories[result.Name]
+		if !ok {
+			h = newHistory(mon.HistorySize)
+			histories[result.Name] = h
+		}
+		h.add(result)
+		result.Uptime = h.uptime()
+		if !seen[run.index] {
+			seen[run.index] = true
+			pending--
+		}
+		results[run.index] = result
+		if mon.OnResult != nil {
+			mon.OnResult(result)
 		}
-		// TODO: set a timeout here as well
-		// Send results in a blocking way
-		mon.hcResults <- results
 
-		// Start a timer which will return with a certain frequency.
-		timer := time.NewTimer(mon.freq)
-		mon.infoLog.Printf("monitord: next API health check in %v.", mon.freq)
+		if result.Pass == failing[result.Name] {
+			mon.enqueue(transitions, Transition{Result: result, Recovered: result.Pass})
+		}
+		failing[result.Name] = !result.Pass
 
-		// After the time of the timer expires, the current time will be sent
-		// through its channel, discard the value. The read from the chan will
-		// block until the timer expires.
+		if pending > 0 {
+			continue
+		}
+		response := MonitorResp{
+			HealthChecksResults: append([]HealthCheckResult(nil), results...),
+			History:             make(map[string][]HealthCheckResult, len(histories)),
+		}
+		for name, h := range histories {
+			response.History[name] = h.list()
+		}
 		select {
+		case mon.hcResults <- response:
 		case <-ctx.Done():
-			mon.infoLog.Printf("monitord: context cancelled. Shutting down.")
-			// Close all possible idle connections of the HTTP client.
-			mon.client.CloseIdleConnections()
+			return
+		}
+	}
+}
+
+// checkRun, result of a run of the health check at index in
+// Monitord.HealthChecks.
+type checkRun struct {
+	index  int
+	result HealthCheckResult
+}
+
+// schedule, performs the health check hc (at index in Monitord.HealthChecks)
+// every interval, and sends the result of every run through performed, until
+// ctx is done.
+func (mon *Monitord) schedule(ctx context.Context, index int, hc HealthCheck, location *time.Location, performed chan<- checkRun) {
+	interval := hc.Interval
+	if interval <= 0 {
+		interval = mon.freq
+	}
+	for {
+		result := mon.perform(ctx, hc, location)
+		// A health check cancelled at shutdown did not fail.
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case performed <- checkRun{index: index, result: result}:
+		case <-ctx.Done():
+			return
+		}
+
+		// Start a timer which will return after the interval of the health
+		// check.
+		timer := time.NewTimer(interval)
+		mon.infoLog.Printf("monitord: next %s health check in %v.", hc.Name, interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
 			return
 		case <-timer.C:
-			// Timer is over, daemon will check again the resources.
-			break
+			// Timer is over, perform the health check again.
 		}
+	}
+}
 
+// perform, performs the health check hc, attempting it again after a failure
+// as many times as its retry policy allows, and returns its result. Every
+// attempt is cancelled after the timeout of hc, even if its Check does not
+// return once its context is done.
+func (mon *Monitord) perform(ctx context.Context, hc HealthCheck, location *time.Location) HealthCheckResult {
+	timeout := hc.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	result := HealthCheckResult{Name: hc.Name, Description: hc.Description}
+	for {
+		result.Attempts++
+		result.Timestamp = time.Now().In(location)
+		start := time.Now()
+		err := attempt(ctx, hc.Check, timeout)
+		result.Latency = time.Since(start)
+		result.Pass = err == nil
+		result.Diagnostics = err
+		if err == nil {
+			mon.infoLog.Printf("monitord: [OK] %s health check passed.", hc.Name)
+			return result
+		}
+		if result.Attempts > hc.Retries || ctx.Err() != nil {
+			mon.infoLog.Printf("monitord: [FAIL] %s health check failed: %v", hc.Name, err)
+			return result
+		}
+		mon.infoLog.Printf("monitord: [RETRY] %s health check failed (attempt %d of %d), retrying in %v: %v", hc.Name, result.Attempts, hc.Retries+1, hc.RetryDelay, err)
+		select {
+		case <-time.After(hc.RetryDelay):
+		case <-ctx.Done():
+			return result
+		}
 	}
+}
 
+// attempt, runs check with a context which is cancelled after timeout, and
+// returns its error, or a timeout error if check does not return in time.
+func attempt(ctx context.Context, check func(context.Context) error, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// Buffered, so that a check returning after its timeout does not block.
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("health check did not finish in %v: %w", timeout, ctx.Err())
+	}
 }
 
 // CurrentHealth, sends a response with the most current health checks. This
 // method is concurrent-safe and should be used by HTTP handlers to retrieve
-// the most current health status of the application to render a web page.
-func (mon Monitord) CurrentHealth() {
+// the most current health status of the application to render a web page
+// (see Health). It returns once ctx is done.
+func (mon *Monitord) CurrentHealth(ctx context.Context) {
 	var response MonitorResp
-	response.Errors = fmt.Errorf("No health checks have been received yet.")
+	response.Errors = ErrNoResults
 	for {
 		select {
 		// Receive requests from clients for a new health check.
 		case req := <-mon.Requests:
-			// TODO: make a non-blocking response
-			req.RespCh <- response
+			// RespCh is buffered by Health, so the response does not block
+			// if the client stopped waiting for it.
+			select {
+			case req.RespCh <- response:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
 		case checks := <-mon.hcResults:
 			// TODO: check that the length of checks is not equal to 0,
 			// otherwise there is an error
-			response.HealthChecksResults = checks
+			response = checks
 			response.Errors = nil
 		}
 	}
 }
+
+// Health, requests the most current health checks from CurrentHealth. An
+// error is returned if CurrentHealth does not answer before ctx is done, e.g.
+// because the monitor is not running. The errors of the health checks
+// themselves are returned in MonitorResp.Errors.
+func (mon *Monitord) Health(ctx context.Context) (MonitorResp, error) {
+	// Buffered, so that CurrentHealth does not block if the client stopped
+	// waiting for the response.
+	req := ClientReq{RespCh: make(chan MonitorResp, 1)}
+	select {
+	case mon.Requests <- req:
+	case <-ctx.Done():
+		return MonitorResp{}, fmt.Errorf("monitord did not receive the request for the health checks: %w", ctx.Err())
+	}
+	select {
+	case resp := <-req.RespCh:
+		return resp, nil
+	case <-ctx.Done():
+		return MonitorResp{}, fmt.Errorf("monitord did not send the health checks: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,206 @@
+package APIMonitor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// newTestMonitor, returns a monitor that performs the health checks every
+// freq and discards its logs.
+func newTestMonitor(freq time.Duration) *Monitord {
+	logger := log.New(io.Discard, "", 0)
+	return NewMonitor(logger, logger, freq)
+}
+
+// TestHealthTimeout, tests that Health does not block if CurrentHealth is not
+// running.
+func TestHealthTimeout(t *testing.T) {
+	mon := newTestMonitor(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := mon.Health(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error: Health() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// TestHealthResults, tests that the results of the health checks carry their
+// latency and the time at which they passed for the last time.
+func TestHealthResults(t *testing.T) {
+	mon := newTestMonitor(50 * time.Millisecond)
+	runs := 0
+	mon.HealthChecks = append(mon.HealthChecks, HealthCheck{
+		Name: "flaky",
+		// Pass on the first run, fail afterwards.
+		Check: func(ctx context.Context) error {
+			runs++
+			time.Sleep(time.Millisecond)
+			if runs > 1 {
+				return errors.New("failed")
+			}
+			return nil
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mon.CurrentHealth(ctx)
+
+	resp, err := mon.Health(context.Background())
+	if err != nil {
+		t.Fatalf("error: Health() = %v", err)
+	}
+	if !errors.Is(resp.Errors, ErrNoResults) {
+		t.Errorf("error: results before the first run, errors = %v", resp.Errors)
+	}
+
+	go mon.Daemon(ctx)
+
+	var passed, failed *HealthCheckResult
+	deadline := time.Now().Add(5 * time.Second)
+	for failed == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("error: timed out waiting for a failed health check")
+		}
+		resp, err := mon.Health(context.Background())
+		if err != nil {
+			t.Fatalf("error: Health() = %v", err)
+		}
+		for _, result := range resp.HealthChecksResults {
+			result := result
+			if result.Pass && passed == nil {
+				passed = &result
+			}
+			if !result.Pass {
+				failed = &result
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if passed == nil {
+		t.Fatal("error: the first run of the health check was not received")
+	}
+	if passed.Latency < time.Millisecond {
+		t.Errorf("error: latency = %v, want at least 1ms", passed.Latency)
+	}
+	if !passed.LastSuccess.Equal(passed.Timestamp) {
+		t.Errorf("error: last success of a passed health check = %v, want %v", passed.LastSuccess, passed.Timestamp)
+	}
+	if !failed.LastSuccess.Equal(passed.Timestamp) {
+		t.Errorf("error: last success of a failed health check = %v, want %v", failed.LastSuccess, passed.Timestamp)
+	}
+}
+
+// TestConcurrentHealthChecks, tests that a slow health check does not delay
+// the other health checks, which run with their own interval.
+func TestConcurrentHealthChecks(t *testing.T) {
+	mon := newTestMonitor(time.Hour)
+	fastRuns := make(chan struct{}, 10)
+	mon.HealthChecks = append(mon.HealthChecks,
+		HealthCheck{
+			Name:    "slow",
+			Timeout: time.Hour,
+			// Blocks until the monitor shuts down.
+			Check: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		},
+		HealthCheck{
+			Name:     "fast",
+			Interval: time.Millisecond,
+			Check: func(ctx context.Context) error {
+				fastRuns <- struct{}{}
+				return nil
+			},
+		},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		mon.Daemon(ctx)
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-fastRuns:
+		case <-time.After(5 * time.Second):
+			t.Fatal("error: the fast health check was delayed by the slow one")
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("error: Daemon() did not return after the context was cancelled")
+	}
+}
+
+// TestHealthCheckRetriesAndTimeout, tests that a failed health check is
+// attempted again according to its retry policy, and that an attempt which
+// does not return in time fails.
+func TestHealthCheckRetriesAndTimeout(t *testing.T) {
+	mon := newTestMonitor(time.Hour)
+	attempts := 0
+	flaky := HealthCheck{
+		Name:       "flaky",
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+		// Fail on the first attempt only.
+		Check: func(ctx context.Context) error {
+			attempts++
+			if attempts == 1 {
+				return errors.New("failed")
+			}
+			return nil
+		},
+	}
+	if result := mon.perform(context.Background(), flaky, time.UTC); !result.Pass || result.Attempts != 2 {
+		t.Errorf("error: flaky health check = (pass %v, %d attempts), want (pass true, 2 attempts)", result.Pass, result.Attempts)
+	}
+
+	stuck := HealthCheck{
+		Name:    "stuck",
+		Timeout: 10 * time.Millisecond,
+		Retries: 1,
+		// Ignore the context.
+		Check: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+	}
+	start := time.Now()
+	result := mon.perform(context.Background(), stuck, time.UTC)
+	if result.Pass || result.Attempts != 2 || !errors.Is(result.Diagnostics, context.DeadlineExceeded) {
+		t.Errorf("error: stuck health check = (pass %v, %d attempts, %v), want a timeout after 2 attempts", result.Pass, result.Attempts, result.Diagnostics)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("error: stuck health check took %v, its timeout is 10ms", elapsed)
+	}
+}
+
+// TestCurrentHealthShutdown, tests that CurrentHealth returns once its
+// context is done.
+func TestCurrentHealthShutdown(t *testing.T) {
+	mon := newTestMonitor(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		mon.CurrentHealth(ctx)
+		close(done)
+	}()
+	if _, err := mon.Health(context.Background()); err != nil {
+		t.Fatalf("error: Health() = %v", err)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("error: CurrentHealth() did not return after the context was cancelled")
+	}
+}
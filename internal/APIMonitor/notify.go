@@ -0,0 +1,289 @@
+package APIMonitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultNotifyTimeout, time after which a notification is cancelled if
+// Monitord.NotifyTimeout is not set.
+const DefaultNotifyTimeout = 10 * time.Second
+
+// Transition, a health check changed between pass and fail.
+type Transition struct {
+	// Result, result of the health check which changed its status.
+	Result HealthCheckResult
+	// Recovered, the health check passes again (after failing). Otherwise,
+	// the health check started failing.
+	Recovered bool
+}
+
+// Status, returns the status of the health check after the transition: pass
+// or fail.
+func (t Transition) Status() string {
+	if t.Recovered {
+		return "pass"
+	}
+	return "fail"
+}
+
+// Summary, returns a one-line, human-readable description of the transition.
+func (t Transition) Summary() string {
+	if t.Recovered {
+		return fmt.Sprintf("Health check '%s' recovered", t.Result.Name)
+	}
+	return fmt.Sprintf("Health check '%s' is failing", t.Result.Name)
+}
+
+// transitionPayload, JSON description of a transition sent by the notifiers.
+type transitionPayload struct {
+	Check          string    `json:"check"`
+	Description    string    `json:"description"`
+	Status         string    `json:"status"`
+	Summary        string    `json:"summary"`
+	Error          string    `json:"error,omitempty"`
+	CheckedAt      time.Time `json:"checked_at"`
+	LatencySeconds float64   `json:"latency_seconds"`
+	UptimePercent  float64   `json:"uptime_percent"`
+}
+
+// payload, returns the JSON description of the transition.
+func (t Transition) payload() ([]byte, error) {
+	p := transitionPayload{
+		Check:          t.Result.Name,
+		Description:    t.Result.Description,
+		Status:         t.Status(),
+		Summary:        t.Summary(),
+		CheckedAt:      t.Result.Timestamp,
+		LatencySeconds: t.Result.Latency.Seconds(),
+		UptimePercent:  t.Result.Uptime,
+	}
+	if t.Result.Diagnostics != nil {
+		p.Error = t.Result.Diagnostics.Error()
+	}
+	return json.Marshal(p)
+}
+
+// Notifier, notifies about the health checks which change between pass and
+// fail, e.g. by calling a webhook or sending an email.
+type Notifier interface {
+	// Notify, sends a notification about t. It must return once ctx is done.
+	Notify(ctx context.Context, t Transition) error
+}
+
+// WebhookNotifier, POSTs the JSON description of every transition to a URL.
+type WebhookNotifier struct {
+	// URL, of the webhook.
+	URL string
+	// Header, headers of the request, e.g. to authenticate it.
+	Header http.Header
+	// Client, HTTP client used to call the webhook. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Notify, POSTs the transition to the webhook. An error is returned if the
+// webhook does not answer with a 2xx status code.
+func (n WebhookNotifier) Notify(ctx context.Context, t Transition) error {
+	body, err := t.payload()
+	if err != nil {
+		return fmt.Errorf("unable to encode the transition of %s: %w", t.Result.Name, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create the request to webhook %s: %w", n.URL, err)
+	}
+	if n.Header != nil {
+		req.Header = n.Header.Clone()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to call webhook %s: %w", n.URL, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook %s answered with status code %d (%s)", n.URL, res.StatusCode, res.Status)
+	}
+	return nil
+}
+
+// SMTPNotifier, sends an email about every transition through an SMTP server.
+type SMTPNotifier struct {
+	// Addr, address (host:port) of the SMTP server.
+	Addr string
+	// From, sender of the emails. To, recipients of the emails.
+	From string
+	To   []string
+	// Username and Password, authenticate against the SMTP server (PLAIN
+	// authentication, only over TLS or to localhost). No authentication is
+	// used if Username is empty.
+	Username string
+	Password string
+}
+
+// Notify, sends an email about the transition. STARTTLS is used if the SMTP
+// server supports it.
+func (n SMTPNotifier) Notify(ctx context.Context, t Transition) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		return fmt.Errorf("unable to connect to SMTP server %s: %w", n.Addr, err)
+	}
+	defer conn.Close()
+	// The deadline bounds the whole SMTP session.
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return fmt.Errorf("unable to set deadline of SMTP connection to %s: %w", n.Addr, err)
+		}
+	}
+	host, _, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid address of SMTP server %s: %w", n.Addr, err)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("unable to start SMTP session with %s: %w", n.Addr, err)
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("unable to start TLS with SMTP server %s: %w", n.Addr, err)
+		}
+	}
+	if n.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.Username, n.Password, host)); err != nil {
+			return fmt.Errorf("unable to authenticate against SMTP server %s: %w", n.Addr, err)
+		}
+	}
+	if err := c.Mail(n.From); err != nil {
+		return fmt.Errorf("SMTP server %s rejected sender %s: %w", n.Addr, n.From, err)
+	}
+	for _, to := range n.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("SMTP server %s rejected recipient %s: %w", n.Addr, to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("unable to send email through SMTP server %s: %w", n.Addr, err)
+	}
+	if _, err := w.Write(n.message(t)); err != nil {
+		return fmt.Errorf("unable to send email through SMTP server %s: %w", n.Addr, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("unable to send email through SMTP server %s: %w", n.Addr, err)
+	}
+	return c.Quit()
+}
+
+// message, returns the email (headers and body) about the transition.
+func (n SMTPNotifier) message(t Transition) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&b, "Subject: [pongo] %s\r\n", t.Summary())
+	fmt.Fprintf(&b, "Date: %s\r\n", t.Result.Timestamp.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&b, "%s.\r\n\r\n", t.Summary())
+	fmt.Fprintf(&b, "Check: %s\r\n", t.Result.Name)
+	fmt.Fprintf(&b, "Description: %s\r\n", t.Result.Description)
+	fmt.Fprintf(&b, "Status: %s\r\n", t.Status())
+	if t.Result.Diagnostics != nil {
+		fmt.Fprintf(&b, "Error: %v\r\n", t.Result.Diagnostics)
+	}
+	fmt.Fprintf(&b, "Checked at: %s\r\n", t.Result.Timestamp.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Uptime: %.1f%%\r\n", t.Result.Uptime)
+	return []byte(b.String())
+}
+
+// CommandNotifier, runs a shell command for every transition. The JSON
+// description of the transition is written to the standard input of the
+// command, and the environment variables PONGO_CHECK, PONGO_STATUS and
+// PONGO_ERROR describe the transition as well.
+type CommandNotifier struct {
+	// Command, run with 'sh -c'.
+	Command string
+}
+
+// Notify, runs the command. An error (with the output of the command) is
+// returned if the command fails.
+func (n CommandNotifier) Notify(ctx context.Context, t Transition) error {
+	body, err := t.payload()
+	if err != nil {
+		return fmt.Errorf("unable to encode the transition of %s: %w", t.Result.Name, err)
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", n.Command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"PONGO_CHECK="+t.Result.Name,
+		"PONGO_STATUS="+t.Status(),
+	)
+	if t.Result.Diagnostics != nil {
+		cmd.Env = append(cmd.Env, "PONGO_ERROR="+t.Result.Diagnostics.Error())
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notification command '%s' failed: %w (output: %s)", n.Command, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// notifyQueueSize, amount of transitions which can wait to be notified. If
+// the queue is full, e.g. because a notifier hangs, new transitions are
+// dropped.
+const notifyQueueSize = 64
+
+// notifyd, sends a notification about every transition received from queue,
+// in order, until ctx is done. The notifications are sent outside of the
+// daemon collecting the results of the health checks, so that a slow notifier
+// does not delay the health checks.
+func (mon *Monitord) notifyd(ctx context.Context, queue <-chan Transition) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-queue:
+			mon.notify(ctx, t)
+		}
+	}
+}
+
+// enqueue, adds t to the queue of notifyd without blocking. t is dropped if
+// the queue is full.
+func (mon *Monitord) enqueue(queue chan<- Transition, t Transition) {
+	select {
+	case queue <- t:
+	default:
+		mon.errorLog.Printf("monitord: notification queue is full, dropping notification '%s'", t.Summary())
+	}
+}
+
+// notify, sends a notification about t through every notifier. The errors of
+// the notifiers are logged. The notifications are cancelled once ctx is done.
+func (mon *Monitord) notify(ctx context.Context, t Transition) {
+	timeout := mon.NotifyTimeout
+	if timeout <= 0 {
+		timeout = DefaultNotifyTimeout
+	}
+	for _, n := range mon.Notifiers {
+		nctx, cancel := context.WithTimeout(ctx, timeout)
+		if err := n.Notify(nctx, t); err != nil {
+			mon.errorLog.Printf("monitord: unable to send notification '%s': %v", t.Summary(), err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,289 @@
+package APIMonitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingNotifier, sends every transition through a channel.
+type recordingNotifier chan Transition
+
+func (n recordingNotifier) Notify(ctx context.Context, t Transition) error {
+	n <- t
+	return nil
+}
+
+// testTransition, returns a transition of the health check 'ssh' to fail.
+func testTransition() Transition {
+	return Transition{Result: HealthCheckResult{
+		Name:        "ssh",
+		Description: "Log into a session.",
+		Diagnostics: errors.New("connection refused"),
+		Timestamp:   time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC),
+		Uptime:      50,
+	}}
+}
+
+// TestDaemonNotifiesTransitions, tests that the notifiers are only notified
+// when a health check changes between pass and fail.
+func TestDaemonNotifiesTransitions(t *testing.T) {
+	mon := newTestMonitor(time.Millisecond)
+	transitions := make(recordingNotifier, 10)
+	mon.Notifiers = append(mon.Notifiers, transitions)
+	runs := 0
+	mon.HealthChecks = append(mon.HealthChecks, HealthCheck{
+		Name: "flaky",
+		// Fail, pass, pass, fail.
+		Check: func(ctx context.Context) error {
+			runs++
+			if runs == 1 || runs == 4 {
+				return errors.New("failed")
+			}
+			return nil
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mon.Daemon(ctx)
+	// Receive the results of the runs, so that the daemon does not block.
+	for i := 0; i < 4; i++ {
+		<-mon.hcResults
+	}
+
+	for _, recovered := range []bool{false, true, false} {
+		select {
+		case tr := <-transitions:
+			if tr.Recovered != recovered || tr.Result.Name != "flaky" {
+				t.Errorf("error: transition = %+v, want recovered = %v", tr, recovered)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("error: timed out waiting for a transition")
+		}
+	}
+	select {
+	case tr := <-transitions:
+		t.Errorf("error: unexpected transition %+v", tr)
+	default:
+	}
+}
+
+// blockingNotifier, sends every transition through a channel and then blocks
+// until the context of the notification is done.
+type blockingNotifier chan Transition
+
+func (n blockingNotifier) Notify(ctx context.Context, t Transition) error {
+	n <- t
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// TestSlowNotifier, tests that a notifier which hangs does not delay the
+// results of the health checks.
+func TestSlowNotifier(t *testing.T) {
+	mon := newTestMonitor(time.Hour)
+	mon.NotifyTimeout = time.Hour
+	blocked := make(blockingNotifier, notifyQueueSize)
+	mon.Notifiers = append(mon.Notifiers, blocked)
+	results := make(chan HealthCheckResult, 100)
+	mon.OnResult = func(result HealthCheckResult) {
+		results <- result
+	}
+	mon.HealthChecks = append(mon.HealthChecks,
+		HealthCheck{
+			Name:     "failing",
+			Interval: time.Millisecond,
+			Check: func(ctx context.Context) error {
+				return errors.New("failed")
+			},
+		},
+		HealthCheck{
+			Name:     "passing",
+			Interval: time.Millisecond,
+			Check: func(ctx context.Context) error {
+				return nil
+			},
+		},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		mon.Daemon(ctx)
+		close(done)
+	}()
+	go func() {
+		// Receive the results, so that the daemon does not block.
+		for {
+			select {
+			case <-mon.hcResults:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("error: timed out waiting for the notification of the failing health check")
+	}
+	// The notifier hangs now, both health checks still report.
+	runs := make(map[string]int)
+	deadline := time.After(5 * time.Second)
+	for runs["failing"] < 5 || runs["passing"] < 5 {
+		select {
+		case result := <-results:
+			runs[result.Name]++
+		case <-deadline:
+			t.Fatalf("error: health checks stopped reporting while a notifier hangs (runs: %v)", runs)
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("error: Daemon() did not return while a notifier hangs")
+	}
+}
+
+// TestWebhookNotifier, tests that the webhook receives the transition as
+// JSON, with the configured headers.
+func TestWebhookNotifier(t *testing.T) {
+	var got transitionPayload
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	n := WebhookNotifier{URL: srv.URL + "/", Header: http.Header{"Authorization": []string{"Bearer secret"}}}
+	if err := n.Notify(context.Background(), testTransition()); err != nil {
+		t.Fatalf("error: Notify() = %v", err)
+	}
+	if got.Check != "ssh" || got.Status != "fail" || got.Error != "connection refused" || got.UptimePercent != 50 {
+		t.Errorf("error: webhook received %+v", got)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("error: webhook received Authorization header '%s'", auth)
+	}
+
+	n.URL = srv.URL + "/missing"
+	if err := n.Notify(context.Background(), testTransition()); err == nil {
+		t.Error("error: no error for a webhook answering 404")
+	}
+}
+
+// TestCommandNotifier, tests that the command receives the transition in its
+// environment and standard input, and that a failing command is an error.
+func TestCommandNotifier(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "notification")
+	n := CommandNotifier{Command: `{ echo "$PONGO_CHECK $PONGO_STATUS $PONGO_ERROR"; cat; } > ` + out}
+	if err := n.Notify(context.Background(), testTransition()); err != nil {
+		t.Fatalf("error: Notify() = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("error: the command did not run: %v", err)
+	}
+	lines := strings.SplitN(string(data), "\n", 2)
+	if lines[0] != "ssh fail connection refused" {
+		t.Errorf("error: environment of the command = '%s'", lines[0])
+	}
+	var payload transitionPayload
+	if len(lines) < 2 || json.Unmarshal([]byte(lines[1]), &payload) != nil || payload.Check != "ssh" {
+		t.Errorf("error: standard input of the command = '%s'", data)
+	}
+
+	n = CommandNotifier{Command: "echo broken >&2; exit 1"}
+	if err := n.Notify(context.Background(), testTransition()); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("error: Notify() of a failing command = %v, want its output", err)
+	}
+}
+
+// startSMTPServer, starts an SMTP server which accepts every email and sends
+// its data through the returned channel.
+func startSMTPServer(t *testing.T) (string, chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error: could not listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	emails := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP test")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 end data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				emails <- data.String()
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return ln.Addr().String(), emails
+}
+
+// TestSMTPNotifier, tests that an email about the transition is sent through
+// a local SMTP server.
+func TestSMTPNotifier(t *testing.T) {
+	addr, emails := startSMTPServer(t)
+	n := SMTPNotifier{Addr: addr, From: "pongo@localhost", To: []string{"ops@localhost"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := n.Notify(ctx, testTransition()); err != nil {
+		t.Fatalf("error: Notify() = %v", err)
+	}
+	email := <-emails
+	for _, want := range []string{"Subject: [pongo] Health check 'ssh' is failing", "To: ops@localhost", "Error: connection refused"} {
+		if !strings.Contains(email, want) {
+			t.Errorf("error: email does not contain '%s':\n%s", want, email)
+		}
+	}
+}
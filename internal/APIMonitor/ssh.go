@@ -0,0 +1,133 @@
+package APIMonitor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHResource, describes a command run in a session through an SSH server,
+// e.g. the SSH reverse proxy in front of the sessions.
+type SSHResource struct {
+	// Addr, address (host:port) of the SSH server.
+	Addr string
+	// Command, command run in the session.
+	Command string
+	// ExpectedOutput, output (stdout, without leading and trailing white
+	// space) expected from Command.
+	ExpectedOutput string
+	// Timeout, time after which the login and the command are cancelled.
+	Timeout time.Duration
+	// HostKeyCallback, verifies the host key of the SSH server.
+	HostKeyCallback ssh.HostKeyCallback
+}
+
+// SSHSession, session in which an SSH health check logs in.
+type SSHSession struct {
+	// Username and Password, credentials of the session.
+	Username string
+	Password string
+	// Release, returns or terminates the session once the health check is
+	// done with it, so that it does not consume capacity.
+	Release func() error
+}
+
+// PingSSHService, acquires a session, logs into it through the SSH server of
+// resource, runs the command of resource and returns an error if the command
+// fails or its output is not the expected one. The login and the command are
+// cancelled after the timeout of resource or once ctx is done. The session is
+// always released, an error while releasing it is returned if the health check
+// passed, and logged otherwise.
+func (mon *Monitord) PingSSHService(ctx context.Context, resource SSHResource, acquire func() (SSHSession, error)) (err error) {
+	ss, err := acquire()
+	if err != nil {
+		return fmt.Errorf("unable to acquire a session for the SSH health check: %w", err)
+	}
+	defer func() {
+		releaseErr := ss.Release()
+		if releaseErr == nil {
+			return
+		}
+		releaseErr = fmt.Errorf("unable to release the session of the SSH health check: %w", releaseErr)
+		// The error of the health check itself takes precedence.
+		if err == nil {
+			err = releaseErr
+		} else {
+			mon.errorLog.Printf("monitord: %v", releaseErr)
+		}
+	}()
+
+	output, err := runSSHCommand(ctx, resource, ss.Username, ss.Password)
+	if err != nil {
+		return err
+	}
+	if output != resource.ExpectedOutput {
+		return fmt.Errorf("SSH command '%s' at %s returned '%s'. Expected output is '%s'", resource.Command, resource.Addr, output, resource.ExpectedOutput)
+	}
+	return nil
+}
+
+// runSSHCommand, logs into the SSH server of resource with a password and
+// returns the output (stdout, without leading and trailing white space) of its
+// command.
+func runSSHCommand(ctx context.Context, resource SSHResource, username, password string) (string, error) {
+	config := &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: resource.HostKeyCallback,
+		Timeout:         resource.Timeout,
+	}
+	if resource.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, resource.Timeout)
+		defer cancel()
+	}
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", resource.Addr)
+	if err != nil {
+		return "", fmt.Errorf("unable to connect to SSH server at %s: %w", resource.Addr, err)
+	}
+	defer conn.Close()
+	// The deadline bounds the handshake, the login and the command.
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return "", fmt.Errorf("unable to set deadline of SSH connection to %s: %w", resource.Addr, err)
+		}
+	}
+	// Close the connection if ctx is cancelled before its deadline.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, resource.Addr, config)
+	if err != nil {
+		return "", fmt.Errorf("unable to log in as %s at SSH server %s: %w", username, resource.Addr, err)
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("unable to open SSH session at %s: %w", resource.Addr, err)
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if err := session.Run(resource.Command); err != nil {
+		return "", fmt.Errorf("SSH command '%s' at %s failed: %w (stderr: %s)", resource.Command, resource.Addr, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
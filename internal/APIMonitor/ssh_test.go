@@ -0,0 +1,178 @@
+package APIMonitor
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startSSHServer, starts an SSH server which accepts the login of username
+// with password and answers every command 'echo <text>' with '<text>'. It
+// returns the address of the server and its host key.
+func startSSHServer(t *testing.T, username, password string) (string, ssh.PublicKey) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error: could not generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("error: could not create signer: %v", err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == username && string(pass) == password {
+				return nil, nil
+			}
+			return nil, errors.New("invalid credentials")
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error: could not listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+	return ln.Addr().String(), signer.PublicKey()
+}
+
+// serveSSH, serves the SSH connection conn of a test server.
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, requests, err := newCh.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer ch.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+					req.Reply(false, nil)
+					return
+				}
+				req.Reply(true, nil)
+				status := uint32(0)
+				if strings.HasPrefix(payload.Command, "echo ") {
+					text := strings.TrimPrefix(payload.Command, "echo ")
+					ch.Write([]byte(text + "\n"))
+				} else {
+					ch.Stderr().Write([]byte("command not found\n"))
+					status = 127
+				}
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				return
+			}
+		}()
+	}
+}
+
+// TestPingSSHService, tests the SSH health check against an SSH server, and
+// that the session of the health check is always released.
+func TestPingSSHService(t *testing.T) {
+	addr, hostKey := startSSHServer(t, "user1", "secret")
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(otherPriv)
+
+	tests := []struct {
+		name     string
+		password string
+		command  string
+		hostKey  ssh.PublicKey
+		wantErr  bool
+	}{
+		{"expected output", "secret", "echo pongo-healthcheck", hostKey, false},
+		{"wrong password", "wrong", "echo pongo-healthcheck", hostKey, true},
+		{"unexpected output", "secret", "echo something else", hostKey, true},
+		{"failing command", "secret", "false", hostKey, true},
+		{"wrong host key", "secret", "echo pongo-healthcheck", otherSigner.PublicKey(), true},
+	}
+	mon := newTestMonitor(time.Hour)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := SSHResource{
+				Addr:            addr,
+				Command:         tt.command,
+				ExpectedOutput:  "pongo-healthcheck",
+				Timeout:         5 * time.Second,
+				HostKeyCallback: ssh.FixedHostKey(tt.hostKey),
+			}
+			released := false
+			acquire := func() (SSHSession, error) {
+				return SSHSession{
+					Username: "user1",
+					Password: tt.password,
+					Release: func() error {
+						released = true
+						return nil
+					},
+				}, nil
+			}
+			err := mon.PingSSHService(context.Background(), resource, acquire)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error: PingSSHService() = %v, want error: %t", err, tt.wantErr)
+			}
+			if !released {
+				t.Error("error: the session of the health check was not released")
+			}
+		})
+	}
+
+	t.Run("no session", func(t *testing.T) {
+		noSession := errors.New("no session")
+		err := mon.PingSSHService(context.Background(), SSHResource{Addr: addr}, func() (SSHSession, error) {
+			return SSHSession{}, noSession
+		})
+		if !errors.Is(err, noSession) {
+			t.Errorf("error: PingSSHService() = %v, want %v", err, noSession)
+		}
+	})
+
+	t.Run("release error", func(t *testing.T) {
+		releaseErr := errors.New("stop failed")
+		resource := SSHResource{
+			Addr:            addr,
+			Command:         "echo pongo-healthcheck",
+			ExpectedOutput:  "pongo-healthcheck",
+			Timeout:         5 * time.Second,
+			HostKeyCallback: ssh.FixedHostKey(hostKey),
+		}
+		err := mon.PingSSHService(context.Background(), resource, func() (SSHSession, error) {
+			return SSHSession{Username: "user1", Password: "secret", Release: func() error { return releaseErr }}, nil
+		})
+		if !errors.Is(err, releaseErr) {
+			t.Errorf("error: PingSSHService() = %v, want %v", err, releaseErr)
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package APIMonitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// TCPResource, describes a TCP service, e.g. a database or the SSH reverse
+// proxy.
+type TCPResource struct {
+	// Addr, address (host:port) of the TCP service.
+	Addr string
+	// Timeout, time after which the connection attempt is cancelled.
+	Timeout time.Duration
+}
+
+// PingTCPService, returns an error if no TCP connection can be established
+// with the service of resource before its timeout or before ctx is done.
+func (mon *Monitord) PingTCPService(ctx context.Context, resource TCPResource) error {
+	d := net.Dialer{Timeout: resource.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", resource.Addr)
+	if err != nil {
+		return fmt.Errorf("unable to connect to TCP service at %s: %w", resource.Addr, err)
+	}
+	return conn.Close()
+}
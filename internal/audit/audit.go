@@ -0,0 +1,361 @@
+// audit, append-only log of the lifecycle events of the sessions, e.g. to
+// answer which participant had which container when, after an incident.
+// Every record is written as a line of JSON (JSON Lines) and carries the hash
+// of the previous record, so that modifying, removing or reordering records
+// breaks the chain of hashes.
+// The hashes are HMAC-SHA256 with a secret key kept outside the log. Without
+// the key, whoever can write to the log cannot compute the hashes of forged
+// records, so the chain cannot be rewritten to hide a modification. Removing
+// the last records of the log keeps the chain intact, the last sequence number
+// and hash have to be kept elsewhere to detect it.
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPath, default location of the audit log.
+const DefaultPath = "/var/local/pongo/audit.jsonl"
+
+// DefaultKeyPath, default location of the key of the audit log, outside the
+// directory of the log.
+const DefaultKeyPath = "/etc/pongo/audit.key"
+
+// KeySize, size in bytes of a generated key.
+const KeySize = 32
+
+const (
+	// EventCreated, a session was created and is available.
+	EventCreated = "session.created"
+	// EventDelivered, a session was delivered to a participant.
+	EventDelivered = "session.delivered"
+	// EventLogin, the first SSH login into a session was detected.
+	EventLogin = "session.login"
+	// EventExtended, the lifetime of a session was extended by its user.
+	EventExtended = "session.extended"
+	// EventExpired, a session was stopped when its lifetime was over.
+	EventExpired = "session.expired"
+	// EventTerminated, a session was stopped before its lifetime was over,
+	// e.g. because it was idle, by an administrator or at shutdown.
+	EventTerminated = "session.terminated"
+	// EventFlagSubmitted, the user of a session submitted a flag.
+	EventFlagSubmitted = "flag.submitted"
+	// EventAdmin, an administrator performed an action.
+	EventAdmin = "admin.action"
+)
+
+// genesisHash, previous hash of the first record of a log.
+var genesisHash = strings.Repeat("0", sha256.Size*2)
+
+// ERR_TAMPERED, the chain of hashes of an audit log is broken.
+var ERR_TAMPERED error = fmt.Errorf("The audit log was tampered with.")
+
+// ERR_SHORT_KEY, the key of an audit log is too short to protect the log.
+var ERR_SHORT_KEY error = fmt.Errorf("The key of the audit log must be at least %d bytes long.", KeySize)
+
+// Record, event of the audit log.
+type Record struct {
+	// Seq, position of the record in the log, starting at 1.
+	Seq uint64 `json:"seq"`
+	// Time, time at which the event happened.
+	Time time.Time `json:"time"`
+	// Event, type of the event, e.g. EventDelivered.
+	Event string `json:"event"`
+	// Session, name of the session.
+	Session string `json:"session,omitempty"`
+	// Username, SSH username of the session.
+	Username string `json:"username,omitempty"`
+	// Identity, identity (IP address) of the participant who owns the
+	// session.
+	Identity string `json:"identity,omitempty"`
+	// Challenge, challenge run by the session.
+	Challenge string `json:"challenge,omitempty"`
+	// Engine, container engine in which the session runs.
+	Engine string `json:"engine,omitempty"`
+	// Containers, IDs of the containers of the session.
+	Containers []string `json:"containers,omitempty"`
+	// Actor, who caused the event if it was not the participant, e.g. the
+	// name of an administrator.
+	Actor string `json:"actor,omitempty"`
+	// Details, further details of the event, e.g. the reason why a session
+	// was terminated.
+	Details map[string]string `json:"details,omitempty"`
+	// PrevHash, hash of the previous record.
+	PrevHash string `json:"prev_hash"`
+	// Hash, HMAC-SHA256 of the record (encoded as JSON with an empty Hash)
+	// with the key of the log.
+	Hash string `json:"hash"`
+}
+
+// computeHash, returns the hash of a record with the key of its log.
+func (r Record) computeHash(key []byte) (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ReadKey, reads the key of an audit log, stored hex-encoded in the file at
+// path.
+func ReadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key of audit log: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding key of audit log %s: %w", path, err)
+	}
+	if len(key) < KeySize {
+		return nil, fmt.Errorf("error reading key of audit log %s: %w", path, ERR_SHORT_KEY)
+	}
+	return key, nil
+}
+
+// LoadOrCreateKey, reads the key of an audit log from the file at path. If
+// the file does not exist, a random key is generated and stored in it,
+// readable only by its owner.
+func LoadOrCreateKey(path string) ([]byte, error) {
+	key, err := ReadKey(path)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return key, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("error creating directory of key of audit log: %w", err)
+	}
+	key = make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error generating key of audit log: %w", err)
+	}
+	// O_EXCL, never overwrite a key created in the meantime, the records
+	// hashed with it could not be verified anymore.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if err != nil {
+		return nil, fmt.Errorf("error creating key of audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		return nil, fmt.Errorf("error writing key of audit log: %w", err)
+	}
+	return key, nil
+}
+
+// Log, audit log stored in a file. Records are only ever appended to the
+// file. Log is concurrent-safe.
+type Log struct {
+	mu sync.Mutex
+	// f, file of the log opened in append mode.
+	f *os.File
+	// key, key with which the records are hashed.
+	key []byte
+	// seq and last, sequence number and hash of the last record.
+	seq  uint64
+	last string
+}
+
+// Open, opens the audit log at path, creating it if it does not exist, whose
+// records are hashed with key. The chain of hashes of the existing records is
+// verified first, new records are not appended to a log which was tampered
+// with.
+func Open(path string, key []byte) (*Log, error) {
+	if len(key) < KeySize {
+		return nil, ERR_SHORT_KEY
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("error creating directory of audit log: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %w", err)
+	}
+	l := &Log{f: f, key: key, last: genesisHash}
+	err = Scan(f, key, func(r Record) error {
+		l.seq = r.Seq
+		l.last = r.Hash
+		return nil
+	})
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error verifying audit log %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Append, appends a record to the log and returns it with its sequence
+// number and hashes. The time of the record is set to now if it is zero. The
+// log is synced before Append returns.
+func (l *Log) Append(r Record) (Record, error) {
+	r, err := l.write(r)
+	if err != nil {
+		return r, err
+	}
+	// Records must survive a crash of the host.
+	return r, l.Sync()
+}
+
+// Sync, commits the records written to the log to disk.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("error syncing audit log: %w", err)
+	}
+	return nil
+}
+
+// write, appends a record to the log without syncing it (see Append).
+func (l *Log) write(r Record) (Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r.Seq = l.seq + 1
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	r.Time = r.Time.UTC()
+	r.PrevHash = l.last
+	hash, err := r.computeHash(l.key)
+	if err != nil {
+		return r, fmt.Errorf("error hashing audit record: %w", err)
+	}
+	r.Hash = hash
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return r, fmt.Errorf("error encoding audit record: %w", err)
+	}
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return r, fmt.Errorf("error writing audit record: %w", err)
+	}
+	l.seq = r.Seq
+	l.last = r.Hash
+	return r, nil
+}
+
+// Close, closes the file of the log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Scan, reads the records of an audit log in order and calls fn with every
+// record, verifying the chain of hashes with the key of the log. It returns an
+// error wrapping ERR_TAMPERED at the first record which breaks the chain.
+func Scan(r io.Reader, key []byte, fn func(Record) error) error {
+	if len(key) < KeySize {
+		return ERR_SHORT_KEY
+	}
+	scanner := bufio.NewScanner(r)
+	// Records are small, but their details are not bounded.
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	prev := genesisHash
+	var seq uint64
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("%w: line %d is not a record: %v", ERR_TAMPERED, line, err)
+		}
+		if rec.Seq != seq+1 {
+			return fmt.Errorf("%w: line %d has sequence number %d, expected %d", ERR_TAMPERED, line, rec.Seq, seq+1)
+		}
+		if rec.PrevHash != prev {
+			return fmt.Errorf("%w: line %d (seq %d) does not follow the previous record", ERR_TAMPERED, line, rec.Seq)
+		}
+		hash, err := rec.computeHash(key)
+		if err != nil {
+			return err
+		}
+		if rec.Hash != hash {
+			return fmt.Errorf("%w: line %d (seq %d) was modified", ERR_TAMPERED, line, rec.Seq)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+		prev = rec.Hash
+		seq = rec.Seq
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading audit log: %w", err)
+	}
+	return nil
+}
+
+// Filter, selects records of an audit log. Empty fields match every record.
+type Filter struct {
+	// Session, name or SSH username of a session.
+	Session string
+	// Identity, identity (IP address) of a participant.
+	Identity string
+	// Container, ID (or prefix of the ID) of a container.
+	Container string
+	// Event, type of event.
+	Event string
+	// Since and Until, time range of the events.
+	Since time.Time
+	Until time.Time
+}
+
+// Match, reports whether a record is selected by the filter.
+func (f Filter) Match(r Record) bool {
+	if f.Session != "" && f.Session != r.Session && f.Session != r.Username {
+		return false
+	}
+	if f.Identity != "" && f.Identity != r.Identity {
+		return false
+	}
+	if f.Event != "" && f.Event != r.Event {
+		return false
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && r.Time.After(f.Until) {
+		return false
+	}
+	if f.Container != "" {
+		for _, id := range r.Containers {
+			if strings.HasPrefix(id, f.Container) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Query, returns the records of an audit log selected by the filter. If the
+// log was tampered with, the records read before the broken record are
+// returned with an error wrapping ERR_TAMPERED.
+func Query(r io.Reader, key []byte, f Filter) ([]Record, error) {
+	var records []Record
+	err := Scan(r, key, func(rec Record) error {
+		if f.Match(rec) {
+			records = append(records, rec)
+		}
+		return nil
+	})
+	return records, err
+}
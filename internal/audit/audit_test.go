@@ -0,0 +1,255 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testKey, key of the audit logs of the tests.
+var testKey = bytes.Repeat([]byte{0x42}, KeySize)
+
+// writeLog, appends a record per event to a new audit log and returns the
+// path of the log.
+func writeLog(t *testing.T, events ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	l, err := Open(path, testKey)
+	if err != nil {
+		t.Fatalf("error: could not open audit log: %v", err)
+	}
+	defer l.Close()
+	for i, event := range events {
+		_, err := l.Append(Record{Event: event, Session: "s1", Identity: "10.0.0.1", Containers: []string{"abcdef0123456789"}, Time: time.Date(2023, 1, 1, 10, i, 0, 0, time.UTC)})
+		if err != nil {
+			t.Fatalf("error: could not append record: %v", err)
+		}
+	}
+	return path
+}
+
+// TestAppendAndReopen, tests that records are chained, and that a reopened log
+// continues the chain of its existing records.
+func TestAppendAndReopen(t *testing.T) {
+	path := writeLog(t, EventCreated, EventDelivered)
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("error: audit log is not readable only by its owner: %v", info.Mode())
+	}
+
+	l, err := Open(path, testKey)
+	if err != nil {
+		t.Fatalf("error: could not reopen audit log: %v", err)
+	}
+	r, err := l.Append(Record{Event: EventExpired, Session: "s1"})
+	if err != nil {
+		t.Fatalf("error: could not append record: %v", err)
+	}
+	l.Close()
+	if r.Seq != 3 {
+		t.Errorf("error: record has sequence number %d, expected 3", r.Seq)
+	}
+
+	data, _ := os.ReadFile(path)
+	records, err := Query(bytes.NewReader(data), testKey, Filter{})
+	if err != nil {
+		t.Fatalf("error: intact audit log does not verify: %v", err)
+	}
+	if len(records) != 3 || records[2].PrevHash != records[1].Hash || records[0].PrevHash != genesisHash {
+		t.Errorf("error: records are not chained: %+v", records)
+	}
+}
+
+// TestTampering, tests that modified, removed and reordered records are
+// detected.
+func TestTampering(t *testing.T) {
+	data, err := os.ReadFile(writeLog(t, EventCreated, EventDelivered, EventExpired))
+	if err != nil {
+		t.Fatalf("error: could not read audit log: %v", err)
+	}
+	lines := strings.SplitAfter(strings.TrimSpace(string(data)), "\n")
+
+	tests := []struct {
+		name string
+		log  string
+	}{
+		{"modified", strings.Replace(string(data), "10.0.0.1", "10.0.0.2", 1)},
+		{"removed", lines[0] + lines[2]},
+		{"reordered", lines[1] + lines[0] + lines[2]},
+		{"truncated record", string(data[:len(data)-10])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Query(strings.NewReader(tt.log), testKey, Filter{})
+			if !errors.Is(err, ERR_TAMPERED) {
+				t.Errorf("error: tampering was not detected: %v", err)
+			}
+		})
+	}
+
+	// The records before the tampered record are still returned.
+	records, _ := Query(strings.NewReader(lines[0]+lines[2]), testKey, Filter{})
+	if len(records) != 1 {
+		t.Errorf("error: %d records returned before the tampered record, expected 1", len(records))
+	}
+}
+
+// TestForgedChain, tests that records rewritten by someone without the key of
+// the log are detected, even if the whole chain of hashes is recomputed.
+func TestForgedChain(t *testing.T) {
+	path := writeLog(t, EventCreated, EventDelivered)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error: could not read audit log: %v", err)
+	}
+	records, err := Query(bytes.NewReader(data), testKey, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite the identity of the participant and recompute the chain with
+	// another key.
+	otherKey := bytes.Repeat([]byte{0x24}, KeySize)
+	forged := new(bytes.Buffer)
+	prev := genesisHash
+	for _, r := range records {
+		r.Identity = "10.0.0.2"
+		r.PrevHash = prev
+		r.Hash, err = r.computeHash(otherKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev = r.Hash
+		line, _ := json.Marshal(r)
+		forged.Write(append(line, '\n'))
+	}
+	if _, err := Query(bytes.NewReader(forged.Bytes()), testKey, Filter{}); !errors.Is(err, ERR_TAMPERED) {
+		t.Errorf("error: a chain recomputed without the key was not detected: %v", err)
+	}
+	if _, err := Query(bytes.NewReader(data), otherKey, Filter{}); !errors.Is(err, ERR_TAMPERED) {
+		t.Errorf("error: the log verifies with another key: %v", err)
+	}
+	if _, err := Open(path, testKey[:KeySize-1]); !errors.Is(err, ERR_SHORT_KEY) {
+		t.Errorf("error: a log was opened with a short key: %v", err)
+	}
+}
+
+// TestLoadOrCreateKey, tests that a missing key is generated once, readable
+// only by its owner, and read back afterwards.
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "audit.key")
+	key, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("error: could not create key: %v", err)
+	}
+	if len(key) != KeySize {
+		t.Errorf("error: generated key has %d bytes, expected %d", len(key), KeySize)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0400 {
+		t.Errorf("error: key is not readable only by its owner: %v", info.Mode())
+	}
+	again, err := LoadOrCreateKey(path)
+	if err != nil || !bytes.Equal(again, key) {
+		t.Errorf("error: existing key was not read back (%v)", err)
+	}
+
+	short := filepath.Join(t.TempDir(), "short.key")
+	if err := os.WriteFile(short, []byte("abcd\n"), 0400); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadKey(short); !errors.Is(err, ERR_SHORT_KEY) {
+		t.Errorf("error: a short key was accepted: %v", err)
+	}
+}
+
+// TestFilter, tests the selection of records.
+func TestFilter(t *testing.T) {
+	r := Record{Time: time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC), Event: EventDelivered, Session: "s1", Username: "user", Identity: "10.0.0.1", Containers: []string{"abcdef0123456789"}}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"session", Filter{Session: "s1"}, true},
+		{"username", Filter{Session: "user"}, true},
+		{"other session", Filter{Session: "s2"}, false},
+		{"identity", Filter{Identity: "10.0.0.1", Event: EventDelivered}, true},
+		{"other event", Filter{Event: EventExpired}, false},
+		{"container prefix", Filter{Container: "abcdef"}, true},
+		{"other container", Filter{Container: "012345"}, false},
+		{"time range", Filter{Since: r.Time.Add(-time.Hour), Until: r.Time}, true},
+		{"before range", Filter{Since: r.Time.Add(time.Second)}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(r); got != tt.want {
+			t.Errorf("error: %s: Match is %v, expected %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestWriter, tests that the records queued by concurrent callers are all
+// appended in a valid chain, in the order in which every caller queued them,
+// and that Close appends the records still queued.
+func TestWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path, testKey)
+	if err != nil {
+		t.Fatalf("error: could not open audit log: %v", err)
+	}
+	w := NewWriter(l, 8, func(err error) {
+		t.Errorf("error: writer failed: %v", err)
+	})
+
+	const callers, perCaller = 10, 20
+	var wg sync.WaitGroup
+	for c := 0; c < callers; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < perCaller; i++ {
+				w.Write(Record{Event: EventCreated, Session: fmt.Sprintf("s%d", c), Details: map[string]string{"i": strconv.Itoa(i)}})
+			}
+		}(c)
+	}
+	wg.Wait()
+	w.Flush()
+
+	data, _ := os.ReadFile(path)
+	records, err := Query(bytes.NewReader(data), testKey, Filter{})
+	if err != nil {
+		t.Fatalf("error: audit log written by the writer does not verify: %v", err)
+	}
+	if len(records) != callers*perCaller {
+		t.Fatalf("error: %d records were appended before the flush returned, expected %d", len(records), callers*perCaller)
+	}
+	next := make(map[string]int)
+	for _, r := range records {
+		if r.Time.IsZero() {
+			t.Errorf("error: record %d has no time", r.Seq)
+		}
+		if r.Details["i"] != strconv.Itoa(next[r.Session]) {
+			t.Errorf("error: record %d is record %s of %s, expected record %d", r.Seq, r.Details["i"], r.Session, next[r.Session])
+		}
+		next[r.Session]++
+	}
+
+	w.Write(Record{Event: EventExpired, Session: "s0"})
+	if err := w.Close(); err != nil {
+		t.Fatalf("error: could not close writer: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	records, err = Query(bytes.NewReader(data), testKey, Filter{Event: EventExpired})
+	if err != nil || len(records) != 1 {
+		t.Errorf("error: the record queued before Close was not appended: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"fmt"
+	"time"
+)
+
+// Writer, appends records to a Log in its own goroutine, so that recording an
+// event never waits for the disk. The records are appended in the order in
+// which they were queued, and the log is synced once for every batch of
+// records queued while the previous batch was written. Writer is
+// concurrent-safe.
+type Writer struct {
+	// log, log to which the records are appended.
+	log *Log
+	// queue, records waiting to be appended.
+	queue chan writeRequest
+	// onError, called with every error of the writer.
+	onError func(error)
+	// done, closed once every queued record was appended after Close.
+	done chan struct{}
+}
+
+// writeRequest, element of the queue of a Writer.
+type writeRequest struct {
+	// rec, record to append.
+	rec Record
+	// flushed, if not nil, the request carries no record and flushed is
+	// closed once every record queued before it was appended and synced.
+	flushed chan struct{}
+}
+
+// NewWriter, constructor for a Writer which appends records to l, with room
+// for size queued records. onError is called with every error while appending
+// a record or syncing the log, since the callers of Write do not wait for it.
+func NewWriter(l *Log, size int, onError func(error)) *Writer {
+	w := &Writer{
+		log:     l,
+		queue:   make(chan writeRequest, size),
+		onError: onError,
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write, queues a record to be appended to the log. The time of the record is
+// set to now if it is zero, so that it is the time of the event and not the
+// time at which the record is appended. Write only blocks if the queue is
+// full, records are never dropped. Write must not be called after Close.
+func (w *Writer) Write(r Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	w.queue <- writeRequest{rec: r}
+}
+
+// Flush, waits until every record queued before has been appended to the log
+// and synced.
+func (w *Writer) Flush() {
+	flushed := make(chan struct{})
+	w.queue <- writeRequest{flushed: flushed}
+	<-flushed
+}
+
+// Close, appends the records still queued and closes the log.
+func (w *Writer) Close() error {
+	close(w.queue)
+	<-w.done
+	return w.log.Close()
+}
+
+// run, appends the queued records until the writer is closed.
+func (w *Writer) run() {
+	defer close(w.done)
+	for req := range w.queue {
+		batch := []writeRequest{req}
+		// Take every request queued in the meantime, so that the log is
+		// synced once for all of them.
+		for drained := false; !drained; {
+			select {
+			case req, ok := <-w.queue:
+				if !ok {
+					drained = true
+					continue
+				}
+				batch = append(batch, req)
+			default:
+				drained = true
+			}
+		}
+		w.writeBatch(batch)
+	}
+}
+
+// writeBatch, appends the records of a batch of requests, syncs the log and
+// then releases the flushes of the batch.
+func (w *Writer) writeBatch(batch []writeRequest) {
+	written := 0
+	for _, req := range batch {
+		if req.flushed != nil {
+			continue
+		}
+		if _, err := w.log.write(req.rec); err != nil {
+			w.onError(fmt.Errorf("error recording event %s of session (%s): %w", req.rec.Event, req.rec.Session, err))
+			continue
+		}
+		written++
+	}
+	if written > 0 {
+		// Records must survive a crash of the host.
+		if err := w.log.Sync(); err != nil {
+			w.onError(err)
+		}
+	}
+	for _, req := range batch {
+		if req.flushed != nil {
+			close(req.flushed)
+		}
+	}
+}
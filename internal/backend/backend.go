@@ -0,0 +1,65 @@
+// backend abstracts the container engine used to run the sessions behind the
+// ContainerRuntime interface. Docker implements the interface with the Docker
+// SDK, Fake implements it in memory, so that the session management can be
+// tested without a container engine. Podman is supported through its
+// Docker-compatible API socket, which is found with Discover.
+package backend
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	dockerExec "github.com/erodrigufer/pongo/internal/docker/exec"
+)
+
+// ContainerRuntime, operations that pongo performs on a container engine to
+// manage the containers and networks of the sessions. Implementations must be
+// concurrent-safe.
+type ContainerRuntime interface {
+	// CreateContainer, creates a container with the given name and returns
+	// its ID. The container is not started.
+	CreateContainer(ctx context.Context, name string, config *container.Config, hostConfig *container.HostConfig, networkConfig *network.NetworkingConfig) (string, error)
+	// StartContainer, starts a created container.
+	StartContainer(ctx context.Context, containerID string) error
+	// StopContainer, stops a running container. If the container does not
+	// stop within timeout, it is killed. Containers created with AutoRemove
+	// are removed once they stop.
+	StopContainer(ctx context.Context, containerID string, timeout *time.Duration) error
+	// RemoveContainer, forcefully removes a container, whether it is running
+	// or not, together with its anonymous volumes.
+	RemoveContainer(ctx context.Context, containerID string) error
+	// ListContainers, lists all running containers. If all is true, stopped
+	// containers are listed as well.
+	ListContainers(ctx context.Context, all bool) ([]types.Container, error)
+	// Exec, runs a command inside a running container, waits for the command
+	// to return and collects its output and exit code.
+	Exec(ctx context.Context, containerID string, cmd []string) (dockerExec.Result, error)
+	// ExecWithStdin, same as Exec, but everything read from stdin is written
+	// to the standard input of the command.
+	ExecWithStdin(ctx context.Context, containerID string, cmd []string, stdin io.Reader) (dockerExec.Result, error)
+	// CreateNetwork, creates a network. The response contains its ID and
+	// any warnings of the container engine.
+	CreateNetwork(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error)
+	// ConnectNetwork, connects a container to a network.
+	ConnectNetwork(ctx context.Context, networkID, containerID string) error
+	// RemoveNetwork, removes a network.
+	RemoveNetwork(ctx context.Context, networkID string) error
+	// CopyFromContainer, returns a tar archive with the file or directory at
+	// srcPath inside a container.
+	CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, error)
+	// CopyToContainer, extracts the tar archive read from content into the
+	// directory dstPath inside a container.
+	CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader) error
+	// Info, returns information about the container engine, e.g. its
+	// runtimes and security options.
+	Info(ctx context.Context) (types.Info, error)
+	// Version, returns the version of the container engine and of its
+	// components.
+	Version(ctx context.Context) (types.Version, error)
+	// Stats, samples the resource usage of a running container.
+	Stats(ctx context.Context, containerID string) (Stats, error)
+}
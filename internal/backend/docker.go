@@ -0,0 +1,120 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	dockerExec "github.com/erodrigufer/pongo/internal/docker/exec"
+)
+
+// Docker, ContainerRuntime implemented with a client of the Docker daemon. It
+// also works with the Docker-compatible API of Podman.
+type Docker struct {
+	// client, communicates with the Docker daemon.
+	client *client.Client
+}
+
+// NewDocker, constructor for a Docker runtime that uses dockerClient to
+// communicate with the Docker daemon.
+func NewDocker(dockerClient *client.Client) *Docker {
+	d := new(Docker)
+	d.client = dockerClient
+	return d
+}
+
+// CreateContainer, implements ContainerRuntime.
+func (d *Docker) CreateContainer(ctx context.Context, name string, config *container.Config, hostConfig *container.HostConfig, networkConfig *network.NetworkingConfig) (string, error) {
+	resp, err := d.client.ContainerCreate(ctx, config, hostConfig, networkConfig, nil, name)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// StartContainer, implements ContainerRuntime.
+func (d *Docker) StartContainer(ctx context.Context, containerID string) error {
+	return d.client.ContainerStart(ctx, containerID, types.ContainerStartOptions{})
+}
+
+// StopContainer, implements ContainerRuntime.
+func (d *Docker) StopContainer(ctx context.Context, containerID string, timeout *time.Duration) error {
+	return d.client.ContainerStop(ctx, containerID, timeout)
+}
+
+// RemoveContainer, implements ContainerRuntime.
+func (d *Docker) RemoveContainer(ctx context.Context, containerID string) error {
+	return d.client.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+}
+
+// ListContainers, implements ContainerRuntime.
+func (d *Docker) ListContainers(ctx context.Context, all bool) ([]types.Container, error) {
+	return d.client.ContainerList(ctx, types.ContainerListOptions{All: all})
+}
+
+// Exec, implements ContainerRuntime.
+func (d *Docker) Exec(ctx context.Context, containerID string, cmd []string) (dockerExec.Result, error) {
+	return dockerExec.Run(ctx, d.client, containerID, cmd)
+}
+
+// ExecWithStdin, implements ContainerRuntime.
+func (d *Docker) ExecWithStdin(ctx context.Context, containerID string, cmd []string, stdin io.Reader) (dockerExec.Result, error) {
+	return dockerExec.RunWithStdin(ctx, d.client, containerID, cmd, stdin)
+}
+
+// CreateNetwork, implements ContainerRuntime.
+func (d *Docker) CreateNetwork(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error) {
+	return d.client.NetworkCreate(ctx, name, options)
+}
+
+// ConnectNetwork, implements ContainerRuntime.
+func (d *Docker) ConnectNetwork(ctx context.Context, networkID, containerID string) error {
+	return d.client.NetworkConnect(ctx, networkID, containerID, nil)
+}
+
+// RemoveNetwork, implements ContainerRuntime.
+func (d *Docker) RemoveNetwork(ctx context.Context, networkID string) error {
+	return d.client.NetworkRemove(ctx, networkID)
+}
+
+// CopyFromContainer, implements ContainerRuntime.
+func (d *Docker) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, error) {
+	archive, _, err := d.client.CopyFromContainer(ctx, containerID, srcPath)
+	return archive, err
+}
+
+// CopyToContainer, implements ContainerRuntime.
+func (d *Docker) CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader) error {
+	return d.client.CopyToContainer(ctx, containerID, dstPath, content, types.CopyToContainerOptions{})
+}
+
+// Info, implements ContainerRuntime.
+func (d *Docker) Info(ctx context.Context) (types.Info, error) {
+	return d.client.Info(ctx)
+}
+
+// Version, implements ContainerRuntime.
+func (d *Docker) Version(ctx context.Context) (types.Version, error) {
+	return d.client.ServerVersion(ctx)
+}
+
+// Stats, implements ContainerRuntime. The Docker daemon samples the usage
+// twice (about a second apart) to compute the CPU usage.
+func (d *Docker) Stats(ctx context.Context, containerID string) (Stats, error) {
+	resp, err := d.client.ContainerStats(ctx, containerID, false)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer resp.Body.Close()
+	var v types.StatsJSON
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return Stats{}, fmt.Errorf("error decoding stats of container %s: %w", containerID, err)
+	}
+	return StatsFromJSON(v), nil
+}
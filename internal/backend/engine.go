@@ -0,0 +1,176 @@
+package backend
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+const (
+	// EngineAuto, use the first container engine whose API socket is found,
+	// Docker is preferred over Podman.
+	EngineAuto = "auto"
+	// EngineDocker, the Docker daemon.
+	EngineDocker = "docker"
+	// EnginePodman, Podman through its Docker-compatible API socket (rootless
+	// or rootful).
+	EnginePodman = "podman"
+)
+
+// Endpoint, address of the API of a container engine.
+type Endpoint struct {
+	// Engine, container engine expected at the endpoint (EngineDocker,
+	// EnginePodman or EngineAuto if the engine is not known until it is
+	// probed).
+	Engine string
+	// Host, address of the API, e.g. 'unix:///var/run/docker.sock'.
+	Host string
+	// Source, where the address was found, e.g. 'DOCKER_HOST' or the path of a
+	// socket.
+	Source string
+	// TLSCA, TLSCert and TLSKey, paths of the CA certificate, client
+	// certificate and client key used to connect to a 'tcp://' host with TLS.
+	// If empty, the usual Docker env. variables are used (only by NewClient,
+	// NewRemoteClient requires them for 'tcp://' hosts).
+	TLSCA   string
+	TLSCert string
+	TLSKey  string
+}
+
+// ERR_NO_ENGINE, no API socket of a container engine was found.
+var ERR_NO_ENGINE error = fmt.Errorf("No API socket of a container engine was found.")
+
+// Discover, finds the API of the container engine (EngineAuto, EngineDocker
+// or EnginePodman). If host is not empty, it is used as-is. Otherwise the
+// environment variables DOCKER_HOST (Docker) and CONTAINER_HOST (Podman) are
+// honoured, before looking for the default sockets of the engines:
+// /var/run/docker.sock for Docker and, for Podman, the rootless socket in
+// $XDG_RUNTIME_DIR (or /run/user/<uid>) followed by the rootful socket in
+// /run/podman.
+func Discover(engine, host string) (Endpoint, error) {
+	return discover(engine, host, os.Getenv, os.Getuid(), isSocket)
+}
+
+// discover, implements Discover with injectable dependencies. getenv returns
+// the value of an environment variable, uid is the user ID of the process and
+// exists reports whether a socket exists at a path.
+func discover(engine, host string, getenv func(string) string, uid int, exists func(string) bool) (Endpoint, error) {
+	switch engine {
+	case EngineAuto, EngineDocker, EnginePodman:
+	default:
+		return Endpoint{}, fmt.Errorf("error: unknown container engine '%s' (valid engines: %s, %s, %s)", engine, EngineAuto, EngineDocker, EnginePodman)
+	}
+	if host != "" {
+		return Endpoint{Engine: engine, Host: host, Source: "configuration"}, nil
+	}
+
+	var tried []string
+	for _, c := range candidates(engine, getenv, uid) {
+		// Addresses set in the environment are trusted, they could point to
+		// a remote engine.
+		if c.socket == "" || exists(c.socket) {
+			return c.Endpoint, nil
+		}
+		tried = append(tried, c.socket)
+	}
+	return Endpoint{}, fmt.Errorf("error: %w (engine: %s, tried: %s)", ERR_NO_ENGINE, engine, strings.Join(tried, ", "))
+}
+
+// candidate, possible endpoint of a container engine.
+type candidate struct {
+	Endpoint
+	// socket, path of the socket of the endpoint. It is empty if the endpoint
+	// was set in the environment.
+	socket string
+}
+
+// candidates, returns the possible endpoints of an engine in the order in
+// which they are tried.
+func candidates(engine string, getenv func(string) string, uid int) []candidate {
+	var cs []candidate
+	fromEnv := func(engine, variable string) {
+		if host := getenv(variable); host != "" {
+			cs = append(cs, candidate{Endpoint: Endpoint{Engine: engine, Host: host, Source: variable}})
+		}
+	}
+	fromSocket := func(engine, path string) {
+		cs = append(cs, candidate{Endpoint: Endpoint{Engine: engine, Host: "unix://" + path, Source: path}, socket: path})
+	}
+
+	if engine != EnginePodman {
+		fromEnv(engine, "DOCKER_HOST")
+		fromSocket(EngineDocker, "/var/run/docker.sock")
+	}
+	if engine != EngineDocker {
+		fromEnv(EnginePodman, "CONTAINER_HOST")
+		// The rootless socket only exists for non-root users.
+		if uid != 0 {
+			runtimeDir := getenv("XDG_RUNTIME_DIR")
+			if runtimeDir == "" {
+				runtimeDir = fmt.Sprintf("/run/user/%d", uid)
+			}
+			fromSocket(EnginePodman, filepath.Join(runtimeDir, "podman", "podman.sock"))
+		}
+		fromSocket(EnginePodman, "/run/podman/podman.sock")
+	}
+	return cs
+}
+
+// isSocket, reports whether a unix socket exists at path.
+func isSocket(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+// ERR_NO_TLS, a 'tcp://' remote engine has no TLS certificates. Its API would
+// be reached in plaintext and without authentication, and it gives root on its
+// host.
+var ERR_NO_TLS error = fmt.Errorf("A 'tcp://' remote container engine requires a CA certificate, a client certificate and a client key.")
+
+// NewClient, initializes a client of the Docker API at the given endpoint.
+// 'tcp://' hosts use TLS if the endpoint has TLS certificates, 'ssh://' hosts
+// are reached through the SSH client of the host (see sshDialer). The
+// remaining options are configured through the usual Docker env. variables.
+func NewClient(endpoint Endpoint) (*client.Client, error) {
+	return newClient(endpoint, client.FromEnv)
+}
+
+// NewRemoteClient, initializes a client of the Docker API of a remote engine.
+// Unlike NewClient, the Docker env. variables are ignored, so that they cannot
+// change the settings of a configured engine, and 'tcp://' hosts are only
+// reached with TLS.
+func NewRemoteClient(endpoint Endpoint) (*client.Client, error) {
+	if strings.HasPrefix(endpoint.Host, "tcp://") && (endpoint.TLSCA == "" || endpoint.TLSCert == "" || endpoint.TLSKey == "") {
+		return nil, fmt.Errorf("error: remote container engine at %s: %w", endpoint.Host, ERR_NO_TLS)
+	}
+	return newClient(endpoint)
+}
+
+// newClient, initializes a client of the Docker API at the given endpoint,
+// with the options opts applied before the options of the endpoint.
+func newClient(endpoint Endpoint, opts ...client.Opt) (*client.Client, error) {
+	u, err := url.Parse(endpoint.Host)
+	if err != nil {
+		return nil, fmt.Errorf("error: invalid address of the container engine (%s): %w", endpoint.Host, err)
+	}
+	opts = append(opts, client.WithAPIVersionNegotiation())
+	if u.Scheme == "ssh" {
+		// The host of the HTTP requests is irrelevant, every connection is
+		// dialed through SSH.
+		opts = append(opts, client.WithHost("http://docker.example.com"), client.WithDialContext(sshDialer(u)))
+	} else {
+		opts = append(opts, client.WithHost(endpoint.Host))
+		if endpoint.TLSCA != "" || endpoint.TLSCert != "" || endpoint.TLSKey != "" {
+			opts = append(opts, client.WithTLSClientConfig(endpoint.TLSCA, endpoint.TLSCert, endpoint.TLSKey))
+		}
+	}
+	engineClient, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error while initializing a client of the container engine at %s: %w", endpoint.Host, err)
+	}
+	return engineClient, nil
+}
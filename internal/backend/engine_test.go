@@ -0,0 +1,70 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestDiscover, tests the order in which the API sockets of the container
+// engines are discovered.
+func TestDiscover(t *testing.T) {
+	const (
+		dockerSocket   = "/var/run/docker.sock"
+		rootlessSocket = "/run/user/1000/podman/podman.sock"
+		rootfulSocket  = "/run/podman/podman.sock"
+	)
+	tests := []struct {
+		name     string
+		engine   string
+		host     string
+		env      map[string]string
+		uid      int
+		sockets  []string
+		wantHost string
+		wantErr  error
+	}{
+		{name: "configured host", engine: EnginePodman, host: "tcp://10.0.0.1:2375", sockets: []string{dockerSocket}, wantHost: "tcp://10.0.0.1:2375"},
+		{name: "DOCKER_HOST", engine: EngineAuto, env: map[string]string{"DOCKER_HOST": "tcp://10.0.0.2:2376"}, wantHost: "tcp://10.0.0.2:2376"},
+		{name: "docker preferred", engine: EngineAuto, uid: 1000, sockets: []string{dockerSocket, rootlessSocket}, wantHost: "unix://" + dockerSocket},
+		{name: "rootless podman", engine: EngineAuto, uid: 1000, sockets: []string{rootlessSocket, rootfulSocket}, wantHost: "unix://" + rootlessSocket},
+		{name: "XDG_RUNTIME_DIR", engine: EnginePodman, uid: 1000, env: map[string]string{"XDG_RUNTIME_DIR": "/tmp/xdg"}, sockets: []string{"/tmp/xdg/podman/podman.sock"}, wantHost: "unix:///tmp/xdg/podman/podman.sock"},
+		{name: "rootful podman", engine: EnginePodman, uid: 0, sockets: []string{rootlessSocket, rootfulSocket}, wantHost: "unix://" + rootfulSocket},
+		{name: "podman ignores DOCKER_HOST", engine: EnginePodman, uid: 1000, env: map[string]string{"DOCKER_HOST": "tcp://10.0.0.2:2376"}, sockets: []string{rootfulSocket}, wantHost: "unix://" + rootfulSocket},
+		{name: "CONTAINER_HOST", engine: EnginePodman, env: map[string]string{"CONTAINER_HOST": "unix:///srv/podman.sock"}, wantHost: "unix:///srv/podman.sock"},
+		{name: "no docker socket", engine: EngineDocker, uid: 1000, sockets: []string{rootlessSocket}, wantErr: ERR_NO_ENGINE},
+		{name: "no socket", engine: EngineAuto, uid: 1000, wantErr: ERR_NO_ENGINE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(key string) string {
+				return tt.env[key]
+			}
+			exists := func(path string) bool {
+				for _, socket := range tt.sockets {
+					if socket == path {
+						return true
+					}
+				}
+				return false
+			}
+			endpoint, err := discover(tt.engine, tt.host, getenv, tt.uid, exists)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error: discover returned %v, expected %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error: discover failed: %v", err)
+			}
+			if endpoint.Host != tt.wantHost {
+				t.Errorf("error: discovered %s, expected %s", endpoint.Host, tt.wantHost)
+			}
+		})
+	}
+
+	if _, err := discover("containerd", "", func(string) string { return "" }, 0, func(string) bool { return true }); err == nil {
+		t.Errorf("error: discover should fail with an unknown engine")
+	}
+}
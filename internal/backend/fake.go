@@ -0,0 +1,539 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	dockerExec "github.com/erodrigufer/pongo/internal/docker/exec"
+)
+
+// ErrNotFound, error returned by Fake when a container, network or file does
+// not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict, error returned by Fake when a container with the same name
+// already exists.
+var ErrConflict = errors.New("name already in use")
+
+// FakeContainer, a container managed by Fake.
+type FakeContainer struct {
+	// ID, ID of the container.
+	ID string
+	// Name, name of the container.
+	Name string
+	// Config, configuration with which the container was created.
+	Config container.Config
+	// HostConfig, host configuration with which the container was created.
+	HostConfig container.HostConfig
+	// Networks, IDs of the networks to which the container is connected.
+	Networks []string
+	// Running, true if the container was started and not stopped.
+	Running bool
+	// Execs, every command executed inside the container.
+	Execs [][]string
+	// Stdins, standard input of every command in Execs (empty if the
+	// command had no input).
+	Stdins []string
+}
+
+// Fake, in-memory ContainerRuntime used for testing. It keeps track of the
+// containers and networks that were created, without running anything.
+// Errors can be injected for every operation with Fail. Fake is
+// concurrent-safe.
+type Fake struct {
+	mu sync.Mutex
+	// containers, every existing container indexed by its ID.
+	containers map[string]*FakeContainer
+	// networks, name of every existing network indexed by its ID.
+	networks map[string]string
+	// files, archives copied into containers indexed by container ID and
+	// path.
+	files map[string][]byte
+	// failures, error returned by every operation (indexed by the name of
+	// the method) until the failure is cleared.
+	failures map[string]error
+	// blocks, channel on which every call of an operation (indexed by the
+	// name of the method) waits before it runs.
+	blocks map[string]<-chan struct{}
+	// execFunc, computes the result of every exec.
+	execFunc func(containerID string, cmd []string) (dockerExec.Result, error)
+	// info, returned by Info.
+	info types.Info
+	// version, returned by Version.
+	version types.Version
+	// stats, resource usage of every container indexed by its ID.
+	stats map[string]Stats
+	// nextID, used to generate unique IDs.
+	nextID int
+}
+
+// NewFake, constructor for an empty Fake. Every exec succeeds with exit code
+// 0, unless a different behaviour is set with SetExecFunc.
+func NewFake() *Fake {
+	f := new(Fake)
+	f.containers = make(map[string]*FakeContainer)
+	f.networks = make(map[string]string)
+	f.files = make(map[string][]byte)
+	f.failures = make(map[string]error)
+	f.blocks = make(map[string]<-chan struct{})
+	f.stats = make(map[string]Stats)
+	f.info.DefaultRuntime = "runc"
+	f.info.Runtimes = map[string]types.Runtime{"runc": {Path: "runc"}}
+	f.version = types.Version{
+		Version:    "fake",
+		APIVersion: "1.41",
+		Components: []types.ComponentVersion{{Name: "Engine", Version: "fake"}},
+	}
+	return f
+}
+
+// Fail, makes every following call of the method op (e.g. "StopContainer")
+// return err. If err is nil, the method succeeds again.
+func (f *Fake) Fail(op string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.failures, op)
+		return
+	}
+	f.failures[op] = err
+}
+
+// Block, makes every following call of the method op wait until release is
+// closed or the context of the call is done, e.g. to simulate a slow engine.
+// Only CopyFromContainer and CopyToContainer can be blocked.
+func (f *Fake) Block(op string, release <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blocks[op] = release
+}
+
+// wait, waits until the method op is not blocked anymore (see Block). It does
+// not hold the lock while waiting, so that other methods are not blocked.
+func (f *Fake) wait(ctx context.Context, op string) {
+	f.mu.Lock()
+	release, ok := f.blocks[op]
+	f.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case <-release:
+	case <-ctx.Done():
+	}
+}
+
+// SetExecFunc, sets the function that computes the result of every exec.
+func (f *Fake) SetExecFunc(fn func(containerID string, cmd []string) (dockerExec.Result, error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.execFunc = fn
+}
+
+// SetInfo, sets the information returned by Info.
+func (f *Fake) SetInfo(info types.Info) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.info = info
+}
+
+// SetVersion, sets the version returned by Version.
+func (f *Fake) SetVersion(version types.Version) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version = version
+}
+
+// SetStats, sets the resource usage returned by Stats for a container.
+func (f *Fake) SetStats(containerID string, stats Stats) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stats[containerID] = stats
+}
+
+// Containers, returns a copy of every existing container sorted by ID.
+func (f *Fake) Containers() []FakeContainer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	containers := make([]FakeContainer, 0, len(f.containers))
+	for _, c := range f.containers {
+		containers = append(containers, c.copy())
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].ID < containers[j].ID
+	})
+	return containers
+}
+
+// Container, returns a copy of the container with the given ID.
+func (f *Fake) Container(containerID string) (FakeContainer, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.containers[containerID]
+	if !ok {
+		return FakeContainer{}, false
+	}
+	return c.copy(), true
+}
+
+// Running, returns the amount of running containers.
+func (f *Fake) Running() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	running := 0
+	for _, c := range f.containers {
+		if c.Running {
+			running++
+		}
+	}
+	return running
+}
+
+// Networks, returns the IDs of every existing network.
+func (f *Fake) Networks() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := make([]string, 0, len(f.networks))
+	for id := range f.networks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// copy, returns a deep copy of the container.
+func (c *FakeContainer) copy() FakeContainer {
+	cp := *c
+	cp.Networks = append([]string(nil), c.Networks...)
+	cp.Execs = append([][]string(nil), c.Execs...)
+	cp.Stdins = append([]string(nil), c.Stdins...)
+	return cp
+}
+
+// ports, returns the ports published by a running container. Host ports
+// which were not set in the port bindings are published on port 32768.
+func (c *FakeContainer) ports() []types.Port {
+	if !c.Running {
+		return nil
+	}
+	var ports []types.Port
+	for port, bindings := range c.HostConfig.PortBindings {
+		for _, binding := range bindings {
+			publicPort, err := strconv.Atoi(binding.HostPort)
+			if err != nil {
+				publicPort = 32768
+			}
+			ports = append(ports, types.Port{
+				IP:          binding.HostIP,
+				PrivatePort: uint16(port.Int()),
+				PublicPort:  uint16(publicPort),
+				Type:        port.Proto(),
+			})
+		}
+	}
+	return ports
+}
+
+// newID, returns a new unique ID. It must be called with f.mu held.
+func (f *Fake) newID(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%s%012d", prefix, f.nextID)
+}
+
+// check, returns the injected failure of an operation (if any) or the error
+// of a cancelled context. It must be called with f.mu held.
+func (f *Fake) check(ctx context.Context, op string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.failures[op]
+}
+
+// CreateContainer, implements ContainerRuntime.
+func (f *Fake) CreateContainer(ctx context.Context, name string, config *container.Config, hostConfig *container.HostConfig, networkConfig *network.NetworkingConfig) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "CreateContainer"); err != nil {
+		return "", err
+	}
+	for _, c := range f.containers {
+		if name != "" && c.Name == name {
+			return "", fmt.Errorf("error: container %s: %w", name, ErrConflict)
+		}
+	}
+
+	c := &FakeContainer{ID: f.newID("c"), Name: name}
+	if config != nil {
+		c.Config = *config
+	}
+	if hostConfig != nil {
+		c.HostConfig = *hostConfig
+	}
+	if networkConfig != nil {
+		for networkID := range networkConfig.EndpointsConfig {
+			if _, ok := f.networks[networkID]; !ok {
+				return "", fmt.Errorf("error: network %s: %w", networkID, ErrNotFound)
+			}
+			c.Networks = append(c.Networks, networkID)
+		}
+	}
+	f.containers[c.ID] = c
+	return c.ID, nil
+}
+
+// StartContainer, implements ContainerRuntime.
+func (f *Fake) StartContainer(ctx context.Context, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "StartContainer"); err != nil {
+		return err
+	}
+	c, ok := f.containers[containerID]
+	if !ok {
+		return fmt.Errorf("error: container %s: %w", containerID, ErrNotFound)
+	}
+	c.Running = true
+	return nil
+}
+
+// StopContainer, implements ContainerRuntime.
+func (f *Fake) StopContainer(ctx context.Context, containerID string, timeout *time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "StopContainer"); err != nil {
+		return err
+	}
+	c, ok := f.containers[containerID]
+	if !ok {
+		return fmt.Errorf("error: container %s: %w", containerID, ErrNotFound)
+	}
+	// AutoRemove only applies to containers which were started.
+	if c.Running && c.HostConfig.AutoRemove {
+		delete(f.containers, containerID)
+	}
+	c.Running = false
+	return nil
+}
+
+// RemoveContainer, implements ContainerRuntime.
+func (f *Fake) RemoveContainer(ctx context.Context, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "RemoveContainer"); err != nil {
+		return err
+	}
+	if _, ok := f.containers[containerID]; !ok {
+		return fmt.Errorf("error: container %s: %w", containerID, ErrNotFound)
+	}
+	delete(f.containers, containerID)
+	return nil
+}
+
+// ListContainers, implements ContainerRuntime.
+func (f *Fake) ListContainers(ctx context.Context, all bool) ([]types.Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "ListContainers"); err != nil {
+		return nil, err
+	}
+	var containers []types.Container
+	for _, c := range f.containers {
+		if !c.Running && !all {
+			continue
+		}
+		state := "created"
+		if c.Running {
+			state = "running"
+		}
+		containers = append(containers, types.Container{
+			ID:     c.ID,
+			Names:  []string{"/" + c.Name},
+			Image:  c.Config.Image,
+			Labels: c.Config.Labels,
+			State:  state,
+			Ports:  c.ports(),
+		})
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].ID < containers[j].ID
+	})
+	return containers, nil
+}
+
+// Exec, implements ContainerRuntime.
+func (f *Fake) Exec(ctx context.Context, containerID string, cmd []string) (dockerExec.Result, error) {
+	return f.exec(ctx, containerID, cmd, "")
+}
+
+// ExecWithStdin, implements ContainerRuntime. The input is recorded in
+// FakeContainer.Stdins.
+func (f *Fake) ExecWithStdin(ctx context.Context, containerID string, cmd []string, stdin io.Reader) (dockerExec.Result, error) {
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		return dockerExec.Result{}, err
+	}
+	return f.exec(ctx, containerID, cmd, string(input))
+}
+
+// exec, runs cmd with the input stdin in a container.
+func (f *Fake) exec(ctx context.Context, containerID string, cmd []string, stdin string) (dockerExec.Result, error) {
+	f.mu.Lock()
+	if err := f.check(ctx, "Exec"); err != nil {
+		f.mu.Unlock()
+		return dockerExec.Result{}, err
+	}
+	c, ok := f.containers[containerID]
+	if !ok || !c.Running {
+		f.mu.Unlock()
+		return dockerExec.Result{}, fmt.Errorf("error: running container %s: %w", containerID, ErrNotFound)
+	}
+	c.Execs = append(c.Execs, append([]string(nil), cmd...))
+	c.Stdins = append(c.Stdins, stdin)
+	execFunc := f.execFunc
+	f.mu.Unlock()
+
+	// execFunc is called without holding the lock, so that it can use the
+	// methods of Fake.
+	if execFunc == nil {
+		return dockerExec.Result{}, nil
+	}
+	return execFunc(containerID, cmd)
+}
+
+// CreateNetwork, implements ContainerRuntime.
+func (f *Fake) CreateNetwork(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "CreateNetwork"); err != nil {
+		return types.NetworkCreateResponse{}, err
+	}
+	id := f.newID("n")
+	f.networks[id] = name
+	return types.NetworkCreateResponse{ID: id}, nil
+}
+
+// ConnectNetwork, implements ContainerRuntime.
+func (f *Fake) ConnectNetwork(ctx context.Context, networkID, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "ConnectNetwork"); err != nil {
+		return err
+	}
+	c, ok := f.containers[containerID]
+	if !ok {
+		return fmt.Errorf("error: container %s: %w", containerID, ErrNotFound)
+	}
+	if _, ok := f.networks[networkID]; !ok {
+		return fmt.Errorf("error: network %s: %w", networkID, ErrNotFound)
+	}
+	c.Networks = append(c.Networks, networkID)
+	return nil
+}
+
+// RemoveNetwork, implements ContainerRuntime.
+func (f *Fake) RemoveNetwork(ctx context.Context, networkID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "RemoveNetwork"); err != nil {
+		return err
+	}
+	if _, ok := f.networks[networkID]; !ok {
+		return fmt.Errorf("error: network %s: %w", networkID, ErrNotFound)
+	}
+	for _, c := range f.containers {
+		for _, id := range c.Networks {
+			if id == networkID {
+				return fmt.Errorf("error: network %s has active endpoints", networkID)
+			}
+		}
+	}
+	delete(f.networks, networkID)
+	return nil
+}
+
+// CopyFromContainer, implements ContainerRuntime. It returns the last archive
+// copied into the container at srcPath.
+func (f *Fake) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, error) {
+	f.wait(ctx, "CopyFromContainer")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "CopyFromContainer"); err != nil {
+		return nil, err
+	}
+	if _, ok := f.containers[containerID]; !ok {
+		return nil, fmt.Errorf("error: container %s: %w", containerID, ErrNotFound)
+	}
+	content, ok := f.files[containerID+":"+srcPath]
+	if !ok {
+		return nil, fmt.Errorf("error: path %s in container %s: %w", srcPath, containerID, ErrNotFound)
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// CopyToContainer, implements ContainerRuntime. The archive is stored as-is
+// at dstPath.
+func (f *Fake) CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader) error {
+	f.wait(ctx, "CopyToContainer")
+	// Read the archive before taking the lock, the reader could be slow.
+	archive, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "CopyToContainer"); err != nil {
+		return err
+	}
+	if _, ok := f.containers[containerID]; !ok {
+		return fmt.Errorf("error: container %s: %w", containerID, ErrNotFound)
+	}
+	f.files[containerID+":"+dstPath] = archive
+	return nil
+}
+
+// Info, implements ContainerRuntime.
+func (f *Fake) Info(ctx context.Context) (types.Info, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "Info"); err != nil {
+		return types.Info{}, err
+	}
+	return f.info, nil
+}
+
+// Version, implements ContainerRuntime.
+func (f *Fake) Version(ctx context.Context) (types.Version, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "Version"); err != nil {
+		return types.Version{}, err
+	}
+	return f.version, nil
+}
+
+// Stats, implements ContainerRuntime. It returns the usage set with SetStats,
+// sampled now.
+func (f *Fake) Stats(ctx context.Context, containerID string) (Stats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(ctx, "Stats"); err != nil {
+		return Stats{}, err
+	}
+	c, ok := f.containers[containerID]
+	if !ok || !c.Running {
+		return Stats{}, fmt.Errorf("error: running container %s: %w", containerID, ErrNotFound)
+	}
+	stats := f.stats[containerID]
+	stats.Read = time.Now()
+	return stats, nil
+}
@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+// TestFake, tests the lifecycle of a container and a network in Fake.
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake()
+
+	resp, err := f.CreateNetwork(ctx, "test", types.NetworkCreate{})
+	if err != nil {
+		t.Fatalf("error: could not create network: %v", err)
+	}
+	networkConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{resp.ID: {}},
+	}
+	id, err := f.CreateContainer(ctx, "upstream", &container.Config{Image: "entrypoint"}, &container.HostConfig{AutoRemove: true}, networkConfig)
+	if err != nil {
+		t.Fatalf("error: could not create container: %v", err)
+	}
+	if _, err := f.CreateContainer(ctx, "upstream", nil, nil, nil); !errors.Is(err, ErrConflict) {
+		t.Errorf("error: creating a container with a duplicate name returned %v, expected ErrConflict", err)
+	}
+
+	if _, err := f.Exec(ctx, id, []string{"true"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("error: exec in a stopped container returned %v, expected ErrNotFound", err)
+	}
+	if err := f.StartContainer(ctx, id); err != nil {
+		t.Fatalf("error: could not start container: %v", err)
+	}
+	if _, err := f.Exec(ctx, id, []string{"true"}); err != nil {
+		t.Errorf("error: exec in a running container failed: %v", err)
+	}
+	if containers, _ := f.ListContainers(ctx, false); len(containers) != 1 || containers[0].Names[0] != "/upstream" {
+		t.Errorf("error: running containers are %v, expected only /upstream", containers)
+	}
+
+	if err := f.RemoveNetwork(ctx, resp.ID); err == nil {
+		t.Errorf("error: network with a connected container was removed")
+	}
+	injected := errors.New("injected")
+	f.Fail("StopContainer", injected)
+	if err := f.StopContainer(ctx, id, nil); !errors.Is(err, injected) {
+		t.Errorf("error: StopContainer returned %v, expected the injected error", err)
+	}
+	f.Fail("StopContainer", nil)
+	if err := f.StopContainer(ctx, id, nil); err != nil {
+		t.Fatalf("error: could not stop container: %v", err)
+	}
+	if _, ok := f.Container(id); ok {
+		t.Errorf("error: container created with AutoRemove still exists after being stopped")
+	}
+	if err := f.RemoveNetwork(ctx, resp.ID); err != nil {
+		t.Errorf("error: could not remove network: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package backend
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	dockerExec "github.com/erodrigufer/pongo/internal/docker/exec"
+)
+
+// Operations of a ContainerRuntime, as reported to an Observer.
+const (
+	OpCreateContainer   = "container_create"
+	OpStartContainer    = "container_start"
+	OpStopContainer     = "container_stop"
+	OpRemoveContainer   = "container_remove"
+	OpListContainers    = "container_list"
+	OpExec              = "exec"
+	OpCreateNetwork     = "network_create"
+	OpConnectNetwork    = "network_connect"
+	OpRemoveNetwork     = "network_remove"
+	OpCopyFromContainer = "copy_from_container"
+	OpCopyToContainer   = "copy_to_container"
+	OpInfo              = "info"
+	OpVersion           = "version"
+	OpStats             = "stats"
+)
+
+// Observer, is called after every call to a ContainerRuntime with the
+// operation (e.g. OpExec), the time the call took and the error it returned.
+type Observer func(operation string, duration time.Duration, err error)
+
+// Instrumented, ContainerRuntime which reports the latency of every call to
+// another ContainerRuntime to an Observer.
+type Instrumented struct {
+	// rt, runtime which performs the calls.
+	rt ContainerRuntime
+	// observe, receives the latency of every call.
+	observe Observer
+}
+
+// NewInstrumented, constructor for a runtime that reports the latency of every
+// call to rt to observe.
+func NewInstrumented(rt ContainerRuntime, observe Observer) *Instrumented {
+	i := new(Instrumented)
+	i.rt = rt
+	i.observe = observe
+	return i
+}
+
+// done, reports a call that started at start.
+func (i *Instrumented) done(operation string, start time.Time, err error) {
+	i.observe(operation, time.Since(start), err)
+}
+
+// CreateContainer, implements ContainerRuntime.
+func (i *Instrumented) CreateContainer(ctx context.Context, name string, config *container.Config, hostConfig *container.HostConfig, networkConfig *network.NetworkingConfig) (string, error) {
+	start := time.Now()
+	id, err := i.rt.CreateContainer(ctx, name, config, hostConfig, networkConfig)
+	i.done(OpCreateContainer, start, err)
+	return id, err
+}
+
+// StartContainer, implements ContainerRuntime.
+func (i *Instrumented) StartContainer(ctx context.Context, containerID string) error {
+	start := time.Now()
+	err := i.rt.StartContainer(ctx, containerID)
+	i.done(OpStartContainer, start, err)
+	return err
+}
+
+// StopContainer, implements ContainerRuntime.
+func (i *Instrumented) StopContainer(ctx context.Context, containerID string, timeout *time.Duration) error {
+	start := time.Now()
+	err := i.rt.StopContainer(ctx, containerID, timeout)
+	i.done(OpStopContainer, start, err)
+	return err
+}
+
+// RemoveContainer, implements ContainerRuntime.
+func (i *Instrumented) RemoveContainer(ctx context.Context, containerID string) error {
+	start := time.Now()
+	err := i.rt.RemoveContainer(ctx, containerID)
+	i.done(OpRemoveContainer, start, err)
+	return err
+}
+
+// ListContainers, implements ContainerRuntime.
+func (i *Instrumented) ListContainers(ctx context.Context, all bool) ([]types.Container, error) {
+	start := time.Now()
+	containers, err := i.rt.ListContainers(ctx, all)
+	i.done(OpListContainers, start, err)
+	return containers, err
+}
+
+// Exec, implements ContainerRuntime.
+func (i *Instrumented) Exec(ctx context.Context, containerID string, cmd []string) (dockerExec.Result, error) {
+	start := time.Now()
+	result, err := i.rt.Exec(ctx, containerID, cmd)
+	i.done(OpExec, start, err)
+	return result, err
+}
+
+// ExecWithStdin, implements ContainerRuntime.
+func (i *Instrumented) ExecWithStdin(ctx context.Context, containerID string, cmd []string, stdin io.Reader) (dockerExec.Result, error) {
+	start := time.Now()
+	result, err := i.rt.ExecWithStdin(ctx, containerID, cmd, stdin)
+	i.done(OpExec, start, err)
+	return result, err
+}
+
+// CreateNetwork, implements ContainerRuntime.
+func (i *Instrumented) CreateNetwork(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error) {
+	start := time.Now()
+	resp, err := i.rt.CreateNetwork(ctx, name, options)
+	i.done(OpCreateNetwork, start, err)
+	return resp, err
+}
+
+// ConnectNetwork, implements ContainerRuntime.
+func (i *Instrumented) ConnectNetwork(ctx context.Context, networkID, containerID string) error {
+	start := time.Now()
+	err := i.rt.ConnectNetwork(ctx, networkID, containerID)
+	i.done(OpConnectNetwork, start, err)
+	return err
+}
+
+// RemoveNetwork, implements ContainerRuntime.
+func (i *Instrumented) RemoveNetwork(ctx context.Context, networkID string) error {
+	start := time.Now()
+	err := i.rt.RemoveNetwork(ctx, networkID)
+	i.done(OpRemoveNetwork, start, err)
+	return err
+}
+
+// CopyFromContainer, implements ContainerRuntime. Only the time until the
+// archive can be read is reported, not the time to read it.
+func (i *Instrumented) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, error) {
+	start := time.Now()
+	content, err := i.rt.CopyFromContainer(ctx, containerID, srcPath)
+	i.done(OpCopyFromContainer, start, err)
+	return content, err
+}
+
+// CopyToContainer, implements ContainerRuntime.
+func (i *Instrumented) CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader) error {
+	start := time.Now()
+	err := i.rt.CopyToContainer(ctx, containerID, dstPath, content)
+	i.done(OpCopyToContainer, start, err)
+	return err
+}
+
+// Info, implements ContainerRuntime.
+func (i *Instrumented) Info(ctx context.Context) (types.Info, error) {
+	start := time.Now()
+	info, err := i.rt.Info(ctx)
+	i.done(OpInfo, start, err)
+	return info, err
+}
+
+// Version, implements ContainerRuntime.
+func (i *Instrumented) Version(ctx context.Context) (types.Version, error) {
+	start := time.Now()
+	version, err := i.rt.Version(ctx)
+	i.done(OpVersion, start, err)
+	return version, err
+}
+
+// Stats, implements ContainerRuntime.
+func (i *Instrumented) Stats(ctx context.Context, containerID string) (Stats, error) {
+	start := time.Now()
+	stats, err := i.rt.Stats(ctx, containerID)
+	i.done(OpStats, start, err)
+	return stats, err
+}
@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// TestInstrumented, tests that every call to the wrapped runtime is reported
+// with its operation and error.
+func TestInstrumented(t *testing.T) {
+	type call struct {
+		operation string
+		err       error
+	}
+	var calls []call
+	rt := NewInstrumented(NewFake(), func(operation string, duration time.Duration, err error) {
+		if duration < 0 {
+			t.Errorf("error: negative duration for %s", operation)
+		}
+		calls = append(calls, call{operation, err})
+	})
+
+	ctx := context.Background()
+	resp, err := rt.CreateNetwork(ctx, "test", types.NetworkCreate{})
+	if err != nil {
+		t.Fatalf("error: could not create network: %v", err)
+	}
+	id, err := rt.CreateContainer(ctx, "upstream", &container.Config{Image: "entrypoint"}, &container.HostConfig{}, nil)
+	if err != nil {
+		t.Fatalf("error: could not create container: %v", err)
+	}
+	rt.StartContainer(ctx, id)
+	rt.Exec(ctx, id, []string{"true"})
+	rt.Exec(ctx, "missing", []string{"true"})
+	rt.RemoveNetwork(ctx, resp.ID)
+
+	want := []string{OpCreateNetwork, OpCreateContainer, OpStartContainer, OpExec, OpExec, OpRemoveNetwork}
+	if len(calls) != len(want) {
+		t.Fatalf("error: %d calls reported, expected %d: %v", len(calls), len(want), calls)
+	}
+	for i, c := range calls {
+		if c.operation != want[i] {
+			t.Errorf("error: call %d reported as %s, expected %s", i, c.operation, want[i])
+		}
+	}
+	if !errors.Is(calls[4].err, ErrNotFound) || calls[3].err != nil {
+		t.Errorf("error: errors of the calls were not reported: %v", calls)
+	}
+}
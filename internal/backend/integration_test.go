@@ -0,0 +1,135 @@
+//go:build integration
+
+package backend
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+// The integration tests run against a real container engine, they are only
+// built with the 'integration' build tag:
+//
+//	PONGO_TEST_ENGINE=podman PONGO_TEST_IMAGE=entrypoint go test -tags integration ./internal/backend/
+//
+// PONGO_TEST_ENGINE selects the engine (docker, podman or auto, the default),
+// PONGO_TEST_ENGINE_HOST overrides the discovered API socket and
+// PONGO_TEST_IMAGE is an image available in the engine which keeps running
+// with a tty attached, e.g. the challenge image.
+
+// newIntegrationRuntime, returns a runtime connected to the engine selected
+// through the environment and the image used by the tests.
+func newIntegrationRuntime(t *testing.T) (*Docker, string) {
+	t.Helper()
+	engine := os.Getenv("PONGO_TEST_ENGINE")
+	if engine == "" {
+		engine = EngineAuto
+	}
+	image := os.Getenv("PONGO_TEST_IMAGE")
+	if image == "" {
+		t.Skip("PONGO_TEST_IMAGE is not set")
+	}
+	endpoint, err := Discover(engine, os.Getenv("PONGO_TEST_ENGINE_HOST"))
+	if err != nil {
+		t.Fatalf("error: could not discover the container engine: %v", err)
+	}
+	engineClient, err := NewClient(endpoint)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	t.Cleanup(func() { engineClient.Close() })
+	t.Logf("Testing the container engine at %s (%s).", endpoint.Host, endpoint.Engine)
+	return NewDocker(engineClient), image
+}
+
+// TestIntegrationProbe, tests that the engine supports every feature used by
+// pongo.
+func TestIntegrationProbe(t *testing.T) {
+	rt, image := newIntegrationRuntime(t)
+	capabilities, err := Probe(context.Background(), rt, image)
+	if err != nil {
+		t.Fatalf("error: could not probe the engine: %v", err)
+	}
+	if err := capabilities.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if engine := os.Getenv("PONGO_TEST_ENGINE"); engine != "" && engine != EngineAuto && engine != capabilities.Engine {
+		t.Errorf("error: engine identified as %s, expected %s", capabilities.Engine, engine)
+	}
+}
+
+// TestIntegrationLifecycle, tests the lifecycle of a session container:
+// creation in a network, exec, copying files in and out, and removal.
+func TestIntegrationLifecycle(t *testing.T) {
+	rt, image := newIntegrationRuntime(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	name := "pongo-integration-" + strings.ReplaceAll(t.Name(), "/", "-")
+	resp, err := rt.CreateNetwork(ctx, name, types.NetworkCreate{Driver: "bridge", CheckDuplicate: true})
+	if err != nil {
+		t.Fatalf("error: could not create network: %v", err)
+	}
+	defer rt.RemoveNetwork(context.Background(), resp.ID)
+
+	networkConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{resp.ID: {NetworkID: resp.ID}},
+	}
+	config := &container.Config{Image: image, Tty: true, AttachStdin: true, Hostname: name}
+	containerID, err := rt.CreateContainer(ctx, name, config, &container.HostConfig{AutoRemove: true}, networkConfig)
+	if err != nil {
+		t.Fatalf("error: could not create container: %v", err)
+	}
+	if err := rt.StartContainer(ctx, containerID); err != nil {
+		t.Fatalf("error: could not start container: %v", err)
+	}
+	timeout := 5 * time.Second
+	defer rt.StopContainer(context.Background(), containerID, &timeout)
+
+	result, err := rt.Exec(ctx, containerID, []string{"sh", "-c", "echo out; echo err >&2; exit 3"})
+	if err != nil {
+		t.Fatalf("error: could not exec: %v", err)
+	}
+	if result.ExitCode != 3 || strings.TrimSpace(result.Stdout) != "out" || strings.TrimSpace(result.Stderr) != "err" {
+		t.Errorf("error: unexpected exec result: %+v", result)
+	}
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	content := []byte("pongo")
+	tw.WriteHeader(&tar.Header{Name: "probe.txt", Mode: 0644, Size: int64(len(content))})
+	tw.Write(content)
+	tw.Close()
+	if err := rt.CopyToContainer(ctx, containerID, "/tmp", &archive); err != nil {
+		t.Fatalf("error: could not copy to container: %v", err)
+	}
+	rd, err := rt.CopyFromContainer(ctx, containerID, "/tmp/probe.txt")
+	if err != nil {
+		t.Fatalf("error: could not copy from container: %v", err)
+	}
+	defer rd.Close()
+	tr := tar.NewReader(rd)
+	if _, err := tr.Next(); err != nil {
+		t.Fatalf("error: could not read archive: %v", err)
+	}
+	if got, _ := io.ReadAll(tr); !bytes.Equal(got, content) {
+		t.Errorf("error: copied file contains %q, expected %q", got, content)
+	}
+
+	if err := rt.StopContainer(ctx, containerID, &timeout); err != nil {
+		t.Fatalf("error: could not stop container: %v", err)
+	}
+	if err := probeAutoRemove(ctx, rt, containerID); err != nil {
+		t.Errorf("error: %v", err)
+	}
+}
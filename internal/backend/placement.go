@@ -0,0 +1,112 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// PlacementSpread, place new sessions in the engine with the most free
+	// capacity, spreading the load across the pool.
+	PlacementSpread = "spread"
+	// PlacementBinpack, place new sessions in the engine with the least free
+	// capacity, filling an engine before using the next one.
+	PlacementBinpack = "binpack"
+)
+
+// Candidate, state of an engine considered to place a new session. Only
+// healthy engines with free capacity which match the constraints of the pool
+// are candidates.
+type Candidate struct {
+	// Name, name of the engine.
+	Name string
+	// Labels, labels of the engine.
+	Labels map[string]string
+	// Sessions, amount of sessions placed in the engine.
+	Sessions int
+	// Capacity, max. amount of sessions of the engine.
+	Capacity int
+}
+
+// Free, free capacity of the engine.
+func (c Candidate) Free() int {
+	return c.Capacity - c.Sessions
+}
+
+// Placement, strategy that chooses the engine in which a new session is
+// placed.
+type Placement interface {
+	// Select, returns the name of the chosen engine. candidates is never
+	// empty and it is sorted by name.
+	Select(candidates []Candidate) string
+}
+
+// NewPlacement, returns the placement strategy with the given name
+// (PlacementSpread or PlacementBinpack).
+func NewPlacement(strategy string) (Placement, error) {
+	switch strategy {
+	case PlacementSpread:
+		return Spread{}, nil
+	case PlacementBinpack:
+		return Binpack{}, nil
+	default:
+		return nil, fmt.Errorf("error: unknown placement strategy '%s' (valid strategies: %s, %s)", strategy, PlacementSpread, PlacementBinpack)
+	}
+}
+
+// Spread, places new sessions in the engine with the most free capacity. Ties
+// are broken by name.
+type Spread struct{}
+
+// Select, implements Placement.
+func (Spread) Select(candidates []Candidate) string {
+	chosen := candidates[0]
+	for _, c := range candidates[1:] {
+		if c.Free() > chosen.Free() {
+			chosen = c
+		}
+	}
+	return chosen.Name
+}
+
+// Binpack, places new sessions in the engine with the least free capacity.
+// Ties are broken by name.
+type Binpack struct{}
+
+// Select, implements Placement.
+func (Binpack) Select(candidates []Candidate) string {
+	chosen := candidates[0]
+	for _, c := range candidates[1:] {
+		if c.Free() < chosen.Free() {
+			chosen = c
+		}
+	}
+	return chosen.Name
+}
+
+// Constraints, labels (key -> value) which an engine must have, so that new
+// sessions can be placed in it.
+type Constraints map[string]string
+
+// ParseConstraints, parses constraints written as 'key=value'.
+func ParseConstraints(list []string) (Constraints, error) {
+	constraints := make(Constraints)
+	for _, constraint := range list {
+		key, value, ok := strings.Cut(constraint, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("error: placement constraint '%s' is not written as 'key=value'", constraint)
+		}
+		constraints[key] = value
+	}
+	return constraints, nil
+}
+
+// Match, reports whether labels satisfy every constraint.
+func (c Constraints) Match(labels map[string]string) bool {
+	for key, value := range c {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
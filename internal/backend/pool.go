@@ -0,0 +1,209 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ERR_NO_CAPACITY, no healthy engine with free capacity matches the placement
+// constraints.
+var ERR_NO_CAPACITY error = fmt.Errorf("No healthy container engine with free capacity is available.")
+
+// Node, container engine of a pool.
+type Node struct {
+	// Name, unique name of the engine in the pool.
+	Name string
+	// Endpoint, address of the API of the engine.
+	Endpoint Endpoint
+	// Runtime, manages the containers of the engine.
+	Runtime ContainerRuntime
+	// Local, true for the engine which runs the SSH reverse proxy. The
+	// reverse proxy reaches the sessions of the local engine through a
+	// network of the engine, and the sessions of other engines through the
+	// ports that they publish in their hosts.
+	Local bool
+	// Address, address of the host of the engine at which the reverse proxy
+	// reaches the ports published by the sessions.
+	Address string
+	// BindIP, IP of the host of the engine on which the sessions publish
+	// their ports.
+	BindIP string
+	// NetworkID, ID of the network of the engine to which the sessions are
+	// connected.
+	NetworkID string
+	// Labels, labels of the engine, matched against placement constraints.
+	Labels map[string]string
+	// Capacity, max. amount of sessions placed in the engine.
+	Capacity int
+}
+
+// NodeStatus, state of an engine of a pool.
+type NodeStatus struct {
+	Node
+	// Sessions, amount of sessions placed in the engine.
+	Sessions int
+	// Healthy, false if the last health check of the engine failed.
+	Healthy bool
+	// Err, error of the last failed health check.
+	Err error
+	// LastCheck, time of the last health check.
+	LastCheck time.Time
+}
+
+// Pool, set of container engines in which sessions are placed. The pool
+// keeps track of the sessions placed in every engine and of the health of
+// every engine, so that new sessions are only placed in healthy engines with
+// free capacity. Pool is concurrent-safe.
+type Pool struct {
+	mu sync.Mutex
+	// nodes, every engine of the pool indexed by its name.
+	nodes map[string]*NodeStatus
+	// placement, strategy used to choose the engine of new sessions.
+	placement Placement
+	// constraints, labels that an engine must have to receive new sessions.
+	constraints Constraints
+}
+
+// NewPool, constructor for an empty pool that places new sessions with the
+// given strategy in engines that satisfy the constraints.
+func NewPool(placement Placement, constraints Constraints) *Pool {
+	p := new(Pool)
+	p.nodes = make(map[string]*NodeStatus)
+	p.placement = placement
+	p.constraints = constraints
+	return p
+}
+
+// Add, adds a healthy engine to the pool. It returns an error if an engine
+// with the same name is already part of the pool.
+func (p *Pool) Add(node Node) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.nodes[node.Name]; ok {
+		return fmt.Errorf("error: container engine '%s' is already part of the pool", node.Name)
+	}
+	p.nodes[node.Name] = &NodeStatus{Node: node, Healthy: true, LastCheck: time.Now()}
+	return nil
+}
+
+// Node, returns the engine with the given name.
+func (p *Pool) Node(name string) (Node, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n, ok := p.nodes[name]
+	if !ok {
+		return Node{}, false
+	}
+	return n.Node, true
+}
+
+// SetNetwork, sets the network of an engine to which the sessions are
+// connected.
+func (p *Pool) SetNetwork(name, networkID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n, ok := p.nodes[name]; ok {
+		n.NetworkID = networkID
+	}
+}
+
+// Status, returns the state of every engine sorted by name.
+func (p *Pool) Status() []NodeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := make([]NodeStatus, 0, len(p.nodes))
+	for _, n := range p.nodes {
+		status = append(status, *n)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Name < status[j].Name
+	})
+	return status
+}
+
+// Place, chooses the engine of a new session and reserves capacity for it in
+// the engine. The capacity has to be given back with Release once the
+// session is stopped (or if its creation fails). It returns ERR_NO_CAPACITY
+// if no engine can receive the session.
+func (p *Pool) Place() (Node, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var candidates []Candidate
+	for _, n := range p.nodes {
+		if !n.Healthy || n.Sessions >= n.Capacity || !p.constraints.Match(n.Labels) {
+			continue
+		}
+		candidates = append(candidates, Candidate{Name: n.Name, Labels: n.Labels, Sessions: n.Sessions, Capacity: n.Capacity})
+	}
+	if len(candidates) == 0 {
+		return Node{}, ERR_NO_CAPACITY
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Name < candidates[j].Name
+	})
+	n := p.nodes[p.placement.Select(candidates)]
+	n.Sessions++
+	return n.Node, nil
+}
+
+// Release, gives back the capacity reserved for a session in an engine.
+func (p *Pool) Release(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n, ok := p.nodes[name]; ok && n.Sessions > 0 {
+		n.Sessions--
+	}
+}
+
+// healthCheckTimeout, max. time that the health check of an engine can take.
+const healthCheckTimeout = 10 * time.Second
+
+// CheckHealth, checks the health of every engine by requesting its version.
+// It returns the engines whose health changed.
+func (p *Pool) CheckHealth(ctx context.Context) []NodeStatus {
+	p.mu.Lock()
+	nodes := make([]Node, 0, len(p.nodes))
+	for _, n := range p.nodes {
+		nodes = append(nodes, n.Node)
+	}
+	p.mu.Unlock()
+
+	// The engines are checked concurrently and without holding the lock, a
+	// slow engine must not block the placement of new sessions.
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node Node) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			_, errs[i] = node.Runtime.Version(ctx)
+		}(i, node)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var changed []NodeStatus
+	for i, node := range nodes {
+		n, ok := p.nodes[node.Name]
+		if !ok {
+			continue
+		}
+		healthy := errs[i] == nil
+		if healthy != n.Healthy {
+			changed = append(changed, NodeStatus{Node: n.Node, Sessions: n.Sessions, Healthy: healthy, Err: errs[i]})
+		}
+		n.Healthy = healthy
+		n.Err = errs[i]
+		n.LastCheck = time.Now()
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		return changed[i].Name < changed[j].Name
+	})
+	return changed
+}
@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestPlacement, tests the placement strategies and constraints of a pool.
+func TestPlacement(t *testing.T) {
+	newPool := func(placement Placement, constraints Constraints) *Pool {
+		p := NewPool(placement, constraints)
+		p.Add(Node{Name: "a", Runtime: NewFake(), Capacity: 2, Labels: map[string]string{"zone": "1"}})
+		p.Add(Node{Name: "b", Runtime: NewFake(), Capacity: 3, Labels: map[string]string{"zone": "2"}})
+		return p
+	}
+	place := func(t *testing.T, p *Pool, n int) []string {
+		t.Helper()
+		var names []string
+		for i := 0; i < n; i++ {
+			node, err := p.Place()
+			if err != nil {
+				t.Fatalf("error: could not place session %d: %v", i, err)
+			}
+			names = append(names, node.Name)
+		}
+		return names
+	}
+	equal := func(a, b []string) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	spread := newPool(Spread{}, nil)
+	if got, want := place(t, spread, 5), []string{"b", "a", "b", "a", "b"}; !equal(got, want) {
+		t.Errorf("error: spread placed sessions in %v, expected %v", got, want)
+	}
+	if _, err := spread.Place(); !errors.Is(err, ERR_NO_CAPACITY) {
+		t.Errorf("error: placing a session in a full pool returned %v, expected ERR_NO_CAPACITY", err)
+	}
+	spread.Release("a")
+	if got := place(t, spread, 1); got[0] != "a" {
+		t.Errorf("error: session placed in %s after releasing capacity of a", got[0])
+	}
+
+	binpack := newPool(Binpack{}, nil)
+	if got, want := place(t, binpack, 5), []string{"a", "a", "b", "b", "b"}; !equal(got, want) {
+		t.Errorf("error: binpack placed sessions in %v, expected %v", got, want)
+	}
+
+	constrained := newPool(Spread{}, Constraints{"zone": "1"})
+	if got, want := place(t, constrained, 2), []string{"a", "a"}; !equal(got, want) {
+		t.Errorf("error: constrained pool placed sessions in %v, expected %v", got, want)
+	}
+	if _, err := constrained.Place(); !errors.Is(err, ERR_NO_CAPACITY) {
+		t.Errorf("error: engines that do not match the constraints should not receive sessions, got %v", err)
+	}
+
+	if _, err := NewPlacement("random"); err == nil {
+		t.Errorf("error: NewPlacement should fail with an unknown strategy")
+	}
+	if _, err := ParseConstraints([]string{"zone"}); err == nil {
+		t.Errorf("error: ParseConstraints should fail without '='")
+	}
+}
+
+// TestCheckHealth, tests that unhealthy engines do not receive new sessions
+// until they are healthy again.
+func TestCheckHealth(t *testing.T) {
+	ctx := context.Background()
+	unstable := NewFake()
+	p := NewPool(Spread{}, nil)
+	p.Add(Node{Name: "stable", Runtime: NewFake(), Capacity: 1})
+	p.Add(Node{Name: "unstable", Runtime: unstable, Capacity: 10})
+
+	unstable.Fail("Version", errors.New("connection refused"))
+	changed := p.CheckHealth(ctx)
+	if len(changed) != 1 || changed[0].Name != "unstable" || changed[0].Healthy {
+		t.Fatalf("error: unexpected health changes: %+v", changed)
+	}
+	if node, err := p.Place(); err != nil || node.Name != "stable" {
+		t.Errorf("error: session placed in %s (%v), expected stable", node.Name, err)
+	}
+	if _, err := p.Place(); !errors.Is(err, ERR_NO_CAPACITY) {
+		t.Errorf("error: unhealthy engine received a session")
+	}
+
+	unstable.Fail("Version", nil)
+	if changed := p.CheckHealth(ctx); len(changed) != 1 || !changed[0].Healthy {
+		t.Fatalf("error: unexpected health changes: %+v", changed)
+	}
+	if node, err := p.Place(); err != nil || node.Name != "unstable" {
+		t.Errorf("error: session placed in %s (%v), expected unstable", node.Name, err)
+	}
+}
@@ -0,0 +1,216 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+)
+
+// Feature, feature of a container engine on which pongo relies.
+type Feature string
+
+const (
+	// FeatureNetworks, user-defined bridge networks to which containers are
+	// connected at creation.
+	FeatureNetworks Feature = "networks"
+	// FeatureAutoRemove, containers are removed once they stop (--rm).
+	FeatureAutoRemove Feature = "auto-remove"
+	// FeatureExec, commands are executed inside running containers.
+	FeatureExec Feature = "exec"
+	// FeaturePortBindings, ports of containers are published on the host.
+	FeaturePortBindings Feature = "port-bindings"
+)
+
+// Features, every feature of a container engine on which pongo relies, in the
+// order in which they are probed.
+var Features = []Feature{FeatureNetworks, FeaturePortBindings, FeatureExec, FeatureAutoRemove}
+
+// Capabilities, result of probing a container engine.
+type Capabilities struct {
+	// Engine, the probed engine (EngineDocker or EnginePodman).
+	Engine string
+	// Version, version of the engine.
+	Version string
+	// APIVersion, version of the API of the engine.
+	APIVersion string
+	// Missing, features which do not work in the engine and the error
+	// observed while probing them.
+	Missing map[Feature]error
+}
+
+// Supports, reports whether the engine supports a feature.
+func (c Capabilities) Supports(feature Feature) bool {
+	_, missing := c.Missing[feature]
+	return !missing
+}
+
+// Err, returns an error describing every missing feature, or nil if the
+// engine supports every feature.
+func (c Capabilities) Err() error {
+	if len(c.Missing) == 0 {
+		return nil
+	}
+	var missing []string
+	for _, feature := range Features {
+		if err, ok := c.Missing[feature]; ok {
+			missing = append(missing, fmt.Sprintf("%s (%v)", feature, err))
+		}
+	}
+	return fmt.Errorf("error: the container engine (%s %s, API %s) does not support features required by pongo: %s", c.Engine, c.Version, c.APIVersion, strings.Join(missing, "; "))
+}
+
+// EngineName, identifies the engine from its version. Podman reports a
+// component named 'Podman Engine'.
+func EngineName(version types.Version) string {
+	for _, component := range version.Components {
+		if strings.Contains(strings.ToLower(component.Name), EnginePodman) {
+			return EnginePodman
+		}
+	}
+	return EngineDocker
+}
+
+// probeTimeout, max. time that probing a container engine may take.
+const probeTimeout = 60 * time.Second
+
+// Probe, checks that a container engine supports every feature pongo relies
+// on, by creating a network and a container from image, publishing a port
+// of the container, executing a command inside it and stopping it. The image
+// must keep running with a tty attached (like the challenge images). Missing
+// features are reported in the capabilities, an error is only returned if the
+// engine cannot be probed at all, e.g. if the container cannot be started.
+func Probe(ctx context.Context, rt ContainerRuntime, image string) (Capabilities, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var capabilities Capabilities
+	capabilities.Missing = make(map[Feature]error)
+	version, err := rt.Version(ctx)
+	if err != nil {
+		return capabilities, fmt.Errorf("error retrieving the version of the container engine: %w", err)
+	}
+	capabilities.Engine = EngineName(version)
+	capabilities.Version = version.Version
+	capabilities.APIVersion = version.APIVersion
+
+	name := fmt.Sprintf("pongo-probe-%d", time.Now().UnixNano())
+
+	networkConfig := new(network.NetworkingConfig)
+	resp, err := rt.CreateNetwork(ctx, name, types.NetworkCreate{Driver: "bridge", CheckDuplicate: true})
+	if err != nil {
+		capabilities.Missing[FeatureNetworks] = err
+	} else {
+		networkConfig.EndpointsConfig = map[string]*network.EndpointSettings{resp.ID: {NetworkID: resp.ID}}
+		defer func() {
+			// Use a new context, ctx could already be expired.
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := rt.RemoveNetwork(ctx, resp.ID); err != nil {
+				capabilities.Missing[FeatureNetworks] = fmt.Errorf("error removing network: %w", err)
+			}
+		}()
+	}
+
+	config := &container.Config{
+		Image:        image,
+		Tty:          true,
+		AttachStdin:  true,
+		ExposedPorts: nat.PortSet{"22/tcp": {}},
+	}
+	hostConfig := &container.HostConfig{
+		AutoRemove: true,
+		// Publish the port on a random port of the loopback interface.
+		PortBindings: nat.PortMap{"22/tcp": {{HostIP: "127.0.0.1"}}},
+	}
+	containerID, err := rt.CreateContainer(ctx, name, config, hostConfig, networkConfig)
+	if err != nil {
+		return capabilities, fmt.Errorf("error creating probe container from image %s: %w", image, err)
+	}
+	if err := rt.StartContainer(ctx, containerID); err != nil {
+		// AutoRemove only applies to started containers. The container has
+		// to be removed before the deferred removal of the network.
+		removeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if rmErr := rt.RemoveContainer(removeCtx, containerID); rmErr != nil {
+			return capabilities, fmt.Errorf("error starting probe container %s: %w (error removing it: %v)", name, err, rmErr)
+		}
+		return capabilities, fmt.Errorf("error starting probe container %s: %w", name, err)
+	}
+
+	if _, err := PublishedPort(ctx, rt, containerID, 22); err != nil {
+		capabilities.Missing[FeaturePortBindings] = err
+	}
+
+	if result, err := rt.Exec(ctx, containerID, []string{"true"}); err != nil {
+		capabilities.Missing[FeatureExec] = err
+	} else if result.ExitCode != 0 {
+		capabilities.Missing[FeatureExec] = fmt.Errorf("command 'true' exited with code %d", result.ExitCode)
+	}
+
+	timeout := 5 * time.Second
+	if err := rt.StopContainer(ctx, containerID, &timeout); err != nil {
+		return capabilities, fmt.Errorf("error stopping probe container %s: %w", name, err)
+	}
+	if err := probeAutoRemove(ctx, rt, containerID); err != nil {
+		capabilities.Missing[FeatureAutoRemove] = err
+	}
+
+	return capabilities, nil
+}
+
+// PublishedPort, returns the port of the host on which a running container
+// publishes its port privatePort (TCP).
+func PublishedPort(ctx context.Context, rt ContainerRuntime, containerID string, privatePort uint16) (uint16, error) {
+	containers, err := rt.ListContainers(ctx, false)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range containers {
+		if c.ID != containerID {
+			continue
+		}
+		for _, port := range c.Ports {
+			if port.PrivatePort == privatePort && port.Type == "tcp" && port.PublicPort != 0 {
+				return port.PublicPort, nil
+			}
+		}
+		return 0, fmt.Errorf("port %d/tcp of container %s is not published", privatePort, containerID)
+	}
+	return 0, fmt.Errorf("container %s is not running", containerID)
+}
+
+// probeAutoRemove, checks that a stopped container created with AutoRemove is
+// removed. The engine may remove the container asynchronously, so it is
+// polled for up to 10 seconds.
+func probeAutoRemove(ctx context.Context, rt ContainerRuntime, containerID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		containers, err := rt.ListContainers(ctx, true)
+		if err != nil {
+			return err
+		}
+		removed := true
+		for _, c := range containers {
+			if c.ID == containerID {
+				removed = false
+			}
+		}
+		if removed {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("probe container was not removed after it stopped")
+		case <-ticker.C:
+		}
+	}
+}
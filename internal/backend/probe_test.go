@@ -0,0 +1,61 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+// TestProbe, tests that Probe identifies the engine, reports missing
+// features and cleans up after itself.
+func TestProbe(t *testing.T) {
+	f := NewFake()
+	capabilities, err := Probe(context.Background(), f, "entrypoint")
+	if err != nil {
+		t.Fatalf("error: could not probe the engine: %v", err)
+	}
+	if err := capabilities.Err(); err != nil {
+		t.Errorf("error: fake engine should support every feature: %v", err)
+	}
+	if capabilities.Engine != EngineDocker {
+		t.Errorf("error: engine identified as %s, expected %s", capabilities.Engine, EngineDocker)
+	}
+	if len(f.Containers()) != 0 || len(f.Networks()) != 0 {
+		t.Errorf("error: probe left containers or networks behind")
+	}
+
+	f.SetVersion(types.Version{
+		Version:    "4.3.1",
+		APIVersion: "1.41",
+		Components: []types.ComponentVersion{{Name: "Podman Engine", Version: "4.3.1"}},
+	})
+	f.Fail("Exec", errors.New("exec is not supported"))
+	capabilities, err = Probe(context.Background(), f, "entrypoint")
+	if err != nil {
+		t.Fatalf("error: could not probe the engine: %v", err)
+	}
+	if capabilities.Engine != EnginePodman {
+		t.Errorf("error: engine identified as %s, expected %s", capabilities.Engine, EnginePodman)
+	}
+	if capabilities.Supports(FeatureExec) || !capabilities.Supports(FeatureNetworks) {
+		t.Errorf("error: unexpected missing features: %v", capabilities.Missing)
+	}
+	if capabilities.Err() == nil {
+		t.Errorf("error: missing exec should be reported as an error")
+	}
+
+	f.Fail("Exec", nil)
+	f.Fail("StartContainer", errors.New("cannot start"))
+	capabilities, err = Probe(context.Background(), f, "entrypoint")
+	if err == nil {
+		t.Errorf("error: Probe should fail if the probe container cannot be started")
+	}
+	if len(f.Containers()) != 0 || len(f.Networks()) != 0 {
+		t.Errorf("error: probe left containers %v or networks %v behind after the probe container could not be started", f.Containers(), f.Networks())
+	}
+	if !capabilities.Supports(FeatureNetworks) {
+		t.Errorf("error: network of the probe could not be removed: %v", capabilities.Missing[FeatureNetworks])
+	}
+}
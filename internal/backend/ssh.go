@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// sshArgs, returns the arguments of the SSH client used to reach the Docker
+// API of the host in u ('ssh://[user@]host[:port]'). The Docker CLI of the
+// remote host forwards its stdin and stdout to the API socket.
+func sshArgs(u *url.URL) []string {
+	args := []string{"-o", "ConnectTimeout=30", "-o", "BatchMode=yes"}
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	return append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+}
+
+// sshDialer, returns a dialer that connects to the Docker API of a remote host
+// through the SSH client of the host, like the Docker CLI does for 'ssh://'
+// hosts. Authentication relies on the SSH configuration of the user running
+// pongo (keys, agent, known hosts).
+func sshDialer(u *url.URL) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	args := sshArgs(u)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// The connection outlives ctx, so the command is not bound to it.
+		cmd := exec.Command("ssh", args...)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		conn := &cmdConn{cmd: cmd, stdin: stdin, stdout: stdout, host: u.Host}
+		cmd.Stderr = &conn.stderr
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("error starting SSH connection to %s: %w", u.Host, err)
+		}
+		return conn, nil
+	}
+}
+
+// cmdConn, net.Conn over the stdin and stdout of a command.
+type cmdConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	// stderr, output of the command, added to read errors.
+	stderr lockedBuffer
+	// host, remote host of the connection.
+	host      string
+	closeOnce sync.Once
+}
+
+// Read, implements net.Conn.
+func (c *cmdConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err != nil && err != io.EOF {
+		return n, fmt.Errorf("error reading from SSH connection to %s: %w (stderr: %s)", c.host, err, c.stderr.String())
+	}
+	return n, err
+}
+
+// Write, implements net.Conn.
+func (c *cmdConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+// Close, implements net.Conn. It terminates the SSH client.
+func (c *cmdConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+// LocalAddr, implements net.Conn.
+func (c *cmdConn) LocalAddr() net.Addr { return sshAddr("local") }
+
+// RemoteAddr, implements net.Conn.
+func (c *cmdConn) RemoteAddr() net.Addr { return sshAddr(c.host) }
+
+// SetDeadline, implements net.Conn. Deadlines are not supported, the HTTP
+// client relies on contexts instead.
+func (c *cmdConn) SetDeadline(t time.Time) error { return nil }
+
+// SetReadDeadline, implements net.Conn.
+func (c *cmdConn) SetReadDeadline(t time.Time) error { return nil }
+
+// SetWriteDeadline, implements net.Conn.
+func (c *cmdConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// sshAddr, address of an SSH connection.
+type sshAddr string
+
+// Network, implements net.Addr.
+func (a sshAddr) Network() string { return "ssh" }
+
+// String, implements net.Addr.
+func (a sshAddr) String() string { return string(a) }
+
+// lockedBuffer, concurrent-safe bytes.Buffer.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write, implements io.Writer.
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// String, returns the content of the buffer.
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Stats, resource usage of a container at a point in time.
+type Stats struct {
+	// Read, time at which the usage was sampled.
+	Read time.Time
+	// CPUPercent, CPU usage since the previous sample, as a percentage of a
+	// single CPU (e.g. 200 means two CPUs are fully used).
+	CPUPercent float64
+	// MemoryBytes, memory used by the container, without the page cache.
+	MemoryBytes uint64
+	// MemoryLimit, memory limit of the container.
+	MemoryLimit uint64
+	// NetRxBytes and NetTxBytes, bytes received and transmitted by the
+	// container through every network interface since it started.
+	NetRxBytes uint64
+	NetTxBytes uint64
+	// NetRxPackets and NetTxPackets, packets received and transmitted by the
+	// container through every network interface since it started.
+	NetRxPackets uint64
+	NetTxPackets uint64
+	// PIDs, amount of processes and threads running in the container.
+	PIDs uint64
+}
+
+// StatsFromJSON, computes the resource usage of a container from the stats
+// reported by the Docker API, like 'docker stats' does.
+func StatsFromJSON(v types.StatsJSON) Stats {
+	s := Stats{
+		Read:        v.Read,
+		MemoryBytes: v.MemoryStats.Usage,
+		MemoryLimit: v.MemoryStats.Limit,
+		PIDs:        v.PidsStats.Current,
+	}
+
+	// The page cache is not counted as used memory (cgroup v1 reports it as
+	// 'total_inactive_file', cgroup v2 as 'inactive_file').
+	for _, key := range []string{"total_inactive_file", "inactive_file"} {
+		if cache, ok := v.MemoryStats.Stats[key]; ok && cache < s.MemoryBytes {
+			s.MemoryBytes -= cache
+			break
+		}
+	}
+
+	cpuDelta := float64(v.CPUStats.CPUUsage.TotalUsage) - float64(v.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(v.CPUStats.SystemUsage) - float64(v.PreCPUStats.SystemUsage)
+	cpus := float64(v.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(v.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		s.CPUPercent = cpuDelta / systemDelta * cpus * 100
+	}
+
+	for _, network := range v.Networks {
+		s.NetRxBytes += network.RxBytes
+		s.NetTxBytes += network.TxBytes
+		s.NetRxPackets += network.RxPackets
+		s.NetTxPackets += network.TxPackets
+	}
+	return s
+}
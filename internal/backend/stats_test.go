@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+// TestStatsFromJSON, tests that the resource usage of a container is computed
+// from the stats reported by the Docker API like 'docker stats' does.
+func TestStatsFromJSON(t *testing.T) {
+	var v types.StatsJSON
+	v.PreCPUStats.CPUUsage.TotalUsage = 1000
+	v.PreCPUStats.SystemUsage = 10000
+	v.CPUStats.CPUUsage.TotalUsage = 3000
+	v.CPUStats.SystemUsage = 18000
+	v.CPUStats.OnlineCPUs = 4
+	v.MemoryStats.Usage = 100 << 20
+	v.MemoryStats.Limit = 512 << 20
+	v.MemoryStats.Stats = map[string]uint64{"inactive_file": 20 << 20}
+	v.PidsStats.Current = 7
+	v.Networks = map[string]types.NetworkStats{
+		"eth0": {RxBytes: 100, TxBytes: 200, RxPackets: 1, TxPackets: 2},
+		"eth1": {RxBytes: 10, TxBytes: 20, RxPackets: 3, TxPackets: 4},
+	}
+
+	s := StatsFromJSON(v)
+	// 2000 of 8000 ns of the 4 CPUs, i.e. a single CPU is fully used.
+	if s.CPUPercent != 100 {
+		t.Errorf("error: CPU usage is %.2f%%, expected 100%%", s.CPUPercent)
+	}
+	if s.MemoryBytes != 80<<20 || s.MemoryLimit != 512<<20 {
+		t.Errorf("error: memory usage is %d/%d, expected %d/%d", s.MemoryBytes, s.MemoryLimit, 80<<20, 512<<20)
+	}
+	if s.NetRxBytes != 110 || s.NetTxBytes != 220 || s.NetRxPackets != 4 || s.NetTxPackets != 6 {
+		t.Errorf("error: network usage of every interface was not added up: %+v", s)
+	}
+	if s.PIDs != 7 {
+		t.Errorf("error: PIDs is %d, expected 7", s.PIDs)
+	}
+
+	// The first sample of a container has no previous CPU usage.
+	v.PreCPUStats = types.CPUStats{}
+	v.CPUStats.SystemUsage = 0
+	if s := StatsFromJSON(v); s.CPUPercent != 0 {
+		t.Errorf("error: CPU usage without a previous sample is %.2f%%, expected 0%%", s.CPUPercent)
+	}
+}
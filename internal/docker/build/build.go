@@ -3,33 +3,60 @@ package dockerBuild
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/jsonmessage"
 )
 
 // Reference material used to program this functions:
 // https://blog.loginradius.com/engineering/build-push-docker-images-golang/
 
+// defaultTimeout, max. time a build can take when no timeout is specified.
+const defaultTimeout = 5 * time.Minute
+
+// Options, optional parameters of a build.
+type Options struct {
+	// Labels, labels added to the built image.
+	Labels map[string]string
+	// Timeout, max. time the build can take. If equal to 0, the default
+	// timeout of 5 minutes is used.
+	Timeout time.Duration
+	// OnEvent, if not nil, it is called for every event of the output stream
+	// of the build, e.g. to report the progress of the build.
+	OnEvent func(Event)
+	// LogFile, if not empty, the full output stream of the build is saved to
+	// this file.
+	LogFile string
+}
+
 // ImageBuild, uses the docker client specified to build an image out of the
 // files that happen to be on the path specified by srcPath. The specified path
 // should have a Dockerfile and all other files required to build the image.
 // It names the created image as 'imageName'. If the specified path does not
 // exist or does not contain a Dockerfile, ImageBuild will return an error.
 func ImageBuild(dockerClient *client.Client, srcPath, imageName string) error {
+	return ImageBuildWithOptions(context.Background(), dockerClient, srcPath, imageName, Options{})
+}
+
+// ImageBuildWithOptions, builds an image like ImageBuild, but it accepts a
+// parent context and optional parameters for the build.
+func ImageBuildWithOptions(ctx context.Context, dockerClient *client.Client, srcPath, imageName string, options Options) error {
 	// Create a context with a timeout for the Docker daemon's action.
-	timeOut, err := time.ParseDuration("5m")
-	if err != nil {
-		return fmt.Errorf("error: parsing time duration: %w", err)
+	timeOut := options.Timeout
+	if timeOut == 0 {
+		timeOut = defaultTimeout
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
 	defer cancel()
 
 	// Every time a Docker image is built locally (even when using the Docker
@@ -46,6 +73,7 @@ func ImageBuild(dockerClient *client.Client, srcPath, imageName string) error {
 		Dockerfile: "Dockerfile",
 		Tags:       []string{imageName},
 		Remove:     true,
+		Labels:     options.Labels,
 	}
 	res, err := dockerClient.ImageBuild(ctx, tar, opts)
 	if err != nil {
@@ -53,8 +81,19 @@ func ImageBuild(dockerClient *client.Client, srcPath, imageName string) error {
 	}
 	defer res.Body.Close()
 
-	// Scan the build text stream for errors.
-	err = scanBuildStream(res.Body)
+	// Save the full output of the build in a log file, if requested.
+	var log io.Writer
+	if options.LogFile != "" {
+		logFile, err := os.Create(options.LogFile)
+		if err != nil {
+			return fmt.Errorf("error: could not create build log %s: %w", options.LogFile, err)
+		}
+		defer logFile.Close()
+		log = logFile
+	}
+
+	// Scan the build text stream for events and errors.
+	err = ScanBuildStream(res.Body, options.OnEvent, log)
 	if err != nil {
 		return fmt.Errorf("an error was encountered during the docker image build: %w", err)
 	}
@@ -62,36 +101,127 @@ func ImageBuild(dockerClient *client.Client, srcPath, imageName string) error {
 	return nil
 }
 
-type ErrorLine struct {
-	Error       string      `json:"error"`
-	ErrorDetail ErrorDetail `json:"errorDetail"`
+// EventKind, kind of an event of the output stream of a build.
+type EventKind string
+
+const (
+	// EventStep, the build started a new step (an instruction of the
+	// Dockerfile).
+	EventStep EventKind = "step"
+	// EventOutput, a line of output of the current step, e.g. the output of a
+	// RUN instruction.
+	EventOutput EventKind = "output"
+	// EventLayer, the status of a layer changed, e.g. a layer of the base
+	// image was pulled or a step produced a new layer.
+	EventLayer EventKind = "layer"
+	// EventProgress, progress of the download or extraction of a layer.
+	EventProgress EventKind = "progress"
+	// EventError, the build failed.
+	EventError EventKind = "error"
+)
+
+// Event, a structured event of the output stream of a build.
+type Event struct {
+	// Kind, kind of the event.
+	Kind EventKind
+	// Step, step of the build during which the event happened, e.g.
+	// 'Step 2/5 : RUN apk add openssh'.
+	Step string
+	// Layer, ID of the layer the event refers to (only for layer and progress
+	// events).
+	Layer string
+	// Message, text of the event, e.g. a line of output or an error message.
+	Message string
+	// Current, amount of bytes already processed (only for progress events).
+	Current int64
+	// Total, total amount of bytes to process (only for progress events).
+	Total int64
+}
+
+// BuildError, error returned when the Docker daemon reports that a build
+// failed.
+type BuildError struct {
+	// Step, step of the build that failed. Empty if the build failed before
+	// the first step.
+	Step string
+	// Message, error reported by the Docker daemon.
+	Message string
 }
 
-type ErrorDetail struct {
-	Message string `json:"message"`
+// Error, implements the error interface.
+func (e *BuildError) Error() string {
+	if e.Step == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (failed at '%s')", e.Message, e.Step)
 }
 
-// scanBuildStream, scan the text stream output of the Docker daemon for the
-// build being performed, if an error is encountered during the build this
-// function returns the error.
-func scanBuildStream(rd io.Reader) error {
-	var lastLine string
+// maxLineSize, max. size of a single line of the output stream of a build.
+const maxLineSize = 1024 * 1024
+
+// ScanBuildStream, scans the JSON output stream of the Docker daemon for a
+// build (or pull) and calls onEvent (if not nil) with a structured event for
+// every message of the stream. Every line of the stream is also copied as-is
+// to log (if not nil). If the Docker daemon reports an error, a *BuildError
+// with the step that failed is returned.
+func ScanBuildStream(rd io.Reader, onEvent func(Event), log io.Writer) error {
+	if onEvent == nil {
+		onEvent = func(Event) {}
+	}
+	var step string
 
 	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
 	for scanner.Scan() {
-		lastLine = scanner.Text()
-		// Uncomment the following line if you want to get a line-by-line
-		// stream output of the Docker daemon building the image.
-		// fmt.Println(scanner.Text())
-	}
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if log != nil {
+			if _, err := fmt.Fprintf(log, "%s\n", line); err != nil {
+				return fmt.Errorf("error: unable to write build log: %w", err)
+			}
+		}
+
+		var msg jsonmessage.JSONMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return fmt.Errorf("error: unable to decode message of Docker build stream (%s): %w", line, err)
+		}
 
-	errLine := &ErrorLine{}
-	// If the last line does not contain an error, then the unmarshalling
-	// will not populate the fields of the errLine struct.
-	json.Unmarshal([]byte(lastLine), errLine)
-	// An error was encountered.
-	if errLine.Error != "" {
-		return errors.New(errLine.Error)
+		switch {
+		case msg.Error != nil || msg.ErrorMessage != "":
+			buildErr := &BuildError{Step: step, Message: msg.ErrorMessage}
+			if msg.Error != nil && msg.Error.Message != "" {
+				buildErr.Message = msg.Error.Message
+			}
+			onEvent(Event{Kind: EventError, Step: step, Message: buildErr.Message})
+			return buildErr
+		case msg.Stream != "":
+			// A single stream message can contain multiple lines.
+			for _, text := range strings.Split(strings.TrimRight(msg.Stream, "\n"), "\n") {
+				text = strings.TrimRight(text, "\r")
+				switch {
+				case strings.HasPrefix(text, "Step "):
+					step = text
+					onEvent(Event{Kind: EventStep, Step: step, Message: text})
+				case strings.HasPrefix(text, " ---> ") && !strings.Contains(strings.TrimPrefix(text, " ---> "), " "):
+					// The ID of the layer produced by the current step, e.g.
+					// ' ---> 5d3a42d1c2b4' (but not ' ---> Running in ...').
+					layer := strings.TrimPrefix(text, " ---> ")
+					onEvent(Event{Kind: EventLayer, Step: step, Layer: layer, Message: text})
+				case text != "":
+					onEvent(Event{Kind: EventOutput, Step: step, Message: text})
+				}
+			}
+		case msg.Status != "":
+			event := Event{Kind: EventLayer, Step: step, Layer: msg.ID, Message: msg.Status}
+			if msg.Progress != nil && msg.Progress.Total > 0 {
+				event.Kind = EventProgress
+				event.Current = msg.Progress.Current
+				event.Total = msg.Progress.Total
+			}
+			onEvent(event)
+		}
 	}
 	if err := scanner.Err(); err != nil {
 		return fmt.Errorf("error: scan of Docker build stream encountered an error: %w", err)
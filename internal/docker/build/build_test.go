@@ -1,6 +1,9 @@
 package dockerBuild
 
 import (
+	"bytes"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/docker/docker/client"
@@ -27,3 +30,54 @@ func TestImageBuild(t *testing.T) {
 
 	//TODO: a cleanup function to erase the test image that was just built.
 }
+
+// TestScanBuildStream, tests that the output stream of a build is turned into
+// structured events, that it is copied to the build log and that a failed
+// build returns the step that failed.
+func TestScanBuildStream(t *testing.T) {
+	stream := `{"status":"Pulling fs layer","progressDetail":{},"id":"a1b2c3"}
+{"status":"Downloading","progressDetail":{"current":512,"total":1024},"id":"a1b2c3"}
+{"stream":"Step 1/2 : FROM alpine\n"}
+{"stream":" ---> 5d3a42d1c2b4\n"}
+{"stream":"Step 2/2 : RUN false\n"}
+{"stream":" ---> Running in 0f1e2d3c\n"}
+{"errorDetail":{"code":1,"message":"The command '/bin/sh -c false' returned a non-zero code: 1"},"error":"The command '/bin/sh -c false' returned a non-zero code: 1"}
+`
+	var events []Event
+	log := new(bytes.Buffer)
+	err := ScanBuildStream(strings.NewReader(stream), func(e Event) {
+		events = append(events, e)
+	}, log)
+
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) {
+		t.Fatalf("error: expected a *BuildError, got %v", err)
+	}
+	if buildErr.Step != "Step 2/2 : RUN false" {
+		t.Errorf("error: build failed at step %q, expected %q", buildErr.Step, "Step 2/2 : RUN false")
+	}
+
+	expected := []EventKind{EventLayer, EventProgress, EventStep, EventLayer, EventStep, EventOutput, EventError}
+	if len(events) != len(expected) {
+		t.Fatalf("error: got %d events, expected %d: %+v", len(events), len(expected), events)
+	}
+	for i, kind := range expected {
+		if events[i].Kind != kind {
+			t.Errorf("error: event %d is of kind %s, expected %s", i, events[i].Kind, kind)
+		}
+	}
+	if events[1].Current != 512 || events[1].Total != 1024 {
+		t.Errorf("error: progress event is %d/%d, expected 512/1024", events[1].Current, events[1].Total)
+	}
+	if events[3].Layer != "5d3a42d1c2b4" {
+		t.Errorf("error: layer event refers to layer %q, expected %q", events[3].Layer, "5d3a42d1c2b4")
+	}
+
+	if log.String() != stream {
+		t.Errorf("error: build log does not contain the full build stream:\n%s", log.String())
+	}
+
+	if err := ScanBuildStream(strings.NewReader("not json\n"), nil, nil); err == nil {
+		t.Errorf("error: an invalid build stream should return an error")
+	}
+}
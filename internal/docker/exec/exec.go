@@ -0,0 +1,83 @@
+// dockerExec provides functions to execute commands inside running containers
+// using the Docker SDK, and to collect their output and exit code.
+package dockerExec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Result, output of a command executed inside a container.
+type Result struct {
+	// Stdout, everything the command wrote to its standard output.
+	Stdout string
+	// Stderr, everything the command wrote to its standard error.
+	Stderr string
+	// ExitCode, exit code of the command.
+	ExitCode int
+}
+
+// Run, executes cmd inside the running container with the given containerID
+// and blocks until the command returns. A non-zero exit code of the command is
+// not considered an error, the caller should check Result.ExitCode.
+func Run(ctx context.Context, dockerClient *client.Client, containerID string, cmd []string) (Result, error) {
+	return RunWithStdin(ctx, dockerClient, containerID, cmd, nil)
+}
+
+// RunWithStdin, same as Run, but everything read from stdin (if not nil) is
+// written to the standard input of the command, which is closed afterwards.
+func RunWithStdin(ctx context.Context, dockerClient *client.Client, containerID string, cmd []string, stdin io.Reader) (Result, error) {
+	var result Result
+
+	// Attach the output streams, in order to read the output of the command.
+	execConfig := types.ExecConfig{
+		AttachStdin:  stdin != nil,
+		AttachStderr: true,
+		AttachStdout: true,
+		Cmd:          cmd,
+	}
+	response, err := dockerClient.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		return result, fmt.Errorf("error: unable to create exec process in container %s: %w", containerID, err)
+	}
+
+	// Attaching to the exec process starts it.
+	hijacked, err := dockerClient.ContainerExecAttach(ctx, response.ID, types.ExecStartCheck{})
+	if err != nil {
+		return result, fmt.Errorf("error: unable to attach to exec process in container %s: %w", containerID, err)
+	}
+	defer hijacked.Close()
+
+	if stdin != nil {
+		// Write the input concurrently, a command could fill its output
+		// buffers before it reads all of its input.
+		go func() {
+			io.Copy(hijacked.Conn, stdin)
+			hijacked.CloseWrite()
+		}()
+	}
+
+	// Without a TTY, the Docker daemon multiplexes stdout and stderr into a
+	// single stream, which has to be demultiplexed. The copy returns when the
+	// command returns.
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, hijacked.Reader); err != nil {
+		return result, fmt.Errorf("error: unable to read output of exec process in container %s: %w", containerID, err)
+	}
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+
+	inspect, err := dockerClient.ContainerExecInspect(ctx, response.ID)
+	if err != nil {
+		return result, fmt.Errorf("error: unable to inspect exec process in container %s: %w", containerID, err)
+	}
+	result.ExitCode = inspect.ExitCode
+
+	return result, nil
+}
@@ -0,0 +1,247 @@
+package dockerImage
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	dockerExec "github.com/erodrigufer/pongo/internal/docker/exec"
+	"github.com/erodrigufer/pongo/internal/pongo"
+	"github.com/erodrigufer/pongo/internal/sysutils"
+)
+
+// DefaultBinaries, binaries that every challenge image needs, so that pongo
+// can create users in it and participants can log into it with SSH.
+var DefaultBinaries = []string{"bash", "useradd", "chpasswd", "sshd"}
+
+// sshPort, port on which sshd listens inside the container.
+const sshPort nat.Port = "22/tcp"
+
+// sshdRetryInterval, time between attempts to connect to sshd while it starts.
+const sshdRetryInterval = 500 * time.Millisecond
+
+// CheckOptions, parameters of the checks performed on an image.
+type CheckOptions struct {
+	// Image, name of the image to check.
+	Image string
+	// Binaries, binaries that have to be available in the image.
+	Binaries []string
+	// SSHTimeout, max. time to wait for sshd to answer after the container
+	// started.
+	SSHTimeout time.Duration
+}
+
+// CheckResult, result of a single check performed on an image.
+type CheckResult struct {
+	// Name, short description of the check.
+	Name string
+	// Pass, true if the check passed.
+	Pass bool
+	// Details, why the check failed, or further information if it passed.
+	Details string
+}
+
+// Passed, returns true if all checks passed.
+func Passed(results []CheckResult) bool {
+	for _, result := range results {
+		if !result.Pass {
+			return false
+		}
+	}
+	return true
+}
+
+// Check, validates that a challenge image can be used by pongo. It starts a
+// throwaway container out of the image, creates a user in it with the same
+// commands used for a session, verifies that sshd answers and that all the
+// required binaries exist. The container is always removed afterwards. The
+// result of every check is returned; if a check makes the following checks
+// pointless (e.g. the container does not start), the following checks are
+// skipped.
+func Check(ctx context.Context, dockerClient *client.Client, options CheckOptions) []CheckResult {
+	var results []CheckResult
+	add := func(name string, err error, details string) bool {
+		result := CheckResult{Name: name, Pass: err == nil, Details: details}
+		if err != nil {
+			result.Details = err.Error()
+		}
+		results = append(results, result)
+		return result.Pass
+	}
+
+	containerID, err := startContainer(ctx, dockerClient, options.Image)
+	if containerID != "" {
+		defer removeContainer(dockerClient, containerID)
+	}
+	if !add("container starts", err, options.Image) {
+		return results
+	}
+
+	username, err := sysutils.NewRandomUsername(10, "abcdefghijklmnopqrstuvwxyz")
+	var password string
+	if err == nil {
+		password, err = sysutils.NewRandomPassword(16, "abcdefghijklmnopqrstuvwxyz0123456789")
+	}
+	if err == nil {
+		err = createUser(ctx, dockerClient, containerID, username, password)
+	}
+	add("user can be created", err, username)
+
+	addr, err := waitForSSH(ctx, dockerClient, containerID, options.SSHTimeout)
+	add("sshd answers", err, addr)
+
+	for _, binary := range options.Binaries {
+		path, err := findBinary(ctx, dockerClient, containerID, binary)
+		add(fmt.Sprintf("binary %s exists", binary), err, path)
+	}
+
+	return results
+}
+
+// startContainer, creates and starts a container out of an image. It returns
+// the ID of the container, if it was created, even if it could not be started.
+func startContainer(ctx context.Context, dockerClient *client.Client, image string) (string, error) {
+	config := &container.Config{
+		Image:        image,
+		Tty:          true,
+		ExposedPorts: nat.PortSet{sshPort: {}},
+		Labels: map[string]string{
+			"pongo.image-test": "true",
+		},
+	}
+	hostConfig := &container.HostConfig{
+		// Publish sshd on a random port of the loopback interface, the IP
+		// address of the container is not reachable from the host with
+		// Docker Desktop, Docker-in-Docker and most CI runners.
+		PortBindings: nat.PortMap{sshPort: {{HostIP: "127.0.0.1"}}},
+	}
+	resp, err := dockerClient.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("error: unable to create container: %w", err)
+	}
+	if err := dockerClient.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return resp.ID, fmt.Errorf("error: unable to start container: %w", err)
+	}
+	return resp.ID, nil
+}
+
+// removeContainer, forcefully removes a container and its volumes.
+func removeContainer(dockerClient *client.Client, containerID string) {
+	// The parent context might already be cancelled, the container should be
+	// removed anyway.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	dockerClient.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{
+		Force:         true,
+		RemoveVolumes: true,
+	})
+}
+
+// createUser, creates a user inside a container with the same commands used
+// for the sessions.
+func createUser(ctx context.Context, dockerClient *client.Client, containerID, username, password string) error {
+	for _, cmd := range pongo.CreateUserCmds(username, password) {
+		var stdin io.Reader
+		if cmd.Stdin != "" {
+			stdin = strings.NewReader(cmd.Stdin)
+		}
+		result, err := dockerExec.RunWithStdin(ctx, dockerClient, containerID, cmd.Args, stdin)
+		if err != nil {
+			return err
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("error: '%s' failed with exit code %d: %s", cmd.Args[0], result.ExitCode, strings.TrimSpace(result.Stderr))
+		}
+	}
+	return nil
+}
+
+// waitForSSH, waits until sshd answers with its SSH banner on the port of the
+// host on which port 22 of the container is published. It returns the address
+// at which sshd answered.
+func waitForSSH(ctx context.Context, dockerClient *client.Client, containerID string, timeout time.Duration) (string, error) {
+	inspect, err := dockerClient.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", fmt.Errorf("error: unable to inspect container: %w", err)
+	}
+	if inspect.NetworkSettings == nil {
+		return "", fmt.Errorf("error: container has no network settings")
+	}
+	addr, err := publishedAddr(inspect.NetworkSettings.Ports, sshPort)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var dialer net.Dialer
+	for {
+		err = readSSHBanner(ctx, &dialer, addr)
+		if err == nil {
+			return addr, nil
+		}
+		select {
+		case <-ctx.Done():
+			return addr, fmt.Errorf("error: sshd did not answer at %s within %v: %w", addr, timeout, err)
+		case <-time.After(sshdRetryInterval):
+		}
+	}
+}
+
+// publishedAddr, returns the address of the host at which port of a container
+// is published, according to the port bindings of the running container.
+func publishedAddr(ports nat.PortMap, port nat.Port) (string, error) {
+	for _, binding := range ports[port] {
+		if binding.HostPort == "" {
+			continue
+		}
+		host := binding.HostIP
+		if host == "" || host == "0.0.0.0" {
+			host = "127.0.0.1"
+		}
+		return net.JoinHostPort(host, binding.HostPort), nil
+	}
+	return "", fmt.Errorf("error: port %s of the container is not published", port)
+}
+
+// readSSHBanner, connects to addr and checks that the server identifies
+// itself as an SSH server.
+func readSSHBanner(ctx context.Context, dialer *net.Dialer, addr string) error {
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("error: unable to read SSH banner: %w", err)
+	}
+	if !strings.HasPrefix(banner, "SSH-") {
+		return fmt.Errorf("error: unexpected SSH banner %q", strings.TrimSpace(banner))
+	}
+	return nil
+}
+
+// findBinary, checks that a binary is available in the PATH of a container.
+// It returns the path of the binary.
+func findBinary(ctx context.Context, dockerClient *client.Client, containerID, binary string) (string, error) {
+	// sshd is usually not in the PATH of regular users.
+	cmd := []string{"sh", "-c", `PATH="$PATH:/usr/sbin:/sbin"; command -v "$1"`, "sh", binary}
+	result, err := dockerExec.Run(ctx, dockerClient, containerID, cmd)
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("error: %s not found", binary)
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
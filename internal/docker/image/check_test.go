@@ -0,0 +1,89 @@
+package dockerImage
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// TestPassed, tests that the checks of an image only pass if every check
+// passed.
+func TestPassed(t *testing.T) {
+	pass := CheckResult{Name: "container starts", Pass: true}
+	fail := CheckResult{Name: "sshd answers", Pass: false}
+	if !Passed(nil) || !Passed([]CheckResult{pass, pass}) {
+		t.Errorf("error: passing checks did not pass")
+	}
+	if Passed([]CheckResult{pass, fail}) {
+		t.Errorf("error: failing check passed")
+	}
+}
+
+// TestPublishedAddr, tests that sshd is dialed at the port of the host on
+// which port 22 of the container is published.
+func TestPublishedAddr(t *testing.T) {
+	tests := []struct {
+		name     string
+		ports    nat.PortMap
+		expected string
+	}{
+		{"loopback", nat.PortMap{sshPort: {{HostIP: "127.0.0.1", HostPort: "32768"}}}, "127.0.0.1:32768"},
+		{"all interfaces", nat.PortMap{sshPort: {{HostIP: "0.0.0.0", HostPort: "32768"}}}, "127.0.0.1:32768"},
+		{"not published", nat.PortMap{sshPort: nil}, ""},
+		{"other port", nat.PortMap{"80/tcp": {{HostIP: "127.0.0.1", HostPort: "8080"}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := publishedAddr(tt.ports, sshPort)
+			if tt.expected == "" {
+				if err == nil {
+					t.Errorf("error: expected an error, got address %s", addr)
+				}
+				return
+			}
+			if err != nil || addr != tt.expected {
+				t.Errorf("error: got address %s (%v), expected %s", addr, err, tt.expected)
+			}
+		})
+	}
+}
+
+// TestReadSSHBanner, tests that only a server which identifies itself as an
+// SSH server passes the check of sshd.
+func TestReadSSHBanner(t *testing.T) {
+	tests := []struct {
+		name   string
+		banner string
+		pass   bool
+	}{
+		{"sshd", "SSH-2.0-OpenSSH_9.3\r\n", true},
+		{"http", "HTTP/1.1 400 Bad Request\r\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			go func() {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.Write([]byte(tt.banner))
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err = readSSHBanner(ctx, new(net.Dialer), l.Addr().String())
+			if (err == nil) != tt.pass {
+				t.Errorf("error: banner %q returned %v", tt.banner, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+// dockerImage provides functions to make sure that the Docker images used by
+// the application are available, either by building them from a build context
+// or by pulling them from a registry, and to pin them by digest.
+package dockerImage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	dockerBuild "github.com/erodrigufer/pongo/internal/docker/build"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// ContextHashLabel, label added to every image built from a build context,
+// its value is the hash of the build context. It is used to skip a build if
+// the build context has not changed.
+const ContextHashLabel = "pongo.context-hash"
+
+// Sources of a resolved image.
+const (
+	// SourceBuilt, the image was built from its build context.
+	SourceBuilt = "built"
+	// SourceCached, the image had already been built from the same build
+	// context, the build was skipped.
+	SourceCached = "cached"
+	// SourcePulled, the image was pulled from a registry.
+	SourcePulled = "pulled"
+	// SourceLocal, the image was already available in the Docker host.
+	SourceLocal = "local"
+)
+
+// RegistryAuth, credentials used to pull images from a registry.
+type RegistryAuth struct {
+	// Username, used to log into the registry.
+	Username string
+	// Password, used to log into the registry.
+	Password string
+	// ServerAddress, address of the registry, e.g. 'localhost:5000'.
+	ServerAddress string
+}
+
+// Spec, describes how to make an image available in the Docker host.
+type Spec struct {
+	// Name, local name of the image, used to create containers out of it.
+	Name string
+	// Context, path to a build context (a directory with a Dockerfile). If
+	// not empty, the image is built from it.
+	Context string
+	// Ref, reference of the image in a registry, e.g.
+	// 'localhost:5000/ctf/entrypoint:v1'. If not empty and Context is empty,
+	// the image is pulled from the registry if it is not available locally.
+	Ref string
+	// Digest, if not empty, the image must resolve to this digest (e.g.
+	// 'sha256:...'). Pulled images are pulled by digest, for built and local
+	// images the digest is compared with the image ID.
+	Digest string
+	// Auth, credentials for the registry, can be nil.
+	Auth *RegistryAuth
+	// BuildTimeout, max. time a build can take.
+	BuildTimeout time.Duration
+	// BuildLog, if not empty, the full output of a build is saved to this
+	// file.
+	BuildLog string
+	// OnEvent, if not nil, it is called for every event of the output stream
+	// of a build or pull.
+	OnEvent func(dockerBuild.Event)
+}
+
+// Resolved, an image that is available in the Docker host.
+type Resolved struct {
+	// Name, local name of the image.
+	Name string
+	// ID, ID of the image in the Docker host.
+	ID string
+	// Digest, digest of the image in its registry, or its ID if the image
+	// has never been pushed to or pulled from a registry.
+	Digest string
+	// Source, how the image was made available (built, cached, pulled or
+	// local).
+	Source string
+}
+
+// Ensure, makes the image described by spec available in the Docker host,
+// building or pulling it if necessary, and returns the resolved image. If the
+// spec pins a digest and the image does not match it, an error is returned.
+func Ensure(ctx context.Context, dockerClient *client.Client, spec Spec) (Resolved, error) {
+	var source string
+	var err error
+	switch {
+	case spec.Context != "":
+		source, err = ensureBuilt(ctx, dockerClient, spec)
+	case spec.Ref != "":
+		source, err = ensurePulled(ctx, dockerClient, spec)
+	default:
+		source = SourceLocal
+	}
+	if err != nil {
+		return Resolved{}, err
+	}
+
+	resolved, err := Inspect(ctx, dockerClient, spec.Name)
+	if err != nil {
+		return Resolved{}, err
+	}
+	resolved.Source = source
+	if spec.Digest != "" && !matchesDigest(resolved, spec.Digest) {
+		return resolved, fmt.Errorf("error: image %s resolved to %s, which does not match the pinned digest %s", spec.Name, resolved.Digest, spec.Digest)
+	}
+
+	return resolved, nil
+}
+
+// Inspect, returns the image with the given name, if it is available in the
+// Docker host.
+func Inspect(ctx context.Context, dockerClient *client.Client, name string) (Resolved, error) {
+	inspect, _, err := dockerClient.ImageInspectWithRaw(ctx, name)
+	if err != nil {
+		return Resolved{}, fmt.Errorf("error: unable to inspect image %s: %w", name, err)
+	}
+	resolved := Resolved{
+		Name:   name,
+		ID:     inspect.ID,
+		Digest: inspect.ID,
+	}
+	// A repo digest has the form 'repository@sha256:...'.
+	if len(inspect.RepoDigests) > 0 {
+		if i := strings.LastIndex(inspect.RepoDigests[0], "@"); i >= 0 {
+			resolved.Digest = inspect.RepoDigests[0][i+1:]
+		}
+	}
+	return resolved, nil
+}
+
+// matchesDigest, checks if a resolved image matches a pinned digest.
+func matchesDigest(resolved Resolved, pinned string) bool {
+	return resolved.Digest == pinned || resolved.ID == pinned
+}
+
+// ensureBuilt, builds the image from its build context, unless the image was
+// already built from an identical build context.
+func ensureBuilt(ctx context.Context, dockerClient *client.Client, spec Spec) (string, error) {
+	hash, err := ContextHash(spec.Context)
+	if err != nil {
+		return "", err
+	}
+	inspect, _, err := dockerClient.ImageInspectWithRaw(ctx, spec.Name)
+	if err == nil && inspect.Config != nil && inspect.Config.Labels[ContextHashLabel] == hash {
+		return SourceCached, nil
+	}
+
+	options := dockerBuild.Options{
+		Labels:  map[string]string{ContextHashLabel: hash},
+		Timeout: spec.BuildTimeout,
+		OnEvent: spec.OnEvent,
+		LogFile: spec.BuildLog,
+	}
+	if err := dockerBuild.ImageBuildWithOptions(ctx, dockerClient, spec.Context, spec.Name, options); err != nil {
+		return "", err
+	}
+	return SourceBuilt, nil
+}
+
+// ensurePulled, pulls the image from its registry, unless it is already
+// available locally (and matches the pinned digest, if any). The pulled
+// image is tagged with the local name of the spec.
+func ensurePulled(ctx context.Context, dockerClient *client.Client, spec Spec) (string, error) {
+	if resolved, err := Inspect(ctx, dockerClient, spec.Name); err == nil {
+		if spec.Digest == "" || matchesDigest(resolved, spec.Digest) {
+			return SourceLocal, nil
+		}
+	}
+
+	ref, err := pullReference(spec.Ref, spec.Digest)
+	if err != nil {
+		return "", err
+	}
+	options := types.ImagePullOptions{}
+	if spec.Auth != nil {
+		options.RegistryAuth, err = encodeAuth(*spec.Auth)
+		if err != nil {
+			return "", err
+		}
+	}
+	rc, err := dockerClient.ImagePull(ctx, ref, options)
+	if err != nil {
+		return "", fmt.Errorf("error: unable to pull image %s: %w", ref, err)
+	}
+	defer rc.Close()
+	// The pull only finishes once its progress stream has been read
+	// completely. Errors during the pull are reported within the stream.
+	if err := dockerBuild.ScanBuildStream(rc, spec.OnEvent, nil); err != nil {
+		return "", fmt.Errorf("error: unable to pull image %s: %w", ref, err)
+	}
+
+	if ref != spec.Name {
+		if err := dockerClient.ImageTag(ctx, ref, spec.Name); err != nil {
+			return "", fmt.Errorf("error: unable to tag image %s as %s: %w", ref, spec.Name, err)
+		}
+	}
+	return SourcePulled, nil
+}
+
+// pullReference, returns the reference used to pull an image. If a digest is
+// pinned, the image is pulled by digest instead of by tag.
+func pullReference(ref, pinned string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", fmt.Errorf("error: invalid image reference %s: %w", ref, err)
+	}
+	if pinned == "" {
+		return reference.FamiliarString(reference.TagNameOnly(named)), nil
+	}
+	d, err := digest.Parse(pinned)
+	if err != nil {
+		return "", fmt.Errorf("error: invalid image digest %s: %w", pinned, err)
+	}
+	withDigest, err := reference.WithDigest(reference.TrimNamed(named), d)
+	if err != nil {
+		return "", fmt.Errorf("error: unable to pin image %s to digest %s: %w", ref, pinned, err)
+	}
+	return reference.FamiliarString(withDigest), nil
+}
+
+// encodeAuth, encodes the registry credentials as expected by the Docker
+// daemon (base64-encoded JSON).
+func encodeAuth(auth RegistryAuth) (string, error) {
+	authConfig := types.AuthConfig{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		ServerAddress: auth.ServerAddress,
+	}
+	encoded, err := json.Marshal(authConfig)
+	if err != nil {
+		return "", fmt.Errorf("error: unable to encode registry credentials: %w", err)
+	}
+	return base64.URLEncoding.EncodeToString(encoded), nil
+}
+
+// ContextHash, returns a hash of all the files within a build context (their
+// relative paths, permissions and contents). The hash changes if any file of
+// the build context changes.
+func ContextHash(dir string) (string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error: unable to walk build context %s: %w", dir, err)
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, path := range files {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return "", err
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			return "", fmt.Errorf("error: unable to stat %s: %w", path, err)
+		}
+		fmt.Fprintf(h, "%s\x00%o\x00", filepath.ToSlash(rel), info.Mode())
+		if info.Mode()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return "", fmt.Errorf("error: unable to read link %s: %w", path, err)
+			}
+			fmt.Fprintf(h, "%s\x00", target)
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("error: unable to open %s: %w", path, err)
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("error: unable to read %s: %w", path, err)
+		}
+		h.Write([]byte{0})
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
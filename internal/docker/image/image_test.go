@@ -0,0 +1,86 @@
+package dockerImage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestContextHash, tests that the hash of a build context only changes if the
+// files within the build context change.
+func TestContextHash(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatalf("error: could not write Dockerfile: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0755); err != nil {
+		t.Fatalf("error: could not create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "files", "motd"), []byte("welcome"), 0644); err != nil {
+		t.Fatalf("error: could not write file: %v", err)
+	}
+
+	first, err := ContextHash(dir)
+	if err != nil {
+		t.Fatalf("error: could not hash build context: %v", err)
+	}
+	second, err := ContextHash(dir)
+	if err != nil {
+		t.Fatalf("error: could not hash build context: %v", err)
+	}
+	if first != second {
+		t.Errorf("error: hash of an unchanged build context changed from %s to %s", first, second)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "files", "motd"), []byte("welcome!"), 0644); err != nil {
+		t.Fatalf("error: could not write file: %v", err)
+	}
+	changed, err := ContextHash(dir)
+	if err != nil {
+		t.Fatalf("error: could not hash build context: %v", err)
+	}
+	if changed == first {
+		t.Errorf("error: hash did not change after a file of the build context changed")
+	}
+
+	// Moving a file changes the hash, even if its content is the same.
+	if err := os.Rename(filepath.Join(dir, "files", "motd"), filepath.Join(dir, "motd")); err != nil {
+		t.Fatalf("error: could not move file: %v", err)
+	}
+	moved, err := ContextHash(dir)
+	if err != nil {
+		t.Fatalf("error: could not hash build context: %v", err)
+	}
+	if moved == changed {
+		t.Errorf("error: hash did not change after a file of the build context was moved")
+	}
+}
+
+// TestPullReference, tests that images with a pinned digest are pulled by
+// digest.
+func TestPullReference(t *testing.T) {
+	const digest = "sha256:2a3a4f4b8d3e3d1bbac1b7b5d3a3e5e1e3f0d2c1b0a9f8e7d6c5b4a3f2e1d0c9"
+	tests := []struct {
+		ref      string
+		digest   string
+		expected string
+	}{
+		{"alpine", "", "alpine:latest"},
+		{"localhost:5000/ctf/entrypoint:v1", "", "localhost:5000/ctf/entrypoint:v1"},
+		{"localhost:5000/ctf/entrypoint:v1", digest, "localhost:5000/ctf/entrypoint@" + digest},
+	}
+	for _, tt := range tests {
+		got, err := pullReference(tt.ref, tt.digest)
+		if err != nil {
+			t.Errorf("error: pullReference(%q, %q) returned an error: %v", tt.ref, tt.digest, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("error: pullReference(%q, %q) = %q, expected %q", tt.ref, tt.digest, got, tt.expected)
+		}
+	}
+
+	if _, err := pullReference("alpine", "not-a-digest"); err == nil {
+		t.Errorf("error: pullReference should reject an invalid digest")
+	}
+}
@@ -0,0 +1,221 @@
+// expiry implements a scheduler that notifies when keys (e.g. the names of
+// sessions) reach their deadline. The deadlines are stored in a min-heap, so
+// that the scheduler only wakes up when the earliest deadline is reached,
+// instead of periodically polling all keys.
+package expiry
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNotScheduled, error returned when operating on a key that is not
+// currently scheduled.
+var ErrNotScheduled = fmt.Errorf("key is not scheduled")
+
+// entry, a single key scheduled to expire at deadline.
+type entry struct {
+	// key, identifies the entry within the scheduler.
+	key string
+	// deadline, time at which the entry expires.
+	deadline time.Time
+	// index, position of the entry within the heap, maintained by the
+	// heap.Interface methods.
+	index int
+}
+
+// entries, min-heap of entries ordered by their deadline. It implements
+// heap.Interface.
+type entries []*entry
+
+func (es entries) Len() int { return len(es) }
+
+func (es entries) Less(i, j int) bool { return es[i].deadline.Before(es[j].deadline) }
+
+func (es entries) Swap(i, j int) {
+	es[i], es[j] = es[j], es[i]
+	es[i].index = i
+	es[j].index = j
+}
+
+func (es *entries) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*es)
+	*es = append(*es, e)
+}
+
+func (es *entries) Pop() any {
+	old := *es
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*es = old[:n-1]
+	return e
+}
+
+// Scheduler, keeps track of the deadlines of a set of keys. It is
+// concurrent-safe, keys can be scheduled, extended and removed while Run() is
+// waiting for the next deadline.
+type Scheduler struct {
+	// mu, guards the heap and the index.
+	mu sync.Mutex
+	// heap, min-heap with all the scheduled entries.
+	heap entries
+	// index, maps a key to its entry within the heap.
+	index map[string]*entry
+	// wake, notifies Run() that the earliest deadline might have changed.
+	wake chan struct{}
+}
+
+// NewScheduler, constructor for a Scheduler without any scheduled keys.
+func NewScheduler() *Scheduler {
+	s := new(Scheduler)
+	s.index = make(map[string]*entry)
+	// Buffered channel, so that notifying Run() never blocks. A single pending
+	// notification is enough for Run() to re-evaluate the earliest deadline.
+	s.wake = make(chan struct{}, 1)
+	return s
+}
+
+// notify, wakes up Run() without blocking.
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Schedule, schedules key to expire at deadline. If the key was already
+// scheduled, its deadline is replaced.
+func (s *Scheduler) Schedule(key string, deadline time.Time) {
+	s.mu.Lock()
+	if e, ok := s.index[key]; ok {
+		e.deadline = deadline
+		heap.Fix(&s.heap, e.index)
+	} else {
+		e := &entry{key: key, deadline: deadline}
+		heap.Push(&s.heap, e)
+		s.index[key] = e
+	}
+	s.mu.Unlock()
+
+	s.notify()
+}
+
+// Extend, postpones the deadline of a scheduled key by d. It returns the new
+// deadline of the key, or ErrNotScheduled if the key is not scheduled.
+func (s *Scheduler) Extend(key string, d time.Duration) (time.Time, error) {
+	s.mu.Lock()
+	e, ok := s.index[key]
+	if !ok {
+		s.mu.Unlock()
+		return time.Time{}, fmt.Errorf("unable to extend %s: %w", key, ErrNotScheduled)
+	}
+	e.deadline = e.deadline.Add(d)
+	heap.Fix(&s.heap, e.index)
+	deadline := e.deadline
+	s.mu.Unlock()
+
+	s.notify()
+	return deadline, nil
+}
+
+// Remove, removes a key from the scheduler. It returns false if the key was
+// not scheduled.
+func (s *Scheduler) Remove(key string) bool {
+	s.mu.Lock()
+	e, ok := s.index[key]
+	if ok {
+		heap.Remove(&s.heap, e.index)
+		delete(s.index, key)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		s.notify()
+	}
+	return ok
+}
+
+// Deadline, returns the deadline of a scheduled key.
+func (s *Scheduler) Deadline(key string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.index[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return e.deadline, true
+}
+
+// Len, returns the amount of scheduled keys.
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.heap)
+}
+
+// popExpired, removes and returns all the entries whose deadline is not after
+// now. It also returns the time until the next deadline, or -1 if no more
+// keys are scheduled.
+func (s *Scheduler) popExpired(now time.Time) ([]entry, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []entry
+	for len(s.heap) > 0 && !s.heap[0].deadline.After(now) {
+		e := heap.Pop(&s.heap).(*entry)
+		delete(s.index, e.key)
+		expired = append(expired, *e)
+	}
+	if len(s.heap) == 0 {
+		return expired, -1
+	}
+	return expired, s.heap[0].deadline.Sub(now)
+}
+
+// Run, blocks until ctx is cancelled and calls expire (sequentially, in the
+// goroutine running Run) for every key when its deadline is reached. A key is
+// removed from the scheduler before expire is called, expire can schedule the
+// key again, e.g. to retry a failed operation later.
+func (s *Scheduler) Run(ctx context.Context, expire func(key string, deadline time.Time)) {
+	for {
+		expired, next := s.popExpired(time.Now())
+		for _, e := range expired {
+			expire(e.key, e.deadline)
+		}
+		// Some keys expired, check again before waiting, since expire might
+		// have taken some time or scheduled new keys.
+		if len(expired) != 0 {
+			continue
+		}
+
+		// No keys are scheduled, wait until a key is scheduled.
+		if next < 0 {
+			select {
+			case <-s.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// Wait until the earliest deadline is reached, or until the
+		// scheduled keys change.
+		timer := time.NewTimer(next)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
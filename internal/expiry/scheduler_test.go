@@ -0,0 +1,86 @@
+package expiry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSchedulerOrder, tests that keys expire in the order of their deadlines,
+// regardless of the order in which they were scheduled, and that removed keys
+// never expire.
+func TestSchedulerOrder(t *testing.T) {
+	s := NewScheduler()
+	now := time.Now()
+	s.Schedule("third", now.Add(60*time.Millisecond))
+	s.Schedule("first", now.Add(10*time.Millisecond))
+	s.Schedule("removed", now.Add(20*time.Millisecond))
+	s.Schedule("second", now.Add(30*time.Millisecond))
+	if !s.Remove("removed") {
+		t.Fatalf("error: key 'removed' should have been scheduled")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	expiredCh := make(chan string, 4)
+	go s.Run(ctx, func(key string, deadline time.Time) {
+		if time.Now().Before(deadline) {
+			t.Errorf("error: key %s expired before its deadline", key)
+		}
+		expiredCh <- key
+	})
+
+	for _, expected := range []string{"first", "second", "third"} {
+		select {
+		case key := <-expiredCh:
+			if key != expected {
+				t.Errorf("error: key %s expired, expected %s", key, expected)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("error: key %s did not expire in time", expected)
+		}
+	}
+	if s.Len() != 0 {
+		t.Errorf("error: %d keys are still scheduled after expiring", s.Len())
+	}
+}
+
+// TestSchedulerExtend, tests that an extended key expires after its new
+// deadline, even if Run() was already waiting for the old deadline.
+func TestSchedulerExtend(t *testing.T) {
+	s := NewScheduler()
+	if _, err := s.Extend("missing", time.Second); !errors.Is(err, ErrNotScheduled) {
+		t.Errorf("error: extending a missing key returned %v, expected ErrNotScheduled", err)
+	}
+
+	start := time.Now()
+	s.Schedule("session", start.Add(20*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	expiredCh := make(chan time.Time, 1)
+	go s.Run(ctx, func(key string, deadline time.Time) {
+		expiredCh <- deadline
+	})
+
+	deadline, err := s.Extend("session", 80*time.Millisecond)
+	if err != nil {
+		t.Fatalf("error: could not extend key: %v", err)
+	}
+	if d, _ := s.Deadline("session"); !d.Equal(deadline) {
+		t.Errorf("error: Deadline() returned %v, expected %v", d, deadline)
+	}
+
+	select {
+	case d := <-expiredCh:
+		if !d.Equal(deadline) {
+			t.Errorf("error: key expired with deadline %v, expected %v", d, deadline)
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("error: extended key expired after %v, before its new deadline", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("error: extended key did not expire in time")
+	}
+}
@@ -0,0 +1,131 @@
+// logging, structured and leveled logging for pongo. Every log line is a
+// logrus entry, written as text, JSON or logfmt, and secrets are redacted
+// before a line is written.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FormatText, human-readable lines (colored if written to a terminal).
+	FormatText = "text"
+	// FormatJSON, one JSON object per line.
+	FormatJSON = "json"
+	// FormatLogfmt, 'key=value' pairs per line.
+	FormatLogfmt = "logfmt"
+)
+
+// Redacted, value which replaces a secret in the logs.
+const Redacted = "[REDACTED]"
+
+// New, returns a logger that writes to out in the given format (FormatText,
+// FormatJSON or FormatLogfmt). Debug messages are only written if debug is
+// true.
+func New(out io.Writer, format string, debug bool) (*logrus.Logger, error) {
+	var formatter logrus.Formatter
+	switch format {
+	case FormatText:
+		formatter = &logrus.TextFormatter{FullTimestamp: true}
+	case FormatJSON:
+		formatter = &logrus.JSONFormatter{}
+	case FormatLogfmt:
+		formatter = &logrus.TextFormatter{DisableColors: true, FullTimestamp: true}
+	default:
+		return nil, fmt.Errorf("error: unknown log format '%s' (valid formats: %s, %s, %s)", format, FormatText, FormatJSON, FormatLogfmt)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(out)
+	logger.SetFormatter(redactingFormatter{formatter})
+	logger.SetLevel(logrus.InfoLevel)
+	if debug {
+		logger.SetLevel(logrus.DebugLevel)
+	}
+	return logger, nil
+}
+
+// NewStdLogger, returns a *log.Logger whose every line is logged by entry at
+// the given level, so that code which logs through the standard library
+// produces structured logs too. If caller is true, the file and line from
+// which a line was logged are added as the field 'caller'.
+func NewStdLogger(entry *logrus.Entry, level logrus.Level, caller bool) *log.Logger {
+	flags := 0
+	if caller {
+		flags = log.Lshortfile
+	}
+	return log.New(levelWriter{entry: entry, level: level, caller: caller}, "", flags)
+}
+
+// levelWriter, io.Writer which logs every write as a single entry.
+type levelWriter struct {
+	entry  *logrus.Entry
+	level  logrus.Level
+	caller bool
+}
+
+// Write, implements io.Writer. *log.Logger calls Write once per line.
+func (w levelWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	entry := w.entry
+	if w.caller {
+		// Lines start with 'file.go:123: '.
+		if file, rest, ok := strings.Cut(msg, ": "); ok {
+			entry = entry.WithField("caller", file)
+			msg = rest
+		}
+	}
+	entry.Log(w.level, msg)
+	return len(p), nil
+}
+
+// sensitiveKeys, fields whose name contains any of these words hold secrets.
+var sensitiveKeys = []string{"password", "secret", "token", "auth"}
+
+// sensitiveText, secrets written as 'password: value' or 'password=value'
+// inside a message.
+var sensitiveText = regexp.MustCompile(`(?i)((?:password|secret|token)s?\s*[:=]\s*)([^\s,;]+)`)
+
+// redactingFormatter, formatter which redacts secrets before delegating to
+// another formatter.
+type redactingFormatter struct {
+	logrus.Formatter
+}
+
+// Format, implements logrus.Formatter.
+func (f redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	// Redact a copy, the entry's data could be shared with other entries.
+	redacted := *entry
+	redacted.Data = make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		if IsSensitive(key) {
+			value = Redacted
+		}
+		redacted.Data[key] = value
+	}
+	redacted.Message = RedactText(entry.Message)
+	return f.Formatter.Format(&redacted)
+}
+
+// IsSensitive, reports whether a field with the given name holds a secret.
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactText, redacts the secrets written as 'password: value' (or
+// 'password=value', 'secret: value', 'token: value') in a text.
+func RedactText(text string) string {
+	return sensitiveText.ReplaceAllString(text, "${1}"+Redacted)
+}
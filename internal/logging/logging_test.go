@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestFormats, tests that every format writes structured, leveled lines.
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{FormatJSON, []string{`"level":"info"`, `"msg":"session created"`, `"session":"abc"`}},
+		{FormatLogfmt, []string{"level=info", `msg="session created"`, "session=abc"}},
+		{FormatText, []string{"level=info", "session=abc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			logger, err := New(buf, tt.format, false)
+			if err != nil {
+				t.Fatalf("error: could not create logger: %v", err)
+			}
+			logger.WithField("session", "abc").Info("session created")
+			logger.Debug("debug message")
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("error: log line %q does not contain %q", buf.String(), want)
+				}
+			}
+			if strings.Contains(buf.String(), "debug message") {
+				t.Errorf("error: debug message logged without debug mode")
+			}
+		})
+	}
+
+	if _, err := New(new(bytes.Buffer), "xml", false); err == nil {
+		t.Errorf("error: unknown format was accepted")
+	}
+}
+
+// TestRedaction, tests that secrets are redacted from fields and messages.
+func TestRedaction(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger, err := New(buf, FormatJSON, false)
+	if err != nil {
+		t.Fatalf("error: could not create logger: %v", err)
+	}
+	logger.WithFields(logrus.Fields{"username": "user1", "password": "hunter2", "registryAuthToken": "t0k3n"}).Info("new user with Password: hunter2, secret=s3cr3t")
+
+	var line map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("error: log line is not JSON: %v", err)
+	}
+	for _, secret := range []string{"hunter2", "t0k3n", "s3cr3t"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("error: secret %q was logged: %s", secret, buf.String())
+		}
+	}
+	if line["username"] != "user1" || line["password"] != Redacted {
+		t.Errorf("error: unexpected fields: %v", line)
+	}
+	if line["msg"] != "new user with Password: "+Redacted+", secret="+Redacted {
+		t.Errorf("error: unexpected message: %s", line["msg"])
+	}
+}
+
+// TestStdLogger, tests that lines logged through a *log.Logger become entries
+// with the level and fields of the logger.
+func TestStdLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger, err := New(buf, FormatJSON, false)
+	if err != nil {
+		t.Fatalf("error: could not create logger: %v", err)
+	}
+	errorLog := NewStdLogger(logger.WithField("component", "test"), logrus.ErrorLevel, true)
+	errorLog.Printf("unable to stop session: %v", "timeout")
+
+	var line map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("error: log line is not JSON: %v", err)
+	}
+	if line["level"] != "error" || line["msg"] != "unable to stop session: timeout" || line["component"] != "test" {
+		t.Errorf("error: unexpected entry: %v", line)
+	}
+	if !strings.HasPrefix(line["caller"], "logging_test.go:") {
+		t.Errorf("error: caller is %q, expected logging_test.go:<line>", line["caller"])
+	}
+}
+
+// TestRequestID, tests that request IDs are carried by contexts.
+func TestRequestID(t *testing.T) {
+	id := NewRequestID()
+	if len(id) != 16 || id == NewRequestID() {
+		t.Errorf("error: request IDs are not random 16 characters IDs: %s", id)
+	}
+	ctx := WithRequestID(context.Background(), id)
+	if RequestID(ctx) != id || RequestID(context.Background()) != "" {
+		t.Errorf("error: request ID was not carried by the context")
+	}
+}
@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// RequestIDHeader, HTTP header in which the ID of a request is sent back to
+// the client (and accepted from a trusted reverse proxy).
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey, key of the request ID in a context.
+type requestIDKey struct{}
+
+// NewRequestID, returns a random ID for a request.
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// Fall back to a time-based ID, IDs only correlate log lines.
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID, returns a copy of ctx which carries a request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID, returns the request ID carried by ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
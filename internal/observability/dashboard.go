@@ -0,0 +1,289 @@
+package observability
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/erodrigufer/pongo/internal/prometheus"
+)
+
+// rowOther, title of the row with the metrics which do not belong to any row
+// in dashboardRows.
+const rowOther = "Other"
+
+// dashboardRows, rows of the dashboard, in the order in which they are shown.
+// A metric is shown in the first row with a prefix of its name.
+var dashboardRows = []struct {
+	title    string
+	prefixes []string
+}{
+	{
+		title:    "Sessions",
+		prefixes: []string{"active_sessions_", "available_sessions_", "session_request", "session_creation_", "session_terminations_", "session_lifetime_"},
+	},
+	{
+		title:    "HTTP",
+		prefixes: []string{"http_"},
+	},
+	{
+		title:    "Container engines",
+		prefixes: []string{"docker_api_"},
+	},
+	{
+		title:    "Health checks",
+		prefixes: []string{"health_check_"},
+	},
+	{
+		title:    "Resource usage of the sessions",
+		prefixes: []string{"session_cpu_", "session_memory_", "session_network_", "session_pids", "session_alert"},
+	},
+}
+
+// panelWidth and panelHeight, size of a panel in the grid of Grafana (which
+// is 24 units wide). Two panels are shown side by side.
+const (
+	panelWidth  = 12
+	panelHeight = 8
+)
+
+// quantiles, quantiles shown in the panel of a histogram.
+var quantiles = []struct {
+	quantile string
+	name     string
+}{
+	{quantile: "0.5", name: "p50"},
+	{quantile: "0.95", name: "p95"},
+}
+
+// datasource, data source of every panel: the Prometheus data source chosen
+// in the variable 'datasource' of the dashboard.
+var datasource = map[string]string{"type": "prometheus", "uid": "${datasource}"}
+
+type dashboard struct {
+	UID           string     `json:"uid"`
+	Title         string     `json:"title"`
+	Description   string     `json:"description"`
+	Tags          []string   `json:"tags"`
+	Editable      bool       `json:"editable"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Version       int        `json:"version"`
+	Refresh       string     `json:"refresh"`
+	Time          timeRange  `json:"time"`
+	Templating    templating `json:"templating"`
+	Panels        []panel    `json:"panels"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type templating struct {
+	List []variable `json:"list"`
+}
+
+type variable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+type panel struct {
+	ID          int               `json:"id"`
+	Type        string            `json:"type"`
+	Title       string            `json:"title"`
+	Description string            `json:"description,omitempty"`
+	GridPos     gridPos           `json:"gridPos"`
+	Datasource  map[string]string `json:"datasource,omitempty"`
+	FieldConfig *fieldConfig      `json:"fieldConfig,omitempty"`
+	Targets     []target          `json:"targets,omitempty"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type fieldConfig struct {
+	Defaults fieldDefaults `json:"defaults"`
+}
+
+type fieldDefaults struct {
+	Unit string `json:"unit"`
+}
+
+type target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+}
+
+// Dashboard, returns a Grafana dashboard (JSON) with a panel for every metric
+// in defs, grouped in rows. Counters are shown as a rate, histograms as their
+// 50th and 95th percentiles and gauges as they are.
+func Dashboard(defs []prometheus.Definition) ([]byte, error) {
+	rows := make(map[string][]prometheus.Definition)
+	for _, def := range defs {
+		title := rowOf(def.Name)
+		rows[title] = append(rows[title], def)
+	}
+
+	var panels []panel
+	y := 0
+	titles := make([]string, 0, len(dashboardRows)+1)
+	for _, row := range dashboardRows {
+		titles = append(titles, row.title)
+	}
+	titles = append(titles, rowOther)
+	for _, title := range titles {
+		if len(rows[title]) == 0 {
+			continue
+		}
+		panels = append(panels, panel{
+			ID:      len(panels) + 1,
+			Type:    "row",
+			Title:   title,
+			GridPos: gridPos{H: 1, W: 24, X: 0, Y: y},
+		})
+		y++
+		for i, def := range rows[title] {
+			p, err := metricPanel(def)
+			if err != nil {
+				return nil, err
+			}
+			p.ID = len(panels) + 1
+			p.GridPos = gridPos{H: panelHeight, W: panelWidth, X: (i % 2) * panelWidth, Y: y + (i/2)*panelHeight}
+			panels = append(panels, p)
+		}
+		y += (len(rows[title]) + 1) / 2 * panelHeight
+	}
+
+	d := dashboard{
+		UID:           "pongo",
+		Title:         "pongo",
+		Description:   "Sessions, HTTP requests, container engines and health checks of pongo. Generated by 'pongo observability export'.",
+		Tags:          []string{"pongo"},
+		Editable:      true,
+		SchemaVersion: 36,
+		Version:       1,
+		Refresh:       "30s",
+		Time:          timeRange{From: "now-6h", To: "now"},
+		Templating: templating{List: []variable{{
+			Name:  "datasource",
+			Label: "Data source",
+			Type:  "datasource",
+			Query: "prometheus",
+		}}},
+		Panels: panels,
+	}
+	out, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding the dashboard: %w", err)
+	}
+	return append(out, '\n'), nil
+}
+
+// rowOf, returns the title of the row of the metric name.
+func rowOf(name string) string {
+	for _, row := range dashboardRows {
+		for _, prefix := range row.prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return row.title
+			}
+		}
+	}
+	return rowOther
+}
+
+// metricPanel, returns the panel of a metric (without its ID and position).
+func metricPanel(def prometheus.Definition) (panel, error) {
+	legend := legendFormat(def.Labels)
+	p := panel{
+		Type:        "timeseries",
+		Title:       def.Name,
+		Description: def.Description,
+		Datasource:  datasource,
+	}
+	unit := unitOf(def.Name)
+	switch def.Type {
+	case prometheus.TypeCounter:
+		if unit == "" {
+			unit = "reqps"
+			if !strings.HasPrefix(def.Name, "http_") {
+				unit = "ops"
+			}
+		}
+		p.Targets = []target{{
+			RefID:        "A",
+			Expr:         fmt.Sprintf("sum%s (rate(%s[$__rate_interval]))", by(def.Labels), def.Name),
+			LegendFormat: legendOr(legend, def.Name),
+		}}
+	case prometheus.TypeGauge:
+		p.Targets = []target{{
+			RefID:        "A",
+			Expr:         def.Name,
+			LegendFormat: legendOr(legend, def.Name),
+		}}
+	case prometheus.TypeHistogram:
+		labels := append([]string{"le"}, def.Labels...)
+		for i, q := range quantiles {
+			p.Targets = append(p.Targets, target{
+				RefID:        string(rune('A' + i)),
+				Expr:         fmt.Sprintf("histogram_quantile(%s, sum%s (rate(%s_bucket[$__rate_interval])))", q.quantile, by(labels), def.Name),
+				LegendFormat: strings.TrimSpace(q.name + " " + legend),
+			})
+		}
+	default:
+		return p, fmt.Errorf("error: metric %s has an unknown type '%s'", def.Name, def.Type)
+	}
+	if unit != "" {
+		p.FieldConfig = &fieldConfig{Defaults: fieldDefaults{Unit: unit}}
+	}
+	return p, nil
+}
+
+// unitOf, returns the Grafana unit of a metric from the suffix of its name,
+// or "" if the unit is not known.
+func unitOf(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_bytes_per_second"):
+		return "Bps"
+	case strings.HasSuffix(name, "_seconds"):
+		return "s"
+	case strings.HasSuffix(name, "_bytes"):
+		return "bytes"
+	case strings.HasSuffix(name, "_percent"):
+		return "percent"
+	}
+	return ""
+}
+
+// by, returns the 'by' clause of an aggregation over labels.
+func by(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return " by (" + strings.Join(labels, ", ") + ")"
+}
+
+// legendFormat, returns the legend of a series with labels, e.g.
+// '{{operation}} {{engine}}'.
+func legendFormat(labels []string) string {
+	legend := make([]string, len(labels))
+	for i, label := range labels {
+		legend[i] = "{{" + label + "}}"
+	}
+	return strings.Join(legend, " ")
+}
+
+// legendOr, returns legend, or name if legend is empty.
+func legendOr(legend, name string) string {
+	if legend == "" {
+		return name
+	}
+	return legend
+}
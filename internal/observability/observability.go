@@ -0,0 +1,18 @@
+// observability, generates a Grafana dashboard and Prometheus alerting rules
+// from the definitions of the metrics exported by pongo, so that both stay in
+// sync with the metrics actually exported.
+package observability
+
+//go:generate go run ../../cmd/pongo observability export --dashboard ../../Grafana/pongo-dashboard.json --rules ../../Prometheus/pongo.rules.yml
+
+import "github.com/erodrigufer/pongo/internal/prometheus"
+
+// exported, reports whether the metric name is in defs.
+func exported(defs []prometheus.Definition, name string) bool {
+	for _, def := range defs {
+		if def.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package observability
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/erodrigufer/pongo/internal/prometheus"
+)
+
+// TestGeneratedFiles, tests that the dashboard and the alerting rules in the
+// repository match the metrics exported by pongo.
+func TestGeneratedFiles(t *testing.T) {
+	defs := prometheus.Definitions()
+	dashboard, err := Dashboard(defs)
+	if err != nil {
+		t.Fatalf("error: could not generate dashboard: %v", err)
+	}
+	rules, err := Rules(defs)
+	if err != nil {
+		t.Fatalf("error: could not generate alerting rules: %v", err)
+	}
+	files := map[string][]byte{
+		"../../Grafana/pongo-dashboard.json": dashboard,
+		"../../Prometheus/pongo.rules.yml":   rules,
+	}
+	for path, want := range files {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("error: could not read %s: %v", path, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("error: %s is out of date, run 'go generate ./internal/observability'", path)
+		}
+	}
+}
+
+// TestDashboardPanels, tests that the dashboard has a panel for every metric.
+func TestDashboardPanels(t *testing.T) {
+	defs := prometheus.Definitions()
+	out, err := Dashboard(defs)
+	if err != nil {
+		t.Fatalf("error: could not generate dashboard: %v", err)
+	}
+	var d dashboard
+	if err := json.Unmarshal(out, &d); err != nil {
+		t.Fatalf("error: dashboard is not valid JSON: %v", err)
+	}
+	panels := make(map[string]panel)
+	for _, p := range d.Panels {
+		panels[p.Title] = p
+	}
+	for _, def := range defs {
+		p, ok := panels[def.Name]
+		if !ok {
+			t.Errorf("error: no panel for metric %s", def.Name)
+			continue
+		}
+		for _, target := range p.Targets {
+			if !strings.Contains(target.Expr, def.Name) {
+				t.Errorf("error: query '%s' of panel %s does not query its metric", target.Expr, def.Name)
+			}
+		}
+	}
+
+	if _, err := Dashboard([]prometheus.Definition{{Name: "x", Type: "summary"}}); err == nil {
+		t.Error("error: dashboard generated for a metric with an unknown type")
+	}
+}
+
+// TestRulesMissingMetric, tests that the alerting rules are not generated if
+// they query a metric which is not exported.
+func TestRulesMissingMetric(t *testing.T) {
+	var defs []prometheus.Definition
+	for _, def := range prometheus.Definitions() {
+		if def.Name != "health_check_status" {
+			defs = append(defs, def)
+		}
+	}
+	if _, err := Rules(defs); err == nil {
+		t.Error("error: alerting rules generated without the metric health_check_status")
+	}
+}
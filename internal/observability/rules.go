@@ -0,0 +1,123 @@
+package observability
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/erodrigufer/pongo/internal/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+// rulesHeader, first line of the generated alerting rules.
+const rulesHeader = "# Code generated by 'pongo observability export'. DO NOT EDIT.\n"
+
+// alerts, alerting rules of pongo.
+var alerts = []struct {
+	// name, of the alert.
+	name string
+	// metrics, metrics queried by expr. The rules cannot be generated if any
+	// of them is not exported by pongo.
+	metrics []string
+	// expr, PromQL expression of the alert.
+	expr string
+	// duration, for which expr must hold before the alert fires.
+	duration string
+	// severity, of the alert (warning or critical).
+	severity    string
+	summary     string
+	description string
+}{
+	{
+		name:        "PongoSessionPoolEmpty",
+		metrics:     []string{"available_sessions_total"},
+		expr:        "available_sessions_total == 0",
+		duration:    "5m",
+		severity:    "critical",
+		summary:     "No sessions are available.",
+		description: "pongo has had no available sessions for 5 minutes, participants cannot get a session. Check session_creation_failures_total and the container engines.",
+	},
+	{
+		name:    "PongoSessionCreationFailing",
+		metrics: []string{"session_creation_failures_total", "session_creation_duration_seconds"},
+		expr: "sum(rate(session_creation_failures_total[10m]))\n" +
+			"  / (sum(rate(session_creation_failures_total[10m])) + sum(rate(session_creation_duration_seconds_count[10m])))\n" +
+			"  > 0.1",
+		duration:    "10m",
+		severity:    "warning",
+		summary:     "More than 10% of the sessions cannot be created.",
+		description: "{{ $value | humanizePercentage }} of the sessions could not be created in the last 10 minutes. The failing step is the reason label of session_creation_failures_total.",
+	},
+	{
+		name:        "PongoHealthCheckFailing",
+		metrics:     []string{"health_check_status"},
+		expr:        "health_check_status == 0",
+		duration:    "1m",
+		severity:    "critical",
+		summary:     "Health check '{{ $labels.check }}' is failing.",
+		description: "The last run of the health check '{{ $labels.check }}' performed by monitord failed. Its diagnostics are shown at /healthcheck.",
+	},
+	{
+		name:    "PongoHighRateOfTooManyRequests",
+		metrics: []string{"http_requests_total"},
+		expr: "sum(rate(http_requests_total{status_code=\"429\"}[5m]))\n" +
+			"  / sum(rate(http_requests_total[5m]))\n" +
+			"  > 0.25",
+		duration:    "10m",
+		severity:    "warning",
+		summary:     "More than 25% of the HTTP requests are answered with 429 Too Many Requests.",
+		description: "{{ $value | humanizePercentage }} of the HTTP requests were rejected with 429 in the last 5 minutes. Participants may be retrying too often or --timeReq may be too long.",
+	},
+}
+
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// Rules, returns the Prometheus alerting rules (YAML) of pongo. An error is
+// returned if a rule queries a metric which is not in defs, e.g. because the
+// metric was renamed.
+func Rules(defs []prometheus.Definition) ([]byte, error) {
+	group := ruleGroup{Name: "pongo"}
+	for _, a := range alerts {
+		for _, name := range a.metrics {
+			if !exported(defs, name) {
+				return nil, fmt.Errorf("error generating alert %s: metric %s is not exported by pongo", a.name, name)
+			}
+		}
+		group.Rules = append(group.Rules, rule{
+			Alert:  a.name,
+			Expr:   a.expr,
+			For:    a.duration,
+			Labels: map[string]string{"severity": a.severity},
+			Annotations: map[string]string{
+				"summary":     a.summary,
+				"description": a.description,
+			},
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(rulesHeader)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(ruleFile{Groups: []ruleGroup{group}}); err != nil {
+		return nil, fmt.Errorf("error encoding the alerting rules: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("error encoding the alerting rules: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,248 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/erodrigufer/pongo/internal/audit"
+	"github.com/spf13/cobra"
+)
+
+// newAuditCmd, returns the parent command of all commands used to inspect the
+// audit log.
+func newAuditCmd() *cobra.Command {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Query, export and verify the audit log of the sessions.",
+		Long:  fmt.Sprintf("Query, export and verify the append-only audit log in which %s records the lifecycle events of the sessions (created, delivered, SSH login, extended, expired, terminated, flag submitted and admin actions). Every record carries the hash of the previous record, keyed with a secret key kept outside the log, so that tampering with the log is detected.", executableName),
+	}
+	auditCmd.PersistentFlags().String("file", audit.DefaultPath, "Path of the audit log.")
+	auditCmd.PersistentFlags().String("key", audit.DefaultKeyPath, "Path of the file with the secret key of the audit log, with which its hashes are verified.")
+	auditCmd.AddCommand(newAuditQueryCmd())
+	auditCmd.AddCommand(newAuditExportCmd())
+	auditCmd.AddCommand(newAuditVerifyCmd())
+	return auditCmd
+}
+
+// configureAuditCmd, adds the audit command (and its children commands) as a
+// child command of root command.
+func configureAuditCmd(parentCmd *cobra.Command) {
+	parentCmd.AddCommand(newAuditCmd())
+}
+
+// auditFilterFlags, flags of the commands that select records of the audit
+// log.
+type auditFilterFlags struct {
+	session, identity, container, event string
+	since, until                        string
+}
+
+// add, adds the flags to cmd.
+func (f *auditFilterFlags) add(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.session, "session", "", "Only records of the session with this name or SSH username.")
+	cmd.Flags().StringVar(&f.identity, "identity", "", "Only records of the participant with this identity (IP address).")
+	cmd.Flags().StringVar(&f.container, "container", "", "Only records of the session which owned the container with this ID (or ID prefix).")
+	cmd.Flags().StringVar(&f.event, "event", "", "Only records of this type of event, e.g. 'session.delivered'.")
+	cmd.Flags().StringVar(&f.since, "since", "", "Only records at or after this time (RFC 3339, e.g. '2023-01-02T15:04:05Z').")
+	cmd.Flags().StringVar(&f.until, "until", "", "Only records at or before this time (RFC 3339).")
+}
+
+// filter, returns the filter described by the flags.
+func (f *auditFilterFlags) filter() (audit.Filter, error) {
+	filter := audit.Filter{
+		Session:   f.session,
+		Identity:  f.identity,
+		Container: f.container,
+		Event:     f.event,
+	}
+	var err error
+	if f.since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, f.since); err != nil {
+			return filter, fmt.Errorf("error: invalid time for --since: %w", err)
+		}
+	}
+	if f.until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, f.until); err != nil {
+			return filter, fmt.Errorf("error: invalid time for --until: %w", err)
+		}
+	}
+	return filter, nil
+}
+
+// queryAuditLog, returns the records of the audit log of cmd selected by the
+// filter flags.
+func queryAuditLog(cmd *cobra.Command, flags *auditFilterFlags) ([]audit.Record, error) {
+	filter, err := flags.filter()
+	if err != nil {
+		return nil, err
+	}
+	f, key, err := openAuditLog(cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return audit.Query(f, key, filter)
+}
+
+// openAuditLog, opens the audit log of cmd and reads its key.
+func openAuditLog(cmd *cobra.Command) (*os.File, []byte, error) {
+	keyPath, err := cmd.Flags().GetString("key")
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := audit.ReadKey(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	path, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening audit log: %w", err)
+	}
+	return f, key, nil
+}
+
+// newAuditQueryCmd, returns the command that prints the records of the audit
+// log in a human-readable form.
+func newAuditQueryCmd() *cobra.Command {
+	flags := new(auditFilterFlags)
+	queryCmd := &cobra.Command{
+		Use:   "query",
+		Short: "Print the records of the audit log, e.g. who had which session when.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			records, err := queryAuditLog(cmd, flags)
+			// Print the records read before the log turned out to be
+			// tampered with, then fail.
+			printAuditRecords(cmd.OutOrStdout(), records)
+			return err
+		},
+	}
+	flags.add(queryCmd)
+	return queryCmd
+}
+
+// printAuditRecords, prints one line per record.
+func printAuditRecords(out io.Writer, records []audit.Record) {
+	for _, r := range records {
+		fmt.Fprintf(out, "%6d  %s  %-18s  session=%s", r.Seq, r.Time.Format(time.RFC3339), r.Event, r.Session)
+		if r.Identity != "" {
+			fmt.Fprintf(out, " identity=%s", r.Identity)
+		}
+		if r.Username != "" {
+			fmt.Fprintf(out, " username=%s", r.Username)
+		}
+		if r.Challenge != "" {
+			fmt.Fprintf(out, " challenge=%s", r.Challenge)
+		}
+		if r.Engine != "" {
+			fmt.Fprintf(out, " engine=%s", r.Engine)
+		}
+		if len(r.Containers) > 0 {
+			fmt.Fprintf(out, " containers=%s", strings.Join(shortIDs(r.Containers), ","))
+		}
+		if r.Actor != "" {
+			fmt.Fprintf(out, " actor=%s", r.Actor)
+		}
+		for _, key := range sortedKeys(r.Details) {
+			fmt.Fprintf(out, " %s=%s", key, r.Details[key])
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+// shortIDs, returns the first 12 characters of every container ID, like the
+// Docker CLI does.
+func shortIDs(ids []string) []string {
+	short := make([]string, len(ids))
+	for i, id := range ids {
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		short[i] = id
+	}
+	return short
+}
+
+// newAuditExportCmd, returns the command that exports the records of the
+// audit log as JSON Lines.
+func newAuditExportCmd() *cobra.Command {
+	flags := new(auditFilterFlags)
+	var output string
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the records of the audit log as JSON Lines.",
+		Long:  "Export the records of the audit log as JSON Lines (one JSON object per line), e.g. to import them into a SIEM. The records keep their hashes, but a filtered export cannot be verified as a chain.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			records, err := queryAuditLog(cmd, flags)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if output != "" {
+				f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+				if err != nil {
+					return fmt.Errorf("error creating export file: %w", err)
+				}
+				defer f.Close()
+				out = f
+			}
+			encoder := json.NewEncoder(out)
+			for _, r := range records {
+				if err := encoder.Encode(r); err != nil {
+					return fmt.Errorf("error exporting audit record: %w", err)
+				}
+			}
+			return nil
+		},
+	}
+	flags.add(exportCmd)
+	exportCmd.Flags().StringVarP(&output, "output", "o", "", "File to which the records are exported (stdout if empty).")
+	return exportCmd
+}
+
+// newAuditVerifyCmd, returns the command that verifies the chain of hashes of
+// the audit log.
+func newAuditVerifyCmd() *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify that the audit log was not tampered with.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, key, err := openAuditLog(cmd)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			var last audit.Record
+			if err := audit.Scan(f, key, func(r audit.Record) error {
+				last = r
+				return nil
+			}); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "The audit log %s is intact: %d records, last hash %s.\n", f.Name(), last.Seq, last.Hash)
+			return nil
+		},
+	}
+	return verifyCmd
+}
+
+// sortedKeys, returns the keys of a map in alphabetical order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
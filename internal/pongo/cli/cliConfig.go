@@ -12,6 +12,9 @@ func configCLI(app Application) error {
 		return fmt.Errorf("error configuring Run command: %w", err)
 	}
 	configureRevisionCmd(rootCmd)
+	configureImageCmd(rootCmd)
+	configureAuditCmd(rootCmd)
+	configureObservabilityCmd(rootCmd)
 
 	return nil
 }
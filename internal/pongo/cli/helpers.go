@@ -2,6 +2,7 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -19,3 +20,15 @@ func bindFlag(cmd *cobra.Command, viperKey, flagKey string) error {
 
 	return nil
 }
+
+// splitList, splits a comma-separated list of values (e.g. the value of a
+// flag) into its elements. Empty elements are ignored.
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
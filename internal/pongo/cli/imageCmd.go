@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/erodrigufer/pongo/internal/backend"
+	dockerBuild "github.com/erodrigufer/pongo/internal/docker/build"
+	dockerImage "github.com/erodrigufer/pongo/internal/docker/image"
+	"github.com/spf13/cobra"
+)
+
+// newImageCmd, returns the parent command of all commands used to manage
+// challenge images.
+func newImageCmd() *cobra.Command {
+	imageCmd := &cobra.Command{
+		Use:   "image",
+		Short: "Build, test and inspect challenge images.",
+		Long:  fmt.Sprintf("Build, test and inspect the Docker images used by %s for the sessions (challenge images), without starting the daemon. The commands can be used in CI pipelines to validate challenge images before an event.", executableName),
+	}
+	imageCmd.AddCommand(newImageBuildCmd())
+	imageCmd.AddCommand(newImageTestCmd())
+	imageCmd.AddCommand(newImageInspectCmd())
+	return imageCmd
+}
+
+// configureImageCmd, adds the image command (and its children commands) as a
+// child command of root command.
+func configureImageCmd(parentCmd *cobra.Command) {
+	parentCmd.AddCommand(newImageCmd())
+}
+
+// newDockerClient, initializes a client that communicates with the Docker
+// daemon (or Podman), whose API socket is discovered like in the run command.
+// The client is configured through the usual Docker env. variables.
+func newDockerClient() (*client.Client, error) {
+	endpoint, err := backend.Discover(backend.EngineAuto, "")
+	if err != nil {
+		return nil, err
+	}
+	return backend.NewClient(endpoint)
+}
+
+// newImageBuildCmd, returns the command that builds a challenge image from a
+// build context.
+func newImageBuildCmd() *cobra.Command {
+	var name, logFile string
+	var timeout time.Duration
+	var verbose bool
+
+	buildCmd := &cobra.Command{
+		Use:   "build <build context>",
+		Short: "Build a challenge image from a build context.",
+		Long:  fmt.Sprintf("Build a challenge image from a build context (a directory with a Dockerfile). The image is labeled with the hash of its build context, so that '%s run' does not rebuild it if the build context did not change.", executableName),
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+			defer dockerClient.Close()
+
+			hash, err := dockerImage.ContextHash(args[0])
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			options := dockerBuild.Options{
+				Labels:  map[string]string{dockerImage.ContextHashLabel: hash},
+				Timeout: timeout,
+				LogFile: logFile,
+				OnEvent: func(event dockerBuild.Event) {
+					printBuildEvent(out, event, verbose)
+				},
+			}
+			if err := dockerBuild.ImageBuildWithOptions(cmd.Context(), dockerClient, args[0], name, options); err != nil {
+				return err
+			}
+
+			resolved, err := dockerImage.Inspect(cmd.Context(), dockerClient, name)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Built image %s (%s).\n", resolved.Name, resolved.ID)
+			return nil
+		},
+	}
+	buildCmd.Flags().StringVar(&name, "name", "entrypoint", "Name of the built image.")
+	buildCmd.Flags().StringVar(&logFile, "log", "", "File in which the full output of the build is saved.")
+	buildCmd.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "Max. time the build can take.")
+	buildCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Print the output of every step and the progress of every layer.")
+	return buildCmd
+}
+
+// printBuildEvent, prints an event of a build. Only steps and errors are
+// printed, unless verbose is true.
+func printBuildEvent(out io.Writer, event dockerBuild.Event, verbose bool) {
+	switch event.Kind {
+	case dockerBuild.EventStep:
+		fmt.Fprintln(out, event.Message)
+	case dockerBuild.EventError:
+		fmt.Fprintf(out, "ERROR: %s\n", event.Message)
+	case dockerBuild.EventProgress:
+		if verbose {
+			fmt.Fprintf(out, "  %s %s: %d/%d\n", event.Layer, event.Message, event.Current, event.Total)
+		}
+	case dockerBuild.EventLayer:
+		if verbose {
+			fmt.Fprintf(out, "  %s %s\n", event.Layer, strings.TrimSpace(event.Message))
+		}
+	default:
+		if verbose {
+			fmt.Fprintf(out, "  %s\n", event.Message)
+		}
+	}
+}
+
+// newImageTestCmd, returns the command that validates a challenge image.
+func newImageTestCmd() *cobra.Command {
+	var binaries []string
+	var sshTimeout time.Duration
+
+	testCmd := &cobra.Command{
+		Use:   "test <image>",
+		Short: "Validate that a challenge image can be used for sessions.",
+		Long:  "Start a throwaway container out of a challenge image, create a user in it the same way it is done for every session, verify that sshd answers and that the required binaries exist. The container is removed afterwards. The command fails if any check fails.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+			defer dockerClient.Close()
+
+			results := dockerImage.Check(cmd.Context(), dockerClient, dockerImage.CheckOptions{
+				Image:      args[0],
+				Binaries:   binaries,
+				SSHTimeout: sshTimeout,
+			})
+
+			out := cmd.OutOrStdout()
+			failed := 0
+			for _, result := range results {
+				status := "PASS"
+				if !result.Pass {
+					status = "FAIL"
+					failed++
+				}
+				fmt.Fprintf(out, "[%s] %s", status, result.Name)
+				if result.Details != "" {
+					fmt.Fprintf(out, ": %s", result.Details)
+				}
+				fmt.Fprintln(out)
+			}
+			if failed > 0 {
+				return fmt.Errorf("error: %d of %d checks failed for image %s", failed, len(results), args[0])
+			}
+			fmt.Fprintf(out, "All %d checks passed for image %s.\n", len(results), args[0])
+			return nil
+		},
+	}
+	testCmd.Flags().StringSliceVar(&binaries, "binary", dockerImage.DefaultBinaries, "Binaries that have to exist in the image (can be repeated or comma-separated).")
+	testCmd.Flags().DurationVar(&sshTimeout, "sshTimeout", 30*time.Second, "Max. time to wait for sshd to answer after the container started.")
+	return testCmd
+}
+
+// newImageInspectCmd, returns the command that shows the details of an
+// image, e.g. its digest and the hash of the build context it was built from.
+func newImageInspectCmd() *cobra.Command {
+	inspectCmd := &cobra.Command{
+		Use:   "inspect <image>",
+		Short: "Show the digest and build details of a challenge image.",
+		Long:  "Show the ID, digest, tags and the hash of the build context of a challenge image available in the Docker host.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+			defer dockerClient.Close()
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+			defer cancel()
+			resolved, err := dockerImage.Inspect(ctx, dockerClient, args[0])
+			if err != nil {
+				return err
+			}
+			inspect, _, err := dockerClient.ImageInspectWithRaw(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("error: unable to inspect image %s: %w", args[0], err)
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Name:         %s\n", resolved.Name)
+			fmt.Fprintf(out, "ID:           %s\n", resolved.ID)
+			fmt.Fprintf(out, "Digest:       %s\n", resolved.Digest)
+			fmt.Fprintf(out, "Tags:         %s\n", strings.Join(inspect.RepoTags, ", "))
+			fmt.Fprintf(out, "Created:      %s\n", inspect.Created)
+			fmt.Fprintf(out, "Size:         %.1f MB\n", float64(inspect.Size)/(1024*1024))
+			contextHash := "-"
+			if inspect.Config != nil && inspect.Config.Labels[dockerImage.ContextHashLabel] != "" {
+				contextHash = inspect.Config.Labels[dockerImage.ContextHashLabel]
+			}
+			fmt.Fprintf(out, "Context hash: %s\n", contextHash)
+			return nil
+		},
+	}
+	return inspectCmd
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	dockerBuild "github.com/erodrigufer/pongo/internal/docker/build"
+)
+
+// TestPrintBuildEvent, tests that only the steps and errors of a build are
+// printed, unless the output is verbose.
+func TestPrintBuildEvent(t *testing.T) {
+	events := []dockerBuild.Event{
+		{Kind: dockerBuild.EventStep, Message: "Step 1/2 : FROM alpine"},
+		{Kind: dockerBuild.EventLayer, Layer: "abc123", Message: "Pull complete\n"},
+		{Kind: dockerBuild.EventProgress, Layer: "abc123", Message: "Downloading", Current: 10, Total: 20},
+		{Kind: dockerBuild.EventOutput, Message: "fetch https://dl-cdn.alpinelinux.org"},
+		{Kind: dockerBuild.EventError, Message: "command not found"},
+	}
+	tests := []struct {
+		name     string
+		verbose  bool
+		expected string
+	}{
+		{"quiet", false, "Step 1/2 : FROM alpine\nERROR: command not found\n"},
+		{"verbose", true, "Step 1/2 : FROM alpine\n  abc123 Pull complete\n  abc123 Downloading: 10/20\n  fetch https://dl-cdn.alpinelinux.org\nERROR: command not found\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			for _, event := range events {
+				printBuildEvent(&out, event, tt.verbose)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("error: printed\n%q\nexpected\n%q", out.String(), tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/erodrigufer/pongo/internal/observability"
+	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
+	"github.com/spf13/cobra"
+)
+
+// newObservabilityCmd, returns the parent command of all commands related to
+// the monitoring of pongo.
+func newObservabilityCmd() *cobra.Command {
+	observabilityCmd := &cobra.Command{
+		Use:   "observability",
+		Short: "Generate the dashboards and alerting rules for the metrics.",
+		Long:  fmt.Sprintf("Generate the Grafana dashboard and the Prometheus alerting rules for the metrics exported by %s.", executableName),
+	}
+	observabilityCmd.AddCommand(newObservabilityExportCmd())
+	return observabilityCmd
+}
+
+// configureObservabilityCmd, adds the observability command (and its children
+// commands) as a child command of root command.
+func configureObservabilityCmd(parentCmd *cobra.Command) {
+	parentCmd.AddCommand(newObservabilityCmd())
+}
+
+// newObservabilityExportCmd, returns the command that writes the Grafana
+// dashboard and the Prometheus alerting rules.
+func newObservabilityExportCmd() *cobra.Command {
+	var dashboardPath, rulesPath string
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write the Grafana dashboard and the Prometheus alerting rules.",
+		Long:  fmt.Sprintf("Write a Grafana dashboard (JSON) with a panel for every metric exported by %s and the Prometheus alerting rules (YAML) for an empty session pool, failing session creations, failing health checks and a high rate of 429 responses. Both are generated from the definitions of the metrics, so they match the metrics of this binary. Use '-' as path to write to stdout.", executableName),
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defs := prometheus.Definitions()
+			dashboard, err := observability.Dashboard(defs)
+			if err != nil {
+				return err
+			}
+			rules, err := observability.Rules(defs)
+			if err != nil {
+				return err
+			}
+			if err := writeOutput(cmd, dashboardPath, dashboard); err != nil {
+				return err
+			}
+			return writeOutput(cmd, rulesPath, rules)
+		},
+	}
+	exportCmd.Flags().StringVar(&dashboardPath, "dashboard", "pongo-dashboard.json", "Path of the Grafana dashboard.")
+	exportCmd.Flags().StringVar(&rulesPath, "rules", "pongo.rules.yml", "Path of the Prometheus alerting rules.")
+	return exportCmd
+}
+
+// writeOutput, writes content to the file at path, or to the output of cmd if
+// path is '-'.
+func writeOutput(cmd *cobra.Command, path string, content []byte) error {
+	if path == "-" {
+		_, err := cmd.OutOrStdout().Write(content)
+		return err
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
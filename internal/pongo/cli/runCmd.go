@@ -3,7 +3,9 @@ package cli
 import (
 	"fmt"
 
+	"github.com/erodrigufer/pongo/internal/audit"
 	"github.com/erodrigufer/pongo/internal/pongo"
+	prometheus "github.com/erodrigufer/pongo/internal/prometheus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -12,15 +14,73 @@ import (
 // If a user does not set a key with either a flag or an env. variable, the
 // value for that key will default to the value defined in this map.
 var defaultValues = map[string]interface{}{
-	"NoInstrumentation": false,
-	"SSH":               "50000",
-	"HTTP":              ":4000",
-	"MaxAvailableSess":  15,
-	"MaxActiveSess":     140,
-	"LifetimeSess":      150,
-	"SRDFreq":           10,
-	"TimeReq":           5,
-	"Debug":             false,
+	"NoInstrumentation":    false,
+	"MetricsAddr":          prometheus.DefaultAddr,
+	"MetricsOnMainServer":  false,
+	"MetricsTLSCert":       "",
+	"MetricsTLSKey":        "",
+	"MetricsUser":          "prometheus",
+	"MetricsPassword":      "",
+	"MetricsToken":         "",
+	"SSH":                  "50000",
+	"HTTP":                 ":4000",
+	"MaxAvailableSess":     15,
+	"MaxActiveSess":        140,
+	"LifetimeSess":         150,
+	"SRDFreq":              10,
+	"TimeReq":              5,
+	"Debug":                false,
+	"IdleLoginTimeout":     0,
+	"IdleTimeout":          0,
+	"MaxExtensions":        2,
+	"MaxExtensionTime":     30,
+	"SnapshotDir":          "",
+	"SnapshotQuota":        50,
+	"ChallengeImage":       "entrypoint",
+	"ChallengeContext":     "/var/local/pongo/image",
+	"ChallengeRef":         "",
+	"ChallengeDigest":      "",
+	"SSHPiperImage":        "sshpiperd",
+	"SSHPiperContext":      "",
+	"SSHPiperRef":          "",
+	"SSHPiperDigest":       "",
+	"RegistryUser":         "",
+	"RegistryPassword":     "",
+	"RegistryServer":       "",
+	"BuildTimeout":         5,
+	"BuildLogDir":          "/tmp/pongo",
+	"Runtime":              "",
+	"CapDrop":              "",
+	"CapAdd":               "",
+	"NoNewPrivileges":      false,
+	"ReadOnlyRootfs":       false,
+	"Tmpfs":                "",
+	"SeccompProfile":       "",
+	"AppArmorProfile":      "",
+	"RequireUserns":        false,
+	"Engine":               "auto",
+	"EngineHost":           "",
+	"RemoteEngines":        "",
+	"EngineTLSCA":          "",
+	"EngineTLSCert":        "",
+	"EngineTLSKey":         "",
+	"Placement":            "spread",
+	"PlacementConstraints": "",
+	"LogFormat":            "text",
+	"StatsFreq":            15,
+	"AlertCPU":             90,
+	"AlertNetPackets":      1000,
+	"AdminUser":            "admin",
+	"AdminPassword":        "",
+	"MonitorToken":         "",
+	"MonitorFreq":          0,
+	"MonitorTimezone":      "Local",
+	"MonitorHistory":       100,
+	"MonitorConfig":        "",
+	"MonitorInsecureSSH":   false,
+	"AuditLog":             audit.DefaultPath,
+	"AuditKey":             audit.DefaultKeyPath,
+	"TracingEndpoint":      "",
 }
 
 type Application interface {
@@ -87,6 +147,354 @@ func fetchConfigValues() (pongo.UserConfiguration, error) {
 	} else {
 		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
 	}
+	viperKey = "MetricsAddr"
+	if viper.IsSet(viperKey) {
+		configValues.MetricsAddr = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MetricsOnMainServer"
+	if viper.IsSet(viperKey) {
+		configValues.MetricsOnMainServer = viper.GetBool(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MetricsTLSCert"
+	if viper.IsSet(viperKey) {
+		configValues.MetricsTLSCert = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MetricsTLSKey"
+	if viper.IsSet(viperKey) {
+		configValues.MetricsTLSKey = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MetricsUser"
+	if viper.IsSet(viperKey) {
+		configValues.MetricsUser = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MetricsPassword"
+	if viper.IsSet(viperKey) {
+		configValues.MetricsPassword = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MetricsToken"
+	if viper.IsSet(viperKey) {
+		configValues.MetricsToken = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "IdleLoginTimeout"
+	if viper.IsSet(viperKey) {
+		configValues.IdleLoginTimeout = viper.GetInt(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "IdleTimeout"
+	if viper.IsSet(viperKey) {
+		configValues.IdleTimeout = viper.GetInt(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MaxExtensions"
+	if viper.IsSet(viperKey) {
+		configValues.MaxExtensions = viper.GetInt(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MaxExtensionTime"
+	if viper.IsSet(viperKey) {
+		configValues.MaxExtensionTime = viper.GetInt(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "SnapshotDir"
+	if viper.IsSet(viperKey) {
+		configValues.SnapshotDir = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "SnapshotQuota"
+	if viper.IsSet(viperKey) {
+		configValues.SnapshotQuota = viper.GetInt(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "ChallengeImage"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeImage.Name = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "ChallengeContext"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeImage.Context = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "ChallengeRef"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeImage.Ref = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "ChallengeDigest"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeImage.Digest = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "SSHPiperImage"
+	if viper.IsSet(viperKey) {
+		configValues.SSHPiperImage.Name = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "SSHPiperContext"
+	if viper.IsSet(viperKey) {
+		configValues.SSHPiperImage.Context = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "SSHPiperRef"
+	if viper.IsSet(viperKey) {
+		configValues.SSHPiperImage.Ref = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "SSHPiperDigest"
+	if viper.IsSet(viperKey) {
+		configValues.SSHPiperImage.Digest = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "RegistryUser"
+	if viper.IsSet(viperKey) {
+		configValues.RegistryUser = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "RegistryPassword"
+	if viper.IsSet(viperKey) {
+		configValues.RegistryPassword = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "RegistryServer"
+	if viper.IsSet(viperKey) {
+		configValues.RegistryServer = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "BuildTimeout"
+	if viper.IsSet(viperKey) {
+		configValues.BuildTimeout = viper.GetInt(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "BuildLogDir"
+	if viper.IsSet(viperKey) {
+		configValues.BuildLogDir = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "Runtime"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeSandbox.Runtime = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "CapDrop"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeSandbox.CapDrop = splitList(viper.GetString(viperKey))
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "CapAdd"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeSandbox.CapAdd = splitList(viper.GetString(viperKey))
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "NoNewPrivileges"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeSandbox.NoNewPrivileges = viper.GetBool(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "ReadOnlyRootfs"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeSandbox.ReadOnlyRootfs = viper.GetBool(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "Tmpfs"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeSandbox.Tmpfs = splitList(viper.GetString(viperKey))
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "SeccompProfile"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeSandbox.SeccompProfile = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "AppArmorProfile"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeSandbox.AppArmorProfile = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "RequireUserns"
+	if viper.IsSet(viperKey) {
+		configValues.ChallengeSandbox.RequireUserns = viper.GetBool(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "Engine"
+	if viper.IsSet(viperKey) {
+		configValues.Engine = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "EngineHost"
+	if viper.IsSet(viperKey) {
+		configValues.EngineHost = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "RemoteEngines"
+	if viper.IsSet(viperKey) {
+		configValues.RemoteEngines = splitList(viper.GetString(viperKey))
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "EngineTLSCA"
+	if viper.IsSet(viperKey) {
+		configValues.EngineTLSCA = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "EngineTLSCert"
+	if viper.IsSet(viperKey) {
+		configValues.EngineTLSCert = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "EngineTLSKey"
+	if viper.IsSet(viperKey) {
+		configValues.EngineTLSKey = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "Placement"
+	if viper.IsSet(viperKey) {
+		configValues.Placement = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "PlacementConstraints"
+	if viper.IsSet(viperKey) {
+		configValues.PlacementConstraints = splitList(viper.GetString(viperKey))
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "LogFormat"
+	if viper.IsSet(viperKey) {
+		configValues.LogFormat = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "StatsFreq"
+	if viper.IsSet(viperKey) {
+		configValues.StatsFreq = viper.GetInt(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "AlertCPU"
+	if viper.IsSet(viperKey) {
+		configValues.AlertCPU = viper.GetInt(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "AlertNetPackets"
+	if viper.IsSet(viperKey) {
+		configValues.AlertNetPackets = viper.GetInt(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "AdminUser"
+	if viper.IsSet(viperKey) {
+		configValues.AdminUser = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "AdminPassword"
+	if viper.IsSet(viperKey) {
+		configValues.AdminPassword = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MonitorToken"
+	if viper.IsSet(viperKey) {
+		configValues.MonitorToken = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MonitorFreq"
+	if viper.IsSet(viperKey) {
+		configValues.MonitorFreq = viper.GetInt(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MonitorTimezone"
+	if viper.IsSet(viperKey) {
+		configValues.MonitorTimezone = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MonitorHistory"
+	if viper.IsSet(viperKey) {
+		configValues.MonitorHistory = viper.GetInt(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MonitorConfig"
+	if viper.IsSet(viperKey) {
+		configValues.MonitorConfig = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "MonitorInsecureSSH"
+	if viper.IsSet(viperKey) {
+		configValues.MonitorInsecureSSH = viper.GetBool(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "AuditLog"
+	if viper.IsSet(viperKey) {
+		configValues.AuditLog = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "AuditKey"
+	if viper.IsSet(viperKey) {
+		configValues.AuditKey = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
+	viperKey = "TracingEndpoint"
+	if viper.IsSet(viperKey) {
+		configValues.TracingEndpoint = viper.GetString(viperKey)
+	} else {
+		return configValues, fmt.Errorf("error: '%s' is not a key manages by viper.", viperKey)
+	}
 
 	return configValues, nil
 }
@@ -156,6 +564,35 @@ func configureFlagsRunCmd(runCmd *cobra.Command) error {
 	if err := bindFlag(runCmd, "NoInstrumentation", "no-instrumentation"); err != nil {
 		return err
 	}
+	// Metrics endpoint.
+	runCmd.Flags().String("metricsAddr", prometheus.DefaultAddr, "IP and port at which the HTTP server of the Prometheus metrics listens.")
+	if err := bindFlag(runCmd, "MetricsAddr", "metricsAddr"); err != nil {
+		return err
+	}
+	runCmd.Flags().Bool("metricsOnMainServer", false, "Serve the Prometheus metrics under /metrics in the HTTP server of the sessions, instead of their own HTTP server.")
+	if err := bindFlag(runCmd, "MetricsOnMainServer", "metricsOnMainServer"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("metricsTLSCert", "", "Path of the TLS certificate of the HTTP server of the metrics (plain HTTP if empty).")
+	if err := bindFlag(runCmd, "MetricsTLSCert", "metricsTLSCert"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("metricsTLSKey", "", "Path of the TLS key of the HTTP server of the metrics.")
+	if err := bindFlag(runCmd, "MetricsTLSKey", "metricsTLSKey"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("metricsUser", "prometheus", "Username required to scrape the metrics (HTTP basic authentication).")
+	if err := bindFlag(runCmd, "MetricsUser", "metricsUser"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("metricsPassword", "", "Password required to scrape the metrics (basic authentication is disabled if empty).")
+	if err := bindFlag(runCmd, "MetricsPassword", "metricsPassword"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("metricsToken", "", "Bearer token required to scrape the metrics (bearer authentication is disabled if empty).")
+	if err := bindFlag(runCmd, "MetricsToken", "metricsToken"); err != nil {
+		return err
+	}
 	// Debug mode.
 	runCmd.Flags().Bool("debug", false, "Run daemon in 'debug' mode. Logging will be more extensive and frequent.")
 	if err := bindFlag(runCmd, "Debug", "debug"); err != nil {
@@ -184,7 +621,7 @@ func configureFlagsRunCmd(runCmd *cobra.Command) error {
 	if err := bindFlag(runCmd, "LifetimeSess", "lifetimeSess"); err != nil {
 		return err
 	}
-	runCmd.Flags().Int("srdFreq", 10, "Frequency (in min) with which srd checks for expired sessions.")
+	runCmd.Flags().Int("srdFreq", 10, "Time (in min) after which srd retries to stop an expired session that could not be stopped.")
 	if err := bindFlag(runCmd, "SRDFreq", "srdFreq"); err != nil {
 		return err
 	}
@@ -193,6 +630,221 @@ func configureFlagsRunCmd(runCmd *cobra.Command) error {
 	if err := bindFlag(runCmd, "TimeReq", "timeReq"); err != nil {
 		return err
 	}
+	// Reclaim abandoned sessions.
+	runCmd.Flags().Int("idleLoginTimeout", 0, "Time (in min) after the activation of a session within which a user has to log in, otherwise the session is reclaimed (0, the default, disables this check).")
+	if err := bindFlag(runCmd, "IdleLoginTimeout", "idleLoginTimeout"); err != nil {
+		return err
+	}
+	runCmd.Flags().Int("idleTimeout", 0, "Time (in min) without any SSH activity after which a session is reclaimed (0, the default, disables this check).")
+	if err := bindFlag(runCmd, "IdleTimeout", "idleTimeout"); err != nil {
+		return err
+	}
+	// Extension of sessions by their users.
+	runCmd.Flags().Int("maxExtensions", 2, "Max. amount of times a user can extend the lifetime of a session.")
+	if err := bindFlag(runCmd, "MaxExtensions", "maxExtensions"); err != nil {
+		return err
+	}
+	runCmd.Flags().Int("maxExtensionTime", 30, "Max. amount of time (in min) by which a user can extend the lifetime of a session at once.")
+	if err := bindFlag(runCmd, "MaxExtensionTime", "maxExtensionTime"); err != nil {
+		return err
+	}
+	// Snapshots of expired sessions.
+	runCmd.Flags().String("snapshotDir", "", "Directory in which the home directories of expired sessions are stored and restored into new sessions of the same participant (identified by a token kept in a cookie of its browser). Snapshots are disabled if empty.")
+	if err := bindFlag(runCmd, "SnapshotDir", "snapshotDir"); err != nil {
+		return err
+	}
+	runCmd.Flags().Int("snapshotQuota", 50, "Max. amount of storage (in MB) that the snapshots of a single participant can occupy.")
+	if err := bindFlag(runCmd, "SnapshotQuota", "snapshotQuota"); err != nil {
+		return err
+	}
+	// Docker images, built from a build context or pulled from a registry.
+	runCmd.Flags().String("challengeImage", "entrypoint", "Local name of the Docker image used to create the entrypoint container of every session.")
+	if err := bindFlag(runCmd, "ChallengeImage", "challengeImage"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("challengeContext", "/var/local/pongo/image", "Build context (directory with a Dockerfile) of the challenge image. The image is only rebuilt if the build context changed. If empty, the image is pulled from challengeRef.")
+	if err := bindFlag(runCmd, "ChallengeContext", "challengeContext"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("challengeRef", "", "Reference of the challenge image in a registry, e.g. 'localhost:5000/ctf/entrypoint:v1'. Only used if challengeContext is empty.")
+	if err := bindFlag(runCmd, "ChallengeRef", "challengeRef"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("challengeDigest", "", "Digest (sha256:...) to which the challenge image is pinned. Startup fails if the image does not match it.")
+	if err := bindFlag(runCmd, "ChallengeDigest", "challengeDigest"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("sshPiperImage", "sshpiperd", "Local name of the Docker image used to create the SSH Piper container.")
+	if err := bindFlag(runCmd, "SSHPiperImage", "sshPiperImage"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("sshPiperContext", "", "Build context (directory with a Dockerfile) of the SSH Piper image.")
+	if err := bindFlag(runCmd, "SSHPiperContext", "sshPiperContext"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("sshPiperRef", "", "Reference of the SSH Piper image in a registry. Only used if sshPiperContext is empty.")
+	if err := bindFlag(runCmd, "SSHPiperRef", "sshPiperRef"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("sshPiperDigest", "", "Digest (sha256:...) to which the SSH Piper image is pinned.")
+	if err := bindFlag(runCmd, "SSHPiperDigest", "sshPiperDigest"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("registryUser", "", "Username used to pull images from a registry.")
+	if err := bindFlag(runCmd, "RegistryUser", "registryUser"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("registryPassword", "", "Password used to pull images from a registry.")
+	if err := bindFlag(runCmd, "RegistryPassword", "registryPassword"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("registryServer", "", "Address of the registry for which the credentials are used, e.g. 'localhost:5000'.")
+	if err := bindFlag(runCmd, "RegistryServer", "registryServer"); err != nil {
+		return err
+	}
+	runCmd.Flags().Int("buildTimeout", 5, "Max. time (in min) that the build of an image can take.")
+	if err := bindFlag(runCmd, "BuildTimeout", "buildTimeout"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("buildLogDir", "/tmp/pongo", "Directory in which the full output of every image build is saved (disabled if empty).")
+	if err := bindFlag(runCmd, "BuildLogDir", "buildLogDir"); err != nil {
+		return err
+	}
+	// Isolation of the session containers.
+	runCmd.Flags().String("runtime", "", "OCI runtime used to run the session containers, e.g. 'runsc' (gVisor) or 'kata-runtime'. It has to be configured in the Docker daemon. If empty, the default runtime is used. It applies to every session, run another instance of pongo for a challenge which needs a different runtime.")
+	if err := bindFlag(runCmd, "Runtime", "runtime"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("capDrop", "", "Comma-separated list of Linux capabilities dropped from the session containers, e.g. 'ALL'.")
+	if err := bindFlag(runCmd, "CapDrop", "capDrop"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("capAdd", "", "Comma-separated list of Linux capabilities added to the session containers, e.g. 'CHOWN,SETUID,SETGID,SYS_CHROOT,AUDIT_WRITE' to run sshd after dropping 'ALL'.")
+	if err := bindFlag(runCmd, "CapAdd", "capAdd"); err != nil {
+		return err
+	}
+	runCmd.Flags().Bool("noNewPrivileges", false, "Processes inside the session containers cannot gain new privileges (e.g. through setuid binaries).")
+	if err := bindFlag(runCmd, "NoNewPrivileges", "noNewPrivileges"); err != nil {
+		return err
+	}
+	runCmd.Flags().Bool("readOnlyRootfs", false, "Mount the root filesystem of the session containers as read-only. Only the tmpfs mounts are writable.")
+	if err := bindFlag(runCmd, "ReadOnlyRootfs", "readOnlyRootfs"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("tmpfs", "", "Comma-separated list of writable tmpfs mounts of the session containers, as 'path' or 'path:options' (options separated by spaces), e.g. '/tmp:rw noexec size=64m,/run'.")
+	if err := bindFlag(runCmd, "Tmpfs", "tmpfs"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("seccompProfile", "", "Path to a seccomp profile (JSON) applied to the session containers, or 'unconfined'. If empty, the default profile of the Docker daemon is used.")
+	if err := bindFlag(runCmd, "SeccompProfile", "seccompProfile"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("apparmorProfile", "", "AppArmor profile (already loaded in the host) applied to the session containers. If empty, the default profile of the Docker daemon is used.")
+	if err := bindFlag(runCmd, "AppArmorProfile", "apparmorProfile"); err != nil {
+		return err
+	}
+	runCmd.Flags().Bool("requireUserns", false, "Refuse to start if the Docker daemon does not run with user-namespace remapping enabled.")
+	if err := bindFlag(runCmd, "RequireUserns", "requireUserns"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("engine", "auto", "Container engine used to run the sessions: 'docker', 'podman' (through its Docker-compatible API socket) or 'auto'.")
+	if err := bindFlag(runCmd, "Engine", "engine"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("engineHost", "", "Address of the API of the container engine, e.g. 'unix:///run/user/1000/podman/podman.sock'. If empty, the socket of the engine is discovered.")
+	if err := bindFlag(runCmd, "EngineHost", "engineHost"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("remoteEngines", "", "Comma-separated list of additional Docker engines in which sessions are placed, as 'name=host bind=IP [addr=IP] [capacity=N] [label=value ...]', e.g. 'node1=tcp://10.0.0.2:2376 bind=10.0.0.2 capacity=50 zone=a'. The sessions publish their SSH port on the bind IP, which should only be reachable by the reverse proxy.")
+	if err := bindFlag(runCmd, "RemoteEngines", "remoteEngines"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("engineTLSCA", "", "Path of the CA certificate used to connect to the remote engines with TLS.")
+	if err := bindFlag(runCmd, "EngineTLSCA", "engineTLSCA"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("engineTLSCert", "", "Path of the client certificate used to connect to the remote engines with TLS.")
+	if err := bindFlag(runCmd, "EngineTLSCert", "engineTLSCert"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("engineTLSKey", "", "Path of the client key used to connect to the remote engines with TLS.")
+	if err := bindFlag(runCmd, "EngineTLSKey", "engineTLSKey"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("placement", "spread", "Strategy used to choose the engine of a new session: 'spread' or 'binpack'.")
+	if err := bindFlag(runCmd, "Placement", "placement"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("placementConstraints", "", "Comma-separated list of labels ('key=value') that an engine must have to receive new sessions.")
+	if err := bindFlag(runCmd, "PlacementConstraints", "placementConstraints"); err != nil {
+		return err
+	}
+	// Format of the logs.
+	runCmd.Flags().String("logFormat", "text", "Format of the logs: 'text', 'json' or 'logfmt'.")
+	if err := bindFlag(runCmd, "LogFormat", "logFormat"); err != nil {
+		return err
+	}
+	// Resource usage of the sessions.
+	runCmd.Flags().Int("statsFreq", 15, "Frequency (in s) with which the resource usage of every active session is sampled (0 disables sampling).")
+	if err := bindFlag(runCmd, "StatsFreq", "statsFreq"); err != nil {
+		return err
+	}
+	runCmd.Flags().Int("alertCPU", 90, "CPU usage (in % of a single CPU) above which a session is flagged as mining.")
+	if err := bindFlag(runCmd, "AlertCPU", "alertCPU"); err != nil {
+		return err
+	}
+	runCmd.Flags().Int("alertNetPackets", 1000, "Rate of transmitted packets (per s) above which a session is flagged as scanning.")
+	if err := bindFlag(runCmd, "AlertNetPackets", "alertNetPackets"); err != nil {
+		return err
+	}
+	// Admin view.
+	runCmd.Flags().String("adminUser", "admin", "Username of the administrator of the admin view (/admin/sessions).")
+	if err := bindFlag(runCmd, "AdminUser", "adminUser"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("adminPassword", "", "Password of the administrator of the admin view (/admin/sessions). The admin view is disabled if empty.")
+	if err := bindFlag(runCmd, "AdminPassword", "adminPassword"); err != nil {
+		return err
+	}
+	// Health monitor.
+	runCmd.Flags().String("monitorToken", "", "Token with which the probes of the health monitor authenticate (header X-Pongo-Monitor-Token). A random token is generated if empty.")
+	if err := bindFlag(runCmd, "MonitorToken", "monitorToken"); err != nil {
+		return err
+	}
+	runCmd.Flags().Int("monitorFreq", 0, "Time (in min) between two runs of the health checks. If 0, six times the min. time between requests (timeReq).")
+	if err := bindFlag(runCmd, "MonitorFreq", "monitorFreq"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("monitorTimezone", "Local", "Time zone (IANA name, e.g. 'Europe/Berlin') of the timestamps of the health checks.")
+	if err := bindFlag(runCmd, "MonitorTimezone", "monitorTimezone"); err != nil {
+		return err
+	}
+	runCmd.Flags().Int("monitorHistory", 100, "Amount of past results kept for every health check, from which its uptime is computed.")
+	if err := bindFlag(runCmd, "MonitorHistory", "monitorHistory"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("monitorConfig", "", "Path of a YAML file with additional health checks (http, ssh, tcp, docker) and the notifiers (webhook, smtp, command) notified when a health check changes between pass and fail.")
+	if err := bindFlag(runCmd, "MonitorConfig", "monitorConfig"); err != nil {
+		return err
+	}
+	runCmd.Flags().Bool("monitorInsecureSSH", false, "Do not verify the host key of the SSH reverse proxy in the SSH health check, if the public host key of the host cannot be read. Otherwise the SSH health check fails in that case.")
+	if err := bindFlag(runCmd, "MonitorInsecureSSH", "monitorInsecureSSH"); err != nil {
+		return err
+	}
+	// Audit log.
+	runCmd.Flags().String("auditLog", audit.DefaultPath, "Path of the append-only audit log of the lifecycle events of the sessions (no events are recorded if empty).")
+	if err := bindFlag(runCmd, "AuditLog", "auditLog"); err != nil {
+		return err
+	}
+	runCmd.Flags().String("auditKey", audit.DefaultKeyPath, "Path of the file with the secret key (hex-encoded) with which the records of the audit log are hashed. It is generated if it does not exist. Keep it outside the directory of the audit log.")
+	if err := bindFlag(runCmd, "AuditKey", "auditKey"); err != nil {
+		return err
+	}
+	// Tracing.
+	runCmd.Flags().String("tracingEndpoint", "", "URL of the OTLP (HTTP) collector to which the traces are exported, e.g. 'http://localhost:4318' (traces are not exported if empty).")
+	if err := bindFlag(runCmd, "TracingEndpoint", "tracingEndpoint"); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -201,6 +853,27 @@ func bindEnvRunCmd() error {
 	if err := viper.BindEnv("NoInstrumentation"); err != nil {
 		return fmt.Errorf("error binding env. variable: %w", err)
 	}
+	if err := viper.BindEnv("MetricsAddr"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MetricsOnMainServer"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MetricsTLSCert"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MetricsTLSKey"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MetricsUser"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MetricsPassword"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MetricsToken"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
 	if err := viper.BindEnv("SSH"); err != nil {
 		return fmt.Errorf("error binding env. variable: %w", err)
 	}
@@ -225,6 +898,159 @@ func bindEnvRunCmd() error {
 	if err := viper.BindEnv("Debug"); err != nil {
 		return fmt.Errorf("error binding env. variable: %w", err)
 	}
+	if err := viper.BindEnv("IdleLoginTimeout"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("IdleTimeout"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MaxExtensions"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MaxExtensionTime"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("SnapshotDir"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("SnapshotQuota"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("ChallengeImage"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("ChallengeContext"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("ChallengeRef"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("ChallengeDigest"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("SSHPiperImage"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("SSHPiperContext"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("SSHPiperRef"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("SSHPiperDigest"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("RegistryUser"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("RegistryPassword"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("RegistryServer"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("BuildTimeout"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("BuildLogDir"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("Runtime"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("CapDrop"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("CapAdd"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("NoNewPrivileges"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("ReadOnlyRootfs"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("Tmpfs"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("SeccompProfile"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("AppArmorProfile"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("RequireUserns"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("Engine"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("EngineHost"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("RemoteEngines"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("EngineTLSCA"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("EngineTLSCert"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("EngineTLSKey"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("Placement"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("PlacementConstraints"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("LogFormat"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("StatsFreq"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("AlertCPU"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("AlertNetPackets"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("AdminUser"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("AdminPassword"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MonitorToken"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MonitorFreq"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MonitorTimezone"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MonitorHistory"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MonitorConfig"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("MonitorInsecureSSH"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("AuditLog"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("AuditKey"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
+	if err := viper.BindEnv("TracingEndpoint"); err != nil {
+		return fmt.Errorf("error binding env. variable: %w", err)
+	}
 
 	return nil
 }
@@ -8,6 +8,8 @@ package pongo
 type UserConfiguration struct {
 	// debugMode, run the daemon in debug mode. More extensive logging.
 	DebugMode bool
+	// logFormat, format of the logs: 'text', 'json' or 'logfmt'.
+	LogFormat string
 	// sshPort, port in which the SSH Piper will work as an SSH proxy.
 	SSHPort string
 	// httpAddr, IP and port in which the HTTP service will be hosted, e.g.
@@ -17,19 +19,19 @@ type UserConfiguration struct {
 	// sessions. scd (session creation daemon) will try to always keep this
 	// amount of available sessions ready to be deployed.
 	MaxAvailableSess int
-	// maxActiveSess, the size of the channel that handles the currently active
-	// sessions. srd (session removal daemon) will check periodically to remove
-	// sessions from the activeSessions chan which have exceeded their max.
-	// lifetime.
-	// IMPORTANT: No more sessions can be active than the size of this channel,
-	// otherwise the other daemons will block.
+	// maxActiveSess, the max. amount of sessions that can be simultaneously
+	// active. srd (session removal daemon) will check periodically to remove
+	// active sessions which have exceeded their max. lifetime.
+	// When this amount is reached, requests for new sessions are rejected
+	// until an active session is removed.
 	MaxActiveSess int
 	// lifetimeSess, is the lifetime of a session in minutes. After this time
 	// has elapsed since the activation of the session by a client, the session
 	// will expire and it will be removed by srd (session removal daemon).
 	LifetimeSess int
-	// srdFreq, is the frequency (in min) with which the session removal
-	// daemon (srd) checks if some active sessions have expired.
+	// srdFreq, is the time (in min) after which the session removal daemon
+	// (srd) retries to stop an expired session, which could not be stopped
+	// when it expired. srd stops every other session exactly when it expires.
 	SRDFreq int
 	// timeBetweenRequests, is the minimum time in minutes that has to pass
 	// between requests coming from the same user-agent with a particular IP
@@ -39,4 +41,196 @@ type UserConfiguration struct {
 	// noInstrumentation, if true, no instrumentation will be performed in the
 	// application.
 	NoInstrumentation bool
+	// metricsAddr, IP and port at which the HTTP server of the Prometheus
+	// metrics listens, e.g. 'localhost:9999'.
+	MetricsAddr string
+	// metricsOnMainServer, if true, the metrics are served under /metrics by
+	// the HTTP server of the sessions (HTTPAddr) instead of their own server.
+	MetricsOnMainServer bool
+	// metricsTLSCert and metricsTLSKey, paths of the TLS certificate and key
+	// of the HTTP server of the metrics. If empty, plain HTTP is used.
+	MetricsTLSCert string
+	MetricsTLSKey  string
+	// metricsUser and metricsPassword, credentials required to scrape the
+	// metrics (HTTP basic authentication). If the password is empty, basic
+	// authentication is disabled.
+	MetricsUser     string
+	MetricsPassword string
+	// metricsToken, bearer token required to scrape the metrics. If empty,
+	// bearer authentication is disabled.
+	MetricsToken string
+	// idleLoginTimeout, time (in min) after the activation of a session within
+	// which a user has to log into the session with SSH, otherwise the session
+	// is reclaimed. If equal to 0, sessions are never reclaimed for this
+	// reason.
+	IdleLoginTimeout int
+	// idleTimeout, time (in min) after which a session in which a user already
+	// logged in is reclaimed, if the user did not interact with the session
+	// during that time. If equal to 0, sessions are never reclaimed for this
+	// reason.
+	IdleTimeout int
+	// maxExtensions, max. amount of times a user can extend the lifetime of
+	// a session.
+	MaxExtensions int
+	// maxExtensionTime, max. amount of time (in min) by which a user can
+	// extend the lifetime of a session at once.
+	MaxExtensionTime int
+	// snapshotDir, directory of the host in which the home directories of
+	// expired sessions are stored, so that they can be restored into a new
+	// session of the same participant (identified by the participant token
+	// in a cookie of its browser). If empty, no snapshots are taken.
+	SnapshotDir string
+	// snapshotQuota, max. amount of storage (in MB) that the snapshots of a
+	// single participant can occupy.
+	SnapshotQuota int
+	// challengeImage, Docker image used to create the entrypoint container
+	// of every session (the challenge).
+	ChallengeImage ImageSpec
+	// sshPiperImage, Docker image used to create the SSH Piper reverse proxy
+	// container.
+	SSHPiperImage ImageSpec
+	// registryUser, username used to pull images from a registry.
+	RegistryUser string
+	// registryPassword, password used to pull images from a registry.
+	RegistryPassword string
+	// registryServer, address of the registry for which the credentials are
+	// used, e.g. 'localhost:5000'.
+	RegistryServer string
+	// buildTimeout, max. time (in min) that the build of an image can take.
+	BuildTimeout int
+	// buildLogDir, directory in which the full output of every image build
+	// is saved. If empty, build logs are not saved.
+	BuildLogDir string
+	// challengeSandbox, options used to isolate the entrypoint container of
+	// every session from the host.
+	ChallengeSandbox SandboxSpec
+	// engine, container engine used to run the sessions: 'docker', 'podman'
+	// (through its Docker-compatible API socket) or 'auto' (the first engine
+	// whose API socket is found).
+	Engine string
+	// engineHost, address of the API of the container engine, e.g.
+	// 'unix:///run/user/1000/podman/podman.sock'. If empty, the address is
+	// discovered.
+	EngineHost string
+	// remoteEngines, additional Docker engines in which sessions are placed,
+	// as 'name=host bind=IP [option=value ...]', e.g.
+	// 'node1=tcp://10.0.0.2:2376 bind=10.0.0.2 capacity=50 zone=a'. The host
+	// is either 'tcp://' or 'ssh://[user@]host'. The options 'addr' (address
+	// at which the reverse proxy reaches the host), 'bind' (required, IP on
+	// which the sessions publish their SSH port) and 'capacity' (max. amount
+	// of sessions) are reserved, any other option is a label of the engine.
+	RemoteEngines []string
+	// engineTLSCA, engineTLSCert and engineTLSKey, paths of the CA
+	// certificate, client certificate and client key used to connect to the
+	// 'tcp://' remote engines with TLS.
+	EngineTLSCA   string
+	EngineTLSCert string
+	EngineTLSKey  string
+	// placement, strategy used to choose the engine of a new session:
+	// 'spread' (the engine with the most free capacity) or 'binpack' (the
+	// engine with the least free capacity).
+	Placement string
+	// placementConstraints, labels ('key=value') that an engine must have to
+	// receive new sessions.
+	PlacementConstraints []string
+	// statsFreq, frequency (in s) with which the resource usage (CPU, memory,
+	// network I/O and processes) of every active session is sampled. If equal
+	// to 0, the resource usage is not sampled.
+	StatsFreq int
+	// alertCPU, CPU usage (in % of a single CPU) above which a session is
+	// flagged as mining.
+	AlertCPU int
+	// alertNetPackets, rate of transmitted packets (per s) above which a
+	// session is flagged as scanning.
+	AlertNetPackets int
+	// adminUser, username of the administrator of the admin view.
+	AdminUser string
+	// adminPassword, password of the administrator of the admin view. If
+	// empty, the admin view is disabled.
+	AdminPassword string
+	// monitorToken, token with which the synthetic requests of the health
+	// monitor (probes) authenticate. If empty, a random token is generated at
+	// startup.
+	MonitorToken string
+	// monitorFreq, time (in min) between two runs of the health checks. If 0,
+	// six times the min. time between requests.
+	MonitorFreq int
+	// monitorTimezone, time zone of the timestamps of the health checks.
+	MonitorTimezone string
+	// monitorHistory, amount of past results kept for every health check.
+	MonitorHistory int
+	// monitorConfig, path of a YAML file with additional health checks and
+	// the notifiers of the health monitor. Ignored if empty.
+	MonitorConfig string
+	// monitorInsecureSSH, if true, the SSH health check does not verify the
+	// host key of the SSH reverse proxy if the public host key of the host
+	// cannot be read. Otherwise the SSH health check fails in that case.
+	MonitorInsecureSSH bool
+	// auditLog, path of the append-only audit log of the lifecycle events of
+	// the sessions. If empty, no events are recorded.
+	AuditLog string
+	// auditKey, path of the file with the secret key with which the records
+	// of the audit log are hashed. It is generated if it does not exist.
+	AuditKey string
+	// tracingEndpoint, URL of the OTLP (HTTP) collector to which the traces
+	// are exported. If empty, no traces are exported.
+	TracingEndpoint string
+}
+
+// ImageSpec, describes where a Docker image used by the application comes
+// from.
+type ImageSpec struct {
+	// name, local name of the image, used to create containers out of it.
+	Name string
+	// context, path to a build context (directory with a Dockerfile) from
+	// which the image is built. Takes precedence over ref.
+	Context string
+	// ref, reference of the image in a registry from which the image is
+	// pulled, e.g. 'localhost:5000/ctf/entrypoint:v1'.
+	Ref string
+	// digest, if not empty, the image must resolve to this digest, e.g.
+	// 'sha256:...'.
+	Digest string
+}
+
+// SandboxSpec, options used to isolate the containers of the sessions from the
+// host, e.g. a sandboxed OCI runtime and hardening options.
+type SandboxSpec struct {
+	// runtime, OCI runtime used to run the containers, e.g. 'runsc' (gVisor)
+	// or 'kata-runtime'. The runtime has to be configured in the Docker
+	// daemon. If empty, the default runtime of the Docker daemon is used.
+	// An instance of pongo serves a single challenge, so the runtime applies
+	// to every session; challenges which need different runtimes are served
+	// by different instances.
+	Runtime string
+	// capDrop, Linux capabilities dropped from the containers, e.g. 'ALL'.
+	CapDrop []string
+	// capAdd, Linux capabilities added to the containers, e.g. to add back
+	// the capabilities required by sshd after dropping 'ALL'.
+	CapAdd []string
+	// noNewPrivileges, if true, the processes of the containers cannot gain
+	// new privileges, e.g. through setuid binaries.
+	NoNewPrivileges bool
+	// readOnlyRootfs, if true, the root filesystem of the containers is
+	// mounted as read-only. Only the tmpfs mounts are writable, so the image
+	// has to keep the files modified when a user is created (e.g.
+	// /etc/passwd) within a tmpfs mount.
+	ReadOnlyRootfs bool
+	// tmpfs, writable tmpfs mounts of the containers, as 'path' or
+	// 'path:options'. The options are separated by spaces, since commas
+	// separate the mounts in the configuration, e.g.
+	// '/tmp:rw noexec size=64m'.
+	Tmpfs []string
+	// seccompProfile, path to a seccomp profile (JSON) applied to the
+	// containers, or 'unconfined'. If empty, the default profile of the
+	// Docker daemon is used.
+	SeccompProfile string
+	// apparmorProfile, name of an AppArmor profile (already loaded in the
+	// host) applied to the containers. If empty, the default profile of the
+	// Docker daemon is used.
+	AppArmorProfile string
+	// requireUserns, if true, pongo only starts if the Docker daemon runs
+	// with user-namespace remapping enabled (root inside a container is not
+	// root in the host).
+	RequireUserns bool
 }
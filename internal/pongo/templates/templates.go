@@ -3,8 +3,11 @@ package templates
 import (
 	"html/template"
 	"path/filepath"
+	"time"
 
 	monitor "github.com/erodrigufer/pongo/internal/APIMonitor"
+	"github.com/erodrigufer/pongo/internal/backend"
+	dockerImage "github.com/erodrigufer/pongo/internal/docker/image"
 )
 
 // TemplateData, holds the dynamic data passed to the HTML templates.
@@ -16,7 +19,8 @@ type TemplateData struct {
 	BuildRev string
 	// Username, of an SSH session.
 	Username string
-	// Password, of an SSH session.
+	// Password, of an SSH session. If empty, the session page asks for the
+	// password to extend the session.
 	Password string
 	// Port, port to which to connect with SSH session
 	Port string
@@ -27,6 +31,61 @@ type TemplateData struct {
 	// HealthCheckResults, a slice with all the results provided by the health
 	// monitor.
 	HealthCheckResults []monitor.HealthCheckResult
+	// HealthCheckPending, is true if the health monitor did not perform the
+	// health checks yet.
+	HealthCheckPending bool
+	// ExpiresAt, time at which an SSH session expires.
+	ExpiresAt time.Time
+	// ExtensionsLeft, amount of times an SSH session can still be extended.
+	ExtensionsLeft int
+	// MaxExtensionTime, max. amount of time (in min) by which an SSH session
+	// can be extended at once.
+	MaxExtensionTime int
+	// Images, Docker images used by the application with their resolved
+	// digests.
+	Images []dockerImage.Resolved
+	// Engines, container engines in which the sessions are placed.
+	Engines []backend.NodeStatus
+	// Flash, a message shown to the user at the top of a page, e.g. why an
+	// action failed.
+	Flash string
+	// AdminSessions, active sessions with their resource usage, shown in the
+	// admin view.
+	AdminSessions []SessionUsage
+}
+
+// SessionUsage, an active session and its last sampled resource usage.
+type SessionUsage struct {
+	// Name, Username, Owner, Challenge and Engine, name of the session, SSH
+	// username, IP address of its participant, challenge run by the session
+	// and container engine in which it runs.
+	Name      string
+	Username  string
+	Owner     string
+	Challenge string
+	Engine    string
+	// ActivatedAt and ExpiresAt, times at which the session was activated
+	// and at which it expires.
+	ActivatedAt time.Time
+	ExpiresAt   time.Time
+	// Sampled, false if the resource usage of the session was not sampled
+	// yet. The remaining fields are only valid if Sampled is true.
+	Sampled bool
+	// SampledAt, time of the last sample.
+	SampledAt time.Time
+	// CPUPercent, CPU usage as a percentage of a single CPU.
+	CPUPercent float64
+	// MemoryMiB, memory used in MiB.
+	MemoryMiB float64
+	// NetRxKiBs and NetTxKiBs, KiB received and transmitted per second.
+	NetRxKiBs float64
+	NetTxKiBs float64
+	// TxPackets, packets transmitted per second.
+	TxPackets float64
+	// PIDs, amount of processes and threads.
+	PIDs uint64
+	// Alerts, alerts raised for the session, e.g. 'mining' or 'scanning'.
+	Alerts []string
 }
 
 // NewTemplateCache, create a templates cache from a directory dir.
@@ -0,0 +1,37 @@
+package pongo
+
+import "fmt"
+
+// Command, a command executed inside a container.
+type Command struct {
+	// Args, the command and its arguments.
+	Args []string
+	// Stdin, input written to the standard input of the command, if not
+	// empty. Secrets are passed on the standard input, so that they never
+	// show up in the process list of the container or of its host.
+	Stdin string
+}
+
+// CreateUserCmds, returns the commands that have to be executed (in order)
+// inside an entrypoint container to create the user with which a client logs
+// into a session with SSH.
+func CreateUserCmds(username, password string) []Command {
+	// Command to create user.
+	cmdCreateUser := Command{Args: []string{
+		"useradd",
+		"--create-home", // Create a home directory for the new user.
+		"--user-group",  // Add user to group with its own name.
+		"--shell",       // Use bash as the default user shell.
+		"/bin/bash",
+		username, // Specify the new user's username.
+	}}
+
+	// Command to change password from a given user, chpasswd reads
+	// '$user:$password' lines from its standard input.
+	cmdChangePwd := Command{
+		Args:  []string{"chpasswd"},
+		Stdin: fmt.Sprintf("%s:%s\n", username, password),
+	}
+
+	return []Command{cmdCreateUser, cmdChangePwd}
+}
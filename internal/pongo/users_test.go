@@ -0,0 +1,26 @@
+package pongo
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCreateUserCmds, tests that the password of the user is only passed on
+// the standard input of the commands, never as an argument.
+func TestCreateUserCmds(t *testing.T) {
+	cmds := CreateUserCmds("alice", "s3cret")
+	if len(cmds) != 2 {
+		t.Fatalf("error: expected 2 commands, got %v", cmds)
+	}
+	for _, cmd := range cmds {
+		if strings.Contains(strings.Join(cmd.Args, " "), "s3cret") {
+			t.Errorf("error: password is an argument of the command %v", cmd.Args)
+		}
+	}
+	if cmds[0].Args[0] != "useradd" || cmds[0].Args[len(cmds[0].Args)-1] != "alice" {
+		t.Errorf("error: first command is %v, expected useradd of alice", cmds[0].Args)
+	}
+	if cmds[1].Args[0] != "chpasswd" || cmds[1].Stdin != "alice:s3cret\n" {
+		t.Errorf("error: second command is %v with input %q, expected chpasswd with alice:s3cret", cmds[1].Args, cmds[1].Stdin)
+	}
+}
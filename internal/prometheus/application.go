@@ -11,6 +11,31 @@ var applicationCounters = []struct {
 		description: "Total amount of HTTP requests",
 		labels:      []string{"status_code", "resource"},
 	},
+	{
+		name:        "session_creation_failures_total",
+		description: "Total amount of sessions which could not be created, by the step of the creation which failed.",
+		labels:      []string{"reason"},
+	},
+	{
+		name:        "session_requests_rejected_total",
+		description: "Total amount of requests for a session which were rejected (rate_limit, max_active or no_available).",
+		labels:      []string{"reason"},
+	},
+	{
+		name:        "session_terminations_total",
+		description: "Total amount of stopped active sessions, by why they were stopped (expired, idle, admin or shutdown).",
+		labels:      []string{"reason"},
+	},
+	{
+		name:        "docker_api_errors_total",
+		description: "Total amount of calls to the API of a container engine which returned an error.",
+		labels:      []string{"operation", "engine"},
+	},
+	{
+		name:        "health_check_failures_total",
+		description: "Total amount of failed health checks performed by monitord, by health check.",
+		labels:      []string{"check"},
+	},
 }
 
 // Define the application-specific gauges.
@@ -29,6 +54,46 @@ var applicationGauges = []struct {
 		description: "Total amount of available sessions.",
 		labels:      []string{},
 	},
+	{
+		name:        "session_request_queue_length",
+		description: "Amount of clients waiting for smd to handle their request for a session.",
+		labels:      []string{},
+	},
+	{
+		name:        "session_cpu_percent",
+		description: "CPU usage of the entrypoint container of an active session, as a percentage of a single CPU.",
+		labels:      []string{"session", "challenge"},
+	},
+	{
+		name:        "session_memory_bytes",
+		description: "Memory used by the entrypoint container of an active session in bytes.",
+		labels:      []string{"session", "challenge"},
+	},
+	{
+		name:        "session_network_receive_bytes_per_second",
+		description: "Bytes received per second by the entrypoint container of an active session, between its last two samples.",
+		labels:      []string{"session", "challenge"},
+	},
+	{
+		name:        "session_network_transmit_bytes_per_second",
+		description: "Bytes transmitted per second by the entrypoint container of an active session, between its last two samples.",
+		labels:      []string{"session", "challenge"},
+	},
+	{
+		name:        "session_pids",
+		description: "Amount of processes and threads running in the entrypoint container of an active session.",
+		labels:      []string{"session", "challenge"},
+	},
+	{
+		name:        "session_alert",
+		description: "1 if the resource usage of an active session exceeds the threshold of an alert (mining or scanning).",
+		labels:      []string{"session", "challenge", "alert"},
+	},
+	{
+		name:        "health_check_status",
+		description: "1 if the last run of a health check performed by monitord passed, 0 if it failed.",
+		labels:      []string{"check"},
+	},
 }
 
 // Define the application-specific histograms.
@@ -44,4 +109,34 @@ var applicationHistograms = []struct {
 		labels:      []string{"status_code", "resource"},
 		buckets:     []float64{0.000025, 0.00005, 0.000075, 0.0001, 0.0003, 0.0005, 0.00075, 0.001, 0.003, 0.007, 0.1, 1},
 	},
+	{
+		name:        "session_lifetime_deviation_seconds",
+		description: "Distribution of the difference between the actual and the intended lifetime of expired sessions in seconds",
+		labels:      []string{},
+		buckets:     []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 600},
+	},
+	{
+		name:        "session_creation_duration_seconds",
+		description: "Distribution of the time it takes to create a session in seconds",
+		labels:      []string{},
+		buckets:     []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+	},
+	{
+		name:        "session_creation_step_duration_seconds",
+		description: "Distribution of the time each step of the creation of a session takes in seconds",
+		labels:      []string{"step"},
+		buckets:     []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+	},
+	{
+		name:        "docker_api_duration_seconds",
+		description: "Distribution of the latency of the calls to the API of a container engine in seconds",
+		labels:      []string{"operation", "engine"},
+		buckets:     []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	},
+	{
+		name:        "session_lifetime_used_seconds",
+		description: "Distribution of the time active sessions were used before they were stopped in seconds",
+		labels:      []string{"reason"},
+		buckets:     []float64{60, 300, 600, 900, 1200, 1800, 2700, 3600, 5400, 7200, 10800},
+	},
 }
@@ -0,0 +1,66 @@
+package prometheus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestApplicationMetrics, tests that every application-specific metric is
+// registered, and that it can be used with its labels.
+func TestApplicationMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	ins, err := startInstrumentation(reg)
+	if err != nil {
+		t.Fatalf("error: could not start instrumentation: %v", err)
+	}
+
+	for _, c := range applicationCounters {
+		if err := IncrementCounter(ins, c.name, make([]string, len(c.labels))...); err != nil {
+			t.Errorf("error: could not increment counter %s: %v", c.name, err)
+		}
+	}
+	for _, g := range applicationGauges {
+		if err := SetGauge(ins, 1, g.name, make([]string, len(g.labels))...); err != nil {
+			t.Errorf("error: could not set gauge %s: %v", g.name, err)
+		}
+	}
+	for _, h := range applicationHistograms {
+		if err := ObserveHistogram(ins, 1, h.name, make([]string, len(h.labels))...); err != nil {
+			t.Errorf("error: could not observe histogram %s: %v", h.name, err)
+		}
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("error: could not gather metrics: %v", err)
+	}
+	gathered := make(map[string]bool)
+	for _, f := range families {
+		gathered[f.GetName()] = true
+	}
+	for _, name := range []string{"session_creation_duration_seconds", "session_creation_step_duration_seconds", "docker_api_duration_seconds", "session_lifetime_used_seconds", "session_creation_failures_total", "session_requests_rejected_total", "session_terminations_total", "session_request_queue_length"} {
+		if !gathered[name] {
+			t.Errorf("error: metric %s is not exported", name)
+		}
+	}
+}
+
+// TestRegistration, tests that instrumentations with their own registry do
+// not collide, and that registering the metrics twice in a registry fails.
+func TestRegistration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := startInstrumentation(reg); err != nil {
+		t.Fatalf("error: could not start instrumentation: %v", err)
+	}
+	if _, err := startInstrumentation(prometheus.NewRegistry()); err != nil {
+		t.Errorf("error: instrumentation with another registry failed: %v", err)
+	}
+
+	_, err := startInstrumentation(reg)
+	var already prometheus.AlreadyRegisteredError
+	if !errors.As(err, &already) {
+		t.Errorf("error: registering the metrics twice returned %v, expected prometheus.AlreadyRegisteredError", err)
+	}
+}
@@ -0,0 +1,38 @@
+package prometheus
+
+// Types of the metrics, as named by Prometheus.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Definition, describes an application-specific metric, e.g. to generate
+// dashboards and alerting rules from the metrics that pongo actually exports.
+type Definition struct {
+	// Name, of the metric.
+	Name string
+	// Type, of the metric (TypeCounter, TypeGauge or TypeHistogram).
+	Type string
+	// Description, of the metric (its 'Help').
+	Description string
+	// Labels, names of the labels of the metric.
+	Labels []string
+}
+
+// Definitions, returns the definitions of all application-specific metrics:
+// first the counters, then the gauges and then the histograms, each in the
+// order in which they are declared.
+func Definitions() []Definition {
+	defs := make([]Definition, 0, len(applicationCounters)+len(applicationGauges)+len(applicationHistograms))
+	for _, c := range applicationCounters {
+		defs = append(defs, Definition{Name: c.name, Type: TypeCounter, Description: c.description, Labels: c.labels})
+	}
+	for _, g := range applicationGauges {
+		defs = append(defs, Definition{Name: g.name, Type: TypeGauge, Description: g.description, Labels: g.labels})
+	}
+	for _, h := range applicationHistograms {
+		defs = append(defs, Definition{Name: h.name, Type: TypeHistogram, Description: h.description, Labels: h.labels})
+	}
+	return defs
+}
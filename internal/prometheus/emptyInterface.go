@@ -18,6 +18,14 @@ func (ei EmptyInterface) decreaseGauge(a string, b []string) error {
 	return nil
 }
 
+func (ei EmptyInterface) setGauge(a float64, b string, c []string) error {
+	return nil
+}
+
+func (ei EmptyInterface) deleteGauge(a string, b []string) error {
+	return nil
+}
+
 func (ei EmptyInterface) observeHistogram(a float64, b string, c []string) error {
 	return nil
 }
@@ -55,17 +55,20 @@ func (cs counters) insertCounter(c *counter) error {
 	return nil
 }
 
-// registerCounter, register a counter with the default Prometheus register.
-// If the counter does not exist within the counters map this function returns
-// an error.
-func (cs counters) registerCounter(name string) error {
+// registerCounter, register a counter with the Prometheus registerer reg.
+// If the counter does not exist within the counters map or it cannot be
+// registered (e.g. another metric with the same name is already registered)
+// this function returns an error.
+func (cs counters) registerCounter(reg prometheus.Registerer, name string) error {
 	if !cs.counterExists(name) {
 		return fmt.Errorf("could not register counter %s, since it does not exist within the counters map.", name)
 	}
 
 	c := cs.counters[name]
 	// Register the counter.
-	prometheus.Register(c.promObject)
+	if err := reg.Register(c.promObject); err != nil {
+		return fmt.Errorf("could not register counter %s: %w", name, err)
+	}
 
 	return nil
 }
@@ -160,17 +163,19 @@ func (gs gauges) gaugeExists(name string) bool {
 	return ok
 }
 
-// registerGauge, register a gauge with the default Prometheus register.
-// If the gauge does not exist within the gauges map this function returns
-// an error.
-func (gs gauges) registerGauge(name string) error {
+// registerGauge, register a gauge with the Prometheus registerer reg.
+// If the gauge does not exist within the gauges map or it cannot be
+// registered this function returns an error.
+func (gs gauges) registerGauge(reg prometheus.Registerer, name string) error {
 	if !gs.gaugeExists(name) {
 		return fmt.Errorf("could not register gauge %s, since it does not exist within the gauges map.", name)
 	}
 
 	g := gs.gauges[name]
 	// Register the gauge.
-	prometheus.Register(g.promObject)
+	if err := reg.Register(g.promObject); err != nil {
+		return fmt.Errorf("could not register gauge %s: %w", name, err)
+	}
 
 	return nil
 }
@@ -228,6 +233,32 @@ func (gs gauges) decreaseGauge(name string, labels []string) error {
 
 }
 
+// setGauge, method used to set the gauge's value.
+// If the gauge does not exist within the gauges map this method returns
+// an error.
+func (gs gauges) setGauge(value float64, name string, labels []string) error {
+	if !gs.gaugeExists(name) {
+		return fmt.Errorf("could not set gauge, since the gauge does not exist within gauges map")
+	}
+
+	gs.gauges[name].promObject.WithLabelValues(labels...).Set(value)
+
+	return nil
+}
+
+// deleteGauge, method used to delete the series of a gauge with the given
+// labels, so that it is no longer exported. If the gauge does not exist
+// within the gauges map this method returns an error.
+func (gs gauges) deleteGauge(name string, labels []string) error {
+	if !gs.gaugeExists(name) {
+		return fmt.Errorf("could not delete gauge, since the gauge does not exist within gauges map")
+	}
+
+	gs.gauges[name].promObject.DeleteLabelValues(labels...)
+
+	return nil
+}
+
 // IncrementGauge, is the exported function responsible for incrementing a
 // gauge by 1 using an InstrumentationAPI interface. If the
 // InstrumentationAPI method noOp() returns true, then no instrumentation is
@@ -264,6 +295,29 @@ func DecrementGauge(i InstrumentationAPI, name string, labels ...string) error {
 	return nil
 }
 
+// SetGauge, is the exported function responsible for setting the value of a
+// gauge using a InstrumentationAPI interface. If the InstrumentationAPI method
+// noOp() returns true, then no instrumentation is performed by this function.
+func SetGauge(i InstrumentationAPI, value float64, name string, labels ...string) error {
+	if i.noOp() {
+		return nil
+	}
+
+	return i.setGauge(value, name, labels)
+}
+
+// DeleteGauge, is the exported function responsible for deleting the series
+// of a gauge with the given labels using a InstrumentationAPI interface. If
+// the InstrumentationAPI method noOp() returns true, then no instrumentation
+// is performed by this function.
+func DeleteGauge(i InstrumentationAPI, name string, labels ...string) error {
+	if i.noOp() {
+		return nil
+	}
+
+	return i.deleteGauge(name, labels)
+}
+
 // histogram, holds all the data required to handle a Prometheus histogram.
 type histogram struct {
 	// name, of histogram.
@@ -318,17 +372,19 @@ func (hs histograms) insertHistogram(h *histogram) error {
 	return nil
 }
 
-// registerHistogram, register a histogram with the default Prometheus register.
-// If the histogram does not exist within the histograms map this function
-// returns an error.
-func (hs histograms) registerHistogram(name string) error {
+// registerHistogram, register a histogram with the Prometheus registerer reg.
+// If the histogram does not exist within the histograms map or it cannot be
+// registered this function returns an error.
+func (hs histograms) registerHistogram(reg prometheus.Registerer, name string) error {
 	if !hs.histogramExists(name) {
 		return fmt.Errorf("could not register histogram %s, since it does not exist within the histograms map.", name)
 	}
 
 	h := hs.histograms[name]
 	// Register the histogram.
-	prometheus.Register(h.promObject)
+	if err := reg.Register(h.promObject); err != nil {
+		return fmt.Errorf("could not register histogram %s: %w", name, err)
+	}
 
 	return nil
 }
@@ -385,6 +441,8 @@ type InstrumentationAPI interface {
 	noOp() bool
 	incrementGauge(string, []string) error
 	decreaseGauge(string, []string) error
+	setGauge(float64, string, []string) error
+	deleteGauge(string, []string) error
 	observeHistogram(float64, string, []string) error
 }
 
@@ -396,11 +454,19 @@ type Instrumentation struct {
 	histograms
 }
 
-// StartInstrumentation, returns an Instrumentation object that fulfils the
+// NewInstrumentation, returns an Instrumentation object whose metrics are
+// registered in reg, without exposing them. Tests and multiple instances of
+// the application use their own registry, so that their metrics do not
+// collide.
+func NewInstrumentation(reg prometheus.Registerer) (*Instrumentation, error) {
+	return startInstrumentation(reg)
+}
+
+// startInstrumentation, returns an Instrumentation object that fulfils the
 // InstrumentationAPI interface with all the instrumentation (counters, gauges
 // and histograms) as defined in application.go. All the instrumentation is
-// already register in Prometheus default register.
-func startInstrumentation() (*Instrumentation, error) {
+// already registered in the Prometheus registerer reg.
+func startInstrumentation(reg prometheus.Registerer) (*Instrumentation, error) {
 	ins := new(Instrumentation)
 
 	// Counters section. ------------------------------------------------------
@@ -414,7 +480,7 @@ func startInstrumentation() (*Instrumentation, error) {
 		if err := ins.insertCounter(newCounter(c.name, c.description, c.labels)); err != nil {
 			return ins, fmt.Errorf("error while inserting counter to counters map: %w", err)
 		}
-		if err := ins.registerCounter(c.name); err != nil {
+		if err := ins.registerCounter(reg, c.name); err != nil {
 			return ins, err
 		}
 	}
@@ -430,7 +496,7 @@ func startInstrumentation() (*Instrumentation, error) {
 		if err := ins.insertGauge(newGauge(g.name, g.description, g.labels)); err != nil {
 			return ins, fmt.Errorf("error while inserting gauge to gauges map: %w", err)
 		}
-		if err := ins.registerGauge(g.name); err != nil {
+		if err := ins.registerGauge(reg, g.name); err != nil {
 			return ins, err
 		}
 	}
@@ -444,9 +510,9 @@ func startInstrumentation() (*Instrumentation, error) {
 		// Create histogram and insert it into histograms map, if a histogram
 		// with the same name already exists the function returns an error.
 		if err := ins.insertHistogram(newHistogram(h.name, h.description, h.labels, h.buckets)); err != nil {
-			return ins, fmt.Errorf("error while inserting gauge to gauges map: %w", err)
+			return ins, fmt.Errorf("error while inserting histogram to histograms map: %w", err)
 		}
-		if err := ins.registerHistogram(h.name); err != nil {
+		if err := ins.registerHistogram(reg, h.name); err != nil {
 			return ins, err
 		}
 	}
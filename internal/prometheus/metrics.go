@@ -2,21 +2,139 @@
 package prometheus
 
 import (
+	"crypto/subtle"
+	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/bmizerany/pat"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// DefaultAddr, default address at which the metrics are served.
+const DefaultAddr = "localhost:9999"
+
+// Options, configure how the metrics are served.
+type Options struct {
+	// Addr, address at which the HTTP server of the metrics listens.
+	Addr string
+	// TLSCert and TLSKey, paths of the TLS certificate and key of the HTTP
+	// server of the metrics. If empty, the metrics are served over plain
+	// HTTP.
+	TLSCert string
+	TLSKey  string
+	// Username and Password, credentials required to scrape the metrics
+	// (HTTP basic authentication). Disabled if Password is empty.
+	Username string
+	Password string
+	// BearerToken, token required to scrape the metrics (sent in the
+	// 'Authorization: Bearer <token>' header). Disabled if empty.
+	BearerToken string
+	// Registerer and Gatherer, registry in which the metrics are registered
+	// and from which they are served, e.g. a prometheus.Registry. If nil, the
+	// default Prometheus registry is used.
+	Registerer prometheus.Registerer
+	Gatherer   prometheus.Gatherer
+}
+
+// Validate, checks that the options are complete, e.g. that both the TLS
+// certificate and key are configured.
+func (o Options) Validate() error {
+	if (o.TLSCert == "") != (o.TLSKey == "") {
+		return fmt.Errorf("error: both the TLS certificate and key of the metrics must be configured")
+	}
+	if o.Password != "" && o.Username == "" {
+		return fmt.Errorf("error: a username is required for the basic authentication of the metrics")
+	}
+	if (o.Registerer == nil) != (o.Gatherer == nil) {
+		return fmt.Errorf("error: both the registerer and the gatherer of the metrics must be configured")
+	}
+	return nil
+}
+
+// registerer, returns the registerer of the metrics configured in the
+// options, or the default Prometheus registerer.
+func (o Options) registerer() prometheus.Registerer {
+	if o.Registerer == nil {
+		return prometheus.DefaultRegisterer
+	}
+	return o.Registerer
+}
+
+// gatherer, returns the gatherer of the metrics configured in the options,
+// or the default Prometheus gatherer.
+func (o Options) gatherer() prometheus.Gatherer {
+	if o.Gatherer == nil {
+		return prometheus.DefaultGatherer
+	}
+	return o.Gatherer
+}
+
+// authenticated, reports whether scraping the metrics requires credentials.
+func (o Options) authenticated() bool {
+	return o.Password != "" || o.BearerToken != ""
+}
+
+// Handler, returns the handler which serves the metrics gathered from the
+// registry of opts, protected with the credentials configured in opts (if
+// any). The metrics of the handler itself are registered in the registry of
+// opts as well.
+func Handler(opts Options) http.Handler {
+	handler := promhttp.InstrumentMetricHandler(opts.registerer(), promhttp.HandlerFor(opts.gatherer(), promhttp.HandlerOpts{}))
+	return requireAuth(opts, handler)
+}
+
+// requireAuth, only lets a request through if it carries the basic
+// authentication credentials or the bearer token of opts. Every request is
+// let through if no credentials are configured.
+func requireAuth(opts Options, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !opts.authenticated() || authorized(opts, r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if opts.Password != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="pongo metrics", charset="UTF-8"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pongo metrics"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+// authorized, reports whether a request carries valid credentials. The
+// credentials are compared in constant time.
+func authorized(opts Options, r *http.Request) bool {
+	if opts.Password != "" {
+		if user, password, ok := r.BasicAuth(); ok {
+			validUser := subtle.ConstantTimeCompare([]byte(user), []byte(opts.Username)) == 1
+			validPassword := subtle.ConstantTimeCompare([]byte(password), []byte(opts.Password)) == 1
+			if validUser && validPassword {
+				return true
+			}
+		}
+	}
+	if opts.BearerToken != "" {
+		const prefix = "Bearer "
+		auth := r.Header.Get("Authorization")
+		if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+			return subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(opts.BearerToken)) == 1
+		}
+	}
+	return false
+}
+
 // declareHTTPServer, declares and configures an HTTP server.
-func declareHTTPServer(errorLog *log.Logger, addr string) *http.Server {
+func declareHTTPServer(errorLog *log.Logger, opts Options) *http.Server {
 	// Use the pat.New() function to initialize a new servemux.
 	mux := pat.New()
 
 	// Prometheus endpoint with the metrics captured through instrumentation.
-	mux.Get("/metrics", promhttp.Handler())
+	mux.Get("/metrics", Handler(opts))
 
 	// chain of middlewares being executed before the mux, e.g.
 	// a defer function to recover from a panic from within a client's connec.
@@ -29,7 +147,7 @@ func declareHTTPServer(errorLog *log.Logger, addr string) *http.Server {
 	// Initialize a new http.Server struct.
 	srv := &http.Server{
 		// Address where server listens.
-		Addr: addr,
+		Addr: opts.Addr,
 		// Logger for errors.
 		ErrorLog: errorLog,
 		// Handler that receives the client after accept().
@@ -47,22 +165,73 @@ func declareHTTPServer(errorLog *log.Logger, addr string) *http.Server {
 	return srv
 }
 
-// ExposeMetrics, expose the metrics with an HTTP server.
-func ExposeMetrics(infoLog, errorLog *log.Logger, addr string) (*Instrumentation, error) {
-	ins, err := startInstrumentation()
+// MountMetrics, registers the metrics in the registry of opts and
+// returns the handler which serves them, so that the metrics can be mounted
+// in another HTTP server. The TLS options are not supported, the other server
+// decides whether TLS is used.
+func MountMetrics(opts Options) (*Instrumentation, http.Handler, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if opts.TLSCert != "" {
+		return nil, nil, fmt.Errorf("error: TLS is only supported if the metrics are served by their own HTTP server")
+	}
+	ins, err := startInstrumentation(opts.registerer())
+	if err != nil {
+		return ins, nil, fmt.Errorf("error while starting the Prometheus instrumentation: %w", err)
+	}
+	return ins, Handler(opts), nil
+}
+
+// ExposeMetrics, expose the metrics with an HTTP server, configured with
+// opts. The metrics are registered in the registry of opts. An
+// error is returned if the server cannot listen at opts.Addr or the TLS
+// certificate cannot be loaded.
+func ExposeMetrics(infoLog, errorLog *log.Logger, opts Options) (*Instrumentation, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	srv := declareHTTPServer(errorLog, opts)
+	scheme := "http"
+	if opts.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCert, opts.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the TLS certificate of the metrics: %w", err)
+		}
+		srv.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		scheme = "https"
+	}
+
+	ins, err := startInstrumentation(opts.registerer())
 	if err != nil {
 		err = fmt.Errorf("error while starting the Prometheus instrumentation: %w", err)
 		return ins, err
 	}
 
-	srv := declareHTTPServer(errorLog, addr)
+	// Listen before serving, so that an address which is already in use is
+	// reported as an error.
+	ln, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return ins, fmt.Errorf("error listening at %s: %w", opts.Addr, err)
+	}
 
-	infoLog.Printf("prometheus: Starting Prometheus web HTTP server at %s.", addr)
-	infoLog.Printf("prometheus: Metrics are served at %s/metrics.", addr)
+	infoLog.Printf("prometheus: Starting Prometheus web HTTP server at %s.", opts.Addr)
+	infoLog.Printf("prometheus: Metrics are served at %s://%s/metrics.", scheme, opts.Addr)
 	infoLog.Print("prometheus: Always verify that your FIREWALL permits traffic to the metrics HTTP webpage.")
+	if !opts.authenticated() {
+		infoLog.Print("prometheus: The metrics are not protected by any credentials.")
+	}
 
 	go func() {
-		err := srv.ListenAndServe()
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ServeTLS(ln, "", "")
+		} else {
+			err = srv.Serve(ln)
+		}
 		// Error returned when server is closed, not actually an error, log to
 		// infoLog.
 		if err == http.ErrServerClosed {
@@ -0,0 +1,96 @@
+package prometheus
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestOptionsValidate, tests that incomplete options are rejected.
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"default", Options{Addr: DefaultAddr}, false},
+		{"tls", Options{TLSCert: "cert.pem", TLSKey: "key.pem"}, false},
+		{"cert without key", Options{TLSCert: "cert.pem"}, true},
+		{"key without cert", Options{TLSKey: "key.pem"}, true},
+		{"basic auth", Options{Username: "prometheus", Password: "secret"}, false},
+		{"password without username", Options{Password: "secret"}, true},
+		{"bearer token", Options{BearerToken: "token"}, false},
+		{"registry", Options{Registerer: prometheus.NewRegistry(), Gatherer: prometheus.NewRegistry()}, false},
+		{"registerer without gatherer", Options{Registerer: prometheus.NewRegistry()}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("error: Validate() = %v, want error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestRequireAuth, tests that the metrics are only served to requests with
+// valid credentials.
+func TestRequireAuth(t *testing.T) {
+	both := Options{Username: "prometheus", Password: "secret", BearerToken: "token"}
+	tests := []struct {
+		name   string
+		opts   Options
+		header func(r *http.Request)
+		want   int
+	}{
+		{"no credentials configured", Options{}, func(r *http.Request) {}, http.StatusOK},
+		{"missing credentials", both, func(r *http.Request) {}, http.StatusUnauthorized},
+		{"basic auth", both, func(r *http.Request) { r.SetBasicAuth("prometheus", "secret") }, http.StatusOK},
+		{"wrong password", both, func(r *http.Request) { r.SetBasicAuth("prometheus", "wrong") }, http.StatusUnauthorized},
+		{"wrong username", both, func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusUnauthorized},
+		{"bearer token", both, func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, http.StatusOK},
+		{"wrong bearer token", both, func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, http.StatusUnauthorized},
+		{"bearer token not configured", Options{Username: "prometheus", Password: "secret"}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, http.StatusUnauthorized},
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			tt.header(r)
+			rr := httptest.NewRecorder()
+			requireAuth(tt.opts, ok).ServeHTTP(rr, r)
+			if rr.Code != tt.want {
+				t.Errorf("error: status code = %d, want %d", rr.Code, tt.want)
+			}
+			if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("error: missing WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+// TestMountMetricsRegistry, tests that the metrics are registered in and
+// served from the registry of the options, so that several instances do not
+// collide in the default registry.
+func TestMountMetricsRegistry(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		reg := prometheus.NewRegistry()
+		ins, handler, err := MountMetrics(Options{Registerer: reg, Gatherer: reg})
+		if err != nil {
+			t.Fatalf("error: could not mount metrics in registry %d: %v", i, err)
+		}
+		if err := IncrementCounter(ins, "session_requests_rejected_total", "rate_limit"); err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		body, _ := io.ReadAll(rr.Body)
+		if rr.Code != http.StatusOK || !strings.Contains(string(body), `session_requests_rejected_total{reason="rate_limit"} 1`) {
+			t.Errorf("error: the metrics of registry %d are not served (%d): %s", i, rr.Code, body)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// snapshot stores tar archives with the files of a participant's session
+// (e.g. its home directory), so that the files can be restored into a new
+// session of the same participant. Every participant has a storage quota.
+package snapshot
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound, error returned when no snapshot exists for a participant and
+// a challenge.
+var ErrNotFound = errors.New("snapshot not found")
+
+// ErrQuotaExceeded, error returned when a single snapshot is larger than the
+// storage quota of a participant.
+var ErrQuotaExceeded = errors.New("snapshot exceeds the storage quota")
+
+// snapshotExt, file extension of the stored snapshots.
+const snapshotExt = ".tar"
+
+// unsafeChars, matches every character that should not be used in a file
+// name built out of an identity or challenge name.
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Store, stores the snapshots of all participants in a directory of the host.
+// Every participant gets its own subdirectory, with one snapshot per
+// challenge. Store is concurrent-safe.
+type Store struct {
+	// mu, serializes the operations modifying the snapshots.
+	mu sync.Mutex
+	// dir, directory in which all snapshots are stored.
+	dir string
+	// quota, max. amount of bytes that the snapshots of a single participant
+	// can occupy.
+	quota int64
+}
+
+// NewStore, constructor for a Store that keeps its snapshots in dir. The
+// snapshots of every participant can occupy at most quota bytes.
+func NewStore(dir string, quota int64) (*Store, error) {
+	if quota <= 0 {
+		return nil, fmt.Errorf("error: invalid snapshot quota (%d bytes)", quota)
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("error: unable to create snapshot directory %s: %w", dir, err)
+	}
+	s := new(Store)
+	s.dir = dir
+	s.quota = quota
+	return s, nil
+}
+
+// sanitize, returns a string that can be safely used as a file name.
+func sanitize(name string) string {
+	name = unsafeChars.ReplaceAllString(name, "_")
+	// Never return a path that could refer to the current or parent
+	// directory.
+	if strings.Trim(name, ".") == "" {
+		name = "_" + name
+	}
+	return name
+}
+
+// participantDir, directory in which the snapshots of a participant are
+// stored.
+func (s *Store) participantDir(identity string) string {
+	return filepath.Join(s.dir, sanitize(identity))
+}
+
+// path, path of the snapshot of a participant for a challenge.
+func (s *Store) path(identity, challenge string) string {
+	return filepath.Join(s.participantDir(identity), sanitize(challenge)+snapshotExt)
+}
+
+// Save, stores the tar archive read from archive as the snapshot of a
+// participant (identity) for a challenge, replacing any previous snapshot for
+// the same challenge. If the snapshots of the participant would exceed the
+// quota, the oldest snapshots of the participant are removed. If the archive
+// alone exceeds the quota, it is discarded and ErrQuotaExceeded is returned.
+// It returns the size of the stored snapshot in bytes.
+func (s *Store) Save(identity, challenge string, archive io.Reader) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := s.participantDir(identity)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return 0, fmt.Errorf("error: unable to create snapshot directory %s: %w", dir, err)
+	}
+
+	// Write to a temporary file first, so that a previous snapshot is only
+	// replaced if the new one was completely and successfully written.
+	tmp, err := os.CreateTemp(dir, ".snapshot-*")
+	if err != nil {
+		return 0, fmt.Errorf("error: unable to create temporary snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	// Read at most one byte more than the quota, to detect archives that
+	// exceed the quota without reading them completely.
+	size, err := io.Copy(tmp, io.LimitReader(archive, s.quota+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error: unable to write snapshot: %w", err)
+	}
+	if size > s.quota {
+		return 0, fmt.Errorf("error: unable to store snapshot of %s (%s): %w (%d bytes)", identity, challenge, ErrQuotaExceeded, s.quota)
+	}
+
+	dst := s.path(identity, challenge)
+	if err := s.evict(dir, dst, size); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return 0, fmt.Errorf("error: unable to store snapshot %s: %w", dst, err)
+	}
+
+	return size, nil
+}
+
+// evict, removes the oldest snapshots within the directory of a participant,
+// until a new snapshot of size bytes fits into the quota. The snapshot stored
+// at replaced is not counted, since it will be replaced by the new snapshot.
+func (s *Store) evict(dir, replaced string, size int64) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error: unable to list snapshots in %s: %w", dir, err)
+	}
+
+	var snapshots []fs.FileInfo
+	used := size
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != snapshotExt {
+			continue
+		}
+		if filepath.Join(dir, entry.Name()) == replaced {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("error: unable to stat snapshot %s: %w", entry.Name(), err)
+		}
+		snapshots = append(snapshots, info)
+		used += info.Size()
+	}
+
+	// Remove the oldest snapshots first.
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].ModTime().Before(snapshots[j].ModTime())
+	})
+	for _, info := range snapshots {
+		if used <= s.quota {
+			break
+		}
+		if err := os.Remove(filepath.Join(dir, info.Name())); err != nil {
+			return fmt.Errorf("error: unable to remove snapshot %s: %w", info.Name(), err)
+		}
+		used -= info.Size()
+	}
+
+	return nil
+}
+
+// Open, opens the snapshot of a participant (identity) for a challenge. If
+// no snapshot exists, ErrNotFound is returned.
+func (s *Store) Open(identity, challenge string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(identity, challenge))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: unable to open snapshot: %w", err)
+	}
+	return f, nil
+}
+
+// RenameRoot, copies the tar archive read from src to dst, replacing the
+// top-level directory of every entry with root. It is used to restore the
+// home directory of a user into the home directory of a user with a different
+// name, e.g. 'olduser/.bashrc' becomes 'newuser/.bashrc'.
+func RenameRoot(dst io.Writer, src io.Reader, root string) error {
+	tr := tar.NewReader(src)
+	tw := tar.NewWriter(dst)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error: unable to read snapshot archive: %w", err)
+		}
+		hdr.Name = replaceRoot(hdr.Name, root)
+		// Hard links point to other entries of the same archive.
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = replaceRoot(hdr.Linkname, root)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("error: unable to write snapshot archive: %w", err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return fmt.Errorf("error: unable to write snapshot archive: %w", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("error: unable to write snapshot archive: %w", err)
+	}
+	return nil
+}
+
+// replaceRoot, replaces the first element of a slash-separated path with
+// root.
+func replaceRoot(name, root string) string {
+	name = strings.TrimPrefix(name, "./")
+	if i := strings.Index(name, "/"); i >= 0 {
+		return root + name[i:]
+	}
+	return root
+}
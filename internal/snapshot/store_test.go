@@ -0,0 +1,101 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStoreQuota, tests that the oldest snapshots of a participant are
+// removed when a new snapshot would exceed the quota, and that snapshots
+// larger than the quota are rejected.
+func TestStoreQuota(t *testing.T) {
+	s, err := NewStore(t.TempDir(), 10)
+	if err != nil {
+		t.Fatalf("error: could not create store: %v", err)
+	}
+
+	if _, err := s.Save("10.0.0.1", "old", strings.NewReader("123456")); err != nil {
+		t.Fatalf("error: could not save snapshot: %v", err)
+	}
+	// Make sure the first snapshot is the oldest one.
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(s.path("10.0.0.1", "old"), past, past); err != nil {
+		t.Fatalf("error: could not change modification time: %v", err)
+	}
+	if _, err := s.Save("10.0.0.1", "new", strings.NewReader("123456")); err != nil {
+		t.Fatalf("error: could not save snapshot: %v", err)
+	}
+
+	if _, err := s.Open("10.0.0.1", "old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("error: oldest snapshot should have been evicted, Open() returned %v", err)
+	}
+	rc, err := s.Open("10.0.0.1", "new")
+	if err != nil {
+		t.Fatalf("error: could not open newest snapshot: %v", err)
+	}
+	content, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(content) != "123456" {
+		t.Errorf("error: snapshot content is %q, expected %q", content, "123456")
+	}
+
+	// Replacing a snapshot of the same challenge does not count twice
+	// against the quota.
+	if _, err := s.Save("10.0.0.1", "new", strings.NewReader("abcdefgh")); err != nil {
+		t.Errorf("error: could not replace snapshot: %v", err)
+	}
+
+	if _, err := s.Save("10.0.0.1", "huge", strings.NewReader("12345678901")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("error: saving a snapshot larger than the quota returned %v, expected ErrQuotaExceeded", err)
+	}
+	if _, err := s.Open("10.0.0.1", "new"); err != nil {
+		t.Errorf("error: a rejected snapshot should not evict other snapshots: %v", err)
+	}
+}
+
+// TestRenameRoot, tests that the top-level directory of every entry of a tar
+// archive is renamed.
+func TestRenameRoot(t *testing.T) {
+	src := new(bytes.Buffer)
+	tw := tar.NewWriter(src)
+	entries := []*tar.Header{
+		{Name: "olduser/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "olduser/.bashrc", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+		{Name: "olduser/link", Typeflag: tar.TypeLink, Linkname: "olduser/.bashrc"},
+	}
+	for _, hdr := range entries {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("error: could not write tar header: %v", err)
+		}
+		if hdr.Size > 0 {
+			tw.Write([]byte("test"))
+		}
+	}
+	tw.Close()
+
+	dst := new(bytes.Buffer)
+	if err := RenameRoot(dst, src, "newuser"); err != nil {
+		t.Fatalf("error: could not rename root of archive: %v", err)
+	}
+
+	expected := []string{"newuser/", "newuser/.bashrc", "newuser/link"}
+	tr := tar.NewReader(dst)
+	for _, name := range expected {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatalf("error: could not read renamed archive: %v", err)
+		}
+		if hdr.Name != name {
+			t.Errorf("error: entry is named %s, expected %s", hdr.Name, name)
+		}
+		if hdr.Typeflag == tar.TypeLink && hdr.Linkname != "newuser/.bashrc" {
+			t.Errorf("error: hard link points to %s, expected newuser/.bashrc", hdr.Linkname)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// tracing, OpenTelemetry tracing for pongo. Spans are exported over OTLP
+// (HTTP) to a collector, e.g. an OpenTelemetry Collector or Jaeger, and the
+// IDs of the current span are added to every log line.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName, name of the tracer (instrumentation library) of pongo.
+const TracerName = "github.com/erodrigufer/pongo"
+
+// Propagator, propagates the trace context of incoming HTTP requests (W3C
+// Trace Context headers), e.g. from a reverse proxy in front of pongo.
+var Propagator = propagation.TraceContext{}
+
+// NewProvider, returns a tracer provider which exports every span to the OTLP
+// (HTTP) collector at endpoint, e.g. 'http://localhost:4318'. Spans are sent
+// over TLS unless the scheme of the endpoint is 'http'. If endpoint is empty,
+// spans are not exported (tracing is disabled).
+// Parameters: version, version of pongo, added to every span.
+func NewProvider(ctx context.Context, endpoint, version string) (*sdktrace.TracerProvider, error) {
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String("pongo"),
+		semconv.ServiceVersionKey.String(version),
+	)
+	if endpoint == "" {
+		return sdktrace.NewTracerProvider(sdktrace.WithResource(res)), nil
+	}
+
+	opts, err := exporterOptions(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP exporter: %w", err)
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	), nil
+}
+
+// exporterOptions, returns the options of the OTLP exporter for a collector
+// endpoint given as a URL.
+func exporterOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("error: invalid tracing endpoint '%s' (expected e.g. 'http://localhost:4318')", endpoint)
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	switch u.Scheme {
+	case "http":
+		opts = append(opts, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("error: invalid scheme '%s' of tracing endpoint (valid schemes: http, https)", u.Scheme)
+	}
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+	return opts, nil
+}
+
+// Error, records err in a span and marks the span as failed. It returns err,
+// so that it can be used in return statements.
+func Error(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// LogHook, logrus hook which adds the IDs of the span carried by the context
+// of a log entry (see logrus.Entry.WithContext) as the fields 'trace_id' and
+// 'span_id'.
+type LogHook struct{}
+
+// Levels, implements logrus.Hook.
+func (LogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire, implements logrus.Hook. logrus fires the hooks on a copy of the
+// entry, so its data can be modified.
+func (LogHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	for key, value := range Fields(entry.Context) {
+		entry.Data[key] = value
+	}
+	return nil
+}
+
+// Fields, returns the IDs of the span carried by ctx as log fields, or no
+// fields if ctx carries no valid span.
+func Fields(ctx context.Context) logrus.Fields {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return logrus.Fields{}
+	}
+	return logrus.Fields{
+		"trace_id": sc.TraceID().String(),
+		"span_id":  sc.SpanID().String(),
+	}
+}
+
+// Session, attributes which identify a session in a span. The password of
+// the session is never added to a span.
+func Session(name, challenge, engine string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("pongo.session", name)}
+	if challenge != "" {
+		attrs = append(attrs, attribute.String("pongo.challenge", challenge))
+	}
+	if engine != "" {
+		attrs = append(attrs, attribute.String("pongo.engine", engine))
+	}
+	return attrs
+}
@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// TestExporterOptions, tests the parsing of the endpoint of the collector.
+func TestExporterOptions(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		options  int
+		valid    bool
+	}{
+		{"http://localhost:4318", 2, true},
+		{"https://collector.example.com", 1, true},
+		{"https://collector.example.com/otlp/v1/traces", 2, true},
+		{"localhost:4318", 0, false},
+		{"grpc://localhost:4317", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		opts, err := exporterOptions(tt.endpoint)
+		if (err == nil) != tt.valid {
+			t.Errorf("error: endpoint '%s': unexpected error: %v", tt.endpoint, err)
+			continue
+		}
+		if len(opts) != tt.options {
+			t.Errorf("error: endpoint '%s': %d options, expected %d", tt.endpoint, len(opts), tt.options)
+		}
+	}
+}
+
+// TestLogHook, tests that the IDs of the span carried by the context of a log
+// entry are added to the log line.
+func TestLogHook(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := logrus.New()
+	logger.SetOutput(buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(LogHook{})
+
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer(TracerName).Start(context.Background(), "test")
+	defer span.End()
+
+	logger.WithContext(ctx).Info("traced")
+	logger.WithContext(context.Background()).Info("untraced")
+	logger.Info("no context")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("error: %d log lines, expected 3", len(lines))
+	}
+	for i, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("error: log line is not JSON: %s", line)
+		}
+		traced := i == 0
+		if _, ok := entry["trace_id"]; ok != traced {
+			t.Errorf("error: log line '%s' has trace_id: %v, expected %v", entry["msg"], ok, traced)
+		}
+		if traced && (entry["trace_id"] != span.SpanContext().TraceID().String() || entry["span_id"] != span.SpanContext().SpanID().String()) {
+			t.Errorf("error: log line has IDs of another span: %v", entry)
+		}
+	}
+}